@@ -0,0 +1,567 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+const (
+	// abWin is the score of a won position; wins found sooner score
+	// higher (abWin - plies).
+	abWin = 1_000_000
+	abInf = abWin + 1
+	// abWinThreshold separates proven wins and losses from evaluations.
+	abWinThreshold = abWin - 1000
+	// abMaxPly bounds search depth, killer tables and PV length.
+	abMaxPly = 64
+	// abTableBits sizes the transposition table (2^bits entries).
+	abTableBits = 16
+	// abNoise bounds the evaluation nudge of a seeded search, in
+	// centiflats.
+	abNoise = 10
+)
+
+var errGameOver = errors.New("game is already over")
+
+// AlphaBetaEngine is gotak's own engine: iterative-deepening negamax with
+// alpha-beta pruning, a transposition table and move ordering (TT move,
+// killers, history), on top of the core gotak move generator. The
+// evaluation weighs flat count, road potential, capstone mobility and
+// stack control, with cfg.Style shifting the weights. A cfg.Seed nudges
+// evaluations slightly so different seeds vary the play; with cfg.Nodes
+// too, searches are repeatable. It holds no state between searches and is
+// safe for concurrent use.
+type AlphaBetaEngine struct{}
+
+// GetMove returns the engine's best move as PTN.
+func (e *AlphaBetaEngine) GetMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error) {
+	res, err := e.Search(ctx, g, cfg)
+	if err != nil {
+		return "", err
+	}
+	return res.BestMove, nil
+}
+
+// Analyze is Search.
+func (e *AlphaBetaEngine) Analyze(ctx context.Context, g *gotak.Game, cfg AIConfig) (*SearchResult, error) {
+	return e.Search(ctx, g, cfg)
+}
+
+// ExplainMove searches the position and describes the engine's evaluation
+// and what its move does.
+func (e *AlphaBetaEngine) ExplainMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error) {
+	res, err := e.Search(ctx, g, cfg)
+	if err != nil {
+		return "", err
+	}
+	return explainSearch("gotak", g, res), nil
+}
+
+// Search deepens until cfg.Nodes positions have been searched, or else
+// cfg.TimeLimit (or a level-based default) runs out, or the level's depth
+// cap is reached, and reports the deepest completed
+// iteration. Scores are from the side to move's point of view.
+func (e *AlphaBetaEngine) Search(ctx context.Context, g *gotak.Game, cfg AIConfig) (*SearchResult, error) {
+	lines, err := e.AnalyzeMultiPV(ctx, g, cfg, 1)
+	if err != nil {
+		return nil, err
+	}
+	return lines[0], nil
+}
+
+// AnalyzeMultiPV is Search for the n best moves, best first. Each
+// iteration searches the root once per line, leaving out the moves already
+// reported, so the time is shared between the lines.
+func (e *AlphaBetaEngine) AnalyzeMultiPV(ctx context.Context, g *gotak.Game, cfg AIConfig, n int) ([]*SearchResult, error) {
+	root, err := newABPosition(g)
+	if err != nil {
+		return nil, err
+	}
+	if _, over := root.result(root.grid()); over {
+		return nil, errGameOver
+	}
+
+	start := time.Now()
+	s := &abSearch{
+		ctx:      ctx,
+		deadline: start.Add(searchTime(cfg)),
+		maxNodes: cfg.Nodes,
+		seed:     cfg.Seed,
+		weights:  styleWeights(cfg.Style),
+		tt:       make([]ttEntry, 1<<abTableBits),
+		history:  map[string]int{},
+	}
+
+	moves := root.moves()
+	if len(moves) == 0 {
+		return nil, errors.New("no legal moves")
+	}
+	n = min(max(n, 1), len(moves))
+	lines := []*SearchResult{{BestMove: moves[0].Text}}
+deepen:
+	for depth := 1; depth <= abMaxDepth(cfg.Level); depth++ {
+		var found []*SearchResult
+		exclude := map[string]bool{}
+		forced := true
+		for len(found) < n {
+			move, score, ok := s.searchRoot(root, moves, depth, exclude)
+			if !ok {
+				// An unfinished iteration searched the previous best move
+				// first, so any move it settled on is at least as good.
+				if len(found) == 0 && move != "" {
+					lines[0].BestMove = move
+				}
+				break deepen
+			}
+			if move == "" {
+				break
+			}
+			line := &SearchResult{BestMove: move, Info: SearchInfo{Depth: depth, ScoreCP: score}}
+			if score > abWinThreshold || score < -abWinThreshold {
+				line.Info.ScoreCP = 0
+				line.Info.Mate = mateMoves(score)
+			} else {
+				forced = false
+			}
+			found = append(found, line)
+			exclude[move] = true
+		}
+		if len(found) == 0 {
+			break
+		}
+		lines = found
+		if forced {
+			// Forced results won't change with more depth.
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		line.Info.Nodes = s.nodes
+		line.Info.Time = time.Since(start)
+		line.Info.PV = s.principalVariation(root, line.BestMove)
+	}
+	return lines, nil
+}
+
+// abMaxDepth caps iterative deepening per level. Expert is limited only by
+// time.
+func abMaxDepth(level DifficultyLevel) int {
+	switch level {
+	case Beginner:
+		return 1
+	case Intermediate:
+		return 3
+	case Advanced:
+		return 5
+	default:
+		return abMaxPly
+	}
+}
+
+// mateMoves turns a win/loss score into moves (not plies) to the result,
+// negative when losing, as TEI engines report it.
+func mateMoves(score int) int {
+	if score > 0 {
+		return (abWin - score + 1) / 2
+	}
+	return -(abWin + score + 1) / 2
+}
+
+// abPosition is a search node: a board plus the bookkeeping DoMove doesn't
+// track. Positions are copy-make; play never mutates its receiver.
+type abPosition struct {
+	board  *gotak.Board
+	toMove int
+	// plies counts half-moves from the start of the game; the first two
+	// place the opponent's flat.
+	plies  int
+	stones [3]int64
+	caps   [3]int64
+}
+
+func opponent(player int) int {
+	return gotak.PlayerWhite + gotak.PlayerBlack - player
+}
+
+// newABPosition rebuilds the game from its starting position (the TPS tag
+// or an empty board) and moves, so it doesn't rely on g.Board having been
+// replayed.
+func newABPosition(g *gotak.Game) (*abPosition, error) {
+	if g == nil || g.Board == nil {
+		return nil, fmt.Errorf("game cannot be nil")
+	}
+	start, err := gotak.NewGame(g.Board.Size, g.ID, g.Slug)
+	if err != nil {
+		return nil, err
+	}
+	p := &abPosition{toMove: gotak.PlayerWhite}
+	if tps, err := g.GetMeta("TPS"); err == nil && tps != "" {
+		b, player, move, err := gotak.ParseTPS(tps)
+		if err != nil {
+			return nil, fmt.Errorf("bad TPS tag: %w", err)
+		}
+		start.Board = b
+		p.toMove = player
+		p.plies = int(move-1) * 2
+		if player == gotak.PlayerBlack {
+			p.plies++
+		}
+	}
+	p.board = start.Board
+	for _, pl := range []int{gotak.PlayerWhite, gotak.PlayerBlack} {
+		p.stones[pl], p.caps[pl] = start.Reserves(pl)
+	}
+
+	for _, turn := range g.Turns {
+		if turn == nil {
+			continue
+		}
+		for _, mv := range []*gotak.Move{turn.First, turn.Second} {
+			if mv == nil {
+				continue
+			}
+			if p, err = p.play(mv); err != nil {
+				return nil, fmt.Errorf("replay %s: %w", mv.Text, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *abPosition) opening() bool { return p.plies < 2 }
+
+func (p *abPosition) moves() []*gotak.Move {
+	return p.board.LegalMoves(p.toMove, p.stones[p.toMove], p.caps[p.toMove], p.opening())
+}
+
+func (p *abPosition) play(m *gotak.Move) (*abPosition, error) {
+	color := p.toMove
+	if p.opening() {
+		color = opponent(color)
+	}
+	next := *p
+	next.board = p.board.Clone()
+	if err := next.board.DoMove(m, color); err != nil {
+		return nil, err
+	}
+	if m.MoveDirection == "" {
+		if m.Stone == gotak.StoneCap {
+			next.caps[color]--
+		} else {
+			next.stones[color]--
+		}
+	}
+	next.toMove = opponent(p.toMove)
+	next.plies++
+	return &next, nil
+}
+
+// result reports whether the game has ended and who won (PlayerNone for a
+// draw). A road for the player who just moved beats a road it made for
+// the opponent.
+func (p *abPosition) result(gr *abGrid) (int, bool) {
+	if p.plies == 0 {
+		return gotak.PlayerNone, false
+	}
+	mover := opponent(p.toMove)
+	if gr.hasRoad(mover) {
+		return mover, true
+	}
+	if gr.hasRoad(p.toMove) {
+		return p.toMove, true
+	}
+	if !gr.full() && p.stones[mover]+p.caps[mover] > 0 && p.stones[p.toMove]+p.caps[p.toMove] > 0 {
+		return gotak.PlayerNone, false
+	}
+	white, black := gr.flats(gotak.PlayerWhite), gr.flats(gotak.PlayerBlack)
+	switch {
+	case white > black:
+		return gotak.PlayerWhite, true
+	case black > white:
+		return gotak.PlayerBlack, true
+	default:
+		return gotak.PlayerNone, true
+	}
+}
+
+const (
+	ttExact uint8 = iota
+	ttLower
+	ttUpper
+)
+
+type ttEntry struct {
+	hash  uint64
+	score int32
+	depth int8
+	flag  uint8
+	move  string
+}
+
+type abSearch struct {
+	ctx      context.Context
+	deadline time.Time
+	// maxNodes, when set, stops the search instead of deadline.
+	maxNodes int64
+	seed     int64
+	weights  evalWeights
+	tt       []ttEntry
+	killers  [abMaxPly][2]string
+	history  map[string]int
+	nodes    int64
+	stopped  bool
+}
+
+func (s *abSearch) expired() bool {
+	if !s.stopped && (s.ctx.Err() != nil || s.overBudget()) {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+func (s *abSearch) overBudget() bool {
+	if s.maxNodes > 0 {
+		return s.nodes >= s.maxNodes
+	}
+	return time.Now().After(s.deadline)
+}
+
+// noise is a repeatable nudge of up to abNoise for the position with hash
+// h, different for every seed.
+func (s *abSearch) noise(h uint64) int {
+	// SplitMix64's finaliser spreads the seed over all the bits.
+	x := h ^ uint64(s.seed) // #nosec G115 -- only the bits matter
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return int(x%(2*abNoise+1)) - abNoise // #nosec G115 -- bounded by abNoise
+}
+
+// searchRoot runs one iteration at depth over the moves not in exclude.
+// ok is false when time ran out; move and score then describe the best move
+// fully searched, if any. Only the full root search is stored in the
+// transposition table, so excluded searches don't displace the best move.
+func (s *abSearch) searchRoot(root *abPosition, moves []*gotak.Move, depth int, exclude map[string]bool) (string, int, bool) {
+	gr := root.grid()
+	ttMove := ""
+	if e := s.probe(gr.hash); e != nil {
+		ttMove = e.move
+	}
+	s.order(moves, gr, root.toMove, 0, ttMove)
+
+	alpha, best := -abInf, ""
+	for _, m := range moves {
+		if exclude[m.Text] {
+			continue
+		}
+		child, err := root.play(m)
+		if err != nil {
+			continue
+		}
+		score := -s.negamax(child, depth-1, 1, -abInf, -alpha)
+		if s.stopped {
+			return best, alpha, false
+		}
+		if score > alpha {
+			alpha, best = score, m.Text
+		}
+	}
+	if len(exclude) == 0 {
+		s.store(gr.hash, depth, 0, alpha, ttExact, best)
+	}
+	return best, alpha, true
+}
+
+func (s *abSearch) negamax(p *abPosition, depth, ply, alpha, beta int) int {
+	s.nodes++
+	if s.nodes&1023 == 0 && s.expired() {
+		return 0
+	}
+	if s.stopped {
+		return 0
+	}
+
+	gr := p.grid()
+	if winner, over := p.result(gr); over {
+		switch winner {
+		case gotak.PlayerNone:
+			return 0
+		case p.toMove:
+			return abWin - ply
+		default:
+			return -(abWin - ply)
+		}
+	}
+	if depth <= 0 || ply >= abMaxPly-1 {
+		return s.evaluate(p, gr)
+	}
+
+	origAlpha := alpha
+	ttMove := ""
+	if e := s.probe(gr.hash); e != nil {
+		ttMove = e.move
+		if int(e.depth) >= depth {
+			score := fromTT(int(e.score), ply)
+			switch {
+			case e.flag == ttExact:
+				return score
+			case e.flag == ttLower && score >= beta:
+				return score
+			case e.flag == ttUpper && score <= alpha:
+				return score
+			}
+		}
+	}
+
+	moves := p.moves()
+	if len(moves) == 0 {
+		return 0
+	}
+	s.order(moves, gr, p.toMove, ply, ttMove)
+
+	best, bestMove := -abInf, ""
+	for _, m := range moves {
+		child, err := p.play(m)
+		if err != nil {
+			continue
+		}
+		score := -s.negamax(child, depth-1, ply+1, -beta, -alpha)
+		if s.stopped {
+			return 0
+		}
+		if score > best {
+			best, bestMove = score, m.Text
+		}
+		if score > alpha {
+			alpha = score
+		}
+		if alpha >= beta {
+			if k := &s.killers[ply]; k[0] != m.Text {
+				k[1], k[0] = k[0], m.Text
+			}
+			s.history[m.Text] += depth * depth
+			break
+		}
+	}
+
+	flag := ttExact
+	switch {
+	case best <= origAlpha:
+		flag = ttUpper
+	case best >= beta:
+		flag = ttLower
+	}
+	s.store(gr.hash, depth, ply, best, flag, bestMove)
+	return best
+}
+
+func (s *abSearch) probe(hash uint64) *ttEntry {
+	e := &s.tt[hash&(1<<abTableBits-1)]
+	if e.hash != hash || e.move == "" {
+		return nil
+	}
+	return e
+}
+
+func (s *abSearch) store(hash uint64, depth, ply, score int, flag uint8, move string) {
+	if move == "" {
+		return
+	}
+	e := &s.tt[hash&(1<<abTableBits-1)]
+	if e.hash == hash && int(e.depth) > depth {
+		return
+	}
+	*e = ttEntry{hash: hash, score: int32(toTT(score, ply)), depth: int8(depth), flag: flag, move: move} // #nosec G115 -- bounded by abWin and abMaxPly
+}
+
+// Win scores are stored relative to the node so they stay correct when the
+// same position is reached at another ply.
+func toTT(score, ply int) int {
+	switch {
+	case score > abWinThreshold:
+		return score + ply
+	case score < -abWinThreshold:
+		return score - ply
+	}
+	return score
+}
+
+func fromTT(score, ply int) int {
+	switch {
+	case score > abWinThreshold:
+		return score - ply
+	case score < -abWinThreshold:
+		return score + ply
+	}
+	return score
+}
+
+// order sorts moves best-first: the TT move, killers, then history and a
+// cheap static guess.
+func (s *abSearch) order(moves []*gotak.Move, gr *abGrid, player, ply int, ttMove string) {
+	keys := make([]int, len(moves))
+	for i, m := range moves {
+		k := s.history[m.Text] + gr.moveHint(m, player)
+		switch m.Text {
+		case ttMove:
+			k += 1 << 30
+		case s.killers[ply][0]:
+			k += 1 << 29
+		case s.killers[ply][1]:
+			k += 1 << 28
+		}
+		keys[i] = k
+	}
+	sort.Stable(byKey{moves, keys})
+}
+
+type byKey struct {
+	moves []*gotak.Move
+	keys  []int
+}
+
+func (b byKey) Len() int           { return len(b.moves) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.moves[i], b.moves[j] = b.moves[j], b.moves[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
+
+// principalVariation follows the transposition table from the root.
+func (s *abSearch) principalVariation(root *abPosition, best string) []string {
+	pv := []string{}
+	p, next := root, best
+	seen := map[uint64]bool{}
+	for len(pv) < abMaxPly && next != "" {
+		var played *abPosition
+		for _, m := range p.moves() {
+			if m.Text == next {
+				played, _ = p.play(m)
+				break
+			}
+		}
+		if played == nil {
+			break
+		}
+		pv = append(pv, next)
+		p = played
+		gr := p.grid()
+		if _, over := p.result(gr); over || seen[gr.hash] {
+			break
+		}
+		seen[gr.hash] = true
+		next = ""
+		if e := s.probe(gr.hash); e != nil {
+			next = e.move
+		}
+	}
+	return pv
+}
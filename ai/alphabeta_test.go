@@ -0,0 +1,255 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+func tpsGame(t *testing.T, tps string) *gotak.Game {
+	t.Helper()
+	b, _, _, err := gotak.ParseTPS(tps)
+	if err != nil {
+		t.Fatalf("ParseTPS: %v", err)
+	}
+	g, err := gotak.NewGame(b.Size, 1, "alphabeta")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	g.Board = b
+	if err := g.UpdateMeta("TPS", tps); err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	return g
+}
+
+func TestAlphaBeta_winsInOne(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5")
+	res, err := (&AlphaBetaEngine{}).Search(context.Background(), g, AIConfig{Level: Intermediate, TimeLimit: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if res.Info.Mate != 1 {
+		t.Errorf("mate = %d, want 1 (%+v)", res.Info.Mate, res)
+	}
+	if res.BestMove != "e1" && res.BestMove != "Ce1" {
+		t.Errorf("best move = %q, want a flat or capstone on e1", res.BestMove)
+	}
+	if len(res.Info.PV) == 0 || res.Info.PV[0] != res.BestMove {
+		t.Errorf("PV %v should start with %s", res.Info.PV, res.BestMove)
+	}
+}
+
+func TestAlphaBeta_blocksRoad(t *testing.T) {
+	// Black threatens e2; white has nothing faster.
+	g := tpsGame(t, "x5/x5/1,x4/2,2,2,2,x/1,x,1,x2 1 5")
+	root, err := newABPosition(g)
+	if err != nil {
+		t.Fatalf("newABPosition: %v", err)
+	}
+	for _, style := range []Style{Balanced, Aggressive, Defensive} {
+		move, err := (&AlphaBetaEngine{}).GetMove(context.Background(), g, AIConfig{Level: Intermediate, Style: style, TimeLimit: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("%s: GetMove: %v", style, err)
+		}
+		m, err := gotak.NewMove(move)
+		if err != nil {
+			t.Fatalf("%s: bad move %q: %v", style, move, err)
+		}
+		after, err := root.play(m)
+		if err != nil {
+			t.Fatalf("%s: play %q: %v", style, move, err)
+		}
+		for _, reply := range after.moves() {
+			next, err := after.play(reply)
+			if err != nil {
+				t.Fatalf("play %q: %v", reply.Text, err)
+			}
+			if next.grid().hasRoad(gotak.PlayerBlack) {
+				t.Errorf("%s: after %s black wins with %s", style, move, reply.Text)
+				break
+			}
+		}
+	}
+}
+
+func TestStyleWeightsShiftEvaluation(t *testing.T) {
+	// Black has a long road group; white has a wall next to it.
+	g := tpsGame(t, "x5/x5/x3,1S,x/2,2,2,x2/1,1,x3 1 5")
+	p, err := newABPosition(g)
+	if err != nil {
+		t.Fatalf("newABPosition: %v", err)
+	}
+	eval := func(style Style) int {
+		s := &abSearch{weights: styleWeights(style)}
+		return s.evaluate(p, p.grid())
+	}
+	aggressive, defensive := eval(Aggressive), eval(Defensive)
+	if defensive >= aggressive {
+		t.Errorf("defensive eval %d should weigh black's road more heavily than aggressive %d", defensive, aggressive)
+	}
+
+	a, d := styleWeights(Aggressive), styleWeights(Defensive)
+	if a.Threat <= d.Threat || d.Wall <= a.Wall || d.Block <= a.Block {
+		t.Errorf("aggressive %+v / defensive %+v weights are not ordered", a, d)
+	}
+}
+
+func TestAlphaBeta_replaysTurns(t *testing.T) {
+	played, err := gotak.NewGame(5, 1, "replay")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	for _, turn := range [][2]string{{"a1", "e5"}, {"c3", "d3"}, {"c2", "Sc4"}} {
+		if err := played.DoTurn(turn[0], turn[1]); err != nil {
+			t.Fatalf("DoTurn: %v", err)
+		}
+	}
+
+	// Analysis hands engines games with turns but an empty board.
+	bare, err := gotak.NewGame(5, 1, "replay")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	bare.Turns = played.Turns
+
+	p, err := newABPosition(bare)
+	if err != nil {
+		t.Fatalf("newABPosition: %v", err)
+	}
+	if got, want := p.board.TPS(p.toMove, 4), played.Board.TPS(gotak.PlayerWhite, 4); got != want {
+		t.Errorf("replayed board %s, want %s", got, want)
+	}
+	if p.stones[gotak.PlayerBlack] != 18 || p.caps[gotak.PlayerWhite] != 1 {
+		t.Errorf("reserves = %v / %v", p.stones, p.caps)
+	}
+}
+
+func TestAlphaBeta_selfPlay(t *testing.T) {
+	g, err := gotak.NewGame(5, 1, "self-play")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	e := &AlphaBetaEngine{}
+	cfg := AIConfig{Level: Beginner, TimeLimit: time.Second}
+	for ply := 0; ply < 30; ply++ {
+		if _, over := g.GameOver(); over {
+			break
+		}
+		player, _ := g.ToMove()
+		move, err := e.GetMove(context.Background(), g, cfg)
+		if errors.Is(err, errGameOver) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ply %d: GetMove: %v", ply, err)
+		}
+		if err := g.DoSingleMove(move, player); err != nil {
+			t.Fatalf("ply %d: engine played illegal %q: %v", ply, move, err)
+		}
+	}
+}
+
+func TestAlphaBeta_timeLimit(t *testing.T) {
+	g := teiTestGame(t)
+	start := time.Now()
+	res, err := (&AlphaBetaEngine{}).Search(context.Background(), g, AIConfig{Level: Expert, TimeLimit: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("search took %v with a 200ms limit", elapsed)
+	}
+	if res.Info.Depth < 1 || res.Info.Nodes == 0 {
+		t.Errorf("info = %+v, want a completed iteration", res.Info)
+	}
+	if _, err := gotak.NewMove(res.BestMove); err != nil {
+		t.Errorf("bad best move %q", res.BestMove)
+	}
+	t.Logf("depth %d, %d nodes in %v", res.Info.Depth, res.Info.Nodes, res.Info.Time)
+}
+
+func TestAlphaBeta_contextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (&AlphaBetaEngine{}).GetMove(ctx, teiTestGame(t), AIConfig{Level: Expert}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestAlphaBeta_gameOver(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,1 2 5")
+	if _, err := (&AlphaBetaEngine{}).GetMove(context.Background(), g, AIConfig{}); !errors.Is(err, errGameOver) {
+		t.Errorf("err = %v, want errGameOver", err)
+	}
+}
+
+func TestAlphaBeta_explain(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5")
+	got, err := (&AlphaBetaEngine{}).ExplainMove(context.Background(), g, AIConfig{Level: Beginner})
+	if err != nil {
+		t.Fatalf("ExplainMove: %v", err)
+	}
+	if !strings.Contains(got, "forced win in 1") {
+		t.Errorf("explanation %q should mention the win", got)
+	}
+}
+
+func TestAlphaBeta_multiPV(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5")
+	lines, err := AnalyzeLines(context.Background(), &AlphaBetaEngine{}, g, AIConfig{Level: Intermediate, TimeLimit: 2 * time.Second}, 4)
+	if err != nil {
+		t.Fatalf("AnalyzeLines: %v", err)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4", len(lines))
+	}
+	if lines[0].Info.Mate != 1 {
+		t.Errorf("first line = %+v, want the win in one", lines[0])
+	}
+	seen := map[string]bool{}
+	for i, line := range lines {
+		if seen[line.BestMove] {
+			t.Errorf("line %d repeats %s", i, line.BestMove)
+		}
+		seen[line.BestMove] = true
+		if i > 0 && line.Info.WinProbability() > lines[i-1].Info.WinProbability() {
+			t.Errorf("line %d (%+v) scores above line %d", i, line.Info, i-1)
+		}
+	}
+}
+
+func TestAlphaBeta_seeded(t *testing.T) {
+	g := teiTestGame(t)
+	search := func(seed int64) *SearchResult {
+		t.Helper()
+		res, err := (&AlphaBetaEngine{}).Search(context.Background(), g, AIConfig{Level: Expert, Seed: seed, Nodes: 20000})
+		if err != nil {
+			t.Fatalf("Search(seed %d): %v", seed, err)
+		}
+		return res
+	}
+
+	first := search(7)
+	again := search(7)
+	if first.BestMove != again.BestMove || first.Info.Nodes != again.Info.Nodes || first.Info.ScoreCP != again.Info.ScoreCP {
+		t.Errorf("seed 7 searched %+v then %+v", first.Info, again.Info)
+	}
+	// The budget is checked every 1024 nodes.
+	if first.Info.Nodes > 20000+1024 {
+		t.Errorf("searched %d nodes with a budget of 20000", first.Info.Nodes)
+	}
+
+	// Different seeds score the position differently.
+	scores := map[int]bool{}
+	for seed := int64(1); seed <= 5; seed++ {
+		scores[search(seed).Info.ScoreCP] = true
+	}
+	if len(scores) < 2 {
+		t.Errorf("five seeds all scored %v", scores)
+	}
+}
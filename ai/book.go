@@ -0,0 +1,373 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/icco/gotak"
+)
+
+// bookMagic starts every book file; the last byte is the format version.
+var bookMagic = []byte("GOTAKBK1")
+
+// BookMove is a move played from a book position and how it scored for
+// the player who made it.
+type BookMove struct {
+	Move   string
+	Wins   int
+	Draws  int
+	Losses int
+}
+
+// Games is the number of games the move was played in.
+func (m BookMove) Games() int { return m.Wins + m.Draws + m.Losses }
+
+// Score is the mover's expected points from the move, pulled towards a
+// draw when it has been played only a few times.
+func (m BookMove) Score() float64 {
+	return (float64(m.Wins) + float64(m.Draws)/2 + 1) / float64(m.Games()+2)
+}
+
+// weight ranks book moves: how often a move was chosen, scaled by how well
+// it did.
+func (m BookMove) weight() float64 { return float64(m.Games()) * m.Score() }
+
+// Book is an opening book: the moves played from positions reached early
+// in past games, with their results. Positions are keyed by the hash the
+// alpha-beta search uses, so transpositions share entries. A Book is not
+// safe for concurrent modification, but once built it can be read from
+// any number of goroutines.
+type Book struct {
+	positions map[uint64][]BookMove
+}
+
+// NewBook returns an empty book.
+func NewBook() *Book {
+	return &Book{positions: map[uint64][]BookMove{}}
+}
+
+// Len is the number of positions in the book.
+func (b *Book) Len() int { return len(b.positions) }
+
+// GameWinner reads a PTN result such as "R-0", "0-F" or "1/2-1/2". It
+// returns the winner (gotak.PlayerNone for a draw) and false for a game
+// without a result.
+func GameWinner(result string) (int, bool) {
+	switch result {
+	case "R-0", "F-0", "1-0":
+		return gotak.PlayerWhite, true
+	case "0-R", "0-F", "0-1":
+		return gotak.PlayerBlack, true
+	case "1/2-1/2":
+		return gotak.PlayerNone, true
+	}
+	return gotak.PlayerNone, false
+}
+
+// AddGame records the first plies half-moves of g, a game that winner won
+// (gotak.PlayerNone for a draw). The game starts from its TPS tag, if it
+// has one, and must follow the rules throughout.
+func (b *Book) AddGame(g *gotak.Game, winner, plies int) error {
+	replay := &gotak.Game{Board: g.Board, Meta: g.Meta}
+	p, err := newABPosition(replay)
+	if err != nil {
+		return err
+	}
+	var moves []*gotak.Move
+	for _, t := range g.Turns {
+		if t == nil {
+			continue
+		}
+		for _, mv := range []*gotak.Move{t.First, t.Second} {
+			if mv != nil {
+				moves = append(moves, mv)
+			}
+		}
+	}
+
+	for _, mv := range moves[:min(plies, len(moves))] {
+		if !slices.ContainsFunc(p.moves(), mv.Equal) {
+			return fmt.Errorf("%s is not a legal move", mv.Text)
+		}
+		hash := p.grid().hash
+		mover := p.toMove
+		if p, err = p.play(mv); err != nil {
+			return fmt.Errorf("replay %s: %w", mv.Text, err)
+		}
+		b.add(hash, mv.Text, winner, mover)
+	}
+	return nil
+}
+
+func (b *Book) add(hash uint64, move string, winner, mover int) {
+	entries := b.positions[hash]
+	i := slices.IndexFunc(entries, func(m BookMove) bool { return m.Move == move })
+	if i < 0 {
+		entries = append(entries, BookMove{Move: move})
+		i = len(entries) - 1
+	}
+	switch winner {
+	case gotak.PlayerNone:
+		entries[i].Draws++
+	case mover:
+		entries[i].Wins++
+	default:
+		entries[i].Losses++
+	}
+	b.positions[hash] = entries
+}
+
+// Merge adds other's results to b.
+func (b *Book) Merge(other *Book) {
+	for hash, moves := range other.positions {
+		entries := b.positions[hash]
+		for _, m := range moves {
+			i := slices.IndexFunc(entries, func(e BookMove) bool { return e.Move == m.Move })
+			if i < 0 {
+				entries = append(entries, BookMove{Move: m.Move})
+				i = len(entries) - 1
+			}
+			entries[i].Wins += m.Wins
+			entries[i].Draws += m.Draws
+			entries[i].Losses += m.Losses
+		}
+		b.positions[hash] = entries
+	}
+}
+
+// Moves returns the book moves for g's position, best first. Moves that
+// aren't legal there, which a hash collision could produce, are left out.
+func (b *Book) Moves(g *gotak.Game) ([]BookMove, error) {
+	p, err := newABPosition(g)
+	if err != nil {
+		return nil, err
+	}
+	entries := b.positions[p.grid().hash]
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	legal := p.moves()
+	var out []BookMove
+	for _, m := range entries {
+		mv, err := gotak.NewMove(m.Move)
+		if err == nil && slices.ContainsFunc(legal, mv.Equal) {
+			out = append(out, m)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].weight() > out[j].weight() })
+	return out, nil
+}
+
+// Write stores the book in its compact binary form: the magic, then each
+// position's hash and moves, every count a uvarint.
+func (b *Book) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, binary.MaxVarintLen64)
+	uvarint := func(n int) {
+		_, _ = bw.Write(binary.AppendUvarint(buf[:0], uint64(n))) // #nosec G115 -- counts are never negative
+	}
+
+	hashes := make([]uint64, 0, len(b.positions))
+	for h := range b.positions {
+		hashes = append(hashes, h)
+	}
+	slices.Sort(hashes)
+
+	_, _ = bw.Write(bookMagic)
+	uvarint(len(hashes))
+	for _, h := range hashes {
+		_ = binary.Write(bw, binary.BigEndian, h)
+		moves := b.positions[h]
+		uvarint(len(moves))
+		for _, m := range moves {
+			uvarint(len(m.Move))
+			_, _ = bw.WriteString(m.Move)
+			uvarint(m.Wins)
+			uvarint(m.Draws)
+			uvarint(m.Losses)
+		}
+	}
+	return bw.Flush()
+}
+
+// Save writes the book to path.
+func (b *Book) Save(path string) error {
+	f, err := os.Create(path) // #nosec G304 -- path comes from operator config
+	if err != nil {
+		return err
+	}
+	if err := b.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadBook reads a book stored by Write.
+func ReadBook(r io.Reader) (*Book, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(bookMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != string(bookMagic) {
+		return nil, errors.New("not an opening book")
+	}
+	count := func() (int, error) {
+		n, err := binary.ReadUvarint(br)
+		if err == nil && n > math.MaxInt32 {
+			err = errors.New("count out of range")
+		}
+		return int(n), err // #nosec G115 -- bounded above
+	}
+
+	b := NewBook()
+	positions, err := count()
+	if err != nil {
+		return nil, fmt.Errorf("read book: %w", err)
+	}
+	for range positions {
+		var h uint64
+		if err := binary.Read(br, binary.BigEndian, &h); err != nil {
+			return nil, fmt.Errorf("read book: %w", err)
+		}
+		n, err := count()
+		if err != nil {
+			return nil, fmt.Errorf("read book: %w", err)
+		}
+		moves := make([]BookMove, n)
+		for i := range moves {
+			size, err := count()
+			if err != nil {
+				return nil, fmt.Errorf("read book: %w", err)
+			}
+			text := make([]byte, size)
+			if _, err := io.ReadFull(br, text); err != nil {
+				return nil, fmt.Errorf("read book: %w", err)
+			}
+			moves[i].Move = string(text)
+			for _, field := range []*int{&moves[i].Wins, &moves[i].Draws, &moves[i].Losses} {
+				if *field, err = count(); err != nil {
+					return nil, fmt.Errorf("read book: %w", err)
+				}
+			}
+		}
+		b.positions[h] = moves
+	}
+	return b, nil
+}
+
+// LoadBook reads a book file written by Save.
+func LoadBook(path string) (*Book, error) {
+	f, err := os.Open(path) // #nosec G304 -- path comes from operator config
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return ReadBook(f)
+}
+
+// BookOptions controls how book moves are chosen.
+type BookOptions struct {
+	// Variety spreads the choice over the book moves. At 0 the best move
+	// is always played; at 1 moves are picked in proportion to how often
+	// they were played times how well they scored, and higher values
+	// flatten the odds further.
+	Variety float64
+	// MinGames leaves out moves played in fewer games.
+	MinGames int
+}
+
+// BookEngine plays from an opening book while the position is in it and
+// asks Engine otherwise. Analysis always goes to Engine.
+type BookEngine struct {
+	Engine
+	Book    *Book
+	Options BookOptions
+}
+
+// GetMove returns a book move or, out of book, Engine's move.
+func (e *BookEngine) GetMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error) {
+	move, _, err := e.PlayMove(ctx, g, cfg)
+	return move, err
+}
+
+// PlayMove is GetMove, also reporting whether the move came from the book.
+func (e *BookEngine) PlayMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, bool, error) {
+	if move, ok := e.bookMove(g, cfg); ok {
+		return move, true, nil
+	}
+	move, err := e.Engine.GetMove(ctx, g, cfg)
+	return move, false, err
+}
+
+// bookMove picks a book move for g. With cfg.Seed the pick depends only on
+// the seed and the position.
+func (e *BookEngine) bookMove(g *gotak.Game, cfg AIConfig) (string, bool) {
+	if e.Book == nil {
+		return "", false
+	}
+	moves, err := e.Book.Moves(g)
+	if err != nil {
+		return "", false
+	}
+	moves = slices.DeleteFunc(moves, func(m BookMove) bool { return m.Games() < max(e.Options.MinGames, 1) })
+	if len(moves) == 0 {
+		return "", false
+	}
+	if e.Options.Variety <= 0 {
+		return moves[0].Move, true
+	}
+
+	weights := make([]float64, len(moves))
+	total := 0.0
+	for i, m := range moves {
+		weights[i] = math.Pow(m.weight(), 1/e.Options.Variety)
+		total += weights[i]
+	}
+	r := rand.Float64() // #nosec G404 -- move variety, not security
+	if cfg.Seed != 0 {
+		p, err := newABPosition(g)
+		if err != nil {
+			return "", false
+		}
+		r = rand.New(rand.NewPCG(uint64(cfg.Seed), p.grid().hash)).Float64() // #nosec G404,G115 -- repeatable variety
+	}
+	r *= total
+	for i, w := range weights {
+		if r < w {
+			return moves[i].Move, true
+		}
+		r -= w
+	}
+	return moves[len(moves)-1].Move, true
+}
+
+// AnalyzeMultiPV passes multi-PV analysis on to Engine.
+func (e *BookEngine) AnalyzeMultiPV(ctx context.Context, g *gotak.Game, cfg AIConfig, n int) ([]*SearchResult, error) {
+	return AnalyzeLines(ctx, e.Engine, g, cfg, n)
+}
+
+// Close closes Engine if it holds resources.
+func (e *BookEngine) Close() error {
+	if c, ok := e.Engine.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// PlayMove asks e for a move and reports whether it came from an opening
+// book.
+func PlayMove(ctx context.Context, e Engine, g *gotak.Game, cfg AIConfig) (string, bool, error) {
+	if b, ok := e.(*BookEngine); ok {
+		return b.PlayMove(ctx, g, cfg)
+	}
+	move, err := e.GetMove(ctx, g, cfg)
+	return move, false, err
+}
@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/icco/gotak"
+)
+
+// playedGame returns a five-by-five game made of moves, alternately
+// white's and black's.
+func playedGame(t *testing.T, moves ...string) *gotak.Game {
+	t.Helper()
+	g, err := gotak.NewGame(5, 1, "book")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	for i, mv := range moves {
+		player := gotak.PlayerWhite
+		if i%2 == 1 {
+			player = gotak.PlayerBlack
+		}
+		if err := g.DoSingleMove(mv, player); err != nil {
+			t.Fatalf("DoSingleMove(%s): %v", mv, err)
+		}
+	}
+	return g
+}
+
+func testBook(t *testing.T) *Book {
+	t.Helper()
+	b := NewBook()
+	games := []struct {
+		moves  []string
+		winner int
+	}{
+		{[]string{"a1", "e5", "c3", "d3"}, gotak.PlayerWhite},
+		{[]string{"a1", "e5", "c3", "c4"}, gotak.PlayerWhite},
+		{[]string{"a1", "e5", "b2"}, gotak.PlayerBlack},
+		{[]string{"e1", "a5", "c3"}, gotak.PlayerNone},
+	}
+	for _, gm := range games {
+		if err := b.AddGame(playedGame(t, gm.moves...), gm.winner, 3); err != nil {
+			t.Fatalf("AddGame(%v): %v", gm.moves, err)
+		}
+	}
+	return b
+}
+
+func TestBookMoves(t *testing.T) {
+	b := testBook(t)
+
+	moves, err := b.Moves(playedGame(t))
+	if err != nil {
+		t.Fatalf("Moves: %v", err)
+	}
+	if len(moves) != 2 || moves[0] != (BookMove{Move: "a1", Wins: 2, Losses: 1}) || moves[1].Move != "e1" {
+		t.Errorf("first moves = %+v", moves)
+	}
+
+	moves, err = b.Moves(playedGame(t, "a1", "e5"))
+	if err != nil {
+		t.Fatalf("Moves: %v", err)
+	}
+	if len(moves) != 2 || moves[0].Move != "c3" || moves[0].Wins != 2 || moves[1].Move != "b2" {
+		t.Errorf("after a1 e5 = %+v", moves)
+	}
+
+	// Only the first three plies were recorded.
+	if moves, err := b.Moves(playedGame(t, "a1", "e5", "c3")); err != nil || len(moves) != 0 {
+		t.Errorf("out of book = %+v, %v", moves, err)
+	}
+
+	if err := b.AddGame(playedGame(t, "a1", "a1"), gotak.PlayerWhite, 4); err == nil {
+		t.Error("AddGame should reject an illegal game")
+	}
+}
+
+func TestBookReadWrite(t *testing.T) {
+	b := testBook(t)
+	var buf bytes.Buffer
+	if err := b.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	read, err := ReadBook(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadBook: %v", err)
+	}
+	if read.Len() != b.Len() {
+		t.Fatalf("read %d positions, want %d", read.Len(), b.Len())
+	}
+	g := playedGame(t, "a1", "e5")
+	want, _ := b.Moves(g)
+	got, _ := read.Moves(g)
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("read moves = %+v, want %+v", got, want)
+	}
+
+	if _, err := ReadBook(bytes.NewReader([]byte("not a book"))); err == nil {
+		t.Error("ReadBook should reject other data")
+	}
+	if _, err := ReadBook(bytes.NewReader(buf.Bytes()[:buf.Len()-2])); err == nil {
+		t.Error("ReadBook should reject a truncated book")
+	}
+
+	read.Merge(b)
+	if got, _ := read.Moves(g); got[0].Wins != 2*want[0].Wins {
+		t.Errorf("merged moves = %+v", got)
+	}
+}
+
+func TestBookEngine(t *testing.T) {
+	ctx := context.Background()
+	e := &BookEngine{Engine: &AlphaBetaEngine{}, Book: testBook(t)}
+	cfg := AIConfig{Level: Beginner}
+
+	move, book, err := PlayMove(ctx, e, playedGame(t, "a1", "e5"), cfg)
+	if err != nil || !book || move != "c3" {
+		t.Errorf("in book = %q, %v, %v; want the best book move c3", move, book, err)
+	}
+	move, book, err = PlayMove(ctx, e, playedGame(t, "a1", "e5", "c3"), cfg)
+	if err != nil || book || move == "" {
+		t.Errorf("out of book = %q, %v, %v", move, book, err)
+	}
+
+	// Every listed move can be picked with variety, and moves from too few
+	// games never are.
+	e.Options = BookOptions{Variety: 4}
+	seen := map[string]bool{}
+	for range 200 {
+		move, _ := e.bookMove(playedGame(t, "a1", "e5"), AIConfig{})
+		seen[move] = true
+	}
+	if !seen["c3"] || !seen["b2"] {
+		t.Errorf("variety played %v", seen)
+	}
+	// A seed fixes the pick.
+	seeded := map[string]bool{}
+	for seed := int64(1); seed <= 20; seed++ {
+		first, _ := e.bookMove(playedGame(t, "a1", "e5"), AIConfig{Seed: seed})
+		if again, _ := e.bookMove(playedGame(t, "a1", "e5"), AIConfig{Seed: seed}); again != first {
+			t.Errorf("seed %d played %s then %s", seed, first, again)
+		}
+		seeded[first] = true
+	}
+	if len(seeded) < 2 {
+		t.Errorf("twenty seeds all played %v", seeded)
+	}
+	e.Options = BookOptions{Variety: 4, MinGames: 2}
+	for range 50 {
+		if move, _ := e.bookMove(playedGame(t, "a1", "e5"), AIConfig{}); move != "c3" {
+			t.Fatalf("played %q from a single game", move)
+		}
+	}
+
+	r := NewDefaultRegistry()
+	r.UseBook(testBook(t), BookOptions{})
+	r.UseBook(testBook(t), BookOptions{})
+	engine, _, err := r.Get(NativeEngine)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if b, ok := engine.(*BookEngine); !ok {
+		t.Errorf("registry engine is %T", engine)
+	} else if _, nested := b.Engine.(*BookEngine); nested {
+		t.Error("UseBook twice should replace the book, not wrap it again")
+	}
+	if _, ok := engine.(MultiPVEngine); !ok {
+		t.Error("book engines should keep multi-PV analysis")
+	}
+}
+
+func TestGameWinner(t *testing.T) {
+	for result, want := range map[string]int{"R-0": gotak.PlayerWhite, "0-F": gotak.PlayerBlack, "1/2-1/2": gotak.PlayerNone} {
+		if got, ok := GameWinner(result); !ok || got != want {
+			t.Errorf("GameWinner(%q) = %d, %v", result, got, ok)
+		}
+	}
+	if _, ok := GameWinner(""); ok {
+		t.Error("a game without a result has no winner")
+	}
+}
@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// EnginesConfig is the on-disk engine configuration read by LoadRegistry,
+// as used by the server's ENGINES_CONFIG and takmatch. Configured engines
+// are added to the built-in ones.
+//
+//	default: tiltak
+//	engines:
+//	  - name: tiltak
+//	    type: tei
+//	    path: /usr/local/bin/tiltak
+//	    args: [tei]
+//	    options: {HalfKomi: "4"}
+//	    min_size: 3
+//	    max_size: 8
+//	    komi: true
+//	    analysis: true
+type EnginesConfig struct {
+	Default string              `yaml:"default"`
+	Engines []EngineConfigEntry `yaml:"engines"`
+}
+
+// EngineConfigEntry configures one engine. Type is "tei" for an external
+// engine or "taktician" for a built-in algorithm under another name.
+type EngineConfigEntry struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Type        string            `yaml:"type"`
+	Path        string            `yaml:"path"`
+	Args        []string          `yaml:"args"`
+	Env         []string          `yaml:"env"`
+	Options     map[string]string `yaml:"options"`
+	Algorithm   string            `yaml:"algorithm"`
+	MinSize     int64             `yaml:"min_size"`
+	MaxSize     int64             `yaml:"max_size"`
+	Komi        bool              `yaml:"komi"`
+	Analysis    bool              `yaml:"analysis"`
+}
+
+// LoadRegistry reads an EnginesConfig file and returns the built-in
+// registry extended with its engines.
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator config
+	if err != nil {
+		return nil, fmt.Errorf("read engines config: %w", err)
+	}
+	var cfg EnginesConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parse engines config %s: %w", path, err)
+	}
+	return BuildRegistry(cfg)
+}
+
+// BuildRegistry returns the built-in registry extended with cfg's engines.
+func BuildRegistry(cfg EnginesConfig) (*Registry, error) {
+	reg := NewDefaultRegistry()
+	for _, entry := range cfg.Engines {
+		engine, err := entry.engine()
+		if err != nil {
+			return nil, fmt.Errorf("engine %q: %w", entry.Name, err)
+		}
+		caps := Capabilities{
+			MinSize:  entry.MinSize,
+			MaxSize:  entry.MaxSize,
+			Komi:     entry.Komi,
+			Analysis: entry.Analysis,
+		}
+		if caps.MinSize == 0 {
+			caps.MinSize = 3
+		}
+		if caps.MaxSize == 0 {
+			caps.MaxSize = 8
+		}
+		info := EngineInfo{Name: entry.Name, Description: entry.Description, Capabilities: caps}
+		if err := reg.Register(info, engine); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Default != "" {
+		if err := reg.SetDefault(cfg.Default); err != nil {
+			return nil, fmt.Errorf("default engine: %w", err)
+		}
+	}
+	return reg, nil
+}
+
+func (e EngineConfigEntry) engine() (Engine, error) {
+	switch e.Type {
+	case "tei":
+		if e.Path == "" {
+			return nil, errors.New("tei engines need a path")
+		}
+		return &TEIEngine{Path: e.Path, Args: e.Args, Env: e.Env, Options: e.Options}, nil
+	case "taktician":
+		switch alg := Algorithm(e.Algorithm); alg {
+		case "", AlgorithmRandom, AlgorithmMinimax, AlgorithmMCTS:
+			return &TakticianEngine{Algorithm: alg}, nil
+		default:
+			return nil, fmt.Errorf("unknown taktician algorithm %q", e.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unknown engine type %q", e.Type)
+	}
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeEnginesConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "engines.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadRegistry(t *testing.T) {
+	path := writeEnginesConfig(t, `
+default: tiltak
+engines:
+  - name: tiltak
+    description: Tiltak over TEI
+    type: tei
+    path: /usr/local/bin/tiltak
+    args: [tei]
+    options: {HalfKomi: "4"}
+    min_size: 5
+    max_size: 6
+    komi: true
+    analysis: true
+  - name: quick
+    type: taktician
+    algorithm: minimax
+`)
+	reg, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry: %v", err)
+	}
+	t.Cleanup(func() { _ = reg.Close() })
+
+	if reg.Default() != "tiltak" {
+		t.Errorf("default = %q, want tiltak", reg.Default())
+	}
+	e, info, err := reg.Get("tiltak")
+	if err != nil {
+		t.Fatalf("Get(tiltak): %v", err)
+	}
+	tei, ok := e.(*TEIEngine)
+	if !ok || tei.Path != "/usr/local/bin/tiltak" || tei.Options["HalfKomi"] != "4" {
+		t.Errorf("tiltak engine = %#v", e)
+	}
+	want := Capabilities{MinSize: 5, MaxSize: 6, Komi: true, Analysis: true}
+	if info.Capabilities != want {
+		t.Errorf("tiltak capabilities = %+v, want %+v", info.Capabilities, want)
+	}
+
+	_, info, err = reg.Get("quick")
+	if err != nil {
+		t.Fatalf("Get(quick): %v", err)
+	}
+	if info.Capabilities.MinSize != 3 || info.Capabilities.MaxSize != 8 {
+		t.Errorf("quick sizes = %+v, want 3-8 defaults", info.Capabilities)
+	}
+	if _, _, err := reg.Get(DefaultEngine); err != nil {
+		t.Errorf("built-in engines should stay registered: %v", err)
+	}
+}
+
+func TestLoadRegistryErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":     "engines:\n  - name: x\n    type: tei\n    path: /bin/x\n    bogus: 1\n",
+		"unknown type":      "engines:\n  - name: x\n    type: uci\n",
+		"tei without path":  "engines:\n  - name: x\n    type: tei\n",
+		"bad algorithm":     "engines:\n  - name: x\n    type: taktician\n    algorithm: alphazero\n",
+		"duplicate name":    "engines:\n  - name: minimax\n    type: taktician\n",
+		"unknown default":   "default: nope\n",
+		"inverted sizes":    "engines:\n  - name: x\n    type: taktician\n    min_size: 7\n    max_size: 5\n",
+		"missing name":      "engines:\n  - type: taktician\n",
+		"not a yaml object": "- just\n- a list\n",
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			if reg, err := LoadRegistry(writeEnginesConfig(t, body)); err == nil {
+				_ = reg.Close()
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	if _, err := LoadRegistry(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
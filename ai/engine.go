@@ -3,8 +3,10 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
+	"math/rand/v2"
 	"regexp"
 	"strconv"
 	"time"
@@ -12,6 +14,7 @@ import (
 	"github.com/icco/gotak"
 	taktician "github.com/nelhage/taktician/ai"
 	"github.com/nelhage/taktician/ai/mcts"
+	"github.com/nelhage/taktician/ptn"
 	"github.com/nelhage/taktician/tak"
 )
 
@@ -50,16 +53,105 @@ type AIConfig struct {
 	Style       Style
 	TimeLimit   time.Duration
 	Personality string // Custom personality name
+	// Seed drives the engine's random choices, so the same seed, position
+	// and settings give the same move. 0 leaves them unseeded. TEI
+	// engines ignore it.
+	Seed int64
+	// Nodes, when set, bounds each search by positions evaluated (or
+	// MCTS playouts) instead of TimeLimit, so that with a Seed results
+	// don't depend on machine speed.
+	Nodes int64
+}
+
+// seed is cfg.Seed, or a fresh random seed when it is unset.
+func (cfg AIConfig) seed() int64 {
+	if cfg.Seed != 0 {
+		return cfg.Seed
+	}
+	return rand.Int64() // #nosec G404 -- play variety, not security
 }
 
 // Engine is the interface for AI move generation.
 type Engine interface {
 	GetMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error)
 	ExplainMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error)
+	// Analyze searches the position and reports the evaluation behind the
+	// best move as well as the move itself.
+	Analyze(ctx context.Context, g *gotak.Game, cfg AIConfig) (*SearchResult, error)
 }
 
-// TakticianEngine wraps the Taktician AI library
-type TakticianEngine struct{}
+// MultiPVEngine is implemented by engines that can report several candidate
+// moves from one search.
+type MultiPVEngine interface {
+	// AnalyzeMultiPV returns up to n lines, best first.
+	AnalyzeMultiPV(ctx context.Context, g *gotak.Game, cfg AIConfig, n int) ([]*SearchResult, error)
+}
+
+// AnalyzeLines asks e for its n best lines. Engines that aren't a
+// MultiPVEngine report their best line only.
+func AnalyzeLines(ctx context.Context, e Engine, g *gotak.Game, cfg AIConfig, n int) ([]*SearchResult, error) {
+	if m, ok := e.(MultiPVEngine); ok && n > 1 {
+		return m.AnalyzeMultiPV(ctx, g, cfg, n)
+	}
+	res, err := e.Analyze(ctx, g, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return []*SearchResult{res}, nil
+}
+
+// SearchInfo is the engine's most recent report during a search.
+type SearchInfo struct {
+	Depth    int
+	SelDepth int
+	// ScoreCP is from the side to move's point of view, in centiflats.
+	ScoreCP int
+	// Mate is non-zero for a forced win (positive) or loss (negative) in
+	// that many moves; ScoreCP is meaningless then.
+	Mate  int
+	Nodes int64
+	Time  time.Duration
+	PV    []string
+}
+
+// SearchResult is the outcome of one search.
+type SearchResult struct {
+	BestMove string
+	Info     SearchInfo
+}
+
+// winProbabilityScale is the score, in centiflats, at which the side to
+// move wins about 73% of the time.
+const winProbabilityScale = 250
+
+// WinProbability maps the score onto the side to move's chance of winning,
+// from 0 to 1. Forced results are 0 or 1.
+func (i SearchInfo) WinProbability() float64 {
+	switch {
+	case i.Mate > 0:
+		return 1
+	case i.Mate < 0:
+		return 0
+	}
+	return 1 / (1 + math.Exp(-float64(i.ScoreCP)/winProbabilityScale))
+}
+
+// Algorithm names one of Taktician's search algorithms.
+type Algorithm string
+
+// Taktician algorithms a TakticianEngine can be pinned to.
+const (
+	AlgorithmRandom  Algorithm = "random"
+	AlgorithmMinimax Algorithm = "minimax"
+	AlgorithmMCTS    Algorithm = "mcts"
+)
+
+// TakticianEngine wraps the Taktician AI library. With no Algorithm set the
+// difficulty level picks one (random, minimax 3, minimax 5, MCTS); with one
+// set, the level only scales search depth or time.
+type TakticianEngine struct {
+	Algorithm Algorithm
+}
 
 // GetMove returns the engine's chosen move for the given game state, formatted as a PTN string.
 func (e *TakticianEngine) GetMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error) {
@@ -77,27 +169,15 @@ func (e *TakticianEngine) GetMove(ctx context.Context, g *gotak.Game, cfg AIConf
 	// Safe conversion of int64 to int (already validated to be in range 3-9)
 	boardSize := int(g.Board.Size)
 
-	// Create appropriate AI based on configuration
-	var ai taktician.TakPlayer
-	switch cfg.Level {
-	case Beginner:
-		ai = taktician.NewRandom(42)
-	case Intermediate:
-		ai = taktician.NewMinimax(taktician.MinimaxConfig{
-			Size:  boardSize,
-			Depth: 3,
-		})
-	case Advanced:
-		ai = taktician.NewMinimax(taktician.MinimaxConfig{
-			Size:  boardSize,
-			Depth: 5,
-		})
-	case Expert:
-		ai = mcts.NewMonteCarlo(mcts.MCTSConfig{
-			Size:  boardSize,
-			Limit: cfg.TimeLimit,
-			C:     1.4, // Exploration parameter
-		})
+	ai, err := e.player(boardSize, cfg)
+	if err != nil {
+		return "", err
+	}
+	if e.Algorithm == AlgorithmMinimax && cfg.Nodes == 0 {
+		// Minimax deepens iteratively and stops at the context deadline.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, searchTime(cfg))
+		defer cancel()
 	}
 
 	// Get move from AI
@@ -112,9 +192,136 @@ func (e *TakticianEngine) GetMove(ctx context.Context, g *gotak.Game, cfg AIConf
 	return ptnMove, nil
 }
 
-// ExplainMove returns a human-readable description of how the engine arrived at its move.
-func (e *TakticianEngine) ExplainMove(_ context.Context, _ *gotak.Game, cfg AIConfig) (string, error) {
-	return fmt.Sprintf("AI move generated using %v level with %v style", cfg.Level, cfg.Style), nil
+// ExplainMove analyses the position with minimax, as Analyze does, and
+// describes the evaluation and what the chosen move does.
+func (e *TakticianEngine) ExplainMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error) {
+	res, err := e.Analyze(ctx, g, cfg)
+	if err != nil {
+		return "", err
+	}
+	return explainSearch("taktician", g, res), nil
+}
+
+// takticianFlat is what one top flat is worth in Taktician's evaluation.
+const takticianFlat = 400
+
+// Analyze runs Taktician's minimax, whatever the engine's Algorithm, since
+// it is the only Taktician search that reports a score. The level caps the
+// depth and cfg.Nodes, or else cfg.TimeLimit (or a level-based default),
+// the effort.
+func (e *TakticianEngine) Analyze(ctx context.Context, g *gotak.Game, cfg AIConfig) (*SearchResult, error) {
+	position, err := convertGameToPosition(g)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert game state: %w", err)
+	}
+	boardSize := int(g.Board.Size)
+
+	if cfg.Nodes == 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, searchTime(cfg))
+		defer cancel()
+	}
+	pv, value, stats := taktician.NewMinimax(minimaxConfig(boardSize, minimaxDepth(cfg.Level), cfg)).Analyze(ctx, position)
+	if len(pv) == 0 {
+		if err := ctx.Err(); err != nil && stats.Depth == 0 {
+			return nil, err
+		}
+		return nil, errors.New("no legal moves")
+	}
+
+	res := &SearchResult{Info: SearchInfo{
+		Depth: stats.Depth,
+		Nodes: int64(stats.Visited), // #nosec G115 -- a node count fits
+		Time:  stats.Elapsed,
+	}}
+	for _, m := range pv {
+		ptn, err := convertMoveToString(m, boardSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert move: %w", err)
+		}
+		res.Info.PV = append(res.Info.PV, ptn)
+	}
+	res.BestMove = res.Info.PV[0]
+
+	// Wins are scored beyond WinThreshold; the PV ends at the win.
+	switch plies := len(pv); {
+	case value > taktician.WinThreshold:
+		res.Info.Mate = (plies + 1) / 2
+	case value < -taktician.WinThreshold:
+		res.Info.Mate = -max((plies+1)/2, 1)
+	default:
+		res.Info.ScoreCP = int(value * 100 / takticianFlat)
+	}
+	return res, nil
+}
+
+// player builds the Taktician AI for one search. Taktician's MCTS can only
+// be limited by time, so with cfg.Nodes set it is replaced by minimax.
+func (e *TakticianEngine) player(boardSize int, cfg AIConfig) (taktician.TakPlayer, error) {
+	switch e.Algorithm {
+	case "":
+	case AlgorithmRandom:
+		return taktician.NewRandom(cfg.seed()), nil
+	case AlgorithmMinimax:
+		return taktician.NewMinimax(minimaxConfig(boardSize, minimaxDepth(cfg.Level), cfg)), nil
+	case AlgorithmMCTS:
+		if cfg.Nodes > 0 {
+			return taktician.NewMinimax(minimaxConfig(boardSize, minimaxDepth(cfg.Level), cfg)), nil
+		}
+		return mcts.NewMonteCarlo(mcts.MCTSConfig{
+			Size:  boardSize,
+			Limit: searchTime(cfg),
+			C:     1.4, // Exploration parameter
+			Seed:  cfg.Seed,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown taktician algorithm %q", e.Algorithm)
+	}
+
+	// Create appropriate AI based on configuration
+	switch cfg.Level {
+	case Beginner:
+		return taktician.NewRandom(cfg.seed()), nil
+	case Intermediate:
+		return taktician.NewMinimax(minimaxConfig(boardSize, 3, cfg)), nil
+	case Advanced:
+		return taktician.NewMinimax(minimaxConfig(boardSize, 5, cfg)), nil
+	default:
+		if cfg.Nodes > 0 {
+			return taktician.NewMinimax(minimaxConfig(boardSize, minimaxDepth(Expert), cfg)), nil
+		}
+		return mcts.NewMonteCarlo(mcts.MCTSConfig{
+			Size:  boardSize,
+			Limit: cfg.TimeLimit,
+			C:     1.4, // Exploration parameter
+			Seed:  cfg.Seed,
+		}), nil
+	}
+}
+
+// minimaxConfig is Taktician's minimax at depth with cfg's seed and node
+// budget.
+func minimaxConfig(boardSize, depth int, cfg AIConfig) taktician.MinimaxConfig {
+	return taktician.MinimaxConfig{
+		Size:     boardSize,
+		Depth:    depth,
+		Seed:     cfg.Seed,
+		MaxEvals: uint64(max(cfg.Nodes, 0)), // #nosec G115 -- not negative
+	}
+}
+
+// minimaxDepth is the depth cap for a pinned minimax engine.
+func minimaxDepth(level DifficultyLevel) int {
+	switch level {
+	case Beginner:
+		return 1
+	case Intermediate:
+		return 3
+	case Advanced:
+		return 5
+	default:
+		return 7
+	}
 }
 
 // convertGameToPosition converts our gotak.Game to Taktician's tak.Position
@@ -137,11 +344,16 @@ func convertGameToPosition(g *gotak.Game) (*tak.Position, error) {
 	// Safe conversion of int64 to int (already validated to be within range)
 	boardSize := int(g.Board.Size)
 
-	// Create a new position with the same size
-	config := tak.Config{
-		Size: boardSize,
+	// Start from the TPS tag if the game has one, else an empty board
+	position := tak.New(tak.Config{Size: boardSize})
+	if tps, err := g.GetMeta("TPS"); err == nil && tps != "" {
+		if position, err = ptn.ParseTPS(tps); err != nil {
+			return nil, fmt.Errorf("bad TPS tag: %w", err)
+		}
+		if position.Size() != boardSize {
+			return nil, fmt.Errorf("TPS tag is for a %dx%d board", position.Size(), position.Size())
+		}
 	}
-	position := tak.New(config)
 
 	// Apply moves from game history to build current position
 	for _, turn := range g.Turns {
@@ -403,3 +403,115 @@ func TestRoundTripConversion(t *testing.T) {
 		})
 	}
 }
+
+func TestEngineAnalyze(t *testing.T) {
+	g, err := gotak.NewGame(5, 1, "analyze")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	// White owns a1-d1 and wins with e1.
+	for _, turn := range [][2]string{{"e5", "a1"}, {"b1", "e4"}, {"c1", "e3"}, {"d1", "a3"}} {
+		if err := g.DoTurn(turn[0], turn[1]); err != nil {
+			t.Fatalf("DoTurn: %v", err)
+		}
+	}
+
+	engines := map[string]Engine{
+		"taktician": &TakticianEngine{},
+		"mcts":      &TakticianEngine{Algorithm: AlgorithmMCTS},
+		"gotak":     &AlphaBetaEngine{},
+	}
+	for name, e := range engines {
+		res, err := e.Analyze(context.Background(), g, AIConfig{Level: Intermediate, TimeLimit: time.Second})
+		if err != nil {
+			t.Fatalf("%s: Analyze: %v", name, err)
+		}
+		if res.BestMove != "e1" && res.BestMove != "Ce1" {
+			t.Errorf("%s: best move = %q, want e1", name, res.BestMove)
+		}
+		if res.Info.Mate != 1 || res.Info.WinProbability() != 1 {
+			t.Errorf("%s: info = %+v, want mate in 1", name, res.Info)
+		}
+		if res.Info.Depth < 1 || len(res.Info.PV) == 0 || res.Info.PV[0] != res.BestMove {
+			t.Errorf("%s: info = %+v, want a PV starting with the best move", name, res.Info)
+		}
+	}
+}
+
+func TestWinProbability(t *testing.T) {
+	if p := (SearchInfo{}).WinProbability(); p != 0.5 {
+		t.Errorf("even position = %v, want 0.5", p)
+	}
+	up, down := SearchInfo{ScoreCP: 300}.WinProbability(), SearchInfo{ScoreCP: -300}.WinProbability()
+	if up <= 0.5 || up >= 1 || up+down < 0.999 || up+down > 1.001 {
+		t.Errorf("+3 flats = %v, -3 flats = %v; want symmetric and short of certain", up, down)
+	}
+	if p := (SearchInfo{ScoreCP: 500, Mate: -2}).WinProbability(); p != 0 {
+		t.Errorf("forced loss = %v, want 0", p)
+	}
+}
+
+func TestConvertGameToPosition_TPS(t *testing.T) {
+	g, err := gotak.NewGame(5, 1, "tps")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	if err := g.UpdateMeta("TPS", "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5"); err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	res, err := (&TakticianEngine{}).Analyze(context.Background(), g, AIConfig{Level: Intermediate, TimeLimit: time.Second})
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if res.BestMove != "e1" && res.BestMove != "Ce1" {
+		t.Errorf("best move = %q, want the win on e1", res.BestMove)
+	}
+
+	if err := g.UpdateMeta("TPS", "x6/x6/x6/x6/x6/x6 1 1"); err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	if _, err := convertGameToPosition(g); err == nil {
+		t.Error("expected an error for a TPS tag of the wrong size")
+	}
+}
+
+func TestTakticianSeed(t *testing.T) {
+	game, err := gotak.NewGame(5, 1, "test-seed")
+	if err != nil {
+		t.Fatalf("Failed to create game: %v", err)
+	}
+	engine := &TakticianEngine{}
+	ctx := context.Background()
+
+	// The random beginner plays the same move for the same seed...
+	moves := map[string]bool{}
+	for seed := int64(1); seed <= 10; seed++ {
+		cfg := AIConfig{Level: Beginner, Seed: seed}
+		first, err := engine.GetMove(ctx, game, cfg)
+		if err != nil {
+			t.Fatalf("GetMove(seed %d) error = %v", seed, err)
+		}
+		again, err := engine.GetMove(ctx, game, cfg)
+		if err != nil {
+			t.Fatalf("GetMove(seed %d) error = %v", seed, err)
+		}
+		if first != again {
+			t.Errorf("seed %d played %s then %s", seed, first, again)
+		}
+		moves[first] = true
+	}
+	// ...and different moves for different seeds.
+	if len(moves) < 2 {
+		t.Errorf("ten seeds all played %v", moves)
+	}
+
+	// A node budget makes the expert repeatable too.
+	cfg := AIConfig{Level: Expert, Seed: 3, Nodes: 2000}
+	first, err := engine.GetMove(ctx, game, cfg)
+	if err != nil {
+		t.Fatalf("GetMove() error = %v", err)
+	}
+	if again, err := engine.GetMove(ctx, game, cfg); err != nil || again != first {
+		t.Errorf("expert with a node budget played %s then %s (%v)", first, again, err)
+	}
+}
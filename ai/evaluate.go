@@ -0,0 +1,327 @@
+package ai
+
+import (
+	"strconv"
+
+	"github.com/icco/gotak"
+)
+
+// evalWeights are the evaluation terms' values in centiflats.
+type evalWeights struct {
+	Flat        int // each top flat
+	Road        int // per square of the longest group's span
+	Threat      int // each empty square that completes a road
+	CapMobility int // each square a capstone can move to
+	Hard        int // own stones under an own top
+	Captive     int // opponent stones under an own top
+	Wall        int // walls touching an opponent road piece
+	// Block scales the opponent's road and threat terms, in percent.
+	// Above 100 the engine spends more effort stopping roads than
+	// building its own.
+	Block int
+}
+
+// styleWeights maps a Style onto evaluation weights: aggressive play
+// chases road threats, defensive play values walls and blocking.
+func styleWeights(style Style) evalWeights {
+	switch style {
+	case Aggressive:
+		return evalWeights{Flat: 90, Road: 16, Threat: 220, CapMobility: 10, Hard: 20, Captive: 10, Wall: 10, Block: 70}
+	case Defensive:
+		return evalWeights{Flat: 100, Road: 8, Threat: 100, CapMobility: 6, Hard: 25, Captive: 10, Wall: 50, Block: 160}
+	default:
+		return evalWeights{Flat: 100, Road: 10, Threat: 120, CapMobility: 6, Hard: 20, Captive: 10, Wall: 25, Block: 100}
+	}
+}
+
+// abSquares[size][i] is the name of square i, where i = row*size + column
+// with a1 at 0.
+var abSquares = func() (names [10][]string) {
+	for size := 3; size < len(names); size++ {
+		for i := range size * size {
+			names[size] = append(names[size], string(rune('a'+i%size))+strconv.Itoa(i/size+1))
+		}
+	}
+	return names
+}()
+
+// abCell is one square's summary: its top piece and what's beneath it.
+type abCell struct {
+	player int
+	kind   byte // 'F', 'S', 'C', or 0 when empty
+	height int
+	// under counts the stones beneath the top by player.
+	under [3]int
+}
+
+// abGrid is an indexed snapshot of a board for evaluation, road checks and
+// hashing.
+type abGrid struct {
+	size  int
+	cells []abCell
+	hash  uint64
+}
+
+func (p *abPosition) grid() *abGrid {
+	size := int(p.board.Size)
+	gr := &abGrid{size: size, cells: make([]abCell, size*size)}
+	// FNV-1a over every stone, square by square.
+	h := uint64(14695981039346656037)
+	mix := func(b byte) {
+		h ^= uint64(b)
+		h *= 1099511628211
+	}
+	for i, name := range abSquares[size] {
+		stack := p.board.Squares[name]
+		for j, st := range stack {
+			kind := st.Type[0]
+			mix(byte(st.Player)<<4 | kind&0x0f) // #nosec G115 -- player is 1 or 2
+			if j == len(stack)-1 {
+				gr.cells[i] = abCell{player: st.Player, kind: kind, height: len(stack)}
+			}
+		}
+		for _, st := range stack[:max(len(stack)-1, 0)] {
+			gr.cells[i].under[st.Player]++
+		}
+		mix(0xff)
+	}
+	mix(byte(p.toMove))
+	if p.opening() {
+		mix(0xfe)
+	}
+	gr.hash = h
+	return gr
+}
+
+// road reports whether square i counts towards player's roads.
+func (gr *abGrid) road(i, player int) bool {
+	c := gr.cells[i]
+	return c.player == player && (c.kind == 'F' || c.kind == 'C')
+}
+
+// neighbours calls f with every square adjacent to i.
+func (gr *abGrid) neighbours(i int, f func(int)) {
+	x, y := i%gr.size, i/gr.size
+	if x > 0 {
+		f(i - 1)
+	}
+	if x < gr.size-1 {
+		f(i + 1)
+	}
+	if y > 0 {
+		f(i - gr.size)
+	}
+	if y < gr.size-1 {
+		f(i + gr.size)
+	}
+}
+
+// groups labels player's connected road pieces and returns, per square,
+// its group id (-1 for none) plus each group's span: the most columns or
+// rows it covers.
+func (gr *abGrid) groups(player int) ([]int, []int) {
+	label := make([]int, len(gr.cells))
+	for i := range label {
+		label[i] = -1
+	}
+	var spans []int
+	queue := make([]int, 0, len(gr.cells))
+	for start := range gr.cells {
+		if label[start] != -1 || !gr.road(start, player) {
+			continue
+		}
+		id := len(spans)
+		minX, maxX, minY, maxY := gr.size, -1, gr.size, -1
+		label[start] = id
+		queue = append(queue[:0], start)
+		for len(queue) > 0 {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			x, y := i%gr.size, i/gr.size
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+			gr.neighbours(i, func(n int) {
+				if label[n] == -1 && gr.road(n, player) {
+					label[n] = id
+					queue = append(queue, n)
+				}
+			})
+		}
+		spans = append(spans, max(maxX-minX, maxY-minY)+1)
+	}
+	return label, spans
+}
+
+// hasRoad reports whether player connects opposite edges.
+func (gr *abGrid) hasRoad(player int) bool {
+	label, spans := gr.groups(player)
+	for id, span := range spans {
+		if span < gr.size {
+			continue
+		}
+		// A full span means the group touches both edges of a row or a
+		// column pair; check which.
+		var west, east, south, north bool
+		for i, l := range label {
+			if l != id {
+				continue
+			}
+			x, y := i%gr.size, i/gr.size
+			west, east = west || x == 0, east || x == gr.size-1
+			south, north = south || y == 0, north || y == gr.size-1
+		}
+		if (west && east) || (south && north) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gr *abGrid) full() bool {
+	for _, c := range gr.cells {
+		if c.height == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (gr *abGrid) flats(player int) int {
+	n := 0
+	for _, c := range gr.cells {
+		if c.player == player && c.kind == 'F' {
+			n++
+		}
+	}
+	return n
+}
+
+// threats counts empty squares where a flat would give player a road.
+func (gr *abGrid) threats(player int) int {
+	n := 0
+	for i := range gr.cells {
+		if gr.cells[i].height != 0 {
+			continue
+		}
+		gr.cells[i] = abCell{player: player, kind: 'F', height: 1}
+		if gr.hasRoad(player) {
+			n++
+		}
+		gr.cells[i] = abCell{}
+	}
+	return n
+}
+
+// evaluate scores a quiet position for the side to move.
+func (s *abSearch) evaluate(p *abPosition, gr *abGrid) int {
+	w := s.weights
+	me, opp := p.toMove, opponent(p.toMove)
+	var score [3]int
+	var roads [3]int
+	var threats [3]int
+
+	for _, pl := range []int{me, opp} {
+		_, spans := gr.groups(pl)
+		longest := 0
+		pieces := 0
+		for _, span := range spans {
+			longest = max(longest, span)
+		}
+		for i, c := range gr.cells {
+			if c.player != pl {
+				continue
+			}
+			if gr.road(i, pl) {
+				pieces++
+			}
+			switch c.kind {
+			case 'F':
+				score[pl] += w.Flat
+			case 'C':
+				moves := 0
+				gr.neighbours(i, func(n int) {
+					if nc := gr.cells[n]; nc.kind != 'C' && (nc.kind != 'S' || nc.player != pl) {
+						moves++
+					}
+				})
+				score[pl] += w.CapMobility * (moves + min(c.height-1, gr.size))
+			case 'S':
+				touching := false
+				gr.neighbours(i, func(n int) {
+					touching = touching || gr.road(n, opponent(pl))
+				})
+				if touching {
+					score[pl] += w.Wall
+				}
+			}
+			score[pl] += w.Hard*c.under[pl] + w.Captive*c.under[opponent(pl)]
+		}
+		roads[pl] = w.Road * longest * longest
+		// A road needs at least size-1 pieces before one placement can
+		// finish it.
+		if pieces >= gr.size-1 && p.stones[pl] > 0 {
+			threats[pl] = gr.threats(pl)
+		}
+	}
+
+	eval := score[me] - score[opp] + roads[me] - roads[opp]*w.Block/100
+	eval += w.Threat*threats[me] - w.Threat*threats[opp]*w.Block/100
+	// The side to move can cash a threat in right away.
+	if threats[me] > 0 {
+		eval += 4 * w.Threat
+	}
+	if s.seed != 0 {
+		eval += s.noise(gr.hash)
+	}
+	return eval
+}
+
+// moveHint is a cheap ordering guess: placements that extend roads, walls
+// that block them, and stack moves that capture.
+func (gr *abGrid) moveHint(m *gotak.Move, player int) int {
+	i := gr.index(m.Square)
+	if i < 0 {
+		return 0
+	}
+	own, theirs := 0, 0
+	gr.neighbours(i, func(n int) {
+		switch {
+		case gr.road(n, player):
+			own++
+		case gr.road(n, opponent(player)):
+			theirs++
+		}
+	})
+	if m.MoveDirection != "" {
+		return 200 + 10*int(m.MoveCount) + 30*theirs
+	}
+	center := gr.size - abs(2*(i%gr.size)-gr.size+1) - abs(2*(i/gr.size)-gr.size+1)
+	switch m.Stone {
+	case gotak.StoneStanding:
+		return 100 + 60*theirs
+	case gotak.StoneCap:
+		return 250 + 30*theirs + 5*center
+	default:
+		return 300 + 40*own + 5*center
+	}
+}
+
+// index returns the square's index, or -1 when it isn't on the board.
+func (gr *abGrid) index(square string) int {
+	if len(square) < 2 {
+		return -1
+	}
+	x := int(square[0] - 'a')
+	y, err := strconv.Atoi(square[1:])
+	if err != nil || x < 0 || x >= gr.size || y < 1 || y > gr.size {
+		return -1
+	}
+	return (y-1)*gr.size + x
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
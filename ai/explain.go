@@ -0,0 +1,253 @@
+package ai
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/icco/gotak"
+)
+
+// DescribeMove explains what playing move does in g's current position,
+// in a few short sentences for players: the road it completes, threatens
+// or blocks, whether it leaves the opponent in Tinuë, how the flat count
+// changes and what its capstone or wall is for. It doesn't search, so it
+// is cheap enough to run for every move of a game.
+func DescribeMove(g *gotak.Game, move string) (string, error) {
+	p, err := newABPosition(g)
+	if err != nil {
+		return "", err
+	}
+	if _, over := p.result(p.grid()); over {
+		return "", errGameOver
+	}
+	parsed, err := gotak.NewMove(move)
+	if err != nil {
+		return "", err
+	}
+	moves := p.moves()
+	i := slices.IndexFunc(moves, parsed.Equal)
+	if i < 0 {
+		return "", fmt.Errorf("%s is not a legal move here", move)
+	}
+	legal := moves[i]
+	next, err := p.play(legal)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(explainMove(p, next, legal), " "), nil
+}
+
+// explainSearch is describeSearch followed by DescribeMove's account of
+// the chosen move.
+func explainSearch(name string, g *gotak.Game, res *SearchResult) string {
+	text := describeSearch(name, res) + "."
+	if why, err := DescribeMove(g, res.BestMove); err == nil && why != "" {
+		text += " " + why
+	}
+	return text
+}
+
+// explainMove lists the sentences DescribeMove joins, most important first.
+func explainMove(p, next *abPosition, m *gotak.Move) []string {
+	mover, opp := p.toMove, next.toMove
+	before, after := p.grid(), next.grid()
+
+	if p.opening() {
+		return []string{fmt.Sprintf("On the first turn each player places the opponent's flat, so this puts %s's first stone on %s.", playerName(opp), m.Square)}
+	}
+
+	var out []string
+	if winner, over := next.result(after); over {
+		switch {
+		case winner == mover && after.hasRoad(mover):
+			out = append(out, "It completes a road and wins the game.")
+		case winner == mover:
+			out = append(out, "It ends the game with more flats on the board.")
+		case winner == opp && after.hasRoad(opp):
+			out = append(out, fmt.Sprintf("It completes a road for %s, who wins.", playerName(opp)))
+		case winner == opp:
+			out = append(out, fmt.Sprintf("It ends the game, and %s has more flats.", playerName(opp)))
+		default:
+			out = append(out, "It ends the game in a draw.")
+		}
+		return append(out, flatSwing(before, after, mover)...)
+	}
+
+	// What the opponent threatened before the move, and still does.
+	threatsBefore := roadThreats(p, opp)
+	threatsAfter := roadThreats(next, opp)
+	switch {
+	case len(threatsBefore) > 0 && len(threatsAfter) == 0:
+		out = append(out, fmt.Sprintf("It stops %s's road threat (%s).", playerName(opp), strings.Join(threatSquares(threatsBefore), ", ")))
+	case len(threatsAfter) > 0:
+		out = append(out, fmt.Sprintf("It leaves %s a road in one (%s).", playerName(opp), strings.Join(threatSquares(threatsAfter), ", ")))
+	}
+
+	// What the move threatens, if the opponent doesn't answer it.
+	if own := roadThreats(next, mover); len(own) > 0 && len(threatsAfter) == 0 {
+		squares := threatSquares(own)
+		switch {
+		case tinue(next, mover, own):
+			out = append(out, fmt.Sprintf("%s is in Tinuë: no reply stops every road (%s).", capitalize(playerName(opp)), strings.Join(squares, ", ")))
+		case len(squares) > 1:
+			out = append(out, fmt.Sprintf("It makes a double road threat at %s.", strings.Join(squares, " and ")))
+		default:
+			out = append(out, fmt.Sprintf("It threatens a road at %s.", squares[0]))
+		}
+	}
+
+	out = append(out, flatSwing(before, after, mover)...)
+	return append(out, pieceReason(p, before, after, m, mover)...)
+}
+
+// roadThreats lists player's moves that would complete a road if it were
+// their turn in p.
+func roadThreats(p *abPosition, player int) []*gotak.Move {
+	q := *p
+	q.toMove = player
+	if q.opening() || !roadPossible(&q, player) {
+		return nil
+	}
+	var out []*gotak.Move
+	for _, m := range q.moves() {
+		if wins(&q, m, player) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// roadPossible is a cheap filter: a road needs a stone of player's on
+// every square of a row or column, so player needs size of them once the
+// move is made.
+func roadPossible(p *abPosition, player int) bool {
+	stones := 0
+	for _, stack := range p.board.Squares {
+		for _, st := range stack {
+			if st.Player == player {
+				stones++
+			}
+		}
+	}
+	if p.stones[player]+p.caps[player] > 0 {
+		stones++
+	}
+	return stones >= int(p.board.Size)
+}
+
+// wins reports whether m gives player a road in p.
+func wins(p *abPosition, m *gotak.Move, player int) bool {
+	r, err := p.play(m)
+	return err == nil && r.grid().hasRoad(player)
+}
+
+// tinue reports whether every reply in p, where the defender is to move,
+// still leaves attacker a road in one. threats are attacker's current road
+// moves, tried first since most replies don't stop them.
+func tinue(p *abPosition, attacker int, threats []*gotak.Move) bool {
+	for _, reply := range p.moves() {
+		r, err := p.play(reply)
+		if err != nil {
+			continue
+		}
+		if winner, over := r.result(r.grid()); over {
+			if winner == attacker {
+				continue
+			}
+			return false
+		}
+		r.toMove = attacker
+		if !slices.ContainsFunc(threats, func(m *gotak.Move) bool { return wins(r, m, attacker) }) &&
+			!slices.ContainsFunc(r.moves(), func(m *gotak.Move) bool { return wins(r, m, attacker) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// threatSquares names threats by the square a placement would go on, or
+// by the move for stack moves, without repeats: a flat, wall or capstone
+// on the same square is one threat for the defender.
+func threatSquares(threats []*gotak.Move) []string {
+	var squares []string
+	for _, m := range threats {
+		sq := m.Square
+		if m.MoveDirection != "" {
+			sq = m.Text
+		}
+		if !slices.Contains(squares, sq) {
+			squares = append(squares, sq)
+		}
+	}
+	return squares
+}
+
+// flatSwing describes a change in the flat count from mover's side.
+func flatSwing(before, after *abGrid, mover int) []string {
+	opp := opponent(mover)
+	was := before.flats(mover) - before.flats(opp)
+	now := after.flats(mover) - after.flats(opp)
+	if was == now {
+		return nil
+	}
+	return []string{fmt.Sprintf("The flat count goes from %+d to %+d for %s.", was, now, playerName(mover))}
+}
+
+// pieceReason explains a capstone or wall placement, or a capstone
+// flattening a wall.
+func pieceReason(p *abPosition, before, after *abGrid, m *gotak.Move, mover int) []string {
+	opp := opponent(mover)
+	nextToOpp := func(gr *abGrid, i int) bool {
+		found := false
+		gr.neighbours(i, func(n int) { found = found || gr.road(n, opp) })
+		return found
+	}
+
+	if m.MoveDirection == "" {
+		i := after.index(m.Square)
+		switch m.Stone {
+		case gotak.StoneCap:
+			if nextToOpp(after, i) {
+				return []string{fmt.Sprintf("The capstone on %s counts for roads and can capture %s's flats next to it.", m.Square, playerName(opp))}
+			}
+			return []string{fmt.Sprintf("The capstone on %s counts for roads and can't be covered.", m.Square)}
+		case gotak.StoneStanding:
+			if nextToOpp(after, i) {
+				return []string{fmt.Sprintf("The wall on %s blocks %s's road through that square.", m.Square, playerName(opp))}
+			}
+			return []string{fmt.Sprintf("The wall on %s can't be covered, but doesn't count for roads.", m.Square)}
+		}
+		return nil
+	}
+
+	// A capstone moving alone onto a wall flattens it.
+	if stack := p.board.Squares[m.Square]; len(stack) > 0 && stack[len(stack)-1].Type == gotak.StoneCap {
+		end := m.Square
+		for range m.MoveDropCounts {
+			end = gotak.Translate(end, m.MoveDirection)
+		}
+		if i := before.index(end); i >= 0 && before.cells[i].kind == 'S' {
+			owner := "its own"
+			if before.cells[i].player == opp {
+				owner = playerName(opp) + "'s"
+			}
+			return []string{fmt.Sprintf("The capstone flattens %s wall on %s.", owner, end)}
+		}
+	}
+	return nil
+}
+
+func playerName(player int) string {
+	if player == gotak.PlayerBlack {
+		return "black"
+	}
+	return "white"
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,122 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+func TestDescribeMove(t *testing.T) {
+	tests := []struct {
+		name string
+		tps  string
+		move string
+		want []string
+		not  []string
+	}{
+		{
+			name: "opening",
+			tps:  "x5/x5/x5/x5/x5 1 1",
+			move: "a1",
+			want: []string{"black's first stone on a1"},
+		},
+		{
+			name: "road",
+			tps:  "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5",
+			move: "e1",
+			want: []string{"completes a road and wins"},
+		},
+		{
+			name: "block",
+			tps:  "x5/x5/x5/2,2,2,x2/1,1,1,1,x 2 5",
+			move: "Se1",
+			want: []string{"stops white's road threat (e1)", "wall on e1 blocks white's road"},
+		},
+		{
+			name: "ignored threat",
+			tps:  "x5/x5/x5/2,2,2,x2/1,1,1,1,x 2 5",
+			move: "e5",
+			want: []string{"leaves white a road in one (e1)"},
+		},
+		{
+			name: "threat",
+			tps:  "2,2,x2,2/x5/x5/x5/1,1,1,x2 1 4",
+			move: "d1",
+			want: []string{"threatens a road at e1", "flat count goes from +0 to +1 for white"},
+			not:  []string{"Tinuë"},
+		},
+		{
+			name: "tinue",
+			tps:  "2,2,x2,2/x5/x5/x3,1,x/1,1,1,x2 1 4",
+			move: "e2",
+			want: []string{"Black is in Tinuë", "d1", "c2"},
+		},
+		{
+			name: "capstone flattens wall",
+			tps:  "x5/x5/x2,1C,2S,x/x5/2,1,x3 1 3",
+			move: "c3>",
+			want: []string{"capstone flattens black's wall on d3"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DescribeMove(tpsGame(t, tc.tps), tc.move)
+			if err != nil {
+				t.Fatalf("DescribeMove: %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("%q missing %q", got, want)
+				}
+			}
+			for _, not := range tc.not {
+				if strings.Contains(got, not) {
+					t.Errorf("%q should not mention %q", got, not)
+				}
+			}
+		})
+	}
+}
+
+func TestDescribeMove_errors(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5")
+	if _, err := DescribeMove(g, "a1"); err == nil {
+		t.Error("a move onto an occupied square should fail")
+	}
+	if _, err := DescribeMove(g, "zz"); err == nil {
+		t.Error("bad PTN should fail")
+	}
+	over := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,1 2 5")
+	if _, err := DescribeMove(over, "e5"); !errors.Is(err, errGameOver) {
+		t.Errorf("err = %v, want errGameOver", err)
+	}
+}
+
+func TestExplainMove_describesPosition(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5")
+	for name, e := range map[string]Engine{"gotak": &AlphaBetaEngine{}, "taktician": &TakticianEngine{}} {
+		got, err := e.ExplainMove(context.Background(), g, AIConfig{Level: Beginner, TimeLimit: time.Second})
+		if err != nil {
+			t.Fatalf("%s: ExplainMove: %v", name, err)
+		}
+		if !strings.HasPrefix(got, name+" chose") || !strings.Contains(got, "completes a road") {
+			t.Errorf("%s explanation = %q", name, got)
+		}
+	}
+
+	// Games without a TPS tag are replayed from their moves.
+	g, err := gotak.NewGame(5, 1, "explain")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	if err := g.DoTurn("a1", "e5"); err != nil {
+		t.Fatalf("DoTurn: %v", err)
+	}
+	if got, err := DescribeMove(g, "Cc3"); err != nil || !strings.Contains(got, "capstone on c3") {
+		t.Errorf("DescribeMove = %q, %v", got, err)
+	}
+}
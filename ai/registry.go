@@ -0,0 +1,198 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// DefaultEngine is the registry name of the level-driven Taktician engine
+// the server used before engines were selectable.
+const DefaultEngine = "taktician"
+
+// NativeEngine is the registry name of AlphaBetaEngine.
+const NativeEngine = "gotak"
+
+var (
+	// ErrUnknownEngine is returned for a name that isn't registered.
+	ErrUnknownEngine = errors.New("unknown engine")
+	// ErrDuplicateEngine is returned when a name is registered twice.
+	ErrDuplicateEngine = errors.New("engine already registered")
+)
+
+// Capabilities describes what an engine can be asked to do.
+type Capabilities struct {
+	MinSize int64 `json:"min_size"`
+	MaxSize int64 `json:"max_size"`
+	// Komi is true when the engine plays with a komi setting.
+	Komi bool `json:"komi"`
+	// Analysis is true when the engine's choices are strong enough to
+	// judge other players' moves with.
+	Analysis bool `json:"analysis"`
+	// MultiPV is true when the engine can report several candidate moves
+	// from one search; others report only their best.
+	MultiPV bool `json:"multi_pv"`
+}
+
+// SupportsSize reports whether the engine plays on a size x size board.
+func (c Capabilities) SupportsSize(size int64) bool {
+	return size >= c.MinSize && size <= c.MaxSize
+}
+
+// EngineInfo is the public description of a registered engine.
+type EngineInfo struct {
+	Name         string       `json:"name"`
+	Description  string       `json:"description,omitempty"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+type registeredEngine struct {
+	info   EngineInfo
+	engine Engine
+}
+
+// Registry maps engine names to engines. It is safe for concurrent use.
+type Registry struct {
+	mu          sync.RWMutex
+	engines     map[string]registeredEngine
+	defaultName string
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{engines: map[string]registeredEngine{}}
+}
+
+// NewDefaultRegistry returns a registry holding the built-in Taktician
+// engines and AlphaBetaEngine, with DefaultEngine as the default.
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	builtin := []struct {
+		info EngineInfo
+		alg  Algorithm
+	}{
+		{EngineInfo{Name: DefaultEngine, Description: "Taktician, algorithm chosen by difficulty level"}, ""},
+		{EngineInfo{Name: string(AlgorithmRandom), Description: "Uniformly random legal moves"}, AlgorithmRandom},
+		{EngineInfo{Name: string(AlgorithmMinimax), Description: "Taktician alpha-beta, depth scaled by level"}, AlgorithmMinimax},
+		{EngineInfo{Name: string(AlgorithmMCTS), Description: "Taktician Monte Carlo tree search"}, AlgorithmMCTS},
+	}
+	for _, b := range builtin {
+		b.info.Capabilities = Capabilities{MinSize: 3, MaxSize: 8, Analysis: b.alg != AlgorithmRandom}
+		if err := r.Register(b.info, &TakticianEngine{Algorithm: b.alg}); err != nil {
+			panic(err)
+		}
+	}
+	native := EngineInfo{
+		Name:         NativeEngine,
+		Description:  "gotak's own alpha-beta search; style shapes its evaluation",
+		Capabilities: Capabilities{MinSize: 4, MaxSize: 9, Analysis: true, MultiPV: true},
+	}
+	if err := r.Register(native, &AlphaBetaEngine{}); err != nil {
+		panic(err)
+	}
+	if err := r.SetDefault(DefaultEngine); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Register adds e under info.Name. The first engine registered becomes the
+// default until SetDefault says otherwise.
+func (r *Registry) Register(info EngineInfo, e Engine) error {
+	if info.Name == "" {
+		return errors.New("engine name is required")
+	}
+	if e == nil {
+		return fmt.Errorf("engine %q is nil", info.Name)
+	}
+	if info.Capabilities.MinSize > info.Capabilities.MaxSize {
+		return fmt.Errorf("engine %q: min size %d is above max size %d",
+			info.Name, info.Capabilities.MinSize, info.Capabilities.MaxSize)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.engines[info.Name]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateEngine, info.Name)
+	}
+	r.engines[info.Name] = registeredEngine{info: info, engine: e}
+	if r.defaultName == "" {
+		r.defaultName = info.Name
+	}
+	return nil
+}
+
+// SetDefault picks the engine Get returns for an empty name.
+func (r *Registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.engines[name]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownEngine, name)
+	}
+	r.defaultName = name
+	return nil
+}
+
+// Default returns the name of the default engine.
+func (r *Registry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultName
+}
+
+// Get looks up an engine by name; "" means the default engine.
+func (r *Registry) Get(name string) (Engine, EngineInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultName
+	}
+	re, ok := r.engines[name]
+	if !ok {
+		return nil, EngineInfo{}, fmt.Errorf("%w: %q", ErrUnknownEngine, name)
+	}
+	return re.engine, re.info, nil
+}
+
+// List returns every registered engine, sorted by name.
+func (r *Registry) List() []EngineInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]EngineInfo, 0, len(r.engines))
+	for _, re := range r.engines {
+		out = append(out, re.info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// UseBook makes every registered engine play from book first, with opts
+// choosing among its moves. Engines registered afterwards don't use it.
+func (r *Registry) UseBook(book *Book, opts BookOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, re := range r.engines {
+		if b, ok := re.engine.(*BookEngine); ok {
+			re.engine = b.Engine
+		}
+		re.engine = &BookEngine{Engine: re.engine, Book: book, Options: opts}
+		r.engines[name] = re
+	}
+}
+
+// Close closes every engine that holds resources, such as TEI processes.
+func (r *Registry) Close() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var errs []error
+	for _, re := range r.engines {
+		if c, ok := re.engine.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close engine %q: %w", re.info.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	r := NewDefaultRegistry()
+	if r.Default() != DefaultEngine {
+		t.Errorf("default = %q, want %q", r.Default(), DefaultEngine)
+	}
+
+	var names []string
+	for _, info := range r.List() {
+		names = append(names, info.Name)
+	}
+	want := []string{"gotak", "mcts", "minimax", "random", "taktician"}
+	if len(names) != len(want) {
+		t.Fatalf("engines = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("engines = %v, want %v", names, want)
+		}
+	}
+
+	_, info, err := r.Get("random")
+	if err != nil {
+		t.Fatalf("Get(random): %v", err)
+	}
+	if info.Capabilities.Analysis {
+		t.Error("random should not be offered for analysis")
+	}
+	if !info.Capabilities.SupportsSize(5) || info.Capabilities.SupportsSize(9) {
+		t.Errorf("random sizes = %+v", info.Capabilities)
+	}
+
+	if _, _, err := r.Get("nope"); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("Get(nope) err = %v, want ErrUnknownEngine", err)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+	if _, _, err := r.Get(""); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("empty registry Get err = %v", err)
+	}
+
+	caps := Capabilities{MinSize: 5, MaxSize: 6}
+	if err := r.Register(EngineInfo{Name: "a", Capabilities: caps}, &TakticianEngine{}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := r.Register(EngineInfo{Name: "a", Capabilities: caps}, &TakticianEngine{}); !errors.Is(err, ErrDuplicateEngine) {
+		t.Errorf("duplicate err = %v", err)
+	}
+	if err := r.Register(EngineInfo{Name: "b", Capabilities: Capabilities{MinSize: 7, MaxSize: 4}}, &TakticianEngine{}); err == nil {
+		t.Error("expected an error for inverted sizes")
+	}
+	if err := r.Register(EngineInfo{Name: "c", Capabilities: caps}, nil); err == nil {
+		t.Error("expected an error for a nil engine")
+	}
+	if _, info, err := r.Get(""); err != nil || info.Name != "a" {
+		t.Errorf("Get(\"\") = %+v, %v; first engine should be the default", info, err)
+	}
+	if err := r.SetDefault("zzz"); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("SetDefault err = %v", err)
+	}
+}
+
+func TestPinnedTakticianAlgorithms(t *testing.T) {
+	game, err := gotak.NewGame(5, 1, "pinned")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	cfg := AIConfig{Level: Intermediate, TimeLimit: 200 * time.Millisecond}
+	for _, alg := range []Algorithm{AlgorithmRandom, AlgorithmMinimax, AlgorithmMCTS} {
+		move, err := (&TakticianEngine{Algorithm: alg}).GetMove(context.Background(), game, cfg)
+		if err != nil {
+			t.Errorf("%s: %v", alg, err)
+			continue
+		}
+		if _, err := gotak.NewMove(move); err != nil {
+			t.Errorf("%s returned bad move %q: %v", alg, move, err)
+		}
+	}
+	if _, err := (&TakticianEngine{Algorithm: "alphazero"}).GetMove(context.Background(), game, cfg); err == nil {
+		t.Error("expected an error for an unknown algorithm")
+	}
+}
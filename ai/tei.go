@@ -0,0 +1,456 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+const (
+	// teiHandshakeTimeout bounds engine startup (tei/teiok) and isready.
+	teiHandshakeTimeout = 10 * time.Second
+	// teiStopOverhead is how long past the requested move time we wait
+	// before telling the engine to stop.
+	teiStopOverhead = 500 * time.Millisecond
+	// teiStopGrace is how long an engine gets to answer stop with a
+	// bestmove before it is killed.
+	teiStopGrace = time.Second
+)
+
+var (
+	errTEIExited = errors.New("tei engine exited")
+	errTEIHung   = errors.New("tei engine did not answer stop and was killed")
+)
+
+// TEIEngine drives an external engine (Tiltak, Topaz, ...) over the Tak
+// Engine Interface, the UCI-like text protocol on the engine's stdin and
+// stdout. The process is started on first use and kept running between
+// searches; if it dies it is restarted on the next call. Searches are
+// serialized.
+type TEIEngine struct {
+	Path string
+	Args []string
+	// Env is appended to the server's environment for the engine process.
+	Env []string
+	// Options are sent as "setoption name <k> value <v>" after the
+	// handshake, e.g. {"HalfKomi": "4"}.
+	Options map[string]string
+
+	mu   sync.Mutex
+	proc *teiProcess
+}
+
+type teiProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines <-chan string // closed once the engine's stdout ends
+	name  string
+
+	// The game the engine last saw teinewgame for.
+	size int64
+	slug string
+}
+
+// GetMove returns the engine's best move as PTN.
+func (e *TEIEngine) GetMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error) {
+	res, err := e.Search(ctx, g, cfg)
+	if err != nil {
+		return "", err
+	}
+	return res.BestMove, nil
+}
+
+// Analyze is Search; TEI engines report score, depth, nodes and PV.
+func (e *TEIEngine) Analyze(ctx context.Context, g *gotak.Game, cfg AIConfig) (*SearchResult, error) {
+	return e.Search(ctx, g, cfg)
+}
+
+// ExplainMove searches the position and describes the engine's evaluation
+// and what its move does.
+func (e *TEIEngine) ExplainMove(ctx context.Context, g *gotak.Game, cfg AIConfig) (string, error) {
+	res, err := e.Search(ctx, g, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	name := e.Name()
+	if name == "" {
+		name = "TEI engine"
+	}
+	return explainSearch(name, g, res), nil
+}
+
+// describeSearch puts a search result into words for players.
+func describeSearch(name string, res *SearchResult) string {
+	parts := []string{fmt.Sprintf("%s chose %s", name, res.BestMove)}
+	switch {
+	case res.Info.Mate > 0:
+		parts = append(parts, fmt.Sprintf("and sees a forced win in %d", res.Info.Mate))
+	case res.Info.Mate < 0:
+		parts = append(parts, fmt.Sprintf("but sees a forced loss in %d", -res.Info.Mate))
+	case res.Info.Depth > 0:
+		parts = append(parts, fmt.Sprintf("with an evaluation of %+.2f flats", float64(res.Info.ScoreCP)/100))
+	}
+	if res.Info.Depth > 0 {
+		parts = append(parts, fmt.Sprintf("at depth %d", res.Info.Depth))
+	}
+	if len(res.Info.PV) > 1 {
+		parts = append(parts, fmt.Sprintf("(expected line: %s)", strings.Join(res.Info.PV, " ")))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Name is the engine's self-reported "id name", once it has started.
+func (e *TEIEngine) Name() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.proc == nil {
+		return ""
+	}
+	return e.proc.name
+}
+
+// Search sends the game's position and searches for cfg.Nodes nodes or,
+// without a node budget, for cfg.TimeLimit (or a level-based default).
+// Cancelling ctx stops the search early; the engine is killed if it
+// ignores stop.
+func (e *TEIEngine) Search(ctx context.Context, g *gotak.Game, cfg AIConfig) (*SearchResult, error) {
+	if g == nil || g.Board == nil {
+		return nil, fmt.Errorf("game cannot be nil")
+	}
+	position, err := teiPosition(g)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.proc == nil {
+		if e.proc, err = e.start(ctx); err != nil {
+			return nil, err
+		}
+	}
+	p := e.proc
+
+	if p.size != g.Board.Size || p.slug != g.Slug {
+		if err := p.send(fmt.Sprintf("teinewgame %d", g.Board.Size)); err != nil {
+			return nil, e.fail(err)
+		}
+		p.size, p.slug = g.Board.Size, g.Slug
+	}
+	if err := p.send("isready"); err != nil {
+		return nil, e.fail(err)
+	}
+	if _, err := p.await(ctx, "readyok", teiHandshakeTimeout); err != nil {
+		return nil, e.fail(err)
+	}
+
+	moveTime := searchTime(cfg)
+	if err := p.send(position); err != nil {
+		return nil, e.fail(err)
+	}
+	goCmd := fmt.Sprintf("go movetime %d", moveTime.Milliseconds())
+	if cfg.Nodes > 0 {
+		goCmd = fmt.Sprintf("go nodes %d", cfg.Nodes)
+	}
+	if err := p.send(goCmd); err != nil {
+		return nil, e.fail(err)
+	}
+
+	res := &SearchResult{}
+	// A node-limited search runs until the engine finishes or ctx ends.
+	var deadline <-chan time.Time
+	if cfg.Nodes == 0 {
+		timer := time.NewTimer(moveTime + teiStopOverhead)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	var grace <-chan time.Time
+	done := ctx.Done()
+	stop := func() {
+		if grace == nil {
+			_ = p.send("stop")
+			grace = time.After(teiStopGrace)
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return nil, e.fail(errTEIExited)
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "info":
+				if info, ok := parseTEIInfo(fields[1:]); ok {
+					res.Info = info
+				}
+			case "bestmove":
+				if len(fields) < 2 {
+					return nil, fmt.Errorf("tei engine sent %q", line)
+				}
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				if _, err := gotak.NewMove(fields[1]); err != nil {
+					return nil, fmt.Errorf("tei engine returned invalid move %q: %w", fields[1], err)
+				}
+				res.BestMove = fields[1]
+				return res, nil
+			}
+		case <-done:
+			done = nil
+			stop()
+		case <-deadline:
+			stop()
+		case <-grace:
+			e.kill()
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return nil, errTEIHung
+		}
+	}
+}
+
+// Close asks the engine to quit, killing it if it doesn't.
+func (e *TEIEngine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.proc == nil {
+		return nil
+	}
+	_ = e.proc.send("quit")
+	select {
+	case <-drain(e.proc.lines):
+	case <-time.After(teiStopGrace):
+	}
+	e.kill()
+	return nil
+}
+
+func (e *TEIEngine) start(ctx context.Context) (*teiProcess, error) {
+	if e.Path == "" {
+		return nil, errors.New("tei engine path is empty")
+	}
+	// Not CommandContext: the process outlives this call.
+	cmd := exec.Command(e.Path, e.Args...) // #nosec G204 -- engines come from server config
+	cmd.Env = append(os.Environ(), e.Env...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start tei engine %s: %w", e.Path, err)
+	}
+
+	lines := make(chan string, 64)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		_ = cmd.Wait()
+	}()
+
+	p := &teiProcess{cmd: cmd, stdin: stdin, lines: lines}
+	fail := func(err error) (*teiProcess, error) {
+		_ = cmd.Process.Kill()
+		return nil, fmt.Errorf("tei handshake with %s: %w", e.Path, err)
+	}
+
+	if err := p.send("tei"); err != nil {
+		return fail(err)
+	}
+	ids, err := p.await(ctx, "teiok", teiHandshakeTimeout)
+	if err != nil {
+		return fail(err)
+	}
+	for _, line := range ids {
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			p.name = strings.TrimSpace(name)
+		}
+	}
+	for k, v := range e.Options {
+		if err := p.send(fmt.Sprintf("setoption name %s value %s", k, v)); err != nil {
+			return fail(err)
+		}
+	}
+	return p, nil
+}
+
+// fail discards a process that stopped behaving and passes err through.
+func (e *TEIEngine) fail(err error) error {
+	e.kill()
+	return err
+}
+
+func (e *TEIEngine) kill() {
+	if e.proc == nil {
+		return
+	}
+	_ = e.proc.stdin.Close()
+	_ = e.proc.cmd.Process.Kill()
+	e.proc = nil
+}
+
+func (p *teiProcess) send(line string) error {
+	_, err := io.WriteString(p.stdin, line+"\n")
+	return err
+}
+
+// await reads until a line equal to want and returns the lines before it.
+func (p *teiProcess) await(ctx context.Context, want string, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var seen []string
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return nil, errTEIExited
+			}
+			line = strings.TrimSpace(line)
+			if line == want {
+				return seen, nil
+			}
+			seen = append(seen, line)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, fmt.Errorf("timed out waiting for %q", want)
+		}
+	}
+}
+
+// drain discards lines until the channel closes.
+func drain(lines <-chan string) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		for range lines {
+		}
+		close(done)
+	}()
+	return done
+}
+
+// teiPosition builds the position command: the starting position as TPS
+// (the game's TPS tag, or an empty board) followed by every move played.
+func teiPosition(g *gotak.Game) (string, error) {
+	start, err := g.GetMeta("TPS")
+	if err != nil || start == "" {
+		empty := &gotak.Board{Size: g.Board.Size}
+		if err := empty.Init(); err != nil {
+			return "", err
+		}
+		start = empty.TPS(gotak.PlayerWhite, 1)
+	}
+
+	var moves []string
+	for _, turn := range g.Turns {
+		for _, mv := range []*gotak.Move{turn.First, turn.Second} {
+			if mv != nil {
+				moves = append(moves, mv.Text)
+			}
+		}
+	}
+
+	cmd := "position tps " + start
+	if len(moves) > 0 {
+		cmd += " moves " + strings.Join(moves, " ")
+	}
+	return cmd, nil
+}
+
+// searchTime is cfg.TimeLimit, or a per-level default when unset.
+func searchTime(cfg AIConfig) time.Duration {
+	if cfg.TimeLimit > 0 {
+		return cfg.TimeLimit
+	}
+	switch cfg.Level {
+	case Beginner:
+		return 100 * time.Millisecond
+	case Intermediate:
+		return 500 * time.Millisecond
+	case Advanced:
+		return 2 * time.Second
+	default:
+		return 5 * time.Second
+	}
+}
+
+// parseTEIInfo parses the fields after "info". Lines without a score or
+// PV (e.g. "info string ...") report ok=false.
+func parseTEIInfo(fields []string) (SearchInfo, bool) {
+	var info SearchInfo
+	useful := false
+	for i := 0; i < len(fields); i++ {
+		next := func() (int64, bool) {
+			if i+1 >= len(fields) {
+				return 0, false
+			}
+			i++
+			n, err := strconv.ParseInt(fields[i], 10, 64)
+			return n, err == nil
+		}
+		switch fields[i] {
+		case "depth":
+			if n, ok := next(); ok {
+				info.Depth = int(n)
+			}
+		case "seldepth":
+			if n, ok := next(); ok {
+				info.SelDepth = int(n)
+			}
+		case "nodes":
+			if n, ok := next(); ok {
+				info.Nodes = n
+			}
+		case "time":
+			if n, ok := next(); ok {
+				info.Time = time.Duration(n) * time.Millisecond
+			}
+		case "score":
+			if i+2 >= len(fields) {
+				continue
+			}
+			kind := fields[i+1]
+			i++
+			if n, ok := next(); ok {
+				switch kind {
+				case "cp":
+					info.ScoreCP, useful = int(n), true
+				case "mate":
+					info.Mate, useful = int(n), true
+				}
+			}
+		case "pv":
+			info.PV = append([]string(nil), fields[i+1:]...)
+			useful = useful || len(info.PV) > 0
+			i = len(fields)
+		case "string":
+			return info, false
+		}
+	}
+	return info, useful
+}
@@ -0,0 +1,271 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+// TestMain doubles as a scripted TEI engine: when GOTAK_FAKE_TEI is set the
+// test binary speaks TEI on stdin/stdout instead of running tests.
+func TestMain(m *testing.M) {
+	if mode := os.Getenv("GOTAK_FAKE_TEI"); mode != "" {
+		runFakeTEI(mode)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeTEI modes:
+//
+//	play     answers go with two info lines and GOTAK_FAKE_TEI_MOVE
+//	ponder   searches until told to stop
+//	stubborn ignores stop
+//	crash    exits when asked to search
+//
+// Every command received is appended to GOTAK_FAKE_TEI_LOG.
+func runFakeTEI(mode string) {
+	move := os.Getenv("GOTAK_FAKE_TEI_MOVE")
+	if move == "" {
+		move = "a1"
+	}
+	var log *os.File
+	if path := os.Getenv("GOTAK_FAKE_TEI_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err == nil {
+			log = f
+			defer func() { _ = f.Close() }()
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	say := func(format string, args ...any) {
+		fmt.Fprintf(out, format+"\n", args...)
+		_ = out.Flush()
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	for in.Scan() {
+		line := in.Text()
+		if log != nil {
+			fmt.Fprintln(log, line)
+		}
+		switch cmd, _, _ := strings.Cut(line, " "); cmd {
+		case "tei":
+			say("id name FakeTEI")
+			say("id author gotak tests")
+			say("option name HalfKomi type spin default 0 min -10 max 10")
+			say("teiok")
+		case "isready":
+			say("readyok")
+		case "go":
+			switch mode {
+			case "play":
+				say("info string thinking")
+				say("info depth 1 score cp 10 nodes 5 time 1 pv %s", move)
+				say("info depth 2 seldepth 3 score cp 25 nodes 40 time 2 pv %s e5", move)
+				say("bestmove %s", move)
+			case "crash":
+				os.Exit(3)
+			}
+		case "stop":
+			if mode == "ponder" {
+				say("info depth 9 score mate 2 pv %s", move)
+				say("bestmove %s", move)
+			}
+		case "quit":
+			return
+		}
+	}
+}
+
+func fakeTEIEngine(t *testing.T, mode string) (*TEIEngine, string) {
+	t.Helper()
+	logPath := filepath.Join(t.TempDir(), "tei.log")
+	e := &TEIEngine{
+		Path:    os.Args[0],
+		Args:    []string{"-test.run=^$"},
+		Env:     []string{"GOTAK_FAKE_TEI=" + mode, "GOTAK_FAKE_TEI_MOVE=c3", "GOTAK_FAKE_TEI_LOG=" + logPath},
+		Options: map[string]string{"HalfKomi": "4"},
+	}
+	t.Cleanup(func() { _ = e.Close() })
+	return e, logPath
+}
+
+func readTEILog(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path) // #nosec G304 -- test temp file
+	if err != nil {
+		t.Fatalf("read engine log: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func teiTestGame(t *testing.T) *gotak.Game {
+	t.Helper()
+	g, err := gotak.NewGame(5, 1, "tei-test")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	if err := g.DoTurn("a1", "e5"); err != nil {
+		t.Fatalf("DoTurn: %v", err)
+	}
+	return g
+}
+
+func TestTEIEngine_Search(t *testing.T) {
+	e, logPath := fakeTEIEngine(t, "play")
+	g := teiTestGame(t)
+
+	res, err := e.Search(context.Background(), g, AIConfig{Level: Intermediate, TimeLimit: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if res.BestMove != "c3" {
+		t.Errorf("best move = %q, want c3", res.BestMove)
+	}
+	want := SearchInfo{Depth: 2, SelDepth: 3, ScoreCP: 25, Nodes: 40, Time: 2 * time.Millisecond, PV: []string{"c3", "e5"}}
+	if !reflect.DeepEqual(res.Info, want) {
+		t.Errorf("info = %+v, want %+v", res.Info, want)
+	}
+	if e.Name() != "FakeTEI" {
+		t.Errorf("name = %q, want FakeTEI", e.Name())
+	}
+
+	// A second search of the same game reuses the process without a new
+	// teinewgame.
+	if _, err := e.GetMove(context.Background(), g, AIConfig{TimeLimit: 100 * time.Millisecond}); err != nil {
+		t.Fatalf("GetMove: %v", err)
+	}
+	if _, err := e.GetMove(context.Background(), g, AIConfig{TimeLimit: 100 * time.Millisecond, Nodes: 5000}); err != nil {
+		t.Fatalf("GetMove with a node budget: %v", err)
+	}
+
+	got := readTEILog(t, logPath)
+	wantLog := []string{
+		"tei",
+		"setoption name HalfKomi value 4",
+		"teinewgame 5",
+		"isready",
+		"position tps x5/x5/x5/x5/x5 1 1 moves a1 e5",
+		"go movetime 200",
+		"isready",
+		"position tps x5/x5/x5/x5/x5 1 1 moves a1 e5",
+		"go movetime 100",
+		"isready",
+		"position tps x5/x5/x5/x5/x5 1 1 moves a1 e5",
+		"go nodes 5000",
+	}
+	if !reflect.DeepEqual(got, wantLog) {
+		t.Errorf("engine received:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(wantLog, "\n"))
+	}
+}
+
+func TestTEIEngine_ExplainMove(t *testing.T) {
+	e, _ := fakeTEIEngine(t, "play")
+	got, err := e.ExplainMove(context.Background(), teiTestGame(t), AIConfig{TimeLimit: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("ExplainMove: %v", err)
+	}
+	for _, want := range []string{"FakeTEI chose c3", "+0.25 flats", "depth 2", "c3 e5"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("explanation %q missing %q", got, want)
+		}
+	}
+}
+
+func TestTEIEngine_TimeLimitStopsSearch(t *testing.T) {
+	e, logPath := fakeTEIEngine(t, "ponder")
+
+	start := time.Now()
+	res, err := e.Search(context.Background(), teiTestGame(t), AIConfig{TimeLimit: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond+teiStopOverhead+teiStopGrace {
+		t.Errorf("search took %v", elapsed)
+	}
+	if res.BestMove != "c3" || res.Info.Mate != 2 {
+		t.Errorf("result = %+v, want c3 with mate 2", res)
+	}
+	log := readTEILog(t, logPath)
+	if log[len(log)-1] != "stop" {
+		t.Errorf("last command = %q, want stop", log[len(log)-1])
+	}
+}
+
+func TestTEIEngine_ContextCancel(t *testing.T) {
+	e, _ := fakeTEIEngine(t, "ponder")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := e.Search(ctx, teiTestGame(t), AIConfig{TimeLimit: time.Minute})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled search took %v", elapsed)
+	}
+
+	// The engine answered stop, so it stays usable.
+	if _, err := e.Search(context.Background(), teiTestGame(t), AIConfig{TimeLimit: 10 * time.Millisecond}); err != nil {
+		t.Errorf("search after cancel: %v", err)
+	}
+}
+
+func TestTEIEngine_KillsUnresponsiveEngine(t *testing.T) {
+	e, _ := fakeTEIEngine(t, "stubborn")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := e.Search(ctx, teiTestGame(t), AIConfig{TimeLimit: time.Minute}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if e.Name() != "" {
+		t.Error("unresponsive engine should have been discarded")
+	}
+}
+
+func TestTEIEngine_Crash(t *testing.T) {
+	e, _ := fakeTEIEngine(t, "crash")
+	if _, err := e.GetMove(context.Background(), teiTestGame(t), AIConfig{}); !errors.Is(err, errTEIExited) {
+		t.Errorf("err = %v, want errTEIExited", err)
+	}
+}
+
+func TestTEIEngine_MissingBinary(t *testing.T) {
+	e := &TEIEngine{Path: filepath.Join(t.TempDir(), "no-such-engine")}
+	if _, err := e.GetMove(context.Background(), teiTestGame(t), AIConfig{}); err == nil {
+		t.Error("expected an error for a missing engine binary")
+	}
+}
+
+func TestParseTEIInfo(t *testing.T) {
+	tests := []struct {
+		line string
+		want SearchInfo
+		ok   bool
+	}{
+		{"depth 4 score cp -35 nodes 1000 pv a1 b2 c3", SearchInfo{Depth: 4, ScoreCP: -35, Nodes: 1000, PV: []string{"a1", "b2", "c3"}}, true},
+		{"depth 7 score mate -3 time 150", SearchInfo{Depth: 7, Mate: -3, Time: 150 * time.Millisecond}, true},
+		{"string hello there", SearchInfo{}, false},
+		{"depth 3 nodes 12", SearchInfo{Depth: 3, Nodes: 12}, false},
+		{"depth x score", SearchInfo{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTEIInfo(strings.Fields(tt.line))
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTEIInfo(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnalyzeGame queues a move-by-move analysis of a game. The job comes back
+// already Finished when the analysis was cached.
+func (c *Client) AnalyzeGame(ctx context.Context, slug string, req AnalyzeRequest) (*AnalysisJobResponse, error) {
+	var out AnalysisJobResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/analyze/game/%s", slug), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AnalysisJob fetches an analysis job.
+func (c *Client) AnalysisJob(ctx context.Context, id string) (*AnalysisJobResponse, error) {
+	var out AnalysisJobResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/analyze/jobs/%s", id)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelAnalysisJob cancels a queued or running analysis job.
+func (c *Client) CancelAnalysisJob(ctx context.Context, id string) (*AnalysisJobResponse, error) {
+	var out AnalysisJobResponse
+	if err := c.do(ctx, request{method: http.MethodDelete, path: pathf("/analyze/jobs/%s", id)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WaitForAnalysis polls an analysis job every interval until it finishes
+// or ctx ends.
+func (c *Client) WaitForAnalysis(ctx context.Context, id string, interval time.Duration) (*AnalysisJobResponse, error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		job, err := c.AnalysisJob(ctx, id)
+		if err != nil || job.Finished() {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// AnalyzePosition asks the engine for its best moves in a position.
+func (c *Client) AnalyzePosition(ctx context.Context, req PositionAnalyzeRequest) (*PositionAnalysisResponse, error) {
+	var out PositionAnalysisResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/analyze/position"), body: req, idempotent: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PositionAnalysis asks the engine for its multiPV best moves after a turn
+// of a game (0 or less for the server's default of one).
+func (c *Client) PositionAnalysis(ctx context.Context, slug string, turn int64, multiPV int, req AnalyzeRequest) (*PositionAnalysisResponse, error) {
+	query := url.Values{}
+	if multiPV > 0 {
+		query.Set("multi_pv", strconv.Itoa(multiPV))
+	}
+	for k, v := range map[string]string{"engine": req.Engine, "level": req.Level, "style": req.Style} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if req.TimeLimit > 0 {
+		query.Set("time_limit", req.TimeLimit.String())
+	}
+	if req.Seed != 0 {
+		query.Set("seed", strconv.FormatInt(req.Seed, 10))
+	}
+	if req.Nodes > 0 {
+		query.Set("nodes", strconv.FormatInt(req.Nodes, 10))
+	}
+	var out PositionAnalysisResponse
+	path := pathf("/game/%s/position/%d/analysis", slug, turn)
+	if err := c.do(ctx, request{method: http.MethodGet, path: path, query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Openings fetches the moves played after the opening prefix in recorded
+// games; no prefix gives the first moves.
+func (c *Client) Openings(ctx context.Context, prefix ...string) (*OpeningsResponse, error) {
+	query := url.Values{}
+	if len(prefix) > 0 {
+		query.Set("prefix", strings.Join(prefix, ","))
+	}
+	var out OpeningsResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/analyze/openings"), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Register creates an account. Log in with Login afterwards.
+func (c *Client) Register(ctx context.Context, req RegisterRequest) error {
+	return c.do(ctx, request{method: http.MethodPost, path: pathf("/auth/register"), body: req, noRefresh: true}, nil)
+}
+
+// Login starts a session and makes the client use it.
+func (c *Client) Login(ctx context.Context, email, password string) (*AuthResponse, error) {
+	var out AuthResponse
+	body := map[string]string{"email": email, "password": password}
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/auth/login"), body: body, noRefresh: true}, &out); err != nil {
+		return nil, err
+	}
+	c.SetTokens(Tokens{Access: out.Token, Refresh: out.RefreshToken, ExpiresAt: out.ExpiresAt})
+	return &out, nil
+}
+
+// Refresh renews the access token now rather than when the server next
+// rejects it.
+func (c *Client) Refresh(ctx context.Context) error {
+	return c.refresh(ctx, c.Tokens().Access)
+}
+
+// Logout ends the session and forgets its tokens.
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.do(ctx, request{method: http.MethodPost, path: pathf("/auth/logout")}, nil)
+	c.SetTokens(Tokens{})
+	return err
+}
+
+// LogoutAll ends every session of the user, this one included, and
+// reports how many were revoked.
+func (c *Client) LogoutAll(ctx context.Context) (int64, error) {
+	var out LogoutAllResponse
+	err := c.do(ctx, request{method: http.MethodPost, path: pathf("/auth/logout-all")}, &out)
+	c.SetTokens(Tokens{})
+	return out.Revoked, err
+}
+
+// Profile fetches the signed-in user.
+func (c *Client) Profile(ctx context.Context) (*User, error) {
+	var out User
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/auth/profile")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateProfile changes the signed-in user's profile.
+func (c *Client) UpdateProfile(ctx context.Context, req UpdateProfileRequest) (*User, error) {
+	var out User
+	if err := c.do(ctx, request{method: http.MethodPut, path: pathf("/auth/profile"), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RequestPasswordReset asks for a password reset for email.
+func (c *Client) RequestPasswordReset(ctx context.Context, email string) (*ResetPasswordResponse, error) {
+	var out ResetPasswordResponse
+	body := map[string]string{"email": email}
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/auth/reset-password"), body: body, noRefresh: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConfirmPasswordReset sets a new password with a reset token.
+func (c *Client) ConfirmPasswordReset(ctx context.Context, token, newPassword string) error {
+	body := map[string]string{"token": token, "new_password": newPassword}
+	return c.do(ctx, request{method: http.MethodPost, path: pathf("/auth/confirm-reset"), body: body, noRefresh: true}, nil)
+}
+
+// CreateAPIToken mints a personal API token. Its secret is only in this
+// response.
+func (c *Client) CreateAPIToken(ctx context.Context, req CreateAPITokenRequest) (*CreateAPITokenResponse, error) {
+	var out CreateAPITokenResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/auth/tokens"), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// APITokens lists the user's API tokens.
+func (c *Client) APITokens(ctx context.Context) ([]APITokenResponse, error) {
+	var out []APITokenResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/auth/tokens")}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RevokeAPIToken revokes an API token.
+func (c *Client) RevokeAPIToken(ctx context.Context, id int64) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: pathf("/auth/tokens/%d", id)}, nil)
+}
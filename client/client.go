@@ -0,0 +1,371 @@
+// Package client is a Go client for the gotak server API.
+//
+// A Client sends every request under the server's /v1 API with the
+// caller's context. It attaches the current access token, swaps an
+// expired one for a new pair using the refresh token, and retries requests
+// that are safe to repeat when the server is briefly unavailable or rate
+// limits them. Errors from the server are returned as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the public gotak server.
+const DefaultBaseURL = "https://gotak.app"
+
+// apiPrefix is the API version the client speaks.
+const apiPrefix = "/v1"
+
+const (
+	defaultRetries   = 2
+	defaultRetryWait = 250 * time.Millisecond
+	maxRetryWait     = 10 * time.Second
+)
+
+// ErrSessionEnded means the server rejected the refresh token, so the
+// user has to log in again. The client forgets its tokens when it happens.
+var ErrSessionEnded = errors.New("session ended, please log in again")
+
+// Tokens are the credentials a Client sends. Access is a JWT access token
+// or a personal API token; Refresh, when set, renews Access when the
+// server rejects it.
+type Tokens struct {
+	Access    string
+	Refresh   string
+	ExpiresAt time.Time
+}
+
+// Client calls the gotak API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+	retries    int
+	retryWait  time.Duration
+	onTokens   func(Tokens)
+
+	mu     sync.Mutex
+	tokens Tokens
+	// refreshMu serializes refreshes: the server ends a session whose
+	// refresh token is used twice.
+	refreshMu sync.Mutex
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends requests through hc instead of a default client
+// with a 30 second timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithTokens starts the client with saved credentials.
+func WithTokens(t Tokens) Option {
+	return func(c *Client) { c.tokens = t }
+}
+
+// WithAPIToken authenticates with a personal API token (gtk_...).
+func WithAPIToken(token string) Option {
+	return func(c *Client) { c.tokens = Tokens{Access: token} }
+}
+
+// WithTokenHandler calls fn whenever the client's tokens change: after a
+// login or refresh, and with zero Tokens after a logout or when the
+// session ends. Use it to persist credentials.
+func WithTokenHandler(fn func(Tokens)) Option {
+	return func(c *Client) { c.onTokens = fn }
+}
+
+// WithRetries sets how many times a request that is safe to repeat is
+// retried after a network error, a 429 or a 502, 503 or 504. The default
+// is 2; 0 disables retries.
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = max(n, 0) }
+}
+
+// WithUserAgent sets the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// New returns a client for the server at baseURL, e.g. DefaultBaseURL or
+// "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		userAgent:  "gotak-client",
+		retries:    defaultRetries,
+		retryWait:  defaultRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// BaseURL is the server the client talks to.
+func (c *Client) BaseURL() string { return c.baseURL }
+
+// Tokens returns the client's current credentials.
+func (c *Client) Tokens() Tokens {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// SetTokens replaces the client's credentials.
+func (c *Client) SetTokens(t Tokens) {
+	c.mu.Lock()
+	c.tokens = t
+	c.mu.Unlock()
+	c.notifyTokens(t)
+}
+
+func (c *Client) notifyTokens(t Tokens) {
+	if c.onTokens != nil {
+		c.onTokens(t)
+	}
+}
+
+// Error is an error response from the server, an RFC 7807 problem.
+type Error struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+	Problem
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Problem.Error
+	}
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("gotak: %s (%d %s)", msg, e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("gotak: %s (%d)", msg, e.StatusCode)
+}
+
+// ErrorCode is the problem code of err if it is an *Error, and "" if not.
+func ErrorCode(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// request is one API call.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// idempotent marks a request that can be sent again without effect,
+	// so it may be retried. GET, PUT and DELETE always are.
+	idempotent bool
+	// noRefresh skips the refresh-and-retry on a 401, for the calls that
+	// create or renew a session.
+	noRefresh bool
+	// retryRateLimited retries a request that isn't idempotent after a
+	// 429: the server turned it away before handling it.
+	retryRateLimited bool
+}
+
+// do sends req and decodes the response into out. out may be nil to
+// discard the body, or a *string to keep it as text.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return fmt.Errorf("gotak: encode request: %w", err)
+		}
+	}
+
+	token := c.Tokens().Access
+	resp, err := c.send(ctx, req, body, token)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && token != "" && !req.noRefresh {
+		_ = resp.Body.Close()
+		if err := c.refresh(ctx, token); err != nil {
+			return err
+		}
+		if resp, err = c.send(ctx, req, body, c.Tokens().Access); err != nil {
+			return err
+		}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 400 {
+		return decodeError(resp)
+	}
+	switch out := out.(type) {
+	case nil:
+		_, _ = io.Copy(io.Discard, resp.Body)
+	case *string:
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("gotak: read response: %w", err)
+		}
+		*out = string(b)
+	default:
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("gotak: decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// send makes the HTTP request, retrying it while it is safe and worth it.
+// The caller closes the response body.
+func (c *Client) send(ctx context.Context, req request, body []byte, token string) (*http.Response, error) {
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	retryable := req.idempotent || req.method == http.MethodGet || req.method == http.MethodPut || req.method == http.MethodDelete
+
+	for attempt := 0; ; attempt++ {
+		hr, err := http.NewRequestWithContext(ctx, req.method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("gotak: %w", err)
+		}
+		hr.Header.Set("Accept", "application/json")
+		hr.Header.Set("User-Agent", c.userAgent)
+		if body != nil {
+			hr.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			hr.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := c.httpClient.Do(hr)
+		rateLimited := err == nil && resp.StatusCode == http.StatusTooManyRequests
+		if !(retryable || req.retryRateLimited && rateLimited) || attempt >= c.retries || !shouldRetry(resp, err) {
+			if err != nil {
+				return nil, fmt.Errorf("gotak: %s %s: %w", req.method, req.path, err)
+			}
+			return resp, nil
+		}
+
+		wait := c.retryDelay(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("gotak: %s %s: %w", req.method, req.path, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// shouldRetry reports whether a response or error is worth another try.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay is how long to wait before retry attempt+1: what the server
+// asked for in Retry-After, or an exponential backoff with jitter.
+func (c *Client) retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if s := resp.Header.Get("Retry-After"); s != "" {
+			if secs, err := strconv.Atoi(s); err == nil && secs >= 0 {
+				return min(time.Duration(secs)*time.Second, maxRetryWait)
+			}
+			if at, err := http.ParseTime(s); err == nil {
+				return min(max(time.Until(at), 0), maxRetryWait)
+			}
+		}
+	}
+	wait := min(c.retryWait<<attempt, maxRetryWait)
+	return wait/2 + rand.N(wait/2+1) //nolint:gosec // jitter, not security
+}
+
+// decodeError reads an error response. Servers that predate problem
+// details send {"error": "..."}, which lands in Problem.Error.
+func decodeError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err == nil && json.Unmarshal(b, &e.Problem) != nil {
+		e.Problem = Problem{Detail: strings.TrimSpace(string(b))}
+	}
+	return e
+}
+
+// refresh swaps the refresh token for a new token pair. stale is the
+// access token the server rejected; if another call has already refreshed
+// past it there is nothing to do. Only a refresh the server refuses ends
+// the session; after a 429 or 5xx the tokens are kept for the next try.
+func (c *Client) refresh(ctx context.Context, stale string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	t := c.Tokens()
+	if t.Access != stale {
+		return nil
+	}
+	if t.Refresh == "" {
+		return &Error{StatusCode: http.StatusUnauthorized, Problem: Problem{Code: "unauthenticated", Detail: "access token rejected"}}
+	}
+
+	var resp AuthResponse
+	err := c.do(ctx, request{
+		method:           http.MethodPost,
+		path:             apiPrefix + "/auth/refresh",
+		body:             map[string]string{"refresh_token": t.Refresh},
+		noRefresh:        true,
+		retryRateLimited: true,
+	}, &resp)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusBadRequest ||
+		apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+		c.SetTokens(Tokens{})
+		return ErrSessionEnded
+	}
+	if err != nil {
+		return err
+	}
+	c.SetTokens(Tokens{Access: resp.Token, Refresh: resp.RefreshToken, ExpiresAt: resp.ExpiresAt})
+	return nil
+}
+
+// pathf builds an API path, escaping each string argument as a path
+// segment.
+func pathf(format string, args ...any) string {
+	for i, a := range args {
+		if s, ok := a.(string); ok {
+			args[i] = url.PathEscape(s)
+		}
+	}
+	return apiPrefix + fmt.Sprintf(format, args...)
+}
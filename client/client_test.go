@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc, opts ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := New(srv.URL, opts...)
+	c.retryWait = time.Millisecond
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			writeJSON(w, http.StatusServiceUnavailable, Problem{Status: 503, Code: "unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, EnginesResponse{Default: "gotak"})
+	})
+
+	got, err := c.Engines(context.Background())
+	if err != nil || got.Default != "gotak" || calls.Load() != 3 {
+		t.Fatalf("Engines = %+v, %v after %d calls", got, err, calls.Load())
+	}
+
+	// A POST that isn't idempotent is sent once.
+	calls.Store(0)
+	if _, err := c.AIMove(context.Background(), "abc", AIRequest{}); ErrorCode(err) != "unavailable" || calls.Load() != 1 {
+		t.Errorf("AIMove = %v after %d calls", err, calls.Load())
+	}
+
+	// Retries stop when they run out.
+	calls.Store(-10)
+	var apiErr *Error
+	if _, err := c.Engines(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || calls.Load() != -7 {
+		t.Errorf("Engines = %v after %d calls", err, calls.Load()+10)
+	}
+}
+
+func TestMoveIsIdempotent(t *testing.T) {
+	var keys []string
+	var mu sync.Mutex
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req MoveRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		keys = append(keys, req.IdempotencyKey)
+		n := len(keys)
+		mu.Unlock()
+		if n == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		writeJSON(w, http.StatusOK, GameStateResponse{Status: "active"})
+	})
+
+	if _, err := c.Move(context.Background(), "abc", MoveRequest{Player: 1, Text: "a1"}); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("idempotency keys = %q, want the same key on the retry", keys)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	var refreshes atomic.Int32
+	var saved []Tokens
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/refresh":
+			refreshes.Add(1)
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["refresh_token"] != "r1" {
+				writeJSON(w, http.StatusUnauthorized, Problem{Code: "unauthenticated"})
+				return
+			}
+			writeJSON(w, http.StatusOK, AuthResponse{Token: "a2", RefreshToken: "r2"})
+		case "/v1/auth/profile":
+			if r.Header.Get("Authorization") != "Bearer a2" {
+				writeJSON(w, http.StatusUnauthorized, Problem{Code: "unauthenticated"})
+				return
+			}
+			writeJSON(w, http.StatusOK, User{ID: 7})
+		}
+	}, WithTokens(Tokens{Access: "a1", Refresh: "r1"}), WithTokenHandler(func(t Tokens) { saved = append(saved, t) }))
+
+	// Concurrent calls rejected with the same token refresh it once.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			if u, err := c.Profile(context.Background()); err != nil || u.ID != 7 {
+				t.Errorf("Profile = %+v, %v", u, err)
+			}
+		})
+	}
+	wg.Wait()
+	if refreshes.Load() != 1 || c.Tokens().Refresh != "r2" || len(saved) != 1 || saved[0].Access != "a2" {
+		t.Errorf("%d refreshes, tokens %+v, saved %+v", refreshes.Load(), c.Tokens(), saved)
+	}
+
+	// A rate limited refresh waits and tries again, and one that stays
+	// rate limited keeps the session.
+	refreshes.Store(0)
+	var limited atomic.Bool
+	limited.Store(true)
+	c2 := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/refresh":
+			if refreshes.Add(1) < 3 || limited.Load() {
+				w.Header().Set("Retry-After", "0")
+				writeJSON(w, http.StatusTooManyRequests, Problem{Code: "rate_limited"})
+				return
+			}
+			writeJSON(w, http.StatusOK, AuthResponse{Token: "a2", RefreshToken: "r2"})
+		case "/v1/auth/profile":
+			if r.Header.Get("Authorization") != "Bearer a2" {
+				writeJSON(w, http.StatusUnauthorized, Problem{Code: "unauthenticated"})
+				return
+			}
+			writeJSON(w, http.StatusOK, User{ID: 7})
+		}
+	}, WithTokens(Tokens{Access: "a1", Refresh: "r1"}))
+	if _, err := c2.Profile(context.Background()); ErrorCode(err) != "rate_limited" || c2.Tokens().Refresh != "r1" {
+		t.Errorf("Profile while refresh is rate limited = %v, tokens %+v", err, c2.Tokens())
+	}
+	refreshes.Store(0)
+	limited.Store(false)
+	if u, err := c2.Profile(context.Background()); err != nil || u.ID != 7 || refreshes.Load() != 3 {
+		t.Errorf("Profile = %+v, %v after %d refreshes", u, err, refreshes.Load())
+	}
+
+	// A rejected refresh token ends the session.
+	c.SetTokens(Tokens{Access: "a1", Refresh: "stale"})
+	if _, err := c.Profile(context.Background()); !errors.Is(err, ErrSessionEnded) {
+		t.Errorf("Profile = %v, want ErrSessionEnded", err)
+	}
+	if c.Tokens() != (Tokens{}) || saved[len(saved)-1] != (Tokens{}) {
+		t.Errorf("tokens after session end = %+v, saved %+v", c.Tokens(), saved)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/game/bad/move":
+			w.Header().Set("Content-Type", "application/problem+json")
+			writeJSON(w, http.StatusBadRequest, Problem{
+				Status: 400, Code: "validation_failed", Detail: "player must be 1 or 2",
+				Errors: []FieldError{{Field: "player", Message: "must be 1 or 2"}},
+			})
+		case "/v1/game/old":
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "game not found"})
+		default:
+			http.Error(w, "upstream exploded", http.StatusInternalServerError)
+		}
+	}, WithRetries(0))
+
+	var e *Error
+	_, err := c.Move(context.Background(), "bad", MoveRequest{Player: 3, Text: "a1"})
+	if !errors.As(err, &e) || e.StatusCode != 400 || e.Code != "validation_failed" || len(e.Errors) != 1 || e.Errors[0].Field != "player" {
+		t.Errorf("Move = %#v", err)
+	}
+	if _, err := c.Game(context.Background(), "old"); !errors.As(err, &e) || e.StatusCode != 404 || err.Error() != "gotak: game not found (404)" {
+		t.Errorf("Game = %v", err)
+	}
+	if _, err := c.Game(context.Background(), "boom"); !errors.As(err, &e) || e.Detail != "upstream exploded" {
+		t.Errorf("Game = %v", err)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Leaderboard(ctx, 0, false); !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Errorf("Leaderboard = %v after %s", err, time.Since(start))
+	}
+}
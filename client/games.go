@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/icco/gotak"
+)
+
+// CreateGame starts a game with the caller as white.
+func (c *Client) CreateGame(ctx context.Context, req CreateGameRequest) (*GameStateResponse, error) {
+	var out GameStateResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/game/new"), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Game fetches a game.
+func (c *Client) Game(ctx context.Context, slug string) (*GameStateResponse, error) {
+	return c.game(ctx, slug, nil)
+}
+
+// GameWithThreats fetches a game with its Threats filled in.
+func (c *Client) GameWithThreats(ctx context.Context, slug string) (*GameStateResponse, error) {
+	return c.game(ctx, slug, url.Values{"threats": {"true"}})
+}
+
+func (c *Client) game(ctx context.Context, slug string, query url.Values) (*GameStateResponse, error) {
+	var out GameStateResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/game/%s", slug), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Turn fetches one turn of a game.
+func (c *Client) Turn(ctx context.Context, slug string, turn int64) (*gotak.Turn, error) {
+	var out gotak.Turn
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/game/%s/%d", slug, turn)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// JoinGame joins a waiting game as black.
+func (c *Client) JoinGame(ctx context.Context, slug string) (*JoinGameResponse, error) {
+	var out JoinGameResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/game/%s/join", slug)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Move plays a move and returns the game after it. A move without an
+// IdempotencyKey is given one, so it can be retried without being played
+// twice.
+func (c *Client) Move(ctx context.Context, slug string, move MoveRequest) (*GameStateResponse, error) {
+	if move.IdempotencyKey == "" {
+		move.IdempotencyKey = newIdempotencyKey()
+	}
+	var out GameStateResponse
+	err := c.do(ctx, request{method: http.MethodPost, path: pathf("/game/%s/move", slug), body: move, idempotent: true}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AIMove has the AI play its move in a game against the AI.
+func (c *Client) AIMove(ctx context.Context, slug string, req AIRequest) (*AIMoveResponse, error) {
+	var out AIMoveResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/game/%s/ai-move", slug), body: req}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Engines lists the AI engines.
+func (c *Client) Engines(ctx context.Context) (*EnginesResponse, error) {
+	var out EnginesResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/ai/engines")}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Replay fetches the board after every move of a game.
+func (c *Client) Replay(ctx context.Context, slug string) (*ReplayResponse, error) {
+	var out ReplayResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/game/%s/replay", slug)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Position fetches the board after a turn; turn 0 is the empty board.
+func (c *Client) Position(ctx context.Context, slug string, turn int64) (*PositionResponse, error) {
+	var out PositionResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/game/%s/position/%d", slug, turn)}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PTN fetches a game in Portable Tak Notation.
+func (c *Client) PTN(ctx context.Context, slug string) (string, error) {
+	var out string
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/game/%s/ptn", slug)}, &out); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// Leaderboard fetches up to limit players' records (0 for the server's
+// default), with bots if includeBots is set.
+func (c *Client) Leaderboard(ctx context.Context, limit int, includeBots bool) (*LeaderboardResponse, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if includeBots {
+		query.Set("include_bots", "true")
+	}
+	var out LeaderboardResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/leaderboard"), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Health fetches the server's liveness report.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	var out HealthResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/healthz"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// NextPuzzle fetches the next puzzle to solve, only from theme if it is
+// set. Signed in, it is the unsolved puzzle nearest the user's rating.
+func (c *Client) NextPuzzle(ctx context.Context, theme string) (*PuzzleResponse, error) {
+	query := url.Values{}
+	if theme != "" {
+		query.Set("theme", theme)
+	}
+	var out PuzzleResponse
+	if err := c.do(ctx, request{method: http.MethodGet, path: pathf("/puzzles/next"), query: query}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AttemptPuzzle checks the solver's moves so far against a puzzle.
+func (c *Client) AttemptPuzzle(ctx context.Context, id int64, moves []string) (*PuzzleAttemptResponse, error) {
+	var out PuzzleAttemptResponse
+	body := map[string][]string{"moves": moves}
+	if err := c.do(ctx, request{method: http.MethodPost, path: pathf("/puzzles/%d/attempt", id), body: body}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/icco/gotak/cmd/server/docs"
+)
+
+// jsonFields lists the JSON members encoding/json writes for struct type t,
+// with embedded structs flattened.
+func jsonFields(t reflect.Type) []string {
+	var out []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "-" || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			out = append(out, jsonFields(ft)...)
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// TestTypesMatchSpec checks every client type has the members of the
+// OpenAPI definition of the same name, so the client can't drift from the
+// server it was written against.
+func TestTypesMatchSpec(t *testing.T) {
+	var doc struct {
+		Definitions map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(docs.SwaggerJSON(), &doc); err != nil {
+		t.Fatalf("parse swagger.json: %v", err)
+	}
+
+	for _, v := range []any{
+		GameStateResponse{}, ThreatReport{}, CreateGameRequest{}, JoinGameResponse{}, MoveRequest{},
+		AIRequest{}, AIMoveResponse{}, EnginesResponse{}, EngineInfo{}, Capabilities{},
+		ReplayResponse{}, ReplayStep{}, PositionResponse{}, LeaderboardResponse{}, LeaderboardEntry{},
+		AnalyzeRequest{}, PositionAnalyzeRequest{}, AnalysisJobResponse{}, MoveAnalysis{}, Evaluation{},
+		PositionAnalysisResponse{}, CandidateLine{}, OpeningsResponse{}, OpeningContinuation{},
+		PuzzleResponse{}, PuzzleAttemptResponse{}, HealthResponse{}, RegisterRequest{}, AuthResponse{},
+		User{}, UpdateProfileRequest{}, CreateAPITokenRequest{}, APITokenResponse{},
+		CreateAPITokenResponse{}, MessageResponse{}, LogoutAllResponse{}, ResetPasswordResponse{},
+		Problem{}, FieldError{},
+	} {
+		rt := reflect.TypeOf(v)
+		var def struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		ok := false
+		// swag qualifies a name with its package.
+		for _, pkg := range []string{"main.", "ai."} {
+			if def, ok = doc.Definitions[pkg+rt.Name()]; ok {
+				break
+			}
+		}
+		if !ok {
+			t.Errorf("%s has no definition in the OpenAPI document", rt.Name())
+			continue
+		}
+		var want []string
+		for name := range def.Properties {
+			want = append(want, name)
+		}
+		slices.Sort(want)
+		if got := jsonFields(rt); !slices.Equal(got, want) {
+			t.Errorf("%s fields = %v, OpenAPI document has %v", rt.Name(), got, want)
+		}
+	}
+}
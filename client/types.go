@@ -0,0 +1,397 @@
+package client
+
+import (
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+// The types below are the API's request and response bodies. They carry
+// the names of the matching definitions in the server's OpenAPI document,
+// which the tests check them against.
+
+// GameStateResponse is a game with its session state. The embedded
+// gotak.Game holds the board, turns and tags.
+type GameStateResponse struct {
+	*gotak.Game
+	CurrentPlayer int    `json:"current_player"`
+	Status        string `json:"status"`
+	Winner        int    `json:"winner"`
+	WhitePlayerID *int64 `json:"white_player_id,omitempty"`
+	BlackPlayerID *int64 `json:"black_player_id,omitempty"`
+	WhiteBot      bool   `json:"white_bot"`
+	BlackBot      bool   `json:"black_bot"`
+	Mode          string `json:"mode"`
+	// Engine is the AI engine an "ai" mode game plays against.
+	Engine string `json:"engine,omitempty"`
+	// Threats is only filled in by GameWithThreats.
+	Threats *ThreatReport `json:"threats,omitempty"`
+}
+
+// ThreatReport lists each player's road-completing moves and, when there
+// is one, a forced road win (Tinuë) for the player to move.
+type ThreatReport struct {
+	White []string `json:"white"`
+	Black []string `json:"black"`
+	Tinue []string `json:"tinue,omitempty"`
+}
+
+// CreateGameRequest configures a new game. Size is the board size as a
+// string ("4" to "9", default "8"); Mode is "human" or "ai".
+type CreateGameRequest struct {
+	Size   string `json:"size"`
+	Mode   string `json:"mode"`
+	Engine string `json:"engine,omitempty"`
+}
+
+// JoinGameResponse confirms joining a game and the side the caller plays.
+type JoinGameResponse struct {
+	Message string `json:"message"`
+	Slug    string `json:"slug"`
+	Player  string `json:"player"`
+}
+
+// MoveRequest is a move in PTN. IdempotencyKey makes retries safe: the
+// server won't play a move already recorded under the same key.
+type MoveRequest struct {
+	Player         int    `json:"player"`
+	Text           string `json:"move"`
+	Turn           int64  `json:"turn"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// AIRequest tunes an AI move. Every field is optional.
+type AIRequest struct {
+	Level       string        `json:"level,omitempty"`
+	Style       string        `json:"style,omitempty"`
+	TimeLimit   time.Duration `json:"time_limit,omitempty"`
+	Personality string        `json:"personality,omitempty"`
+	Seed        int64         `json:"seed,omitempty"`
+	Nodes       int64         `json:"nodes,omitempty"`
+}
+
+// AIMoveResponse is the game after an AI move, with the move played, an
+// explanation of it, and whether it came from the opening book.
+type AIMoveResponse struct {
+	*GameStateResponse
+	Move string `json:"move"`
+	Hint string `json:"hint,omitempty"`
+	Book bool   `json:"book,omitempty"`
+}
+
+// EnginesResponse lists the AI engines and names the default.
+type EnginesResponse struct {
+	Default string       `json:"default"`
+	Engines []EngineInfo `json:"engines"`
+}
+
+// EngineInfo describes an AI engine.
+type EngineInfo struct {
+	Name         string       `json:"name"`
+	Description  string       `json:"description,omitempty"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// Capabilities is what an engine supports.
+type Capabilities struct {
+	MinSize  int64 `json:"min_size"`
+	MaxSize  int64 `json:"max_size"`
+	Komi     bool  `json:"komi"`
+	Analysis bool  `json:"analysis"`
+	MultiPV  bool  `json:"multi_pv"`
+}
+
+// ReplayResponse is a game's board after every move.
+type ReplayResponse struct {
+	Slug  string       `json:"slug"`
+	Size  int64        `json:"size"`
+	Steps []ReplayStep `json:"steps"`
+}
+
+// ReplayStep is the board after one move.
+type ReplayStep struct {
+	Turn     int64                     `json:"turn"`
+	Player   int                       `json:"player"`
+	Move     string                    `json:"move"`
+	Board    map[string][]*gotak.Stone `json:"board"`
+	PlayedAt *time.Time                `json:"played_at,omitempty"`
+}
+
+// PositionResponse is the board after a turn.
+type PositionResponse struct {
+	Slug  string                    `json:"slug"`
+	Size  int64                     `json:"size"`
+	Turn  int64                     `json:"turn"`
+	Board map[string][]*gotak.Stone `json:"board"`
+}
+
+// LeaderboardResponse is the win/loss/draw table.
+type LeaderboardResponse struct {
+	IncludeBots bool               `json:"include_bots"`
+	Entries     []LeaderboardEntry `json:"entries"`
+}
+
+// LeaderboardEntry is one player's record.
+type LeaderboardEntry struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Bot    bool   `json:"bot"`
+	Games  int    `json:"games"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+}
+
+// AnalyzeRequest configures an engine for analysis. Every field is
+// optional; TimeLimit is ignored when Nodes is set.
+type AnalyzeRequest struct {
+	Level     string        `json:"level,omitempty"`
+	Style     string        `json:"style,omitempty"`
+	TimeLimit time.Duration `json:"time_limit,omitempty"`
+	Engine    string        `json:"engine,omitempty"`
+	Seed      int64         `json:"seed,omitempty"`
+	Nodes     int64         `json:"nodes,omitempty"`
+}
+
+// PositionAnalyzeRequest is a position to analyse: a TPS, or a board Size
+// to start from empty, with Moves played on top of it.
+type PositionAnalyzeRequest struct {
+	AnalyzeRequest
+	TPS     string   `json:"tps,omitempty"`
+	Moves   []string `json:"moves,omitempty"`
+	Size    int64    `json:"size,omitempty"`
+	MultiPV int      `json:"multi_pv,omitempty"`
+}
+
+// Analysis job statuses.
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// AnalysisJobResponse is a game analysis job and the moves analysed so
+// far.
+type AnalysisJobResponse struct {
+	ID         string         `json:"id"`
+	Slug       string         `json:"slug"`
+	Status     string         `json:"status"`
+	Engine     string         `json:"engine"`
+	Level      string         `json:"level"`
+	Total      int            `json:"total"`
+	Completed  int            `json:"completed"`
+	Agreed     int            `json:"agreed"`
+	Moves      []MoveAnalysis `json:"moves"`
+	Error      string         `json:"error,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job has stopped, successfully or not.
+func (j *AnalysisJobResponse) Finished() bool {
+	switch j.Status {
+	case JobDone, JobFailed, JobCanceled:
+		return true
+	}
+	return false
+}
+
+// MoveAnalysis compares one played move with the engine's choice.
+type MoveAnalysis struct {
+	Turn           int64       `json:"turn"`
+	Player         int         `json:"player"`
+	Played         string      `json:"played"`
+	Best           string      `json:"best"`
+	Agreed         bool        `json:"agreed"`
+	EvalBefore     *Evaluation `json:"eval_before,omitempty"`
+	EvalAfter      *Evaluation `json:"eval_after,omitempty"`
+	Loss           float64     `json:"loss"`
+	Classification string      `json:"classification,omitempty"`
+	Explanation    string      `json:"explanation,omitempty"`
+	MissedWin      []string    `json:"missed_win,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// Evaluation is the engine's view of a position for the player to move.
+type Evaluation struct {
+	ScoreCP        int      `json:"score_cp"`
+	Mate           int      `json:"mate,omitempty"`
+	WinProbability float64  `json:"win_probability"`
+	Depth          int      `json:"depth"`
+	Nodes          int64    `json:"nodes"`
+	PV             []string `json:"pv,omitempty"`
+	Result         string   `json:"result,omitempty"`
+}
+
+// PositionAnalysisResponse is the engine's candidate moves for a position.
+type PositionAnalysisResponse struct {
+	TPS    string          `json:"tps"`
+	Hash   string          `json:"hash"`
+	Size   int64           `json:"size"`
+	ToMove int             `json:"to_move"`
+	Engine string          `json:"engine"`
+	Level  string          `json:"level"`
+	Lines  []CandidateLine `json:"lines"`
+}
+
+// CandidateLine is one candidate move and its evaluation.
+type CandidateLine struct {
+	Move string `json:"move"`
+	Evaluation
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// OpeningsResponse is how often each move followed an opening.
+type OpeningsResponse struct {
+	Prefix        []string              `json:"prefix"`
+	GameCount     int                   `json:"game_count"`
+	Continuations []OpeningContinuation `json:"continuations"`
+}
+
+// OpeningContinuation is a move after the prefix and how many games
+// played it.
+type OpeningContinuation struct {
+	Move  string `json:"move"`
+	Count int    `json:"count"`
+}
+
+// PuzzleResponse is a puzzle: a position where ToMove has a forced win in
+// Depth moves.
+type PuzzleResponse struct {
+	ID         int64    `json:"id"`
+	TPS        string   `json:"tps"`
+	Size       int64    `json:"size"`
+	ToMove     int      `json:"to_move"`
+	Depth      int      `json:"depth"`
+	Rating     int      `json:"rating"`
+	Themes     []string `json:"themes"`
+	UserRating int      `json:"user_rating,omitempty"`
+}
+
+// Puzzle attempt results.
+const (
+	AttemptCorrect   = "correct"
+	AttemptSolved    = "solved"
+	AttemptIncorrect = "incorrect"
+)
+
+// PuzzleAttemptResponse grades an attempt. A correct move so far comes
+// with the defender's Reply; a finished attempt with the Solution.
+type PuzzleAttemptResponse struct {
+	Result   string   `json:"result"`
+	Reply    string   `json:"reply,omitempty"`
+	Solution []string `json:"solution,omitempty"`
+	Rating   int      `json:"rating,omitempty"`
+	Change   int      `json:"change,omitempty"`
+}
+
+// HealthResponse is the server's liveness report.
+type HealthResponse struct {
+	Healthy  string `json:"healthy"`
+	Revision string `json:"revision,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+}
+
+// RegisterRequest creates an account.
+type RegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+// AuthResponse is a new session: a short-lived access token and the
+// refresh token that renews it.
+type AuthResponse struct {
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	User         User      `json:"user"`
+}
+
+// User is an account.
+type User struct {
+	ID          int64      `json:"id"`
+	Provider    string     `json:"provider"`
+	ProviderID  string     `json:"provider_id"`
+	Email       string     `json:"email,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	AvatarURL   string     `json:"avatar_url,omitempty"`
+	Preferences string     `json:"preferences,omitempty"`
+	Bot         bool       `json:"bot"`
+	Role        string     `json:"role"`
+	BannedAt    *time.Time `json:"banned_at,omitempty"`
+	BanReason   string     `json:"ban_reason,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// UpdateProfileRequest changes the fields of a profile that are set.
+type UpdateProfileRequest struct {
+	Name        string `json:"name,omitempty"`
+	Preferences string `json:"preferences,omitempty"`
+}
+
+// CreateAPITokenRequest mints a personal API token with the given scopes
+// ("play", "read", "analyze").
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+// APITokenResponse describes an API token without its secret.
+type APITokenResponse struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPITokenResponse is a new API token. Token is only ever shown
+// here.
+type CreateAPITokenResponse struct {
+	APITokenResponse
+	Token string `json:"token"`
+}
+
+// MessageResponse is a bare confirmation.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// LogoutAllResponse reports how many sessions were revoked.
+type LogoutAllResponse struct {
+	Message string `json:"message"`
+	Revoked int64  `json:"revoked"`
+}
+
+// ResetPasswordResponse acknowledges a password reset request.
+type ResetPasswordResponse struct {
+	Message  string `json:"message"`
+	DevToken string `json:"dev_token,omitempty"`
+}
+
+// Problem is an error response (RFC 7807).
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Error    string       `json:"error"`
+}
+
+// FieldError is one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
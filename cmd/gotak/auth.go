@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/icco/gotak/client"
+)
+
+// session ties the API client to the token cache on disk. The client
+// refreshes expired access tokens itself; session saves each new pair and
+// forgets the cache when the session ends. It is shared by pointer between
+// model copies so a refresh in one command is seen by the next.
+type session struct {
+	api *client.Client
+
+	mu    sync.Mutex
+	cache *TokenCache
+}
+
+func newSession(serverURL string) *session {
+	s := &session{}
+	s.api = client.New(serverURL,
+		client.WithUserAgent(fmt.Sprintf("gotak-cli %s", getVersion())),
+		client.WithTokenHandler(s.tokensChanged))
+	return s
+}
+
+// set starts using cache, e.g. one loaded from disk or a fresh login.
+func (s *session) set(cache *TokenCache) {
+	s.mu.Lock()
+	s.cache = cache
+	s.mu.Unlock()
+	s.api.SetTokens(client.Tokens{Access: cache.Token, Refresh: cache.RefreshToken, ExpiresAt: cache.ExpiresAt})
+}
+
+// clear forgets the tokens in memory and on disk.
+func (s *session) clear() {
+	s.api.SetTokens(client.Tokens{})
+}
+
+// tokensChanged keeps the cache on disk in step with the client's tokens.
+func (s *session) tokensChanged(t client.Tokens) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.Access == "" {
+		s.cache = nil
+		_ = clearTokenCache()
+		return
+	}
+	if s.cache == nil {
+		s.cache = &TokenCache{ServerURL: s.api.BaseURL()}
+	}
+	s.cache.Token = t.Access
+	s.cache.RefreshToken = t.Refresh
+	s.cache.ExpiresAt = t.ExpiresAt
+	_ = saveTokenCache(s.cache)
+}
+
+// tokenCache is what a login saves to disk.
+func tokenCache(serverURL string, r *client.AuthResponse) *TokenCache {
+	return &TokenCache{
+		Token:        r.Token,
+		RefreshToken: r.RefreshToken,
+		Email:        r.User.Email,
+		Name:         r.User.Name,
+		ExpiresAt:    r.ExpiresAt,
+		ServerURL:    serverURL,
+	}
+}
+
+// failed turns an API error into the message for it: sessionExpired when
+// the user has to log in again, otherwise an apiError saying what failed.
+func failed(what string, err error) tea.Msg {
+	if errors.Is(err, client.ErrSessionEnded) {
+		return sessionExpired{}
+	}
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		return apiError{error: fmt.Sprintf("%s: %v", what, err)}
+	}
+	msg := apiErr.Detail
+	if msg == "" {
+		msg = apiErr.Problem.Error
+	}
+	if msg == "" {
+		return apiError{error: fmt.Sprintf("%s (status %d)", what, apiErr.StatusCode)}
+	}
+	return apiError{error: fmt.Sprintf("%s: %s", what, msg)}
+}
@@ -2,15 +2,15 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +19,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/icco/gotak"
+	"github.com/icco/gotak/client"
 )
 
 // Version is overridden at build time by goreleaser via -ldflags.
@@ -64,6 +65,12 @@ var (
 			Align(lipgloss.Center).
 			MarginTop(1)
 
+	warningStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")).
+			Bold(true).
+			Align(lipgloss.Center).
+			MarginTop(1)
+
 	inputStyle = lipgloss.NewStyle().
 			BorderStyle(lipgloss.RoundedBorder()).
 			BorderForeground(lipgloss.Color("240")).
@@ -86,22 +93,13 @@ func getTokenCachePath() (string, error) {
 	return filepath.Join(cacheDir, "auth.json"), nil
 }
 
-// saveTokenCache saves the authentication token to cache
-func saveTokenCache(token, email, name, serverURL string) error {
+// saveTokenCache saves the authentication tokens to cache
+func saveTokenCache(cache *TokenCache) error {
 	cachePath, err := getTokenCachePath()
 	if err != nil {
 		return err
 	}
 
-	// Set expiry to 24 hours from now (adjust based on your JWT expiry)
-	cache := TokenCache{
-		Token:     token,
-		Email:     email,
-		Name:      name,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		ServerURL: serverURL,
-	}
-
 	data, err := json.MarshalIndent(cache, "", "  ")
 	if err != nil {
 		return err
@@ -127,38 +125,21 @@ func loadTokenCache() (*TokenCache, error) {
 		return nil, err
 	}
 
-	// Check if token is expired
-	if time.Now().After(cache.ExpiresAt) {
+	// An expired access token is fine as long as it can be refreshed.
+	if cache.RefreshToken == "" && time.Now().After(cache.ExpiresAt) {
 		return nil, fmt.Errorf("token expired")
 	}
 
 	return &cache, nil
 }
 
-// validateToken checks if the cached token is still valid by making a test API call
-func validateToken(token, serverURL string) error {
+// validateToken checks if the cached session is still valid by making a
+// test API call, refreshing the access token if needed.
+func validateToken(api *client.Client) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/auth/profile", nil)
-	if err != nil {
-		return err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("User-Agent", fmt.Sprintf("gotak-cli %s", getVersion()))
-
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("token validation failed: %d", resp.StatusCode)
-	}
-
-	return nil
+	_, err := api.Profile(ctx)
+	return err
 }
 
 // clearTokenCache removes the cached token
@@ -182,20 +163,20 @@ func main() {
 	if *localFlag {
 		serverURL = "http://localhost:8080"
 	} else {
-		serverURL = "https://gotak.app"
+		serverURL = client.DefaultBaseURL
 	}
 
 	// Try to load cached token first
 	model := initialModel(serverURL)
 	if cache, err := loadTokenCache(); err == nil && cache.ServerURL == serverURL {
 		// Validate the cached token
-		if err := validateToken(cache.Token, serverURL); err == nil {
+		model.session.set(cache)
+		if err := validateToken(model.session.api); err == nil {
 			// Token is valid, skip auth screens
-			model.token = cache.Token
 			model.authenticated = true
 			model.screen = screenMenu
 		} else {
-			_ = clearTokenCache()
+			model.session.clear()
 		}
 	}
 
@@ -217,6 +198,7 @@ const (
 	screenMenu
 	screenGame
 	screenSettings
+	screenPuzzle
 )
 
 type authMode int
@@ -236,7 +218,7 @@ type model struct {
 	emailInput     textinput.Model
 	passwordInput  textinput.Model
 	nameInput      textinput.Model
-	token          string
+	session        *session
 	authenticated  bool
 	authFocus      int
 
@@ -249,8 +231,13 @@ type model struct {
 
 	// Game state
 	gameSlug  string
-	gameData  *GameData
+	gameData  *client.GameStateResponse
 	boardSize int
+	// threats is the latest road threat report for gameData, if any.
+	threats *client.ThreatReport
+
+	// Puzzle state
+	puzzle puzzleState
 
 	// Move input
 	moveInput string
@@ -266,48 +253,15 @@ type model struct {
 	isLoading bool
 }
 
-type GameData struct {
-	ID     int64             `json:"id"`
-	Slug   string            `json:"slug"`
-	Status string            `json:"status"`
-	Turns  []GameTurn        `json:"turns"`
-	Board  *GameBoard        `json:"board"`
-	Tags   map[string]string `json:"tags"`
-}
-
-type GameBoard struct {
-	Size    int64               `json:"size"`
-	Squares map[string][]*Stone `json:"squares"`
-}
-
-// Stone mirrors gotak.Stone for client-side decoding.
-type Stone struct {
-	Type   string `json:"type"`
-	Player int    `json:"player"`
-}
-
-type GameTurn struct {
-	Number  int64     `json:"number"`
-	First   *GameMove `json:"first"`
-	Second  *GameMove `json:"second"`
-	Result  string    `json:"result"`
-	Comment string    `json:"comment"`
-}
-
-type GameMove struct {
-	Player int    `json:"player"`
-	Text   string `json:"text"`
-	Type   string `json:"type"`
-	Square string `json:"square"`
-}
-
-// TokenCache represents cached authentication data
+// TokenCache represents cached authentication data. ExpiresAt is when the
+// access token expires; the refresh token outlives it.
 type TokenCache struct {
-	Token     string    `json:"token"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	ExpiresAt time.Time `json:"expires_at"`
-	ServerURL string    `json:"server_url"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	ServerURL    string    `json:"server_url"`
 }
 
 func initialModel(serverURL string) model {
@@ -332,6 +286,7 @@ func initialModel(serverURL string) model {
 
 	return model{
 		serverURL:     serverURL,
+		session:       newSession(serverURL),
 		screen:        screenAuthMode, // Start with mode selection
 		authMode:      authModeLogin,
 		emailInput:    emailInput,
@@ -358,14 +313,22 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case authSuccess:
-		m.token = msg.token
+		m.session.set(msg.cache)
 		m.authenticated = true
 		m.screen = screenMenu
 		m.error = ""
 		m.isLoading = false
 
-		_ = saveTokenCache(msg.token, msg.email, msg.name, m.serverURL)
+		return m, nil
 
+	case sessionExpired:
+		m.authenticated = false
+		m.screen = screenAuthMode
+		m.gameData = nil
+		m.threats = nil
+		m.waitingForAI = false
+		m.error = client.ErrSessionEnded.Error()
+		m.isLoading = false
 		return m, nil
 
 	case registrationSuccess:
@@ -384,7 +347,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.screen = screenGame
 		m.error = ""
 		m.isLoading = false
-		return m, nil
+		m.threats = nil
+		return m, m.fetchThreats()
 
 	case apiError:
 		m.error = msg.error
@@ -396,6 +360,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.moveInput = ""
 		m.error = ""
 		m.isLoading = false
+		m.threats = nil
 
 		// If this is an AI game, it's the AI's turn, and we're not already waiting for AI
 		if m.gameMode == "ai" && !m.isGameOver() && !m.waitingForAI {
@@ -410,7 +375,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Reset AI waiting flag if it was an AI move
 		m.waitingForAI = false
 
-		return m, nil
+		return m, m.fetchThreats()
 
 	case aiMoveReceived:
 		// AI endpoint now returns updated game state directly
@@ -418,6 +383,36 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.error = ""
 		m.isLoading = false
 		m.waitingForAI = false
+		m.threats = nil
+		return m, m.fetchThreats()
+
+	case puzzleLoaded:
+		m.puzzle = puzzleState{puzzle: msg.puzzle}
+		m.moveInput = ""
+		m.error = ""
+		m.isLoading = false
+		return m, nil
+
+	case puzzleAttempted:
+		m.isLoading = false
+		if m.puzzle.puzzle == nil || m.puzzle.puzzle.ID != msg.id {
+			return m, nil
+		}
+		m.puzzle.moves = msg.moves
+		m.puzzle.line = append(m.puzzle.line, msg.moves[len(msg.moves)-1])
+		if msg.attempt.Reply != "" {
+			m.puzzle.line = append(m.puzzle.line, msg.attempt.Reply)
+		}
+		m.puzzle.last = msg.attempt
+		m.moveInput = ""
+		m.error = ""
+		return m, nil
+
+	case threatsLoaded:
+		// Drop reports for a game or position that has moved on.
+		if m.gameData != nil && msg.slug == m.gameSlug && msg.moves == m.getTotalMoves() {
+			m.threats = msg.report
+		}
 		return m, nil
 
 	case tea.KeyMsg:
@@ -432,6 +427,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateGame(msg)
 		case screenSettings:
 			return m.updateSettings(msg)
+		case screenPuzzle:
+			return m.updatePuzzle(msg)
 		}
 	}
 
@@ -629,7 +626,7 @@ func (m model) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.menuCursor--
 		}
 	case keyDown, "j":
-		if m.menuCursor < 3 {
+		if m.menuCursor < 4 {
 			m.menuCursor++
 		}
 	case keyEnter, " ":
@@ -637,14 +634,21 @@ func (m model) updateMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		case 0: // New Game
 			m.isLoading = true
 			return m, m.createGame()
-		case 1: // Settings
+		case 1: // Puzzles
+			m.screen = screenPuzzle
+			m.puzzle = puzzleState{}
+			m.moveInput = ""
+			m.error = ""
+			m.isLoading = true
+			return m, m.fetchPuzzle()
+		case 2: // Settings
 			m.screen = screenSettings
-		case 2: // Logout
-			_ = clearTokenCache()
-			m.token = ""
+		case 3: // Logout
+			cmd := m.logoutUser()
 			m.authenticated = false
 			m.screen = screenAuthMode
-		case 3: // Quit
+			return m, cmd
+		case 4: // Quit
 			return m, tea.Quit
 		}
 	}
@@ -746,6 +750,8 @@ func (m model) View() string {
 		content = m.viewGame()
 	case screenSettings:
 		content = m.viewSettings()
+	case screenPuzzle:
+		content = m.viewPuzzle()
 	default:
 		content = "Unknown screen"
 	}
@@ -1003,6 +1009,7 @@ func (m model) viewMenu() string {
 
 	choices := []string{
 		"🎮 New Game",
+		"🧩 Puzzles",
 		"⚙️  Settings",
 		"🚪 Logout",
 		"❌ Quit",
@@ -1077,6 +1084,10 @@ func (m model) viewGame() string {
 
 	content := lipgloss.JoinVertical(lipgloss.Center, title, boardDisplay, inputArea, gameInfo, help)
 
+	if warning := m.threatWarning(); warning != "" {
+		content = lipgloss.JoinVertical(lipgloss.Center, content, warningStyle.Width(m.width).Render("⚠ "+warning))
+	}
+
 	if m.error != "" {
 		errorMsg := errorStyle.Width(m.width).Render("❌ " + m.error)
 		content = lipgloss.JoinVertical(lipgloss.Center, content, errorMsg)
@@ -1085,6 +1096,29 @@ func (m model) viewGame() string {
 	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, content)
 }
 
+// threatWarning describes the road threats in m.threats for the player to
+// move: a forced win, a road they can complete, or one they must stop.
+func (m model) threatWarning() string {
+	if m.threats == nil || m.isGameOver() {
+		return ""
+	}
+	names := map[int]string{1: "White", 2: "Black"}
+	own, opp := m.threats.White, m.threats.Black
+	player := m.getCurrentPlayer()
+	if player == 2 {
+		own, opp = opp, own
+	}
+	switch {
+	case len(own) > 0:
+		return fmt.Sprintf("%s can complete a road: %s", names[player], strings.Join(own, ", "))
+	case len(m.threats.Tinue) > 0:
+		return fmt.Sprintf("%s has a forced road win: %s", names[player], strings.Join(m.threats.Tinue, " "))
+	case len(opp) > 0:
+		return fmt.Sprintf("%s threatens a road: %s", names[3-player], strings.Join(opp, ", "))
+	}
+	return ""
+}
+
 func (m model) getTotalMoves() int {
 	total := 0
 	for _, turn := range m.gameData.Turns {
@@ -1101,14 +1135,18 @@ func (m model) getTotalMoves() int {
 // renderBoard draws an ASCII grid of the current board state, using
 // the Squares the server attaches to game responses.
 func (m model) renderBoard(size int) string {
-	if size <= 0 {
-		size = 5
-	}
-
-	var squares map[string][]*Stone
+	var squares map[string][]*gotak.Stone
 	if m.gameData != nil && m.gameData.Board != nil {
 		squares = m.gameData.Board.Squares
 	}
+	return renderSquares(size, squares)
+}
+
+// renderSquares draws an ASCII grid of squares.
+func renderSquares(size int, squares map[string][]*gotak.Stone) string {
+	if size <= 0 {
+		size = 5
+	}
 
 	const cellWidth = 5 // " XYZ "
 
@@ -1170,7 +1208,7 @@ func (m model) renderBoard(size int) string {
 
 // renderCell formats a single board cell so all cells line up at `width` runes
 // regardless of stack depth or stone type.
-func renderCell(stones []*Stone, width int) string {
+func renderCell(stones []*gotak.Stone, width int) string {
 	if len(stones) == 0 {
 		return centerRunes("·", width)
 	}
@@ -1196,7 +1234,7 @@ func centerRunes(s string, width int) string {
 	return strings.Repeat(" ", left) + s + strings.Repeat(" ", right)
 }
 
-func stoneSymbol(s *Stone) string {
+func stoneSymbol(s *gotak.Stone) string {
 	if s == nil {
 		return "·"
 	}
@@ -1248,45 +1286,19 @@ func (m model) isGameOver() bool {
 
 // requestAIMove requests an AI move from the server
 func (m model) requestAIMove() tea.Cmd {
+	api, slug := m.session.api, m.gameSlug
 	return func() tea.Msg {
-		payload := map[string]interface{}{
-			"level":      "intermediate", // Could be made configurable
-			"style":      "balanced",
-			"time_limit": int64(10 * time.Second), // Duration in nanoseconds
-		}
-
-		data, _ := json.Marshal(payload)
-
-		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, m.serverURL+"/game/"+m.gameSlug+"/ai-move", bytes.NewBuffer(data))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+m.token)
-		req.Header.Set("User-Agent", fmt.Sprintf("gotak-cli %s", getVersion()))
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := api.AIMove(context.Background(), slug, client.AIRequest{
+			Level:     "intermediate", // Could be made configurable
+			Style:     "balanced",
+			TimeLimit: 10 * time.Second,
+		})
 		if err != nil {
-			return apiError{error: fmt.Sprintf("AI move request failed: %v", err)}
+			return failed("AI move failed", err)
 		}
-		defer func() { _ = resp.Body.Close() }()
 
-		if resp.StatusCode != http.StatusOK {
-			var errorResp struct {
-				Error string `json:"error"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-				return apiError{error: fmt.Sprintf("AI move failed: %s", errorResp.Error)}
-			}
-			return apiError{error: fmt.Sprintf("AI move failed (status %d)", resp.StatusCode)}
-		}
-
-		// AI endpoint now returns the updated game state directly
-		var game GameData
-		if err := json.NewDecoder(resp.Body).Decode(&game); err != nil {
-			return apiError{error: "AI move response error"}
-		}
-
-		// Return the updated game state
-		return aiMoveReceived{game: &game}
+		// The AI endpoint returns the updated game state directly
+		return aiMoveReceived{game: resp.GameStateResponse}
 	}
 }
 
@@ -1316,84 +1328,50 @@ func (m model) viewSettings() string {
 
 // API Commands
 func (m model) loginUser() tea.Cmd {
+	api := m.session.api
+	email, password := m.emailInput.Value(), m.passwordInput.Value()
 	return func() tea.Msg {
-		payload := map[string]string{
-			"email":    m.emailInput.Value(),
-			"password": m.passwordInput.Value(),
-		}
-
-		data, _ := json.Marshal(payload)
-		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, m.serverURL+"/auth/login", bytes.NewBuffer(data))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("User-Agent", fmt.Sprintf("gotak-cli %s", getVersion()))
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := api.Login(context.Background(), email, password)
 		if err != nil {
-			return apiError{error: fmt.Sprintf("Connection failed: %v", err)}
-		}
-		defer func() { _ = resp.Body.Close() }()
-
-		if resp.StatusCode != http.StatusOK {
-			// Read the actual error message from server
-			var errorResp struct {
-				Error string `json:"error"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-				return apiError{error: fmt.Sprintf("Login failed: %s", errorResp.Error)}
-			}
-			return apiError{error: fmt.Sprintf("Login failed (status %d)", resp.StatusCode)}
-		}
-
-		var authResp struct {
-			Token string `json:"token"`
-			User  struct {
-				ID    int64  `json:"id"`
-				Email string `json:"email"`
-				Name  string `json:"name"`
-			} `json:"user"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-			return apiError{error: "Login response error"}
+			return failed("Login failed", err)
 		}
+		return authSuccess{cache: tokenCache(api.BaseURL(), resp)}
+	}
+}
 
-		return authSuccess{
-			token: authResp.Token,
-			email: authResp.User.Email,
-			name:  authResp.User.Name,
+// logoutUser forgets the local tokens and then revokes the session
+// server-side (best effort).
+func (m model) logoutUser() tea.Cmd {
+	token := m.session.api.Tokens().Access
+	m.session.clear()
+	serverURL := m.serverURL
+	return func() tea.Msg {
+		if token == "" {
+			return nil
 		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// A client of its own, so logging out can't touch a session
+		// started after it.
+		api := client.New(serverURL,
+			client.WithAPIToken(token),
+			client.WithRetries(0),
+			client.WithUserAgent(fmt.Sprintf("gotak-cli %s", getVersion())))
+		_ = api.Logout(ctx)
+		return nil
 	}
 }
 
 func (m model) registerUser() tea.Cmd {
+	api := m.session.api
+	req := client.RegisterRequest{
+		Email:    m.emailInput.Value(),
+		Password: m.passwordInput.Value(),
+		Name:     m.nameInput.Value(),
+	}
 	return func() tea.Msg {
-		payload := map[string]string{
-			"email":    m.emailInput.Value(),
-			"password": m.passwordInput.Value(),
-			"name":     m.nameInput.Value(),
-		}
-
-		data, _ := json.Marshal(payload)
-		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, m.serverURL+"/auth/register", bytes.NewBuffer(data))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("User-Agent", fmt.Sprintf("gotak-cli %s", getVersion()))
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return apiError{error: fmt.Sprintf("Connection failed: %v", err)}
-		}
-		defer func() { _ = resp.Body.Close() }()
-
-		if resp.StatusCode != http.StatusCreated { // Registration returns 201 on success
-			// Read the actual error message from server
-			var errorResp struct {
-				Error string `json:"error"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-				return apiError{error: fmt.Sprintf("Registration failed: %s", errorResp.Error)}
-			}
-			return apiError{error: fmt.Sprintf("Registration failed (status %d)", resp.StatusCode)}
+		if err := api.Register(context.Background(), req); err != nil {
+			return failed("Registration failed", err)
 		}
 
 		// Registration successful, now show success message and return to login
@@ -1402,142 +1380,72 @@ func (m model) registerUser() tea.Cmd {
 }
 
 func (m model) createGame() tea.Cmd {
+	api := m.session.api
+	req := client.CreateGameRequest{
+		Size: strconv.Itoa(m.boardSize),
+		Mode: m.gameMode, // "human" or "ai"
+	}
 	return func() tea.Msg {
-		payload := map[string]interface{}{
-			"size": fmt.Sprintf("%d", m.boardSize), // Server expects string
-			"mode": m.gameMode,                     // "human" or "ai"
-		}
-
-		data, _ := json.Marshal(payload)
-
-		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, m.serverURL+"/game/new", bytes.NewBuffer(data))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+m.token)
-		req.Header.Set("User-Agent", fmt.Sprintf("gotak-cli %s", getVersion()))
-
-		// Don't follow redirects automatically
-		client := &http.Client{
-			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
-		resp, err := client.Do(req)
+		game, err := api.CreateGame(context.Background(), req)
 		if err != nil {
-			return apiError{error: fmt.Sprintf("Connection failed: %v", err)}
+			return failed("Create game failed", err)
 		}
-		defer func() { _ = resp.Body.Close() }()
-
-		// Handle redirect response
-		if resp.StatusCode == http.StatusTemporaryRedirect {
-			// Extract game slug from Location header
-			location := resp.Header.Get("Location")
-			if location == "" {
-				return apiError{error: "Game creation redirect missing location"}
-			}
-
-			// Extract slug from "/game/{slug}"
-			parts := strings.Split(location, "/")
-			if len(parts) < 3 || parts[1] != "game" {
-				return apiError{error: "Invalid game location format"}
-			}
-			gameSlug := parts[2]
-
-			// Now fetch the game data with a GET request
-			getReq, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, m.serverURL+"/game/"+gameSlug, nil)
-			getReq.Header.Set("Authorization", "Bearer "+m.token)
-			getReq.Header.Set("User-Agent", fmt.Sprintf("gotak-cli %s", getVersion()))
-
-			getResp, err := client.Do(getReq)
-			if err != nil {
-				return apiError{error: fmt.Sprintf("Failed to fetch created game: %v", err)}
-			}
-			defer func() { _ = getResp.Body.Close() }()
-
-			if getResp.StatusCode != http.StatusOK {
-				return apiError{error: fmt.Sprintf("Failed to fetch game data (status %d)", getResp.StatusCode)}
-			}
-
-			var game GameData
-			if err := json.NewDecoder(getResp.Body).Decode(&game); err != nil {
-				return apiError{error: "Game data parsing error"}
-			}
-
-			return gameLoaded{game: &game}
-		}
-
-		if resp.StatusCode != http.StatusOK {
-			// Read the actual error message from server
-			var errorResp struct {
-				Error string `json:"error"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-				return apiError{error: fmt.Sprintf("Create game failed: %s", errorResp.Error)}
-			}
-			return apiError{error: fmt.Sprintf("Create game failed (status %d)", resp.StatusCode)}
-		}
-
-		return apiError{error: "Unexpected response from server"}
+		return gameLoaded{game: game}
 	}
 }
 
 func (m model) submitMove() tea.Cmd {
+	api, slug := m.session.api, m.gameSlug
+	move := client.MoveRequest{
+		Player: m.getCurrentPlayer(),
+		Text:   m.moveInput,
+		Turn:   int64(m.getTotalMoves() + 1),
+	}
 	return func() tea.Msg {
-		payload := map[string]interface{}{
-			"player": m.getCurrentPlayer(),
-			"move":   m.moveInput,
-			"turn":   int64(m.getTotalMoves() + 1),
-		}
-
-		data, _ := json.Marshal(payload)
-
-		req, _ := http.NewRequestWithContext(context.Background(), http.MethodPost, m.serverURL+"/game/"+m.gameSlug+"/move", bytes.NewBuffer(data))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+m.token)
-		req.Header.Set("User-Agent", fmt.Sprintf("gotak-cli %s", getVersion()))
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		game, err := api.Move(context.Background(), slug, move)
 		if err != nil {
-			return apiError{error: fmt.Sprintf("Move failed: %v", err)}
+			return failed("Move failed", err)
 		}
-		defer func() { _ = resp.Body.Close() }()
+		return moveSubmitted{game: game}
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			// Read the actual error message from server
-			var errorResp struct {
-				Error string `json:"error"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-				return apiError{error: fmt.Sprintf("Move failed: %s", errorResp.Error)}
-			}
-			return apiError{error: fmt.Sprintf("Move failed (status %d)", resp.StatusCode)}
+// fetchThreats asks the server for the road threats in the current game.
+// Failures are ignored; the warning is only a hint.
+func (m model) fetchThreats() tea.Cmd {
+	if m.gameData == nil || m.isGameOver() {
+		return nil
+	}
+	api, slug, moves := m.session.api, m.gameSlug, m.getTotalMoves()
+	return func() tea.Msg {
+		game, err := api.GameWithThreats(context.Background(), slug)
+		if errors.Is(err, client.ErrSessionEnded) {
+			return sessionExpired{}
 		}
-
-		var game GameData
-		if err := json.NewDecoder(resp.Body).Decode(&game); err != nil {
-			return apiError{error: "Move response error"}
+		if err != nil {
+			return nil
 		}
-
-		// Clear the move input on successful move
-		return moveSubmitted{game: &game}
+		return threatsLoaded{slug: slug, moves: moves, report: game.Threats}
 	}
 }
 
 // Messages
 type authSuccess struct {
-	token string
-	email string
-	name  string
+	cache *TokenCache
 }
 
+// sessionExpired is sent when the refresh token was rejected, so the user
+// has to log in again.
+type sessionExpired struct{}
+
 type registrationSuccess struct{}
 
 type gameLoaded struct {
-	game *GameData
+	game *client.GameStateResponse
 }
 
 type moveSubmitted struct {
-	game *GameData
+	game *client.GameStateResponse
 }
 
 type apiError struct {
@@ -1545,5 +1453,13 @@ type apiError struct {
 }
 
 type aiMoveReceived struct {
-	game *GameData
+	game *client.GameStateResponse
+}
+
+// threatsLoaded carries the threat report for a game after moves
+// half-moves.
+type threatsLoaded struct {
+	slug   string
+	moves  int
+	report *client.ThreatReport
 }
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/client"
+)
+
+// puzzleState is the puzzle screen's state: the puzzle, the solver's
+// moves, and the line played so far including the server's replies.
+type puzzleState struct {
+	puzzle *client.PuzzleResponse
+	moves  []string
+	line   []string
+	last   *client.PuzzleAttemptResponse
+}
+
+func (p *puzzleState) over() bool {
+	return p.last != nil && p.last.Result != client.AttemptCorrect
+}
+
+// squares replays the line from the puzzle's position for renderBoard.
+// Moves that don't apply are left off.
+func (p *puzzleState) squares() map[string][]*gotak.Stone {
+	b, player, _, err := gotak.ParseTPS(p.puzzle.TPS)
+	if err != nil {
+		return nil
+	}
+	for _, text := range p.line {
+		mv, err := gotak.NewMove(text)
+		if err != nil || b.DoMove(mv, player) != nil {
+			break
+		}
+		player = gotak.PlayerWhite + gotak.PlayerBlack - player
+	}
+	return b.Squares
+}
+
+func (m model) updatePuzzle(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", keyEsc:
+		m.screen = screenMenu
+		m.error = ""
+		return m, nil
+	case keyCtrlC:
+		return m, tea.Quit
+	case keyEnter:
+		if m.puzzle.puzzle == nil || m.puzzle.over() {
+			m.isLoading = true
+			return m, m.fetchPuzzle()
+		}
+		if m.moveInput != "" {
+			m.isLoading = true
+			return m, m.attemptPuzzle(append(append([]string{}, m.puzzle.moves...), m.moveInput))
+		}
+		return m, nil
+	case "backspace":
+		if len(m.moveInput) > 0 {
+			m.moveInput = m.moveInput[:len(m.moveInput)-1]
+		}
+		return m, nil
+	default:
+		if !m.puzzle.over() && gotak.IsValidMoveCharacter(msg.String()) {
+			m.moveInput += msg.String()
+		}
+		return m, nil
+	}
+}
+
+func (m model) viewPuzzle() string {
+	p := m.puzzle.puzzle
+	if p == nil {
+		text := "Loading puzzle..."
+		if m.error != "" {
+			text = "❌ " + m.error + "\n\nEnter: Try again | Q: Menu"
+		}
+		return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, titleStyle.Width(m.width).Render(text))
+	}
+
+	title := titleStyle.Width(m.width).Render(fmt.Sprintf("🧩 Puzzle %d (rated %d)", p.ID, p.Rating))
+	board := renderSquares(int(p.Size), m.puzzle.squares())
+
+	side := "White"
+	if p.ToMove == 2 {
+		side = "Black"
+	}
+	task := fmt.Sprintf("%s to move: complete a road", side)
+	if p.Depth > 1 {
+		task = fmt.Sprintf("%s to move: force a road in %d moves", side, p.Depth)
+	}
+	lines := []string{task}
+	if len(m.puzzle.line) > 0 {
+		lines = append(lines, "Played: "+strings.Join(m.puzzle.line, " "))
+	}
+
+	help := "Enter: Play move | Q: Menu"
+	if last := m.puzzle.last; last != nil && last.Result != client.AttemptCorrect {
+		verdict := "✅ Solved!"
+		if last.Result != client.AttemptSolved {
+			verdict = "❌ That lets the win go."
+		}
+		if last.Rating != 0 {
+			verdict += fmt.Sprintf(" Puzzle rating %d (%+d).", last.Rating, last.Change)
+		}
+		lines = append(lines, verdict, "Solution: "+strings.Join(last.Solution, " "))
+		help = "Enter: Next puzzle | Q: Menu"
+	}
+	status := menuItemStyle.Render(strings.Join(lines, "\n"))
+
+	cursor := ""
+	if !m.isLoading && !m.puzzle.over() {
+		cursor = "_"
+	}
+	inputArea := inputStyle.Width(60).Render(fmt.Sprintf("Move: %s%s", m.moveInput, cursor))
+
+	content := lipgloss.JoinVertical(lipgloss.Center, title, board, inputArea, status, menuItemStyle.Render(help))
+	if m.error != "" {
+		content = lipgloss.JoinVertical(lipgloss.Center, content, errorStyle.Width(m.width).Render("❌ "+m.error))
+	}
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, content)
+}
+
+// fetchPuzzle asks the server for the next puzzle at the user's rating.
+func (m model) fetchPuzzle() tea.Cmd {
+	api := m.session.api
+	return func() tea.Msg {
+		puzzle, err := api.NextPuzzle(context.Background(), "")
+		if err != nil {
+			return failed("No puzzle", err)
+		}
+		return puzzleLoaded{puzzle: puzzle}
+	}
+}
+
+// attemptPuzzle sends the solver's moves, ending with the new one.
+func (m model) attemptPuzzle(moves []string) tea.Cmd {
+	api, id := m.session.api, m.puzzle.puzzle.ID
+	return func() tea.Msg {
+		attempt, err := api.AttemptPuzzle(context.Background(), id, moves)
+		if err != nil {
+			return failed("Move failed", err)
+		}
+		return puzzleAttempted{id: id, moves: moves, attempt: attempt}
+	}
+}
+
+type puzzleLoaded struct {
+	puzzle *client.PuzzleResponse
+}
+
+type puzzleAttempted struct {
+	id      int64
+	moves   []string
+	attempt *client.PuzzleAttemptResponse
+}
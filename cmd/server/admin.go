@@ -0,0 +1,888 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/icco/gotak"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+// Audit log actions.
+const (
+	auditBanUser       = "ban_user"
+	auditUnbanUser     = "unban_user"
+	auditSetBot        = "set_bot"
+	auditGrantAdmin    = "grant_admin"
+	auditRevokeAdmin   = "revoke_admin"
+	auditAdjudicate    = "adjudicate_game"
+	auditDeleteGame    = "delete_game"
+	auditPurgeAnalysis = "purge_analysis_cache"
+)
+
+const (
+	defaultAdminPageLimit = 50
+	maxAdminPageLimit     = 100
+)
+
+var (
+	errUserBanned     = errors.New("account banned")
+	errAdminNotBanned = errors.New("admins can't be banned")
+	errAlreadyBanned  = errors.New("user is already banned")
+	errNotBanned      = errors.New("user is not banned")
+)
+
+// bannedProblem is the 403 for a banned user's request.
+func bannedProblem() *apiError {
+	return &apiError{status: http.StatusForbidden, code: codeBanned, detail: "this account has been banned"}
+}
+
+type BanRequest struct {
+	Reason string `json:"reason" example:"spamming game chat"`
+}
+
+func (req *BanRequest) validate() []FieldError {
+	return requireFields("reason", req.Reason)
+}
+
+// SetBotRequest marks an account as a bot or as a person.
+type SetBotRequest struct {
+	Bot *bool `json:"bot" example:"true"`
+}
+
+func (req *SetBotRequest) validate() []FieldError {
+	if req.Bot == nil {
+		return []FieldError{{Field: "bot", Message: "is required"}}
+	}
+	return nil
+}
+
+// AdjudicateRequest ends a game by decision: Winner is 1 for White, 2 for
+// Black, or 0 for a draw.
+type AdjudicateRequest struct {
+	Winner *int   `json:"winner" example:"1"`
+	Reason string `json:"reason" example:"black abandoned the game"`
+}
+
+func (req *AdjudicateRequest) validate() []FieldError {
+	fields := requireFields("reason", req.Reason)
+	if req.Winner == nil {
+		fields = append(fields, FieldError{Field: "winner", Message: "is required"})
+	} else if *req.Winner != 0 && *req.Winner != gotak.PlayerWhite && *req.Winner != gotak.PlayerBlack {
+		fields = append(fields, FieldError{Field: "winner", Message: "must be 0, 1 or 2"})
+	}
+	return fields
+}
+
+// AdminStatusResponse counts games and analysis jobs by status.
+type AdminStatusResponse struct {
+	Users            int64            `json:"users" example:"1200"`
+	BannedUsers      int64            `json:"banned_users" example:"3"`
+	Admins           int64            `json:"admins" example:"2"`
+	Games            map[string]int64 `json:"games"`
+	AnalysisJobs     map[string]int64 `json:"analysis_jobs"`
+	GameAnalyses     int64            `json:"game_analyses" example:"5400"`
+	PositionAnalyses int64            `json:"position_analyses" example:"880"`
+}
+
+type AdminUsersResponse struct {
+	Total int64  `json:"total" example:"1200"`
+	Users []User `json:"users"`
+}
+
+type AuditLogResponse struct {
+	Total   int64      `json:"total" example:"17"`
+	Entries []AuditLog `json:"entries"`
+}
+
+// PurgeAnalysisResponse counts the cached analyses removed.
+type PurgeAnalysisResponse struct {
+	GameAnalyses     int64 `json:"game_analyses" example:"40"`
+	PositionAnalyses int64 `json:"position_analyses" example:"0"`
+}
+
+// adminRoutes is the moderation API. It needs a password or OAuth
+// session of a user with the admin role; API tokens can't reach it.
+func adminRoutes(limits *rateLimiter) http.Handler {
+	r := chi.NewRouter()
+	r.Use(authMiddleware)
+	r.Use(limits.limit(settings.RateLimits.API))
+	r.Use(requireSession)
+	r.Use(requireAdmin)
+
+	r.Get("/status", adminStatusHandler)
+	r.Get("/users", adminListUsersHandler)
+	r.Post("/users/{id}/ban", adminBanUserHandler)
+	r.Post("/users/{id}/unban", adminUnbanUserHandler)
+	r.Put("/users/{id}/bot", adminSetBotHandler)
+	r.Post("/games/{slug}/adjudicate", adminAdjudicateGameHandler)
+	r.Delete("/games/{slug}", adminDeleteGameHandler)
+	r.Delete("/analysis-cache", adminPurgeAnalysisHandler)
+	r.Get("/audit", adminAuditLogHandler)
+	return r
+}
+
+// requireAdmin refuses users without the admin role.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getMustUserFromContext(r)
+		if user.Role != roleAdmin {
+			logging.FromContext(r.Context()).Warnw("admin route refused", "user_id", user.ID, "path", r.URL.Path)
+			writeProblem(w, r, newAPIError(http.StatusForbidden, "admin role required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordAudit adds an entry to the audit log. Call it in the transaction
+// that makes the change, so the change and its record stand or fall
+// together. A nil actor is the server admin command.
+func recordAudit(tx *gorm.DB, actor *User, action, targetType, targetID, detail string) error {
+	entry := AuditLog{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Detail:     detail,
+		CreatedAt:  time.Now(),
+	}
+	if actor != nil {
+		entry.ActorID = &actor.ID
+	}
+	return tx.Create(&entry).Error
+}
+
+// banUser bans a user, ends their sessions and revokes their API tokens.
+func banUser(db *gorm.DB, actor *User, id int64, reason string) (*User, error) {
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		switch {
+		case user.Role == roleAdmin:
+			return errAdminNotBanned
+		case user.BannedAt != nil:
+			return errAlreadyBanned
+		}
+
+		now := time.Now()
+		if err := tx.Model(&User{}).Where("id = ?", id).
+			Updates(map[string]any{"banned_at": now, "ban_reason": reason}).Error; err != nil {
+			return err
+		}
+		user.BannedAt, user.BanReason = &now, reason
+		if _, err := revokeAllSessions(tx, id); err != nil {
+			return err
+		}
+		if err := tx.Model(&APIToken{}).Where("user_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, auditBanUser, "user", strconv.FormatInt(id, 10), reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// unbanUser lifts a ban. The user has to sign in again; their old
+// sessions and tokens stay revoked.
+func unbanUser(db *gorm.DB, actor *User, id int64) (*User, error) {
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		if user.BannedAt == nil {
+			return errNotBanned
+		}
+		if err := tx.Model(&User{}).Where("id = ?", id).
+			Updates(map[string]any{"banned_at": nil, "ban_reason": ""}).Error; err != nil {
+			return err
+		}
+		user.BannedAt, user.BanReason = nil, ""
+		return recordAudit(tx, actor, auditUnbanUser, "user", strconv.FormatInt(id, 10), "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// setBot marks a user as a bot or not. Bots are labelled in games and
+// left off the human leaderboard, so only admins decide.
+func setBot(db *gorm.DB, actor *User, id int64, bot bool) (*User, error) {
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("id = ?", id).Update("bot", bot).Error; err != nil {
+			return err
+		}
+		user.Bot = bot
+		return recordAudit(tx, actor, auditSetBot, "user", strconv.FormatInt(id, 10), strconv.FormatBool(bot))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// adjudicateGame ends a game with the given result, whatever its state.
+func adjudicateGame(db *gorm.DB, actor *User, slug string, winner int, reason string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := updateGameStatus(tx, slug, winner); err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, auditAdjudicate, "game", slug, fmt.Sprintf("winner %d: %s", winner, reason))
+	})
+}
+
+// deleteGame removes a game with its moves, tags, board snapshots and
+// analyses. Callers cancel its analysis jobs first. Puzzles mined from
+// the game keep their own copy of the position and are left alone.
+func deleteGame(db *gorm.DB, actor *User, slug, reason string) error {
+	var game Game
+	if err := db.Select("id").Where("slug = ?", slug).First(&game).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{&Move{}, &Tag{}, &BoardSnapshot{}, &AnalysisCache{}, &AnalysisJob{}} {
+			if err := tx.Where("game_id = ?", game.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&Game{}, game.ID).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, auditDeleteGame, "game", slug, reason)
+	})
+}
+
+// adminStatus counts users, games, analysis jobs and cached analyses.
+func adminStatus(db *gorm.DB) (AdminStatusResponse, error) {
+	byStatus := func(model any) (map[string]int64, error) {
+		var rows []struct {
+			Status string
+			Count  int64
+		}
+		if err := db.Model(model).Select("status, count(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		out := make(map[string]int64, len(rows))
+		for _, row := range rows {
+			out[row.Status] = row.Count
+		}
+		return out, nil
+	}
+
+	var resp AdminStatusResponse
+	err := errors.Join(
+		db.Model(&User{}).Count(&resp.Users).Error,
+		db.Model(&User{}).Where("banned_at IS NOT NULL").Count(&resp.BannedUsers).Error,
+		db.Model(&User{}).Where("role = ?", roleAdmin).Count(&resp.Admins).Error,
+		db.Model(&AnalysisCache{}).Count(&resp.GameAnalyses).Error,
+		db.Model(&PositionAnalysisCache{}).Count(&resp.PositionAnalyses).Error,
+	)
+	if err == nil {
+		resp.Games, err = byStatus(&Game{})
+	}
+	if err == nil {
+		resp.AnalysisJobs, err = byStatus(&AnalysisJob{})
+	}
+	return resp, err
+}
+
+// purgeAnalysis deletes cached analyses: one game's, or with an empty slug
+// every game's and position's.
+func purgeAnalysis(db *gorm.DB, actor *User, slug string) (PurgeAnalysisResponse, error) {
+	var out PurgeAnalysisResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		target := "all"
+		if slug != "" {
+			var game Game
+			if err := tx.Select("id").Where("slug = ?", slug).First(&game).Error; err != nil {
+				return err
+			}
+			res := tx.Where("game_id = ?", game.ID).Delete(&AnalysisCache{})
+			if res.Error != nil {
+				return res.Error
+			}
+			out.GameAnalyses, target = res.RowsAffected, slug
+		} else {
+			res := tx.Where("1 = 1").Delete(&AnalysisCache{})
+			if res.Error != nil {
+				return res.Error
+			}
+			out.GameAnalyses = res.RowsAffected
+			res = tx.Where("1 = 1").Delete(&PositionAnalysisCache{})
+			if res.Error != nil {
+				return res.Error
+			}
+			out.PositionAnalyses = res.RowsAffected
+		}
+		detail := fmt.Sprintf("%d game analyses, %d position analyses", out.GameAnalyses, out.PositionAnalyses)
+		return recordAudit(tx, actor, auditPurgeAnalysis, "cache", target, detail)
+	})
+	return out, err
+}
+
+// setRole grants or revokes the admin role.
+func setRole(db *gorm.DB, actor *User, email, role string) (*User, error) {
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("email = ?", email).First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&User{}).Where("id = ?", user.ID).Update("role", role).Error; err != nil {
+			return err
+		}
+		user.Role = role
+		action := auditGrantAdmin
+		if role != roleAdmin {
+			action = auditRevokeAdmin
+		}
+		return recordAudit(tx, actor, action, "user", strconv.FormatInt(user.ID, 10), email)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// pageParams reads the limit and offset query parameters.
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	q := r.URL.Query()
+	limit = defaultAdminPageLimit
+	if raw := q.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxAdminPageLimit {
+			return 0, 0, newAPIError(http.StatusBadRequest, "limit must be between 1 and 100")
+		}
+	}
+	if raw := q.Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, newAPIError(http.StatusBadRequest, "offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
+
+// userModerationError maps a ban or unban failure to a problem.
+func userModerationError(err error) *apiError {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return newAPIError(http.StatusNotFound, "user not found")
+	case errors.Is(err, errAdminNotBanned):
+		return newAPIError(http.StatusForbidden, err.Error())
+	case errors.Is(err, errAlreadyBanned), errors.Is(err, errNotBanned):
+		return newAPIError(http.StatusConflict, err.Error())
+	}
+	return internalError("could not update user", err)
+}
+
+// @Summary Server status
+// @Description Counts users, games and analysis jobs by status, and the
+// @Description cached analyses. Admin only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} AdminStatusResponse
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/status [get]
+func adminStatusHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+	resp, err := store.AdminStatus()
+	if err != nil {
+		l.Errorw("could not count for status", zap.Error(err))
+		writeProblem(w, r, internalError("could not load status", err))
+		return
+	}
+
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary List users
+// @Description Lists users, newest first, optionally only those whose email
+// @Description or name contains query, or only banned ones. Admin only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param query query string false "Text to find in the email or name"
+// @Param banned query bool false "Only banned users"
+// @Param limit query int false "Maximum users (default 50, max 100)"
+// @Param offset query int false "Users to skip"
+// @Success 200 {object} AdminUsersResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/users [get]
+func adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("query"))
+	users, total, err := store.Users(query, r.URL.Query().Get("banned") == "true", limit, offset)
+	if err != nil {
+		l.Errorw("could not list users", zap.Error(err))
+		writeProblem(w, r, internalError("could not list users", err))
+		return
+	}
+	resp := AdminUsersResponse{Users: users, Total: total}
+
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Ban a user
+// @Description Bans a user: they are signed out everywhere, their API
+// @Description tokens are revoked and they can't sign in again until
+// @Description unbanned. Admins can't be banned. Admin only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User id"
+// @Param request body BanRequest true "Why the user is banned"
+// @Success 200 {object} User
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/users/{id}/ban [post]
+func adminBanUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+	admin := getMustUserFromContext(r)
+
+	id, err := strconv.ParseInt(chi.URLParamFromCtx(ctx, "id"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "invalid user id"))
+		return
+	}
+	var req BanRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	user, err := store.BanUser(admin, id, req.Reason)
+	if err != nil {
+		problem := userModerationError(err)
+		if problem.status == http.StatusInternalServerError {
+			l.Errorw("could not ban user", "user_id", id, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	l.Infow("user banned", "admin_id", admin.ID, "user_id", id, "reason", req.Reason)
+	if err := Renderer.JSON(w, http.StatusOK, user); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Unban a user
+// @Description Lifts a ban. The user signs in again to get new sessions and
+// @Description tokens. Admin only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User id"
+// @Success 200 {object} User
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/users/{id}/unban [post]
+func adminUnbanUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+	admin := getMustUserFromContext(r)
+
+	id, err := strconv.ParseInt(chi.URLParamFromCtx(ctx, "id"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "invalid user id"))
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	user, err := store.UnbanUser(admin, id)
+	if err != nil {
+		problem := userModerationError(err)
+		if problem.status == http.StatusInternalServerError {
+			l.Errorw("could not unban user", "user_id", id, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	l.Infow("user unbanned", "admin_id", admin.ID, "user_id", id)
+	if err := Renderer.JSON(w, http.StatusOK, user); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Mark a user as a bot
+// @Description Marks an account as a bot, or as a person. Bots are
+// @Description labelled in games and left off the leaderboard unless it is
+// @Description asked to include them. Admin only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "User id"
+// @Param request body SetBotRequest true "Whether the user is a bot"
+// @Success 200 {object} User
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/users/{id}/bot [put]
+func adminSetBotHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+	admin := getMustUserFromContext(r)
+
+	id, err := strconv.ParseInt(chi.URLParamFromCtx(ctx, "id"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "invalid user id"))
+		return
+	}
+	var req SetBotRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	user, err := store.SetBot(admin, id, *req.Bot)
+	if err != nil {
+		problem := userModerationError(err)
+		if problem.status == http.StatusInternalServerError {
+			l.Errorw("could not set bot flag", "user_id", id, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	l.Infow("bot flag set", "admin_id", admin.ID, "user_id", id, "bot", *req.Bot)
+	if err := Renderer.JSON(w, http.StatusOK, user); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Adjudicate a game
+// @Description Ends a game with the given result, whether or not it is
+// @Description over, for abandoned or disputed games. Winner is 1 for
+// @Description White, 2 for Black, or 0 for a draw. Admin only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Game slug"
+// @Param request body AdjudicateRequest true "Result and why"
+// @Success 200 {object} GameStateResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/games/{slug}/adjudicate [post]
+func adminAdjudicateGameHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+	admin := getMustUserFromContext(r)
+	slug := chi.URLParamFromCtx(ctx, "slug")
+
+	var req AdjudicateRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+	if err := store.AdjudicateGame(admin, slug, *req.Winner, req.Reason); err != nil {
+		problem := gameLoadError(err)
+		if problem.status == http.StatusInternalServerError {
+			l.Errorw("could not adjudicate game", "slug", slug, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+	l.Infow("game adjudicated", "admin_id", admin.ID, "slug", slug, "winner", *req.Winner, "reason", req.Reason)
+
+	resp, err := buildGameStateResponse(store, slug)
+	if err != nil {
+		l.Errorw("could not load adjudicated game", "slug", slug, zap.Error(err))
+		writeProblem(w, r, gameLoadError(err))
+		return
+	}
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Delete a game
+// @Description Deletes a game with its moves, tags and analyses, canceling
+// @Description analysis jobs for it. Puzzles taken from the game are kept.
+// @Description Admin only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Game slug"
+// @Param reason query string false "Why the game is deleted, for the audit log"
+// @Success 200 {object} MessageResponse
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/games/{slug} [delete]
+func adminDeleteGameHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+	admin := getMustUserFromContext(r)
+	slug := chi.URLParamFromCtx(ctx, "slug")
+	reason := r.URL.Query().Get("reason")
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	game, err := store.GameRecord(slug)
+	if err == nil && analysisJobs != nil {
+		var ids []string
+		if ids, err = store.GameAnalysisJobs(game.ID); err == nil {
+			for _, id := range ids {
+				analysisJobs.cancel(id)
+			}
+		}
+	}
+	if err == nil {
+		err = store.DeleteGame(admin, slug, reason)
+	}
+	if err != nil {
+		problem := gameLoadError(err)
+		if problem.status == http.StatusInternalServerError {
+			problem = internalError("could not delete game", err)
+			l.Errorw("could not delete game", "slug", slug, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	l.Infow("game deleted", "admin_id", admin.ID, "slug", slug, "reason", reason)
+	if err := Renderer.JSON(w, http.StatusOK, MessageResponse{Message: "game deleted"}); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Purge cached analyses
+// @Description Deletes cached analyses so they are searched again: one
+// @Description game's, or every game and position analysis when no game
+// @Description is given. Admin only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param game query string false "Slug of the game whose analyses to purge"
+// @Success 200 {object} PurgeAnalysisResponse
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/analysis-cache [delete]
+func adminPurgeAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	admin := getMustUserFromContext(r)
+	slug := r.URL.Query().Get("game")
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	resp, err := store.PurgeAnalysis(admin, slug)
+	if err != nil {
+		problem := gameLoadError(err)
+		if problem.status == http.StatusInternalServerError {
+			problem = internalError("could not purge analyses", err)
+			l.Errorw("could not purge analyses", "slug", slug, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	l.Infow("analysis cache purged", "admin_id", admin.ID, "slug", slug,
+		"game_analyses", resp.GameAnalyses, "position_analyses", resp.PositionAnalyses)
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Audit log
+// @Description Lists admin actions, newest first, optionally only one
+// @Description action: ban_user, unban_user, set_bot, grant_admin,
+// @Description revoke_admin, adjudicate_game, delete_game or
+// @Description purge_analysis_cache. Admin only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param action query string false "Only this action"
+// @Param limit query int false "Maximum entries (default 50, max 100)"
+// @Param offset query int false "Entries to skip"
+// @Success 200 {object} AuditLogResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/admin/audit [get]
+func adminAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	entries, total, err := store.AuditLog(r.URL.Query().Get("action"), limit, offset)
+	if err != nil {
+		l.Errorw("could not list audit log", zap.Error(err))
+		writeProblem(w, r, internalError("could not list audit log", err))
+		return
+	}
+	resp := AuditLogResponse{Entries: entries, Total: total}
+
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+const adminUsage = "usage: server admin grant | revoke <email>"
+
+// runAdmin is the admin subcommand, which grants or revokes the admin
+// role. It is how the first admin is made.
+func runAdmin(out io.Writer, url string, args []string) error {
+	if len(args) != 2 {
+		return errors.New(adminUsage)
+	}
+	role := roleUser
+	switch args[0] {
+	case "grant":
+		role = roleAdmin
+	case "revoke":
+	default:
+		return errors.New(adminUsage)
+	}
+
+	store, err := openStore(url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+
+	user, err := store.SetRole(nil, args[1], role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("no user with email %s", args[1])
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(out, "%s (user %d) is now %s\n", user.Email, user.ID, user.Role)
+	return nil
+}
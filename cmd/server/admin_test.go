@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+func TestBanUser(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	admin := &User{Provider: "local", ProviderID: "admin", Email: "admin@example.com", Name: "Admin", Role: roleAdmin}
+	if err := db.Create(admin).Error; err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+
+	session, _, err := createSession(db, user.ID, "")
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+	_, raw, err := createAPIToken(db, user.ID, "bot", []string{scopeRead}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+
+	banned, err := banUser(db, admin, user.ID, "spam")
+	if err != nil {
+		t.Fatalf("banUser: %v", err)
+	}
+	if banned.BannedAt == nil || banned.BanReason != "spam" {
+		t.Errorf("banned user = %+v", banned)
+	}
+	if _, err := activeSession(db, session.ID); !errors.Is(err, errSessionRevoked) {
+		t.Errorf("session after ban: err = %v, want errSessionRevoked", err)
+	}
+	if _, _, err := authenticateAPIToken(db, raw); err == nil {
+		t.Error("API token still works after ban")
+	}
+
+	if _, err := banUser(db, admin, user.ID, "spam"); !errors.Is(err, errAlreadyBanned) {
+		t.Errorf("second ban: err = %v, want errAlreadyBanned", err)
+	}
+	if _, err := banUser(db, admin, admin.ID, "spam"); !errors.Is(err, errAdminNotBanned) {
+		t.Errorf("banning an admin: err = %v, want errAdminNotBanned", err)
+	}
+
+	unbanned, err := unbanUser(db, admin, user.ID)
+	if err != nil || unbanned.BannedAt != nil || unbanned.BanReason != "" {
+		t.Fatalf("unbanUser = %+v, %v", unbanned, err)
+	}
+	if _, err := unbanUser(db, admin, user.ID); !errors.Is(err, errNotBanned) {
+		t.Errorf("second unban: err = %v, want errNotBanned", err)
+	}
+
+	// Only the changes that were made are audited.
+	var entries []AuditLog
+	if err := db.Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("load audit log: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != auditBanUser || entries[1].Action != auditUnbanUser {
+		t.Fatalf("audit log = %+v", entries)
+	}
+	if e := entries[0]; e.ActorID == nil || *e.ActorID != admin.ID || e.TargetType != "user" || e.Detail != "spam" {
+		t.Errorf("ban entry = %+v", e)
+	}
+}
+
+// TestAdminAccess checks who gets through to the admin API, and that a
+// banned user is refused everywhere.
+func TestAdminAccess(t *testing.T) {
+	useTestSettings(t)
+	store := setupTestStore(t)
+	db := storeDB(store)
+	router := buildRouter(routerOptions{IsDev: true, Store: store})
+
+	user := createTestUser(t, db)
+	tokens, err := issueTokens(&gormStore{db: db}, user, "test")
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	_, apiToken, err := createAPIToken(db, user.ID, "bot", []string{scopeRead}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+	get := func(path, token string) (int, Problem) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var p Problem
+		_ = json.Unmarshal(rec.Body.Bytes(), &p)
+		return rec.Code, p
+	}
+
+	if code, _ := get("/v1/admin/status", tokens.Token); code != http.StatusForbidden {
+		t.Errorf("GET /v1/admin/status as a user = %d", code)
+	}
+	if err := db.Model(user).Update("role", roleAdmin).Error; err != nil {
+		t.Fatalf("make admin: %v", err)
+	}
+	if code, _ := get("/v1/admin/status", tokens.Token); code != http.StatusOK {
+		t.Errorf("GET /v1/admin/status as an admin = %d", code)
+	}
+	if code, _ := get("/v1/admin/status", apiToken); code != http.StatusForbidden {
+		t.Errorf("GET /v1/admin/status with an API token = %d", code)
+	}
+	// The admin API has no unversioned alias.
+	if code, _ := get("/admin/status", tokens.Token); code != http.StatusNotFound {
+		t.Errorf("GET /admin/status = %d", code)
+	}
+
+	// A ban set while the session is live, as if it raced a login.
+	if err := db.Model(user).Updates(map[string]any{"role": roleUser, "banned_at": time.Now()}).Error; err != nil {
+		t.Fatalf("ban: %v", err)
+	}
+	for _, token := range []string{tokens.Token, apiToken} {
+		if code, p := get("/v1/auth/profile", token); code != http.StatusForbidden || p.Code != codeBanned {
+			t.Errorf("GET /v1/auth/profile while banned = %d %+v", code, p)
+		}
+	}
+}
+
+func TestAdjudicateGame(t *testing.T) {
+	db, slug, white, black := setupMoveGame(t, testSQLiteURL(t), 5)
+	playColumns(t, db, slug, white, black, 2)
+
+	if err := adjudicateGame(db, nil, slug, gotak.PlayerBlack, "white abandoned"); err != nil {
+		t.Fatalf("adjudicateGame: %v", err)
+	}
+	// The board has no winner, but the game is over all the same.
+	_, err := submitMove(db, slug, white.ID, gotak.PlayerWhite, "c1", "")
+	var ae *apiError
+	if !errors.As(err, &ae) || ae.code != codeGameOver {
+		t.Errorf("move after adjudication: err = %v, want %s", err, codeGameOver)
+	}
+	var game Game
+	if err := db.Where("slug = ?", slug).First(&game).Error; err != nil {
+		t.Fatalf("load game: %v", err)
+	}
+	if game.Status != "finished" || game.Winner != gotak.PlayerBlack || game.CurrentPlayer != gotak.PlayerWhite {
+		t.Errorf("game after adjudication = status %s, winner %d, to move %d", game.Status, game.Winner, game.CurrentPlayer)
+	}
+	var n int64
+	if err := db.Model(&AuditLog{}).Where("action = ? AND target_id = ?", auditAdjudicate, slug).Count(&n).Error; err != nil || n != 1 {
+		t.Errorf("adjudication audit entries = %d, %v", n, err)
+	}
+}
+
+func TestDeleteGame(t *testing.T) {
+	db, slug, white, black := setupMoveGame(t, testSQLiteURL(t), 5)
+	playColumns(t, db, slug, white, black, 4)
+	var game Game
+	if err := db.Where("slug = ?", slug).First(&game).Error; err != nil {
+		t.Fatalf("load game: %v", err)
+	}
+	for _, row := range []any{
+		&AnalysisCache{GameID: game.ID, Level: "easy", Style: "balanced", GameVersion: "v1"},
+		&AnalysisJob{ID: "job1", GameID: game.ID, Slug: slug, Engine: "builtin", Level: "easy", Style: "balanced", GameVersion: "v1", Status: jobDone},
+		&Puzzle{GameID: game.ID, PositionHash: "hash", TPS: "x5/x5/x5/x5/x5 1 1", Player: 1, Rating: 1500},
+		&Tag{GameID: game.ID, Key: "Event", Value: "Test"},
+	} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+
+	if err := deleteGame(db, nil, slug, "test game"); err != nil {
+		t.Fatalf("deleteGame: %v", err)
+	}
+	for _, model := range []any{&Game{}, &Move{}, &Tag{}, &BoardSnapshot{}, &AnalysisCache{}, &AnalysisJob{}} {
+		var n int64
+		if err := db.Model(model).Count(&n).Error; err != nil || n != 0 {
+			t.Errorf("%T rows left = %d, %v", model, n, err)
+		}
+	}
+	var puzzles int64
+	if err := db.Model(&Puzzle{}).Count(&puzzles).Error; err != nil || puzzles != 1 {
+		t.Errorf("puzzles = %d, %v; want the puzzle kept", puzzles, err)
+	}
+	var entry AuditLog
+	if err := db.Where("action = ?", auditDeleteGame).First(&entry).Error; err != nil || entry.TargetID != slug || entry.Detail != "test game" {
+		t.Errorf("audit entry = %+v, %v", entry, err)
+	}
+
+	if err := deleteGame(db, nil, slug, ""); err == nil {
+		t.Error("deleting a deleted game should fail")
+	}
+}
+
+func TestRunAdmin(t *testing.T) {
+	url := testSQLiteURL(t)
+	db, _, white, _ := setupMoveGame(t, url, 5)
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runAdmin(&out, url, args)
+		return out.String(), err
+	}
+
+	for _, args := range [][]string{nil, {"grant"}, {"promote", white.Email}, {"grant", white.Email, "extra"}} {
+		if _, err := run(args...); err == nil {
+			t.Errorf("admin %v should fail", args)
+		}
+	}
+	if _, err := run("grant", "nobody@example.com"); err == nil || !strings.Contains(err.Error(), "no user") {
+		t.Errorf("granting an unknown user = %v", err)
+	}
+
+	for _, tc := range []struct{ command, role string }{{"grant", roleAdmin}, {"revoke", roleUser}} {
+		out, err := run(tc.command, white.Email)
+		if err != nil || !strings.Contains(out, "is now "+tc.role) {
+			t.Errorf("admin %s = %q, %v", tc.command, out, err)
+		}
+		var user User
+		if err := db.First(&user, white.ID).Error; err != nil || user.Role != tc.role {
+			t.Errorf("role after %s = %q, %v", tc.command, user.Role, err)
+		}
+	}
+
+	var entries []AuditLog
+	if err := db.Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("load audit log: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != auditGrantAdmin || entries[1].Action != auditRevokeAdmin || entries[0].ActorID != nil {
+		t.Errorf("audit log = %+v", entries)
+	}
+}
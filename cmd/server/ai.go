@@ -1,9 +1,10 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"errors"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -13,30 +14,83 @@ import (
 	"go.uber.org/zap"
 )
 
-// AIRequest represents a request for an AI move
+// defaultAIMoveTimeLimit is the search time an AI move gets by default
+// when the request doesn't say.
+const defaultAIMoveTimeLimit = 10 * time.Second
+
+// AIRequest represents a request for an AI move. Seed makes the move
+// repeatable; without one the game's Seed tag is used. Nodes, if set,
+// replaces the time limit with a search budget so the same seed gives the
+// same move on any machine.
 type AIRequest struct {
-	Level       string        `json:"level"`
-	Style       string        `json:"style"`
-	TimeLimit   time.Duration `json:"time_limit"`
+	Level string `json:"level"`
+	Style string `json:"style"`
+	// TimeLimit is the search time in nanoseconds, capped at the server's
+	// maximum.
+	TimeLimit   time.Duration `json:"time_limit" swaggertype:"integer" example:"2000000000"`
 	Personality string        `json:"personality"`
+	Seed        int64         `json:"seed"`
+	Nodes       int64         `json:"nodes"`
 }
 
-// AIMoveResponse is the response for an AI move
+func (req *AIRequest) validate() []FieldError {
+	var out []FieldError
+	switch req.Level {
+	case "", "beginner", "intermediate", "advanced", "expert":
+	default:
+		out = append(out, FieldError{Field: "level", Message: "must be beginner, intermediate, advanced or expert"})
+	}
+	switch req.Style {
+	case "", "aggressive", "defensive", "balanced":
+	default:
+		out = append(out, FieldError{Field: "style", Message: "must be aggressive, defensive or balanced"})
+	}
+	if req.TimeLimit < 0 {
+		out = append(out, FieldError{Field: "time_limit", Message: "must not be negative"})
+	}
+	if req.Nodes < 0 {
+		out = append(out, FieldError{Field: "nodes", Message: "must not be negative"})
+	}
+	return out
+}
+
+// AIMoveResponse is the response for an AI move: the game state after it,
+// the move played and an explanation of what the move does. Book is true
+// when the move came from the opening book rather than a search.
 type AIMoveResponse struct {
+	*GameStateResponse
 	Move string `json:"move"`
 	Hint string `json:"hint,omitempty"`
+	Book bool   `json:"book,omitempty"`
 }
 
 // PostAIMoveHandler handles AI move requests
+// @Summary Have the AI move
+// @Description Play the AI's move in a game against the AI. The caller must
+// @Description be the game's human player and it must be the AI's turn.
+// @Tags ai
+// @Accept json
+// @Produce json
+// @Param slug path string true "Game slug identifier"
+// @Param request body AIRequest false "Engine settings"
+// @Success 200 {object} AIMoveResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Failure 503 {object} Problem
+// @Security BearerAuth
+// @Router /v1/game/{slug}/ai-move [post]
 func PostAIMoveHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "bad connection to db"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
 
@@ -45,36 +99,35 @@ func PostAIMoveHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 	if user == nil {
 		l.Errorw("unauthenticated request to AI move endpoint")
-		if err := Renderer.JSON(w, 401, map[string]string{"error": "unauthenticated"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusUnauthorized, "authentication required"))
 		return
 	}
 
-	err = verifyGameParticipation(db, slug, user.ID)
-	if err != nil {
+	// The AI's move is only recorded if the game is still at this version
+	// when the search finishes. Read it before the game so a move made in
+	// between shows up as a conflict.
+	dbGame, err := store.GameRecord(slug)
+	userPlayerNumber := gotak.PlayerNone
+	if err == nil {
+		userPlayerNumber = dbGame.playerOf(user.ID)
+	}
+	if userPlayerNumber == gotak.PlayerNone {
 		l.Errorw("user not authorized for game", "slug", slug, "user_id", user.ID, zap.Error(err))
-		if err := Renderer.JSON(w, 403, map[string]string{"error": "unauthorized"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, &apiError{status: http.StatusForbidden, code: codeNotParticipant, detail: "access denied: you are not a participant in this game"})
 		return
 	}
 
-	game, err := getGame(db, slug)
+	game, err := store.Game(slug)
 	if err != nil {
 		l.Errorw("could not get game", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, gameLoadError(err))
 		return
 	}
 
 	var req AIRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		l.Errorw("invalid AI request", zap.Error(err))
-		if err := Renderer.JSON(w, 400, map[string]string{"error": "invalid request"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	if err := decodeRequest(r, &req); err != nil {
+		l.Warnw("invalid AI request", zap.Error(err))
+		writeProblem(w, r, err)
 		return
 	}
 
@@ -84,7 +137,7 @@ func PostAIMoveHandler(w http.ResponseWriter, r *http.Request) {
 	case "beginner":
 		level = ai.Beginner
 	case "intermediate":
-		level = ai.Intermediate
+		level = ai.Intermediate // default
 	case "advanced":
 		level = ai.Advanced
 	case "expert":
@@ -101,163 +154,114 @@ func PostAIMoveHandler(w http.ResponseWriter, r *http.Request) {
 	case "defensive":
 		style = ai.Defensive
 	case "balanced":
-		style = ai.Balanced
+		style = ai.Balanced // default
 	default:
 		style = ai.Balanced // default
 	}
 
-	// Parse time limit (default to 10 seconds)
-	timeLimit := 10 * time.Second
-	if req.TimeLimit > 0 {
-		timeLimit = req.TimeLimit
-	}
-
-	cfg := ai.AIConfig{
-		Level:       level,
-		Style:       style,
-		TimeLimit:   timeLimit,
-		Personality: req.Personality,
-	}
-
-	engine := &ai.TakticianEngine{}
-	move, err := engine.GetMove(ctx, game, cfg)
-	if err != nil {
-		l.Errorw("AI move failed", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "AI move failed"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	hint, _ := engine.ExplainMove(ctx, game, cfg)
-
-	userPlayerNumber, err := getPlayerNumber(db, slug, user.ID)
-	if err != nil {
-		l.Errorw("could not get user player number", "slug", slug, "user_id", user.ID, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "internal server error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
+	timeLimit := settings.engineTime(req.TimeLimit, settings.Engines.MoveTime)
 
 	aiPlayerNumber := gotak.PlayerBlack
 	if userPlayerNumber == gotak.PlayerBlack {
 		aiPlayerNumber = gotak.PlayerWhite
 	}
 
-	var dbGame Game
-	if err := db.Where("slug = ?", slug).First(&dbGame).Error; err != nil {
-		l.Errorw("could not get game state for turn check", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not verify game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
 	if dbGame.CurrentPlayer != aiPlayerNumber {
 		l.Errorw("not AI's turn", "current_player", dbGame.CurrentPlayer, "ai_player", aiPlayerNumber)
-		if err := Renderer.JSON(w, 400, map[string]string{"error": "it's not the AI's turn"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, &apiError{status: http.StatusBadRequest, code: codeNotYourTurn, detail: "it's not the AI's turn"})
 		return
 	}
 
-	err = replayMoves(game)
+	seed, err := aiSeed(store, game, req.Seed)
 	if err != nil {
-		l.Errorw("could not replay moves for AI", zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not replay game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		l.Errorw("could not record game seed", "slug", slug, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "internal server error"))
 		return
 	}
 
-	err = game.DoSingleMove(move, aiPlayerNumber)
-	if err != nil {
-		l.Errorw("invalid AI move", "move", move, "player", aiPlayerNumber, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": fmt.Sprintf("AI generated invalid move: %v", err)}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	// Store the AI move in database - determine which turn this move belongs to
-	// Check if we need to complete an existing turn or start a new one
-	var currentTurn int64 = 1 // Default to turn 1 if no turns exist
-
-	if len(game.Turns) > 0 {
-		lastTurn := game.Turns[len(game.Turns)-1]
-		if lastTurn.First != nil && lastTurn.Second == nil {
-			// Incomplete turn - AI move should complete this turn
-			currentTurn = int64(len(game.Turns))
-		} else {
-			// Complete turn - AI move should start a new turn
-			currentTurn = int64(len(game.Turns)) + 1
-		}
+	cfg := ai.AIConfig{
+		Level:       level,
+		Style:       style,
+		TimeLimit:   timeLimit,
+		Personality: req.Personality,
+		Seed:        seed,
+		Nodes:       req.Nodes,
 	}
 
-	if err := insertMove(db, game.ID, aiPlayerNumber, move, currentTurn); err != nil {
-		l.Errorw("could not insert AI move", "move", move, "player", aiPlayerNumber, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not save AI move"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	// Games created before engines were selectable have no Engine tag and
+	// get the default engine.
+	engineName, _ := game.GetMeta("Engine")
+	engine, _, err := selectEngine(engineName, game.Board.Size, false)
+	if err != nil {
+		l.Errorw("game engine unavailable", "slug", slug, "engine", engineName, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusServiceUnavailable, "AI engine unavailable"))
 		return
 	}
 
-	// Reload the game state to get updated turns from database
-	game, err = getGame(db, slug)
+	move, book, err := ai.PlayMove(ctx, engine, game, cfg)
 	if err != nil {
-		l.Errorw("could not reload game after AI move", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not reload game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		l.Errorw("AI move failed", "slug", slug, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "AI move failed"))
 		return
 	}
 
-	// Update current player to switch turns.
-	// After AI move, check if current turn is complete based on updated game state.
-	var nextPlayer int
-	if len(game.Turns) > 0 {
-		lastTurn := game.Turns[len(game.Turns)-1]
-		if lastTurn.First != nil && lastTurn.Second != nil {
-			// Turn is complete, next player is always White (start of next turn).
-			nextPlayer = gotak.PlayerWhite
-		} else {
-			// Turn is incomplete, switch to the other player.
-			if aiPlayerNumber == gotak.PlayerWhite {
-				nextPlayer = gotak.PlayerBlack
-			} else {
-				nextPlayer = gotak.PlayerWhite
-			}
-		}
-	} else {
-		// No turns yet, start with White.
-		nextPlayer = gotak.PlayerWhite
-	}
-
-	if err := db.Model(&Game{}).Where("slug = ?", slug).Update("current_player", nextPlayer).Error; err != nil {
-		l.Errorw("could not update current player after AI move", "slug", slug, "next_player", nextPlayer, zap.Error(err))
-		// Continue - this is not fatal for AI move execution.
+	// Describe the move itself rather than calling ExplainMove, which
+	// would search the position a second time.
+	hint, err := ai.DescribeMove(game, move)
+	if err != nil {
+		l.Warnw("could not explain AI move", "slug", slug, "move", move, zap.Error(err))
 	}
 
-	winner, gameOver := game.GameOver()
-	if gameOver {
-		err = updateGameStatus(db, game.Slug, winner)
-		if err != nil {
-			l.Errorw("could not update game status after AI move", zap.Error(err))
+	if _, err := store.RecordMove(dbGame, aiPlayerNumber, move); err != nil {
+		l.Errorw("could not record AI move", "slug", slug, "move", move, "player", aiPlayerNumber, zap.Error(err))
+		problem := internalError("could not save AI move", err)
+		var ae *apiError
+		switch {
+		case errors.Is(err, errMoveConflict):
+			problem = &apiError{status: http.StatusConflict, code: codeMoveConflict, detail: "the game changed while the AI was thinking; reload and try again", err: err}
+		case errors.As(err, &ae) && ae.code == codeInvalidMove:
+			problem = &apiError{status: http.StatusInternalServerError, code: codeInternal, detail: "AI generated " + ae.detail, err: err}
+		case errors.As(err, &ae):
+			problem = ae
 		}
+		writeProblem(w, r, problem)
+		return
 	}
 
-	state, err := buildGameStateResponse(db, slug)
+	state, err := buildGameStateResponse(store, slug)
 	if err != nil {
 		l.Errorw("could not build game state after AI move", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not build game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not build game state"))
 		return
 	}
 
-	l.Infow("AI move executed", "slug", slug, "move", move, "hint", hint)
-	if err := Renderer.JSON(w, http.StatusOK, state); err != nil {
+	l.Infow("AI move executed", "slug", slug, "engine", engineName, "move", move, "book", book, "seed", seed, "nodes", cfg.Nodes, "hint", hint)
+	if err := Renderer.JSON(w, http.StatusOK, AIMoveResponse{GameStateResponse: state, Move: move, Hint: hint, Book: book}); err != nil {
 		l.Errorw("failed to render game response", zap.Error(err))
 	}
 }
+
+// aiSeed is the seed for the AI's next move in game: requested if given,
+// otherwise the game's Seed tag. A game without one is given a random seed
+// on its first AI move, so every game plays differently but can be
+// replayed from its PTN. A requested seed replaces the tag.
+func aiSeed(store Store, game *gotak.Game, requested int64) (int64, error) {
+	seed := requested
+	current, _ := game.GetMeta("Seed")
+	if seed == 0 {
+		if s, err := strconv.ParseInt(current, 10, 64); err == nil && s != 0 {
+			return s, nil
+		}
+		// Keep seeds within what JSON clients read exactly.
+		seed = rand.Int64N(1<<53-1) + 1 // #nosec G404 -- game variety, not security
+	}
+	if text := strconv.FormatInt(seed, 10); text != current {
+		if err := store.UpdateTag(game.Slug, "Seed", text); err != nil {
+			return 0, err
+		}
+		if err := game.UpdateMeta("Seed", text); err != nil {
+			return 0, err
+		}
+	}
+	return seed, nil
+}
@@ -1136,7 +1136,7 @@ func postAIMoveHandlerWithDB(w http.ResponseWriter, r *http.Request, db *gorm.DB
 		return
 	}
 
-	_, _ = engine.ExplainMove(ctx, game, cfg)
+	_, _ = ai.DescribeMove(game, move)
 
 	// Now execute the AI move in the game
 	// First, determine which player the AI is (opposite of human user)
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestAISeed(t *testing.T) {
+	store := setupTestStore(t)
+	user := createTestUser(t, storeDB(store))
+	slug, err := store.CreateGame(5, user.ID, "ai")
+	if err != nil {
+		t.Fatalf("createGame: %v", err)
+	}
+	game, err := store.Game(slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+
+	// The first AI move picks a seed and records it on the game.
+	seed, err := aiSeed(store, game, 0)
+	if err != nil || seed == 0 {
+		t.Fatalf("aiSeed = %d, %v", seed, err)
+	}
+	game, err = store.Game(slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+	if tag, _ := game.GetMeta("Seed"); tag != strconv.FormatInt(seed, 10) {
+		t.Errorf("Seed tag = %q, want %d", tag, seed)
+	}
+	if again, err := aiSeed(store, game, 0); err != nil || again != seed {
+		t.Errorf("second move seed = %d, %v; want the game's %d", again, err, seed)
+	}
+
+	// A requested seed wins and replaces the tag.
+	if got, err := aiSeed(store, game, 42); err != nil || got != 42 {
+		t.Errorf("requested seed = %d, %v", got, err)
+	}
+	game, err = store.Game(slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+	if tag, _ := game.GetMeta("Seed"); tag != "42" {
+		t.Errorf("Seed tag = %q, want 42", tag)
+	}
+	var tags int64
+	if err := storeDB(store).Model(&Tag{}).Where("game_id = ? AND key = ?", game.ID, "Seed").Count(&tags).Error; err != nil || tags != 1 {
+		t.Errorf("%d Seed tag rows, %v; want 1 after setting it twice", tags, err)
+	}
+	if got, _ := aiSeed(store, game, 0); got != 42 {
+		t.Errorf("later seed = %d, want 42", got)
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/icco/gotak/ai"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Analysis job states. Jobs move from queued to running and end in one of
+// the other three; a running job goes back to queued if its server stops.
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+const (
+	// defaultAnalysisWorkers is the worker pool size unless configured.
+	defaultAnalysisWorkers = 2
+	// analysisJobPoll is how often idle workers look for jobs queued by
+	// other server instances and for stale ones.
+	analysisJobPoll = 5 * time.Second
+	// analysisJobStale is how long a running job may go without recording
+	// a move, beyond the two searches a move takes, before it is assumed
+	// orphaned by a crashed server and queued again.
+	analysisJobStale = time.Minute
+)
+
+// analysisJobs is the server's worker pool. It is nil until main starts it;
+// jobs queued before then wait in the database.
+var analysisJobs *analysisQueue
+
+// AnalysisJobResponse is the payload returned by the analysis job
+// endpoints. Moves holds the moves analysed so far, in order.
+type AnalysisJobResponse struct {
+	ID         string         `json:"id"`
+	Slug       string         `json:"slug"`
+	Status     string         `json:"status" example:"running"`
+	Engine     string         `json:"engine"`
+	Level      string         `json:"level"`
+	Total      int            `json:"total"`
+	Completed  int            `json:"completed"`
+	Agreed     int            `json:"agreed"`
+	Moves      []MoveAnalysis `json:"moves"`
+	Error      string         `json:"error,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+func newAnalysisJobResponse(job *AnalysisJob) AnalysisJobResponse {
+	moves := job.moves()
+	return AnalysisJobResponse{
+		ID:         job.ID,
+		Slug:       job.Slug,
+		Status:     job.Status,
+		Engine:     job.Engine,
+		Level:      job.Level,
+		Total:      job.Total,
+		Completed:  len(moves),
+		Agreed:     countAgreed(moves),
+		Moves:      moves,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
+
+// moves decodes the results so far; a row that fails to decode counts as
+// having none, so a resumed job starts over rather than failing.
+func (j *AnalysisJob) moves() []MoveAnalysis {
+	moves := []MoveAnalysis{}
+	if j.Moves != "" {
+		if err := json.Unmarshal([]byte(j.Moves), &moves); err != nil {
+			return []MoveAnalysis{}
+		}
+	}
+	return moves
+}
+
+func (j *AnalysisJob) cacheKey() analysisCacheKey {
+	return analysisCacheKey{
+		gameID:      j.GameID,
+		engine:      j.Engine,
+		level:       j.Level,
+		style:       j.Style,
+		timeLimitNs: j.TimeLimitNs,
+		gameVersion: j.GameVersion,
+		seed:        j.Seed,
+		nodes:       j.Nodes,
+	}
+}
+
+// config rebuilds the engine config the job was queued with.
+func (j *AnalysisJob) config() ai.AIConfig {
+	cfg, _ := analyzeConfigFromRequest(AnalyzeRequest{
+		Level:     j.Level,
+		Style:     j.Style,
+		TimeLimit: time.Duration(j.TimeLimitNs),
+		Seed:      j.Seed,
+		Nodes:     j.Nodes,
+	})
+	return cfg
+}
+
+func countAgreed(moves []MoveAnalysis) int {
+	agreed := 0
+	for _, m := range moves {
+		if m.Agreed {
+			agreed++
+		}
+	}
+	return agreed
+}
+
+// newAnalysisJobID returns a random 128-bit id, hex encoded, so job ids
+// can't be guessed.
+func newAnalysisJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// enqueueAnalysisJob stores job, filling in its id and status. An active
+// job with the same settings is returned instead, and a cached analysis
+// (or a game without moves) yields a job that is already done.
+func enqueueAnalysisJob(store Store, l *zap.SugaredLogger, job *AnalysisJob) (*AnalysisJob, error) {
+	k := job.cacheKey()
+	active, err := store.ActiveAnalysisJob(k)
+	if err == nil {
+		return active, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if job.ID, err = newAnalysisJobID(); err != nil {
+		return nil, err
+	}
+	job.Status, job.Moves = jobQueued, "[]"
+	cached, ok, err := store.LoadAnalysis(k)
+	if err != nil {
+		l.Warnw("analysis cache lookup failed", zap.Error(err))
+	}
+	if ok || job.Total == 0 {
+		encoded, err := json.Marshal(cached.Moves)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		job.Status, job.FinishedAt = jobDone, &now
+		if cached.Moves != nil {
+			job.Moves = string(encoded)
+		}
+	}
+	if err := store.CreateAnalysisJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// analysisQueue is a pool of workers draining the analysis_jobs table.
+// Several servers can share the table: workers claim a job by moving it
+// from queued to running in one conditional update.
+type analysisQueue struct {
+	store   Store
+	workers int
+	// selectEngine is swapped out in tests.
+	selectEngine func(name string, size int64, analysis bool) (ai.Engine, ai.EngineInfo, error)
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+
+	mu sync.Mutex
+	// running cancels the jobs this server is working on.
+	running map[string]context.CancelFunc
+}
+
+func newAnalysisQueue(store Store, workers int) *analysisQueue {
+	return &analysisQueue{
+		store:        store,
+		workers:      max(workers, 1),
+		selectEngine: selectEngine,
+		wake:         make(chan struct{}, 1),
+		running:      map[string]context.CancelFunc{},
+	}
+}
+
+// start launches the workers. They stop when ctx is done, putting the
+// jobs they were running back in the queue; wait blocks until they have.
+func (q *analysisQueue) start(ctx context.Context) {
+	q.requeueStale()
+	for range q.workers {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+}
+
+func (q *analysisQueue) wait() {
+	q.wg.Wait()
+}
+
+// notify wakes an idle worker after a job is queued. It is safe to call on
+// a nil queue.
+func (q *analysisQueue) notify() {
+	if q == nil {
+		return
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *analysisQueue) work(ctx context.Context) {
+	defer q.wg.Done()
+	ticker := time.NewTicker(analysisJobPoll)
+	defer ticker.Stop()
+	for {
+		for q.runOnce(ctx) {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+			q.requeueStale()
+		}
+	}
+}
+
+// runOnce claims and runs one job, and reports whether there was one.
+func (q *analysisQueue) runOnce(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	job, err := q.store.ClaimAnalysisJob()
+	if err != nil {
+		log.Warnw("could not claim analysis job", zap.Error(err))
+		return false
+	}
+	if job == nil {
+		return false
+	}
+	q.process(ctx, job)
+	return true
+}
+
+// process analyses the job's remaining moves, recording each one as it
+// goes so progress is visible and a restarted job resumes where it was.
+func (q *analysisQueue) process(ctx context.Context, job *AnalysisJob) {
+	l := log.With("job", job.ID, "slug", job.Slug)
+	jobCtx, cancel := context.WithCancel(ctx)
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+		cancel()
+	}()
+
+	game, err := q.store.Game(job.Slug)
+	if err != nil {
+		l.Warnw("analysis job game unavailable", zap.Error(err))
+		q.finish(job.ID, jobFailed, "game not found")
+		return
+	}
+	engine, _, err := q.selectEngine(job.Engine, game.Board.Size, true)
+	if err != nil {
+		l.Warnw("analysis job engine unavailable", zap.Error(err))
+		q.finish(job.ID, jobFailed, err.Error())
+		return
+	}
+
+	// Moves played after the job was queued aren't part of it.
+	half := gameHalfMoves(game)
+	if len(half) < job.Total {
+		q.finish(job.ID, jobFailed, "game has fewer moves than when analysis was requested")
+		return
+	}
+	half = half[:job.Total]
+
+	cfg := job.config()
+	moves := job.moves()
+	for i := len(moves); i < len(half); i++ {
+		m := evaluateMove(jobCtx, engine, game, half[i], cfg)
+		if jobCtx.Err() != nil {
+			if ctx.Err() != nil {
+				// Shutting down: leave the job for the next server.
+				q.setStatus(job.ID, jobRunning, jobQueued)
+			}
+			return
+		}
+		moves = append(moves, m)
+		if !q.progress(job.ID, moves) {
+			l.Infow("analysis job stopped: canceled or taken over")
+			return
+		}
+	}
+
+	if err := q.store.SaveAnalysis(job.cacheKey(), countAgreed(moves), moves); err != nil {
+		l.Warnw("could not save analysis cache row", zap.Error(err))
+	}
+	minePuzzles(q.store, l, job.GameID, game, half, moves)
+	q.finish(job.ID, jobDone, "")
+}
+
+// progress stores the moves analysed so far, which doubles as the job's
+// heartbeat. It returns false once the job is no longer running here.
+func (q *analysisQueue) progress(id string, moves []MoveAnalysis) bool {
+	encoded, err := json.Marshal(moves)
+	if err != nil {
+		log.Warnw("could not encode analysis progress", "job", id, zap.Error(err))
+		return true
+	}
+	running, err := q.store.UpdateAnalysisJob(id, jobRunning, map[string]any{"moves": string(encoded), "updated_at": time.Now()})
+	if err != nil {
+		log.Warnw("could not record analysis progress", "job", id, zap.Error(err))
+		return true
+	}
+	return running
+}
+
+// finish ends a running job.
+func (q *analysisQueue) finish(id, status, message string) {
+	_, err := q.store.UpdateAnalysisJob(id, jobRunning, map[string]any{"status": status, "error": message, "finished_at": time.Now()})
+	if err != nil {
+		log.Warnw("could not finish analysis job", "job", id, "status", status, zap.Error(err))
+	}
+}
+
+// setStatus moves a job from one state to another, reporting whether it
+// was in the from state.
+func (q *analysisQueue) setStatus(id, from, to string) bool {
+	ok, err := q.store.UpdateAnalysisJob(id, from, map[string]any{"status": to, "updated_at": time.Now()})
+	if err != nil {
+		log.Warnw("could not update analysis job", "job", id, "status", to, zap.Error(err))
+		return false
+	}
+	return ok
+}
+
+// requeueStale puts running jobs whose server stopped recording progress
+// back in the queue.
+func (q *analysisQueue) requeueStale() {
+	jobs, err := q.store.RunningAnalysisJobs()
+	if err != nil {
+		log.Warnw("could not look for stale analysis jobs", zap.Error(err))
+		return
+	}
+	for _, job := range jobs {
+		cutoff := time.Now().Add(-analysisJobStale - 2*time.Duration(job.TimeLimitNs))
+		if !job.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		requeued, err := q.store.RequeueAnalysisJob(job.ID, cutoff)
+		if err != nil {
+			log.Warnw("could not requeue analysis job", "job", job.ID, zap.Error(err))
+		} else if requeued {
+			log.Infow("requeued stale analysis job", "job", job.ID)
+		}
+	}
+}
+
+// cancel marks a queued or running job canceled and stops it if it is
+// running on this server. Workers elsewhere stop at their next move.
+func (q *analysisQueue) cancel(id string) bool {
+	canceled := false
+	for _, from := range []string{jobQueued, jobRunning} {
+		ok, err := q.store.UpdateAnalysisJob(id, from, map[string]any{"status": jobCanceled, "finished_at": time.Now()})
+		if err != nil {
+			log.Warnw("could not cancel analysis job", "job", id, zap.Error(err))
+			return false
+		}
+		canceled = canceled || ok
+	}
+	q.mu.Lock()
+	if stop, ok := q.running[id]; ok {
+		stop()
+	}
+	q.mu.Unlock()
+	return canceled
+}
+
+// @Summary Get an analysis job
+// @Description Reports a game analysis job's status and the moves analysed
+// @Description so far. Finished jobs carry the full analysis.
+// @Tags analysis
+// @Produce json
+// @Param id path string true "Job id"
+// @Success 200 {object} AnalysisJobResponse
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/analyze/jobs/{id} [get]
+func getAnalysisJobHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	_, job, ok := loadAnalysisJob(w, r, l)
+	if !ok {
+		return
+	}
+	if err := Renderer.JSON(w, http.StatusOK, newAnalysisJobResponse(job)); err != nil {
+		l.Errorw("failed to render analysis job", zap.Error(err))
+	}
+}
+
+// @Summary Cancel an analysis job
+// @Description Cancels a queued or running analysis job. Jobs started by a
+// @Description signed-in user can only be canceled by that user.
+// @Tags analysis
+// @Produce json
+// @Param id path string true "Job id"
+// @Success 200 {object} AnalysisJobResponse
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/analyze/jobs/{id} [delete]
+func cancelAnalysisJobHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	store, job, ok := loadAnalysisJob(w, r, l)
+	if !ok {
+		return
+	}
+
+	if job.UserID != nil {
+		if user := getUserFromContext(r); user == nil || user.ID != *job.UserID {
+			writeProblem(w, r, newAPIError(http.StatusForbidden, "only the user who started this analysis can cancel it"))
+			return
+		}
+	}
+
+	q := analysisJobs
+	if q == nil {
+		q = newAnalysisQueue(store, 1)
+	}
+	if !q.cancel(job.ID) {
+		writeProblem(w, r, newAPIError(http.StatusConflict, "analysis job already finished"))
+		return
+	}
+
+	if reloaded, err := store.AnalysisJob(job.ID); err != nil {
+		l.Errorw("could not reload analysis job", "job", job.ID, zap.Error(err))
+	} else {
+		job = reloaded
+	}
+	if err := Renderer.JSON(w, http.StatusOK, newAnalysisJobResponse(job)); err != nil {
+		l.Errorw("failed to render analysis job", zap.Error(err))
+	}
+}
+
+// loadAnalysisJob handles the store + lookup boilerplate for the job
+// endpoints, writing the error response itself.
+func loadAnalysisJob(w http.ResponseWriter, r *http.Request, l *zap.SugaredLogger) (Store, *AnalysisJob, bool) {
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
+		return nil, nil, false
+	}
+
+	id := ugcPolicy.Sanitize(chi.URLParamFromCtx(r.Context(), "id"))
+	job, err := store.AnalysisJob(id)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			l.Errorw("could not load analysis job", "job", id, zap.Error(err))
+		}
+		writeProblem(w, r, newAPIError(http.StatusNotFound, "analysis job not found"))
+		return nil, nil, false
+	}
+	return store, job, true
+}
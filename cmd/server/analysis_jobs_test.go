@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// queueTestJob stores a five-by-five game with three half-moves and queues
+// its analysis for user the way postAnalyzeHandler does.
+func queueTestJob(t *testing.T, db *gorm.DB, user *User) *AnalysisJob {
+	t.Helper()
+	slug, err := createGame(db, 5, user.ID, "human")
+	if err != nil {
+		t.Fatalf("createGame: %v", err)
+	}
+	id, err := getGameID(db, slug)
+	if err != nil {
+		t.Fatalf("getGameID: %v", err)
+	}
+	for _, m := range []struct {
+		player int
+		text   string
+		turn   int64
+	}{{gotak.PlayerWhite, "a1", 1}, {gotak.PlayerBlack, "e5", 1}, {gotak.PlayerWhite, "c3", 2}} {
+		if err := insertMove(db, id, m.player, m.text, m.turn); err != nil {
+			t.Fatalf("insertMove: %v", err)
+		}
+	}
+	game, err := getGame(db, slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+
+	job, err := enqueueAnalysisJob(&gormStore{db: db}, zap.NewNop().Sugar(), &AnalysisJob{
+		GameID:      id,
+		Slug:        slug,
+		UserID:      &user.ID,
+		Engine:      "stub",
+		Level:       "intermediate",
+		Style:       "balanced",
+		TimeLimitNs: int64(time.Second),
+		GameVersion: gameCacheVersion(game),
+		Total:       len(gameHalfMoves(game)),
+	})
+	if err != nil {
+		t.Fatalf("enqueueAnalysisJob: %v", err)
+	}
+	return job
+}
+
+func stubQueue(db *gorm.DB, engine *stubEngine) *analysisQueue {
+	q := newAnalysisQueue(&gormStore{db: db}, 1)
+	q.selectEngine = func(name string, _ int64, _ bool) (ai.Engine, ai.EngineInfo, error) {
+		return engine, ai.EngineInfo{Name: name}, nil
+	}
+	return q
+}
+
+func reloadJob(t *testing.T, db *gorm.DB, id string) *AnalysisJob {
+	t.Helper()
+	var job AnalysisJob
+	if err := db.First(&job, "id = ?", id).Error; err != nil {
+		t.Fatalf("reload job %s: %v", id, err)
+	}
+	return &job
+}
+
+func TestAnalysisJob_runsToDone(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	job := queueTestJob(t, db, user)
+	if job.Status != jobQueued || job.Total != 3 || len(job.ID) != 32 {
+		t.Fatalf("queued job = %+v", job)
+	}
+
+	// Asking again while the job is pending returns the same job.
+	again, err := enqueueAnalysisJob(&gormStore{db: db}, zap.NewNop().Sugar(), &AnalysisJob{
+		GameID: job.GameID, Slug: job.Slug, Engine: job.Engine, Level: job.Level, Style: job.Style,
+		TimeLimitNs: job.TimeLimitNs, GameVersion: job.GameVersion, Total: job.Total,
+	})
+	if err != nil || again.ID != job.ID {
+		t.Fatalf("second enqueue = %+v, %v; want job %s", again, err, job.ID)
+	}
+
+	engine := &stubEngine{moves: []string{"a1", "e5", "c3"}}
+	q := stubQueue(db, engine)
+	if !q.runOnce(context.Background()) {
+		t.Fatal("runOnce found no job")
+	}
+	if q.runOnce(context.Background()) {
+		t.Error("queue should be empty")
+	}
+
+	resp := newAnalysisJobResponse(reloadJob(t, db, job.ID))
+	if resp.Status != jobDone || resp.Completed != 3 || resp.Agreed != 3 || resp.FinishedAt == nil {
+		t.Errorf("finished job = %+v", resp)
+	}
+	if _, ok, err := loadAnalysisCache(db, job.cacheKey()); err != nil || !ok {
+		t.Errorf("finished job should fill the analysis cache: %v", err)
+	}
+
+	// With the cache filled, a new request is done straight away.
+	cached, err := enqueueAnalysisJob(&gormStore{db: db}, zap.NewNop().Sugar(), &AnalysisJob{
+		GameID: job.GameID, Slug: job.Slug, Engine: job.Engine, Level: job.Level, Style: job.Style,
+		TimeLimitNs: job.TimeLimitNs, GameVersion: job.GameVersion, Total: job.Total,
+	})
+	if err != nil {
+		t.Fatalf("enqueue after cache: %v", err)
+	}
+	if cached.ID == job.ID || cached.Status != jobDone || len(cached.moves()) != 3 {
+		t.Errorf("cached job = %+v", cached)
+	}
+}
+
+func TestAnalysisJob_cancel(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	job := queueTestJob(t, db, user)
+	engine := &stubEngine{}
+	q := stubQueue(db, engine)
+
+	if !q.cancel(job.ID) {
+		t.Fatal("cancel of a queued job should succeed")
+	}
+	if q.cancel(job.ID) {
+		t.Error("a canceled job can't be canceled again")
+	}
+	if q.runOnce(context.Background()) || engine.calls != 0 {
+		t.Errorf("canceled job ran: %d engine calls", engine.calls)
+	}
+	if got := reloadJob(t, db, job.ID); got.Status != jobCanceled || got.FinishedAt == nil {
+		t.Errorf("job = %+v", got)
+	}
+
+	// A running job notices at its next move.
+	running := queueTestJob(t, db, user)
+	claimed, err := q.store.ClaimAnalysisJob()
+	if err != nil || claimed == nil || claimed.ID != running.ID {
+		t.Fatalf("claim = %+v, %v", claimed, err)
+	}
+	q.cancel(running.ID)
+	if q.progress(running.ID, []MoveAnalysis{{Played: "a1"}}) {
+		t.Error("progress on a canceled job should report it stopped")
+	}
+}
+
+func TestAnalysisJob_resumesStaleJob(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	job := queueTestJob(t, db, user)
+	q := stubQueue(db, &stubEngine{moves: []string{"a1", "e5", "c3"}})
+
+	// A server claims the job, records one move and dies.
+	if claimed, err := q.store.ClaimAnalysisJob(); err != nil || claimed == nil {
+		t.Fatalf("claim = %+v, %v", claimed, err)
+	}
+	if !q.progress(job.ID, []MoveAnalysis{{Turn: 1, Player: gotak.PlayerWhite, Played: "a1", Best: "a1", Agreed: true}}) {
+		t.Fatal("progress should record")
+	}
+
+	q.requeueStale()
+	if got := reloadJob(t, db, job.ID); got.Status != jobRunning {
+		t.Fatalf("fresh job was requeued: %+v", got)
+	}
+	stale := time.Now().Add(-analysisJobStale - 3*time.Second)
+	if err := db.Model(&AnalysisJob{}).Where("id = ?", job.ID).UpdateColumn("updated_at", stale).Error; err != nil {
+		t.Fatalf("age job: %v", err)
+	}
+	q.requeueStale()
+	if got := reloadJob(t, db, job.ID); got.Status != jobQueued || len(got.moves()) != 1 {
+		t.Fatalf("stale job = %+v", got)
+	}
+
+	engine := &stubEngine{moves: []string{"a1", "e5", "c3"}}
+	q = stubQueue(db, engine)
+	if !q.runOnce(context.Background()) {
+		t.Fatal("runOnce found no job")
+	}
+	if engine.calls != 2 {
+		t.Errorf("engine calls = %d, want 2 for the two remaining moves", engine.calls)
+	}
+	if got := reloadJob(t, db, job.ID); got.Status != jobDone || len(got.moves()) != 3 {
+		t.Errorf("resumed job = %+v", got)
+	}
+}
+
+func TestAnalysisJob_shutdownRequeues(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	job := queueTestJob(t, db, user)
+	q := stubQueue(db, &stubEngine{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	claimed, err := q.store.ClaimAnalysisJob()
+	if err != nil || claimed == nil {
+		t.Fatalf("claim = %+v, %v", claimed, err)
+	}
+	cancel()
+	q.process(ctx, claimed)
+	if got := reloadJob(t, db, job.ID); got.Status != jobQueued {
+		t.Errorf("job after shutdown = %+v, want queued", got)
+	}
+}
+
+func TestAnalysisJob_missingGameFails(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	job := queueTestJob(t, db, user)
+	if err := db.Model(&AnalysisJob{}).Where("id = ?", job.ID).Update("slug", "gone").Error; err != nil {
+		t.Fatalf("update slug: %v", err)
+	}
+	q := stubQueue(db, &stubEngine{})
+	q.runOnce(context.Background())
+	if got := reloadJob(t, db, job.ID); got.Status != jobFailed || got.Error == "" {
+		t.Errorf("job = %+v, want failed", got)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"time"
 
@@ -18,16 +17,26 @@ import (
 	"gorm.io/gorm/clause"
 )
 
-// defaultAnalyzeTimeLimit is the per-move budget the engine gets when the
-// caller doesn't supply one. Two seconds at Advanced is enough to flag
-// most obvious blunders without making a 50-move analysis last forever.
+// defaultAnalyzeTimeLimit is the per-move budget the engine gets by
+// default when the caller doesn't supply one. Two seconds at Advanced is
+// enough to flag most obvious blunders without making a 50-move analysis
+// last forever.
 const defaultAnalyzeTimeLimit = 2 * time.Second
 
 // AnalyzeRequest configures the analysis engine. All fields are optional.
 type AnalyzeRequest struct {
-	Level     string        `json:"level"`
-	Style     string        `json:"style"`
-	TimeLimit time.Duration `json:"time_limit"`
+	Level string `json:"level"`
+	Style string `json:"style"`
+	// TimeLimit is the search time in nanoseconds, capped at the server's
+	// maximum.
+	TimeLimit time.Duration `json:"time_limit" swaggertype:"integer" example:"2000000000"`
+	// Engine names a registered engine with analysis support (see
+	// GET /v1/ai/engines). Empty means the default engine.
+	Engine string `json:"engine"`
+	// Seed and Nodes make the analysis repeatable: Nodes replaces the time
+	// limit with a search budget and Seed fixes the engine's tie-breaking.
+	Seed  int64 `json:"seed,omitempty"`
+	Nodes int64 `json:"nodes,omitempty"`
 }
 
 // MoveAnalysis is the engine's verdict on a single move (one half-turn).
@@ -39,108 +48,185 @@ type MoveAnalysis struct {
 	Played string `json:"played"`
 	Best   string `json:"best"`
 	Agreed bool   `json:"agreed"`
+	// EvalBefore and EvalAfter are the position before and after the
+	// played move, both from the mover's point of view.
+	EvalBefore *Evaluation `json:"eval_before,omitempty"`
+	EvalAfter  *Evaluation `json:"eval_after,omitempty"`
+	// Loss is how much the move lowered the mover's win probability, from
+	// 0 to 1.
+	Loss           float64        `json:"loss"`
+	Classification Classification `json:"classification,omitempty"`
+	// Explanation describes what the played move does: roads it completes,
+	// threatens or blocks, the flat count and so on.
+	Explanation string `json:"explanation,omitempty"`
+	// MissedWin is the forced road win the mover had and the played move
+	// gave up: their winning move, then the best defence and so on.
+	MissedWin []string `json:"missed_win,omitempty"`
 	// Error captures why the engine couldn't evaluate this move, if any.
 	// When non-empty, Best and Agreed should be ignored.
 	Error string `json:"error,omitempty"`
 }
 
-// AnalyzeResponse is the payload returned by POST /analyze/game/{slug}.
+// Evaluation is an engine's assessment of a position for one player.
+type Evaluation struct {
+	// ScoreCP is in centiflats; positive favours the player.
+	ScoreCP int `json:"score_cp"`
+	// Mate is non-zero for a forced win (positive) or loss (negative) in
+	// that many moves.
+	Mate           int      `json:"mate,omitempty"`
+	WinProbability float64  `json:"win_probability"`
+	Depth          int      `json:"depth"`
+	Nodes          int64    `json:"nodes"`
+	PV             []string `json:"pv,omitempty"`
+	// Result is "win", "loss" or "draw" once the game is over; there is
+	// nothing left to search then.
+	Result string `json:"result,omitempty"`
+}
+
+// Classification grades a move by its Loss.
+type Classification string
+
+// Move classifications, best to worst.
+const (
+	ClassBest       Classification = "best"
+	ClassGood       Classification = "good"
+	ClassInaccuracy Classification = "inaccuracy"
+	ClassMistake    Classification = "mistake"
+	ClassBlunder    Classification = "blunder"
+	// ClassMissedWin marks a move that gave up a forced road win, whatever
+	// its Loss.
+	ClassMissedWin Classification = "missed_win"
+)
+
+// Win-probability losses at which a move stops being good, an inaccuracy
+// and a mistake respectively.
+const (
+	inaccuracyLoss = 0.05
+	mistakeLoss    = 0.10
+	blunderLoss    = 0.15
+)
+
+// classifyMove grades a move. The engine's own choice is always best, even
+// when a deeper look at the resulting position scores it lower.
+func classifyMove(agreed bool, loss float64) Classification {
+	switch {
+	case agreed:
+		return ClassBest
+	case loss < inaccuracyLoss:
+		return ClassGood
+	case loss < mistakeLoss:
+		return ClassInaccuracy
+	case loss < blunderLoss:
+		return ClassMistake
+	default:
+		return ClassBlunder
+	}
+}
+
+// AnalyzeResponse is a complete game analysis as stored in AnalysisCache.
+// The analysis endpoints report it through AnalysisJobResponse.
 type AnalyzeResponse struct {
 	Slug      string         `json:"slug"`
 	Size      int64          `json:"size"`
 	Level     string         `json:"level"`
+	Engine    string         `json:"engine"`
 	Moves     []MoveAnalysis `json:"moves"`
 	MoveCount int            `json:"move_count"`
 	Agreed    int            `json:"agreed"`
 }
 
 // @Summary Analyze a game move-by-move
-// @Description Walks the game move-by-move, asking the AI engine what it
-// @Description would play at each position, and records whether the player's
-// @Description move matches. Useful as a rough "blunder detector".
+// @Description Queues an analysis job that walks the game move-by-move,
+// @Description asking the AI engine what it would play at each position and
+// @Description how it scores the positions before and after the player's
+// @Description move. Each move gets a loss (drop in win probability) and a
+// @Description classification from best to blunder. Poll the returned job at
+// @Description GET /analyze/jobs/{id}. A job that is already queued for the
+// @Description same game and settings is returned instead of a new one, and
+// @Description cached results come back as a finished job.
 // @Tags analysis
 // @Accept json
 // @Produce json
 // @Param slug path string true "Game slug identifier"
 // @Param request body AnalyzeRequest false "Engine config (optional)"
-// @Success 200 {object} AnalyzeResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /analyze/game/{slug} [post]
+// @Success 200 {object} AnalysisJobResponse "Finished job (cached result)"
+// @Success 202 {object} AnalysisJobResponse "Queued or running job"
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/analyze/game/{slug} [post]
 func postAnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
 
-	req, err := decodeAnalyzeRequest(r)
-	if err != nil {
+	var req AnalyzeRequest
+	if err := decodeRequest(r, &req); err != nil {
 		l.Warnw("invalid analyze request body", zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid request body"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, err)
 		return
 	}
 
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
 
 	slug := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "slug"))
-	game, err := getGame(db, slug)
+	game, err := store.Game(slug)
 	if err != nil {
 		l.Errorw("could not get game", "slug", slug, zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusNotFound, ErrorResponse{Error: "game not found"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, gameLoadError(err))
+		return
+	}
+
+	_, info, err := selectEngine(req.Engine, game.Board.Size, true)
+	if err != nil {
+		l.Warnw("unusable analysis engine", "engine", req.Engine, zap.Error(err))
+		writeProblem(w, r, invalidRequest(FieldError{Field: "engine", Message: err.Error()}))
 		return
 	}
 
 	cfg, levelName := analyzeConfigFromRequest(req)
-	key := analysisCacheKey{
-		gameID:      game.ID,
-		level:       levelName,
-		style:       string(cfg.Style),
-		timeLimitNs: int64(cfg.TimeLimit),
-		gameVersion: gameCacheVersion(game),
+	job := &AnalysisJob{
+		GameID:      game.ID,
+		Slug:        slug,
+		Engine:      info.Name,
+		Level:       levelName,
+		Style:       string(cfg.Style),
+		TimeLimitNs: int64(cfg.TimeLimit),
+		GameVersion: gameCacheVersion(game),
+		Seed:        cfg.Seed,
+		Nodes:       cfg.Nodes,
+		Total:       len(gameHalfMoves(game)),
+	}
+	if user := getUserFromContext(r); user != nil {
+		job.UserID = &user.ID
 	}
 
-	if cached, ok := loadAnalysisCache(db, l, key); ok {
-		writeAnalyzeResponse(w, l, slug, game.Board.Size, levelName, cached)
+	job, err = enqueueAnalysisJob(store, l, job)
+	if err != nil {
+		l.Errorw("could not queue analysis", "slug", slug, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not queue analysis"))
 		return
 	}
+	analysisJobs.notify()
 
-	moves := analyzeGame(ctx, &ai.TakticianEngine{}, game, cfg)
-	agreed := 0
-	for _, m := range moves {
-		if m.Agreed {
-			agreed++
-		}
+	status := http.StatusAccepted
+	if job.Status == jobDone {
+		status = http.StatusOK
 	}
-
-	saveAnalysisCache(db, l, key, agreed, moves)
-
-	writeAnalyzeResponse(w, l, slug, game.Board.Size, levelName, AnalyzeResponse{
-		Moves:     moves,
-		MoveCount: len(moves),
-		Agreed:    agreed,
-	})
-}
-
-func writeAnalyzeResponse(w http.ResponseWriter, l *zap.SugaredLogger, slug string, size int64, level string, resp AnalyzeResponse) {
-	resp.Slug = slug
-	resp.Size = size
-	resp.Level = level
-	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
-		l.Errorw("failed to render analyze response", zap.Error(err))
+	w.Header().Set("Location", "/analyze/jobs/"+job.ID)
+	if err := Renderer.JSON(w, status, newAnalysisJobResponse(job)); err != nil {
+		l.Errorw("failed to render analysis job", zap.Error(err))
 	}
 }
 
-// gameCacheVersion is the cache-invalidation fingerprint. The "v1:" prefix
+// gameCacheVersion is the cache-invalidation fingerprint. The prefix is
+// bumped whenever MoveAnalysis changes shape ("v2:" added evaluations, "v3:"
+// explanations, "v4:" missed wins), and
 // reserves room to add more inputs (UpdatedAt, content hash) later.
 func gameCacheVersion(g *gotak.Game) string {
 	count := 0
@@ -155,77 +241,64 @@ func gameCacheVersion(g *gotak.Game) string {
 			count++
 		}
 	}
-	return fmt.Sprintf("v1:moves=%d", count)
+	return fmt.Sprintf("v4:moves=%d", count)
 }
 
 type analysisCacheKey struct {
 	gameID      int64
+	engine      string
 	level       string
 	style       string
 	timeLimitNs int64
 	gameVersion string
+	seed        int64
+	nodes       int64
 }
 
-// loadAnalysisCache logs non-NotFound errors so a flaky cache is observable,
-// but always degrades to a miss so caching never blocks analysis.
-func loadAnalysisCache(db *gorm.DB, l *zap.SugaredLogger, k analysisCacheKey) (AnalyzeResponse, bool) {
+// loadAnalysisCache finds the cached analysis for k. A miss is not an
+// error; callers treat errors as misses too, so caching never blocks
+// analysis.
+func loadAnalysisCache(db *gorm.DB, k analysisCacheKey) (AnalyzeResponse, bool, error) {
 	var row AnalysisCache
-	err := db.Where("game_id = ? AND level = ? AND style = ? AND time_limit_ns = ? AND game_version = ?",
-		k.gameID, k.level, k.style, k.timeLimitNs, k.gameVersion).First(&row).Error
+	err := db.Where("game_id = ? AND engine = ? AND level = ? AND style = ? AND time_limit_ns = ? AND game_version = ? AND seed = ? AND nodes = ?",
+		k.gameID, k.engine, k.level, k.style, k.timeLimitNs, k.gameVersion, k.seed, k.nodes).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return AnalyzeResponse{}, false, nil
+	}
 	if err != nil {
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			l.Warnw("analysis cache lookup failed", zap.Error(err))
-		}
-		return AnalyzeResponse{}, false
+		return AnalyzeResponse{}, false, err
 	}
 	var moves []MoveAnalysis
 	if err := json.Unmarshal([]byte(row.Moves), &moves); err != nil {
-		l.Warnw("analysis cache row failed to decode", "id", row.ID, zap.Error(err))
-		return AnalyzeResponse{}, false
+		return AnalyzeResponse{}, false, fmt.Errorf("analysis cache row %d: %w", row.ID, err)
 	}
 	return AnalyzeResponse{
 		Moves:     moves,
 		MoveCount: len(moves),
 		Agreed:    row.Agreed,
-	}, true
+	}, true, nil
 }
 
-// saveAnalysisCache is best-effort; concurrent misses can race so writes
-// use ON CONFLICT DO NOTHING.
-func saveAnalysisCache(db *gorm.DB, l *zap.SugaredLogger, k analysisCacheKey, agreed int, moves []MoveAnalysis) {
+// saveAnalysisCache stores an analysis for k. Concurrent misses can race,
+// so writes use ON CONFLICT DO NOTHING.
+func saveAnalysisCache(db *gorm.DB, k analysisCacheKey, agreed int, moves []MoveAnalysis) error {
 	encoded, err := json.Marshal(moves)
 	if err != nil {
-		l.Warnw("could not encode analysis for cache", zap.Error(err))
-		return
+		return err
 	}
 	row := AnalysisCache{
 		GameID:      k.gameID,
+		Engine:      k.engine,
 		Level:       k.level,
 		Style:       k.style,
 		TimeLimitNs: k.timeLimitNs,
 		GameVersion: k.gameVersion,
+		Seed:        k.seed,
+		Nodes:       k.nodes,
 		Agreed:      agreed,
 		Moves:       string(encoded),
 	}
-	err = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
-	if err != nil {
-		l.Warnw("could not save analysis cache row", zap.Error(err))
-	}
-}
-
-// decodeAnalyzeRequest reads the optional JSON body. An empty body is fine
-// and yields a zero-value AnalyzeRequest; anything else that fails to
-// decode is a 400.
-func decodeAnalyzeRequest(r *http.Request) (AnalyzeRequest, error) {
-	var req AnalyzeRequest
-	if r.Body == nil {
-		return req, nil
-	}
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil && !errors.Is(err, io.EOF) {
-		return req, err
-	}
-	return req, nil
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
 }
 
 // analyzeConfigFromRequest maps the wire request to an ai.AIConfig.
@@ -253,11 +326,37 @@ func analyzeConfigFromRequest(req AnalyzeRequest) (ai.AIConfig, string) {
 		style = ai.Defensive
 	}
 
-	timeLimit := defaultAnalyzeTimeLimit
-	if req.TimeLimit > 0 {
-		timeLimit = req.TimeLimit
+	timeLimit := settings.engineTime(req.TimeLimit, settings.Engines.AnalysisTime)
+	return ai.AIConfig{Level: level, Style: style, TimeLimit: timeLimit, Seed: req.Seed, Nodes: max(req.Nodes, 0)}, levelName
+}
+
+// halfMove locates one recorded move (one player half-turn) in a game.
+type halfMove struct {
+	turnIdx  int
+	isSecond bool
+	number   int64
+	player   int
+	played   string
+}
+
+// gameHalfMoves lists g's moves in the order they were played.
+func gameHalfMoves(g *gotak.Game) []halfMove {
+	var out []halfMove
+	if g == nil {
+		return out
 	}
-	return ai.AIConfig{Level: level, Style: style, TimeLimit: timeLimit}, levelName
+	for turnIdx, turn := range g.Turns {
+		if turn == nil {
+			continue
+		}
+		if turn.First != nil {
+			out = append(out, halfMove{turnIdx, false, turn.Number, gotak.PlayerWhite, turn.First.Text})
+		}
+		if turn.Second != nil {
+			out = append(out, halfMove{turnIdx, true, turn.Number, gotak.PlayerBlack, turn.Second.Text})
+		}
+	}
+	return out
 }
 
 // analyzeGame walks `g` move by move and asks `engine` for the best move at
@@ -269,58 +368,156 @@ func analyzeConfigFromRequest(req AnalyzeRequest) (ai.AIConfig, string) {
 // exhausted rather than getting a silently truncated list.
 func analyzeGame(ctx context.Context, engine ai.Engine, g *gotak.Game, cfg ai.AIConfig) []MoveAnalysis {
 	out := []MoveAnalysis{}
-	if g == nil || g.Board == nil || len(g.Turns) == 0 {
+	if g == nil || g.Board == nil {
 		return out
 	}
-
-	for turnIdx, turn := range g.Turns {
-		if turn == nil {
-			continue
-		}
-		if turn.First != nil {
-			out = append(out, evaluateMove(ctx, engine, g, turnIdx, false, turn.Number, gotak.PlayerWhite, turn.First.Text, cfg))
-		}
-		if turn.Second != nil {
-			out = append(out, evaluateMove(ctx, engine, g, turnIdx, true, turn.Number, gotak.PlayerBlack, turn.Second.Text, cfg))
-		}
+	for _, hm := range gameHalfMoves(g) {
+		out = append(out, evaluateMove(ctx, engine, g, hm, cfg))
 	}
 	return out
 }
 
-func evaluateMove(
-	ctx context.Context,
-	engine ai.Engine,
-	orig *gotak.Game,
-	turnIdx int,
-	isSecond bool,
-	turnNumber int64,
-	player int,
-	played string,
-	cfg ai.AIConfig,
-) MoveAnalysis {
-	out := MoveAnalysis{Turn: turnNumber, Player: player, Played: played}
+func evaluateMove(ctx context.Context, engine ai.Engine, orig *gotak.Game, hm halfMove, cfg ai.AIConfig) MoveAnalysis {
+	out := MoveAnalysis{Turn: hm.number, Player: hm.player, Played: hm.played}
 
 	if err := ctx.Err(); err != nil {
 		out.Error = err.Error()
 		return out
 	}
 
-	pre, err := gameBeforeMove(orig, turnIdx, isSecond)
+	pre, err := gameBeforeMove(orig, hm.turnIdx, hm.isSecond)
 	if err != nil {
 		out.Error = err.Error()
 		return out
 	}
 
-	best, err := engine.GetMove(ctx, pre, cfg)
+	before, err := engine.Analyze(ctx, pre, cfg)
 	if err != nil {
 		out.Error = err.Error()
 		return out
 	}
-	out.Best = best
-	out.Agreed = best == played
+	out.Best = before.BestMove
+	out.Agreed = before.BestMove == hm.played
+	out.EvalBefore = newEvaluation(before.Info, false)
+	out.Explanation, _ = ai.DescribeMove(pre, hm.played)
+
+	post, err := gameAfterMove(orig, hm.turnIdx, hm.isSecond)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	out.MissedWin = missedWin(pre, post, hm.player)
+
+	if out.Agreed {
+		// Searching the engine's own line again would only add noise.
+		out.EvalAfter = out.EvalBefore
+		out.Classification = ClassBest
+		if out.MissedWin != nil {
+			out.Classification = ClassMissedWin
+		}
+		return out
+	}
+
+	if out.EvalAfter = finalEvaluation(post, hm.player); out.EvalAfter == nil {
+		after, err := engine.Analyze(ctx, post, cfg)
+		if err != nil {
+			out.Error = err.Error()
+			return out
+		}
+		// The opponent is to move after the played move.
+		out.EvalAfter = newEvaluation(after.Info, true)
+	}
+
+	out.Loss = max(out.EvalBefore.WinProbability-out.EvalAfter.WinProbability, 0)
+	out.Classification = classifyMove(false, out.Loss)
+	if out.MissedWin != nil {
+		out.Classification = ClassMissedWin
+	}
 	return out
 }
 
+// missedWin returns the forced road win player had in pre, as PTN, when
+// their move, leading to post, let it go.
+func missedWin(pre, post *gotak.Game, player int) []string {
+	before, err := replayedGame(pre)
+	if err != nil {
+		return nil
+	}
+	line, ok := before.FindTinue(tinueDepth)
+	if !ok {
+		return nil
+	}
+	after, err := replayedGame(post)
+	if err != nil {
+		return nil
+	}
+	if winner, over := after.GameOver(); over && winner == player {
+		return nil
+	}
+	// A slower forced win still counts as keeping it.
+	if after.InTinue(tinueDepth - 1) {
+		return nil
+	}
+	return moveTexts(line)
+}
+
+// replayedGame is g's moves played out on a fresh board, for the checks
+// that read g.Board.
+func replayedGame(g *gotak.Game) (*gotak.Game, error) {
+	out := &gotak.Game{Board: &gotak.Board{Size: g.Board.Size}, Turns: g.Turns}
+	if err := replayMoves(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// newEvaluation converts a search report, which is from the side to move's
+// point of view, into an Evaluation; flip turns it round for the other
+// player.
+func newEvaluation(info ai.SearchInfo, flip bool) *Evaluation {
+	e := &Evaluation{
+		ScoreCP:        info.ScoreCP,
+		Mate:           info.Mate,
+		WinProbability: info.WinProbability(),
+		Depth:          info.Depth,
+		Nodes:          info.Nodes,
+		PV:             info.PV,
+	}
+	if flip {
+		e.ScoreCP, e.Mate, e.WinProbability = -e.ScoreCP, -e.Mate, 1-e.WinProbability
+	}
+	return e
+}
+
+// finalEvaluation returns the result for player if g is already over, or
+// nil if there is still a game to search.
+func finalEvaluation(g *gotak.Game, player int) *Evaluation {
+	board, err := replayedGame(g)
+	if err != nil {
+		return nil
+	}
+	winner, over := board.GameOver()
+	switch {
+	case !over:
+		return nil
+	case winner == player:
+		return &Evaluation{WinProbability: 1, Result: "win"}
+	case winner == 0:
+		return &Evaluation{WinProbability: 0.5, Result: "draw"}
+	default:
+		return &Evaluation{Result: "loss"}
+	}
+}
+
+// gameAfterMove returns a fresh *gotak.Game whose Turns end with the move
+// identified by (turnIdx, isSecond), i.e. the position before the next one.
+func gameAfterMove(orig *gotak.Game, turnIdx int, isSecond bool) (*gotak.Game, error) {
+	if isSecond {
+		return gameBeforeMove(orig, turnIdx+1, false)
+	}
+	return gameBeforeMove(orig, turnIdx, true)
+}
+
 // gameBeforeMove returns a fresh *gotak.Game whose Turns slice represents
 // the state of `orig` immediately before the move identified by
 // (turnIdx, isSecond). When isSecond is true the first move of
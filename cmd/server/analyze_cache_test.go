@@ -4,12 +4,12 @@ import (
 	"testing"
 
 	"github.com/icco/gotak"
-	"go.uber.org/zap"
 )
 
 func cacheKey(gameID int64, level, style string, timeNs int64, version string) analysisCacheKey {
 	return analysisCacheKey{
 		gameID:      gameID,
+		engine:      "taktician",
 		level:       level,
 		style:       style,
 		timeLimitNs: timeNs,
@@ -19,18 +19,19 @@ func cacheKey(gameID int64, level, style string, timeNs int64, version string) a
 
 func TestAnalysisCache_roundTrip(t *testing.T) {
 	db := setupTestDB(t)
-	l := zap.NewNop().Sugar()
 
 	moves := []MoveAnalysis{
 		{Turn: 1, Player: gotak.PlayerWhite, Played: "a1", Best: "a1", Agreed: true},
 		{Turn: 1, Player: gotak.PlayerBlack, Played: "e5", Best: "d4", Agreed: false},
 	}
 	key := cacheKey(42, "advanced", "balanced", 2e9, "v1:moves=2")
-	saveAnalysisCache(db, l, key, 1, moves)
+	if err := saveAnalysisCache(db, key, 1, moves); err != nil {
+		t.Fatalf("saveAnalysisCache: %v", err)
+	}
 
-	got, ok := loadAnalysisCache(db, l, key)
-	if !ok {
-		t.Fatal("expected cache hit immediately after save")
+	got, ok, err := loadAnalysisCache(db, key)
+	if err != nil || !ok {
+		t.Fatalf("expected cache hit immediately after save: %v", err)
 	}
 	if got.Agreed != 1 {
 		t.Errorf("agreed = %d, want 1", got.Agreed)
@@ -45,10 +46,11 @@ func TestAnalysisCache_roundTrip(t *testing.T) {
 
 func TestAnalysisCache_keyVariantsMiss(t *testing.T) {
 	db := setupTestDB(t)
-	l := zap.NewNop().Sugar()
 
 	base := cacheKey(42, "advanced", "balanced", 2e9, "v1:moves=2")
-	saveAnalysisCache(db, l, base, 0, nil)
+	if err := saveAnalysisCache(db, base, 0, nil); err != nil {
+		t.Fatalf("saveAnalysisCache: %v", err)
+	}
 
 	cases := []struct {
 		name string
@@ -59,11 +61,12 @@ func TestAnalysisCache_keyVariantsMiss(t *testing.T) {
 		{"different style", cacheKey(42, "advanced", "aggressive", 2e9, "v1:moves=2")},
 		{"different time limit", cacheKey(42, "advanced", "balanced", 5e9, "v1:moves=2")},
 		{"game grew", cacheKey(42, "advanced", "balanced", 2e9, "v1:moves=3")},
+		{"different engine", analysisCacheKey{gameID: 42, engine: "minimax", level: "advanced", style: "balanced", timeLimitNs: 2e9, gameVersion: "v1:moves=2"}},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			if _, ok := loadAnalysisCache(db, l, c.key); ok {
-				t.Errorf("%s should miss but hit", c.name)
+			if _, ok, err := loadAnalysisCache(db, c.key); err != nil || ok {
+				t.Errorf("%s should miss but hit: %v", c.name, err)
 			}
 		})
 	}
@@ -71,16 +74,18 @@ func TestAnalysisCache_keyVariantsMiss(t *testing.T) {
 
 func TestAnalysisCache_concurrentWritesNoError(t *testing.T) {
 	db := setupTestDB(t)
-	l := zap.NewNop().Sugar()
 	key := cacheKey(99, "advanced", "balanced", 2e9, "v1:moves=0")
 
 	// Two writes on the same key would violate the unique index without the
 	// ON CONFLICT clause.
-	saveAnalysisCache(db, l, key, 0, nil)
-	saveAnalysisCache(db, l, key, 0, nil)
+	for range 2 {
+		if err := saveAnalysisCache(db, key, 0, nil); err != nil {
+			t.Fatalf("saveAnalysisCache: %v", err)
+		}
+	}
 
-	if _, ok := loadAnalysisCache(db, l, key); !ok {
-		t.Errorf("cache hit expected after second save")
+	if _, ok, err := loadAnalysisCache(db, key); err != nil || !ok {
+		t.Errorf("cache hit expected after second save: %v", err)
 	}
 }
 
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxMultiPV caps how many candidate lines one request can ask for.
+const maxMultiPV = 8
+
+// PositionAnalyzeRequest is the body of POST /analyze/position. The
+// position is TPS, a PTN move list played from an empty board of Size, or
+// TPS followed by moves. Engine settings are as for game analysis.
+type PositionAnalyzeRequest struct {
+	AnalyzeRequest
+	TPS   string   `json:"tps,omitempty" example:"x5/x5/x5/x5/2,x4 2 1"`
+	Moves []string `json:"moves,omitempty"`
+	// Size is required without TPS, and must match it otherwise.
+	Size int64 `json:"size,omitempty" example:"5"`
+	// MultiPV is how many candidate moves to return (default 1, at most
+	// 8). Engines without multi-PV support return their best move only.
+	MultiPV int `json:"multi_pv,omitempty" example:"3"`
+}
+
+// CandidateLine is one of the engine's candidate moves, scored from the
+// point of view of the player to move.
+type CandidateLine struct {
+	Move string `json:"move"`
+	Evaluation
+	// Explanation describes what Move does in the position.
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// PositionAnalysisResponse is the payload returned by the position
+// analysis endpoints. Lines are best first.
+type PositionAnalysisResponse struct {
+	TPS    string          `json:"tps"`
+	Hash   string          `json:"hash"`
+	Size   int64           `json:"size"`
+	ToMove int             `json:"to_move"`
+	Engine string          `json:"engine"`
+	Level  string          `json:"level"`
+	Lines  []CandidateLine `json:"lines"`
+}
+
+// analysisPosition is a position ready to hand to an engine.
+type analysisPosition struct {
+	board  *gotak.Board
+	toMove int
+	move   int64
+}
+
+func (p analysisPosition) tps() string {
+	return p.board.TPS(p.toMove, p.move)
+}
+
+// game is the position as engines take it: a TPS tag on an otherwise
+// empty game.
+func (p analysisPosition) game() (*gotak.Game, error) {
+	tps := p.tps()
+	g, err := gotak.NewGame(p.board.Size, 0, "position-"+positionHash(tps)[:12])
+	if err != nil {
+		return nil, err
+	}
+	if err := g.UpdateMeta("TPS", tps); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// positionHash identifies a position for caching. The TPS is regenerated
+// from the board, so equivalent spellings of a position share a hash.
+func positionHash(tps string) string {
+	sum := sha256.Sum256([]byte(tps))
+	return hex.EncodeToString(sum[:])
+}
+
+// @Summary Analyze a single position
+// @Description Asks the AI engine for its best moves in one position, given
+// @Description as TPS, a PTN move list, or both. Returns up to multi_pv
+// @Description candidate moves with scores and expected lines. Results are
+// @Description cached by position.
+// @Tags analysis
+// @Accept json
+// @Produce json
+// @Param request body PositionAnalyzeRequest true "Position and engine config"
+// @Success 200 {object} PositionAnalysisResponse
+// @Failure 400 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/analyze/position [post]
+func postAnalyzePositionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+
+	var req PositionAnalyzeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		l.Warnw("invalid position analysis body", zap.Error(err))
+		writeProblem(w, r, err)
+		return
+	}
+
+	pos, err := positionFromRequest(req)
+	if err != nil {
+		l.Warnw("invalid position", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	// The store is only a cache here; analysis goes ahead without it.
+	store, err := requestStore(r)
+	if err != nil {
+		l.Warnw("position analysis running without cache", zap.Error(err))
+	}
+	servePositionAnalysis(w, r, store, pos, req.AnalyzeRequest, req.MultiPV)
+}
+
+// @Summary Analyze a game position
+// @Description Analyzes the position after every move of every turn with
+// @Description Number <= turn, as GET /game/{slug}/position/{turn} returns it.
+// @Tags analysis
+// @Produce json
+// @Param slug path string true "Game slug identifier"
+// @Param turn path int true "Turn number (0 = starting position)"
+// @Param multi_pv query int false "Candidate moves to return (default 1)"
+// @Param engine query string false "Engine name (see GET /v1/ai/engines)"
+// @Param level query string false "beginner, intermediate, advanced or expert"
+// @Param style query string false "balanced, aggressive or defensive"
+// @Param time_limit query string false "Search time, e.g. 2s"
+// @Param seed query int false "Search seed, for repeatable analysis"
+// @Param nodes query int false "Search node budget, used instead of time_limit"
+// @Success 200 {object} PositionAnalysisResponse
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/game/{slug}/position/{turn}/analysis [get]
+func getPositionAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+
+	turnStr := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "turn"))
+	turnNum, err := strconv.ParseInt(turnStr, 10, 64)
+	if err != nil || turnNum < 0 {
+		l.Warnw("invalid turn number", "turn", turnStr, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "turn must be a non-negative integer"))
+		return
+	}
+
+	req, multiPV, err := analyzeRequestFromQuery(r)
+	if err != nil {
+		l.Warnw("invalid analysis query", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	store, game, ok := loadGameForReadWithStore(w, r, l)
+	if !ok {
+		return
+	}
+
+	pos, err := positionAtTurn(game, turnNum)
+	if err != nil {
+		l.Errorw("could not replay to turn", "slug", game.Slug, "turn", turnNum, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not compute position"))
+		return
+	}
+	servePositionAnalysis(w, r, store, pos, req, multiPV)
+}
+
+// servePositionAnalysis picks the engine, serves a cached result if there
+// is one and otherwise runs and caches the analysis. db may be nil.
+func servePositionAnalysis(w http.ResponseWriter, r *http.Request, store Store, pos analysisPosition, req AnalyzeRequest, multiPV int) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+
+	if winner, over := (&gotak.Game{Board: pos.board}).GameOver(); over {
+		l.Infow("analysis requested for a finished position", "winner", winner)
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "the game is over in this position"))
+		return
+	}
+
+	engine, info, err := selectEngine(req.Engine, pos.board.Size, true)
+	if err != nil {
+		l.Warnw("unusable analysis engine", "engine", req.Engine, zap.Error(err))
+		writeProblem(w, r, invalidRequest(FieldError{Field: "engine", Message: err.Error()}))
+		return
+	}
+
+	cfg, levelName := analyzeConfigFromRequest(req)
+	multiPV = min(max(multiPV, 1), maxMultiPV)
+	tps := pos.tps()
+	resp := PositionAnalysisResponse{
+		TPS:    tps,
+		Hash:   positionHash(tps),
+		Size:   pos.board.Size,
+		ToMove: pos.toMove,
+		Engine: info.Name,
+		Level:  levelName,
+	}
+	key := positionCacheKey{
+		hash:        resp.Hash,
+		engine:      info.Name,
+		level:       levelName,
+		style:       string(cfg.Style),
+		timeLimitNs: int64(cfg.TimeLimit),
+		multiPV:     multiPV,
+		seed:        cfg.Seed,
+		nodes:       cfg.Nodes,
+	}
+
+	var (
+		lines []CandidateLine
+		ok    bool
+	)
+	if store != nil {
+		if lines, ok, err = store.LoadPositionAnalysis(key); err != nil {
+			l.Warnw("position analysis cache lookup failed", zap.Error(err))
+		}
+	}
+	if ok {
+		if g, err := pos.game(); err == nil {
+			explainLines(g, lines)
+		}
+	} else {
+		lines, err = analyzePosition(ctx, engine, pos, cfg, multiPV)
+		if err != nil {
+			l.Errorw("position analysis failed", "engine", info.Name, "tps", tps, zap.Error(err))
+			writeProblem(w, r, newAPIError(http.StatusInternalServerError, "analysis failed"))
+			return
+		}
+		if store != nil {
+			if err := store.SavePositionAnalysis(key, tps, lines); err != nil {
+				l.Warnw("could not save position analysis cache row", zap.Error(err))
+			}
+		}
+	}
+
+	resp.Lines = lines
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render position analysis", zap.Error(err))
+	}
+}
+
+// analyzePosition asks engine for up to multiPV lines in pos.
+func analyzePosition(ctx context.Context, engine ai.Engine, pos analysisPosition, cfg ai.AIConfig, multiPV int) ([]CandidateLine, error) {
+	g, err := pos.game()
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := ai.AnalyzeLines(ctx, engine, g, cfg, multiPV)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]CandidateLine, 0, len(results))
+	for _, res := range results {
+		lines = append(lines, CandidateLine{Move: res.BestMove, Evaluation: *newEvaluation(res.Info, false)})
+	}
+	explainLines(g, lines)
+	return lines, nil
+}
+
+// explainLines fills in each line's Explanation. Lines cached before
+// explanations existed get them here too.
+func explainLines(g *gotak.Game, lines []CandidateLine) {
+	for i := range lines {
+		if lines[i].Explanation == "" {
+			lines[i].Explanation, _ = ai.DescribeMove(g, lines[i].Move)
+		}
+	}
+}
+
+// positionFromRequest builds the position a request describes, checking
+// every move against the core move generator.
+func positionFromRequest(req PositionAnalyzeRequest) (analysisPosition, error) {
+	pos := analysisPosition{toMove: gotak.PlayerWhite, move: 1}
+	switch {
+	case req.TPS != "":
+		b, player, move, err := gotak.ParseTPS(req.TPS)
+		if err != nil {
+			return pos, fmt.Errorf("invalid tps: %w", err)
+		}
+		if req.Size != 0 && req.Size != b.Size {
+			return pos, fmt.Errorf("size %d does not match the %dx%d tps", req.Size, b.Size, b.Size)
+		}
+		pos.board, pos.toMove, pos.move = b, player, move
+	case len(req.Moves) > 0 || req.Size != 0:
+		if req.Size < 3 || req.Size > 9 {
+			return pos, errors.New("size must be between 3 and 9")
+		}
+		pos.board = &gotak.Board{Size: req.Size}
+		if err := pos.board.Init(); err != nil {
+			return pos, err
+		}
+	default:
+		return pos, errors.New("tps or size is required")
+	}
+
+	g := &gotak.Game{Board: pos.board}
+	for i, text := range req.Moves {
+		mv, err := gotak.NewMove(text)
+		if err != nil {
+			return pos, fmt.Errorf("move %d (%q): %w", i+1, text, err)
+		}
+		opening := pos.move == 1
+		stones, caps := g.Reserves(pos.toMove)
+		legal := slices.IndexFunc(pos.board.LegalMoves(pos.toMove, stones, caps, opening), func(m *gotak.Move) bool {
+			return m.Equal(mv)
+		})
+		if legal < 0 {
+			return pos, fmt.Errorf("move %d (%q) is not legal here", i+1, text)
+		}
+		color := pos.toMove
+		if opening {
+			// Each player places the opponent's flat on the first turn.
+			color = gotak.PlayerWhite + gotak.PlayerBlack - pos.toMove
+		}
+		if err := pos.board.DoMove(mv, color); err != nil {
+			return pos, fmt.Errorf("move %d (%q): %w", i+1, text, err)
+		}
+		if pos.toMove == gotak.PlayerBlack {
+			pos.move++
+		}
+		pos.toMove = gotak.PlayerWhite + gotak.PlayerBlack - pos.toMove
+	}
+	return pos, nil
+}
+
+// positionAtTurn is the position boardAtTurn returns, with the player to
+// move: black when turnNum's second move hasn't been played yet.
+func positionAtTurn(game *gotak.Game, turnNum int64) (analysisPosition, error) {
+	squares, err := boardAtTurn(game, turnNum)
+	if err != nil {
+		return analysisPosition{}, err
+	}
+	pos := analysisPosition{
+		board:  &gotak.Board{Size: game.Board.Size, Squares: squares},
+		toMove: gotak.PlayerWhite,
+		move:   1,
+	}
+	var last *gotak.Turn
+	for _, t := range game.Turns {
+		if t != nil && t.Number <= turnNum && (last == nil || t.Number > last.Number) {
+			last = t
+		}
+	}
+	switch {
+	case last == nil:
+	case last.Second == nil:
+		pos.toMove, pos.move = gotak.PlayerBlack, last.Number
+	default:
+		pos.move = last.Number + 1
+	}
+	return pos, nil
+}
+
+// analyzeRequestFromQuery reads engine settings from query parameters.
+func analyzeRequestFromQuery(r *http.Request) (AnalyzeRequest, int, error) {
+	q := r.URL.Query()
+	req := AnalyzeRequest{
+		Level:  q.Get("level"),
+		Style:  q.Get("style"),
+		Engine: q.Get("engine"),
+	}
+	if s := q.Get("time_limit"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return req, 0, fmt.Errorf("invalid time_limit %q", s)
+		}
+		req.TimeLimit = d
+	}
+	for name, field := range map[string]*int64{"seed": &req.Seed, "nodes": &req.Nodes} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || (name == "nodes" && n < 0) {
+				return req, 0, fmt.Errorf("invalid %s %q", name, s)
+			}
+			*field = n
+		}
+	}
+	multiPV := 1
+	if s := q.Get("multi_pv"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return req, 0, fmt.Errorf("invalid multi_pv %q", s)
+		}
+		multiPV = n
+	}
+	return req, multiPV, nil
+}
+
+type positionCacheKey struct {
+	hash        string
+	engine      string
+	level       string
+	style       string
+	timeLimitNs int64
+	multiPV     int
+	seed        int64
+	nodes       int64
+}
+
+// loadPositionCache finds the cached analysis for k, like
+// loadAnalysisCache.
+func loadPositionCache(db *gorm.DB, k positionCacheKey) ([]CandidateLine, bool, error) {
+	var row PositionAnalysisCache
+	err := db.Where("position_hash = ? AND engine = ? AND level = ? AND style = ? AND time_limit_ns = ? AND multi_pv = ? AND seed = ? AND nodes = ?",
+		k.hash, k.engine, k.level, k.style, k.timeLimitNs, k.multiPV, k.seed, k.nodes).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var lines []CandidateLine
+	if err := json.Unmarshal([]byte(row.Lines), &lines); err != nil {
+		return nil, false, fmt.Errorf("position analysis cache row %d: %w", row.ID, err)
+	}
+	return lines, true, nil
+}
+
+// savePositionCache stores an analysis for k, like saveAnalysisCache.
+func savePositionCache(db *gorm.DB, k positionCacheKey, tps string, lines []CandidateLine) error {
+	encoded, err := json.Marshal(lines)
+	if err != nil {
+		return err
+	}
+	row := PositionAnalysisCache{
+		PositionHash: k.hash,
+		Engine:       k.engine,
+		Level:        k.level,
+		Style:        k.style,
+		TimeLimitNs:  k.timeLimitNs,
+		MultiPV:      k.multiPV,
+		Seed:         k.seed,
+		Nodes:        k.nodes,
+		TPS:          tps,
+		Lines:        string(encoded),
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error
+}
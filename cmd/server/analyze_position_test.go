@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+)
+
+func TestPositionFromRequest_movesMatchGame(t *testing.T) {
+	g := playGame(t, []scriptedMove{
+		{gotak.PlayerWhite, "a1"},
+		{gotak.PlayerBlack, "e5"},
+		{gotak.PlayerWhite, "c3"},
+	})
+	pos, err := positionFromRequest(PositionAnalyzeRequest{Size: 5, Moves: []string{"a1", "e5", "c3"}})
+	if err != nil {
+		t.Fatalf("positionFromRequest: %v", err)
+	}
+	if got, want := pos.tps(), g.Board.TPS(gotak.PlayerBlack, 2); got != want {
+		t.Errorf("tps = %s, want %s", got, want)
+	}
+
+	// The same position spelled as TPS, or as TPS plus moves, hashes alike.
+	fromTPS, err := positionFromRequest(PositionAnalyzeRequest{TPS: pos.tps()})
+	if err != nil {
+		t.Fatalf("positionFromRequest(tps): %v", err)
+	}
+	partial, err := positionFromRequest(PositionAnalyzeRequest{TPS: "x5/x5/x5/x5/2,x4 2 1", Moves: []string{"e5", "c3"}})
+	if err != nil {
+		t.Fatalf("positionFromRequest(tps+moves): %v", err)
+	}
+	for _, p := range []analysisPosition{fromTPS, partial} {
+		if positionHash(p.tps()) != positionHash(pos.tps()) {
+			t.Errorf("%s and %s should share a hash", p.tps(), pos.tps())
+		}
+	}
+}
+
+func TestPositionFromRequest_errors(t *testing.T) {
+	tests := map[string]PositionAnalyzeRequest{
+		"nothing":         {},
+		"bad size":        {Size: 12},
+		"bad tps":         {TPS: "x5/x5 1"},
+		"size mismatch":   {TPS: "x5/x5/x5/x5/x5 1 1", Size: 6},
+		"bad ptn":         {Size: 5, Moves: []string{"zz"}},
+		"opening wall":    {Size: 5, Moves: []string{"Sa1"}},
+		"illegal stack":   {Size: 5, Moves: []string{"a1", "e5", "a1>"}},
+		"bad drops":       {Size: 5, Moves: []string{"a1", "e5", "e5", "b1", "2e5-11"}},
+		"occupied square": {Size: 5, Moves: []string{"a1", "a1"}},
+		"no capstones":    {Size: 3, Moves: []string{"a1", "c3", "Cb2"}},
+	}
+	for name, req := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := positionFromRequest(req); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestPositionAtTurn(t *testing.T) {
+	g := playGame(t, []scriptedMove{
+		{gotak.PlayerWhite, "a1"},
+		{gotak.PlayerBlack, "e5"},
+		{gotak.PlayerWhite, "c3"},
+	})
+	tests := []struct {
+		turn int64
+		want string
+	}{
+		{0, "x5/x5/x5/x5/x5 1 1"},
+		{1, "x4,1/x5/x5/x5/2,x4 1 2"},
+		{2, "x4,1/x5/x2,1,x2/x5/2,x4 2 2"},
+		{9, "x4,1/x5/x2,1,x2/x5/2,x4 2 2"},
+	}
+	for _, tc := range tests {
+		pos, err := positionAtTurn(g, tc.turn)
+		if err != nil {
+			t.Fatalf("positionAtTurn(%d): %v", tc.turn, err)
+		}
+		if got := pos.tps(); got != tc.want {
+			t.Errorf("turn %d: tps = %s, want %s", tc.turn, got, tc.want)
+		}
+	}
+}
+
+func TestAnalyzePosition_multiPV(t *testing.T) {
+	pos, err := positionFromRequest(PositionAnalyzeRequest{TPS: "x5/x5/x5/2,2,2,x2/1,1,1,x2 1 5"})
+	if err != nil {
+		t.Fatalf("positionFromRequest: %v", err)
+	}
+	cfg := ai.AIConfig{Level: ai.Intermediate, TimeLimit: 2 * time.Second}
+	lines, err := analyzePosition(context.Background(), &ai.AlphaBetaEngine{}, pos, cfg, 3)
+	if err != nil {
+		t.Fatalf("analyzePosition: %v", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %+v", len(lines), lines)
+	}
+	seen := map[string]bool{}
+	for i, line := range lines {
+		if seen[line.Move] {
+			t.Errorf("line %d repeats %s", i, line.Move)
+		}
+		seen[line.Move] = true
+		if len(line.PV) == 0 || line.PV[0] != line.Move {
+			t.Errorf("line %d PV %v should start with %s", i, line.PV, line.Move)
+		}
+		if line.Explanation == "" {
+			t.Errorf("line %d (%s) has no explanation", i, line.Move)
+		}
+		if i > 0 && line.WinProbability > lines[i-1].WinProbability {
+			t.Errorf("lines are not best first: %+v", lines)
+		}
+	}
+
+	// Engines without multi-PV report their best move only.
+	lines, err = analyzePosition(context.Background(), &stubEngine{moves: []string{"a1"}}, analysisPosition{board: pos.board, toMove: 1, move: 1}, cfg, 3)
+	if err != nil || len(lines) != 1 {
+		t.Errorf("stub lines = %+v, %v; want one", lines, err)
+	}
+}
+
+func TestPositionCache_roundTrip(t *testing.T) {
+	db := setupTestDB(t)
+	key := positionCacheKey{hash: positionHash("x5/x5/x5/x5/x5 1 1"), engine: "gotak", level: "advanced", style: "balanced", timeLimitNs: 2e9, multiPV: 2}
+
+	if _, ok, err := loadPositionCache(db, key); err != nil || ok {
+		t.Fatalf("empty cache should miss: %v", err)
+	}
+	want := []CandidateLine{
+		{Move: "a1", Evaluation: Evaluation{ScoreCP: 12, WinProbability: 0.51, Depth: 3, PV: []string{"a1", "e5"}}},
+		{Move: "e5", Evaluation: Evaluation{ScoreCP: 10, WinProbability: 0.5, Depth: 3}},
+	}
+	for range 2 { // a racing writer must not fail
+		if err := savePositionCache(db, key, "x5/x5/x5/x5/x5 1 1", want); err != nil {
+			t.Fatalf("savePositionCache: %v", err)
+		}
+	}
+
+	got, ok, err := loadPositionCache(db, key)
+	if err != nil || !ok || len(got) != 2 || got[0].Move != "a1" || got[0].PV[1] != "e5" {
+		t.Errorf("cached lines = %+v, %v, %v", got, ok, err)
+	}
+	other := key
+	other.multiPV = 3
+	if _, ok, err := loadPositionCache(db, other); err != nil || ok {
+		t.Errorf("a different multi-PV count should miss: %v", err)
+	}
+}
+
+func TestPostAnalyzePositionHandler(t *testing.T) {
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		postAnalyzePositionHandler(w, httptest.NewRequest(http.MethodPost, "/analyze/position", bytes.NewBufferString(body)))
+		return w
+	}
+
+	w := post(`{"size":5,"moves":["a1","e5"],"multi_pv":2,"engine":"gotak","level":"beginner","time_limit":500000000}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp PositionAnalysisResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Engine != "gotak" || resp.ToMove != gotak.PlayerWhite || resp.Hash != positionHash(resp.TPS) || len(resp.Lines) != 2 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	for name, body := range map[string]string{
+		"bad json":      `{`,
+		"no position":   `{}`,
+		"illegal move":  `{"size":5,"moves":["a1","a1"]}`,
+		"random engine": `{"size":5,"engine":"random"}`,
+		"game over":     `{"tps":"x5/x5/x5/2,2,2,x2/1,1,1,1,1 2 5"}`,
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestAnalyzeRequestFromQuery(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/game/x/position/3/analysis?multi_pv=4&engine=gotak&level=expert&time_limit=3s&seed=7&nodes=5000", nil)
+	req, multiPV, err := analyzeRequestFromQuery(r)
+	if err != nil {
+		t.Fatalf("analyzeRequestFromQuery: %v", err)
+	}
+	if multiPV != 4 || req.Engine != "gotak" || req.Level != "expert" || req.TimeLimit != 3*time.Second || req.Seed != 7 || req.Nodes != 5000 {
+		t.Errorf("got %+v, multi_pv %d", req, multiPV)
+	}
+	for _, q := range []string{"multi_pv=0", "multi_pv=x", "time_limit=soon", "time_limit=-1s", "seed=x", "nodes=-5"} {
+		if _, _, err := analyzeRequestFromQuery(httptest.NewRequest(http.MethodGet, "/?"+q, nil)); err == nil {
+			t.Errorf("%s: expected an error", q)
+		}
+	}
+}
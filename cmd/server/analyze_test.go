@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,21 +13,41 @@ import (
 // scriptedMove and the playGame helper live in replay_test.go and are
 // shared across the cmd/server test binary.
 
-// stubEngine returns the next hard-coded move on each call, so tests can
-// assert how the analyzer drives the engine.
+// stubEngine answers for the position after n half-moves with moves[n] and
+// scores[n], so tests can assert how the analyzer drives the engine.
 type stubEngine struct {
-	moves []string
-	calls int
+	moves  []string
+	scores []int
+	calls  int
 }
 
-func (s *stubEngine) GetMove(_ context.Context, _ *gotak.Game, _ ai.AIConfig) (string, error) {
-	if s.calls >= len(s.moves) {
-		s.calls++
-		return "", nil
-	}
-	m := s.moves[s.calls]
+func (s *stubEngine) Analyze(_ context.Context, g *gotak.Game, _ ai.AIConfig) (*ai.SearchResult, error) {
 	s.calls++
-	return m, nil
+	ply := 0
+	for _, t := range g.Turns {
+		if t.First != nil {
+			ply++
+		}
+		if t.Second != nil {
+			ply++
+		}
+	}
+	res := &ai.SearchResult{Info: ai.SearchInfo{Depth: 1}}
+	if ply < len(s.moves) {
+		res.BestMove = s.moves[ply]
+	}
+	if ply < len(s.scores) {
+		res.Info.ScoreCP = s.scores[ply]
+	}
+	return res, nil
+}
+
+func (s *stubEngine) GetMove(ctx context.Context, g *gotak.Game, cfg ai.AIConfig) (string, error) {
+	res, err := s.Analyze(ctx, g, cfg)
+	if err != nil {
+		return "", err
+	}
+	return res.BestMove, nil
 }
 
 func (s *stubEngine) ExplainMove(_ context.Context, _ *gotak.Game, _ ai.AIConfig) (string, error) {
@@ -122,9 +143,135 @@ func TestAnalyzeGame_recordsAgreement(t *testing.T) {
 			t.Errorf("move %d = %+v, want %+v", i, got, w)
 		}
 	}
+	if !strings.Contains(moves[0].Explanation, "black's first stone on a1") {
+		t.Errorf("move 0 explanation = %q", moves[0].Explanation)
+	}
 
-	if engine.calls != 4 {
-		t.Errorf("engine called %d times, want 4", engine.calls)
+	// One search per position, plus one after the disagreed move.
+	if engine.calls != 5 {
+		t.Errorf("engine called %d times, want 5", engine.calls)
+	}
+}
+
+func TestAnalyzeGame_classifiesMoves(t *testing.T) {
+	g := playGame(t, []scriptedMove{
+		{gotak.PlayerWhite, "a1"},
+		{gotak.PlayerBlack, "e5"},
+		{gotak.PlayerWhite, "b2"},
+		{gotak.PlayerBlack, "d4"},
+	})
+	// Scores are for the side to move after n half-moves. Black's e5
+	// hands white 3.5 flats; white's b2 gives back a quarter of a flat.
+	engine := &stubEngine{
+		moves:  []string{"a1", "c3", "c3", "d4", "a2"},
+		scores: []int{0, 0, 350, -325, 0},
+	}
+	moves := analyzeGame(context.Background(), engine, g, ai.AIConfig{})
+
+	want := []Classification{ClassBest, ClassBlunder, ClassGood, ClassBest}
+	for i, w := range want {
+		if got := moves[i]; got.Classification != w || got.Error != "" {
+			t.Errorf("move %d (%s) = %q, loss %.3f, error %q; want %q", i, got.Played, got.Classification, got.Loss, got.Error, w)
+		}
+	}
+
+	e5 := moves[1]
+	if e5.EvalBefore.ScoreCP != 0 || e5.EvalAfter.ScoreCP != -350 {
+		t.Errorf("e5 evals = %+v / %+v, want 0 / -350 for black", e5.EvalBefore, e5.EvalAfter)
+	}
+	if want := e5.EvalBefore.WinProbability - e5.EvalAfter.WinProbability; e5.Loss != want || e5.Loss < blunderLoss {
+		t.Errorf("e5 loss = %.3f, want %.3f", e5.Loss, want)
+	}
+	if moves[0].Loss != 0 || moves[0].EvalAfter != moves[0].EvalBefore {
+		t.Errorf("agreed move should lose nothing: %+v", moves[0])
+	}
+}
+
+func TestAnalyzeGame_finalMove(t *testing.T) {
+	// Turn 1 places the opponent's stones, so white owns a1 and completes
+	// the first rank with e1.
+	moves := []scriptedMove{
+		{gotak.PlayerWhite, "a5"},
+		{gotak.PlayerBlack, "a1"},
+		{gotak.PlayerWhite, "b1"},
+		{gotak.PlayerBlack, "b5"},
+		{gotak.PlayerWhite, "c1"},
+		{gotak.PlayerBlack, "c5"},
+		{gotak.PlayerWhite, "d1"},
+		{gotak.PlayerBlack, "d5"},
+		{gotak.PlayerWhite, "e1"},
+	}
+	g := playGame(t, moves)
+
+	// The engine would have played elsewhere, but e1 completes the road.
+	engine := &stubEngine{moves: make([]string, len(moves)), scores: make([]int, len(moves))}
+	for i := range engine.moves {
+		engine.moves[i] = "a3"
+	}
+	got := analyzeGame(context.Background(), engine, g, ai.AIConfig{})
+	last := got[len(got)-1]
+	if last.Played != "e1" || last.EvalAfter == nil || last.EvalAfter.Result != "win" || last.EvalAfter.WinProbability != 1 {
+		t.Fatalf("winning move = %+v, after %+v", last, last.EvalAfter)
+	}
+	if last.Loss != 0 || last.Classification != ClassGood {
+		t.Errorf("winning move loss %.3f / %q, want 0 / good", last.Loss, last.Classification)
+	}
+	if engine.calls != 2*len(moves)-1 {
+		t.Errorf("engine called %d times, want %d (no search once the game is over)", engine.calls, 2*len(moves)-1)
+	}
+}
+
+func TestAnalyzeGame_missedWin(t *testing.T) {
+	// White has a1 to d1 and plays a3 instead of the winning e1.
+	moves := []scriptedMove{
+		{gotak.PlayerWhite, "a5"},
+		{gotak.PlayerBlack, "a1"},
+		{gotak.PlayerWhite, "b1"},
+		{gotak.PlayerBlack, "b5"},
+		{gotak.PlayerWhite, "c1"},
+		{gotak.PlayerBlack, "c5"},
+		{gotak.PlayerWhite, "d1"},
+		{gotak.PlayerBlack, "d5"},
+		{gotak.PlayerWhite, "a3"},
+	}
+	g := playGame(t, moves)
+
+	// The engine agrees with every move, so only the solver can object.
+	engine := &stubEngine{moves: make([]string, len(moves))}
+	for i, m := range moves {
+		engine.moves[i] = m.move
+	}
+	got := analyzeGame(context.Background(), engine, g, ai.AIConfig{})
+	for _, m := range got[:len(got)-1] {
+		if m.MissedWin != nil || m.Classification == ClassMissedWin {
+			t.Errorf("%s marked as a missed win: %v", m.Played, m.MissedWin)
+		}
+	}
+	last := got[len(got)-1]
+	if last.Classification != ClassMissedWin || len(last.MissedWin) != 1 || last.MissedWin[0] != "e1" {
+		t.Errorf("a3 = %q, missed %v; want missed_win e1", last.Classification, last.MissedWin)
+	}
+}
+
+func TestClassifyMove(t *testing.T) {
+	tests := []struct {
+		agreed bool
+		loss   float64
+		want   Classification
+	}{
+		{true, 0.4, ClassBest},
+		{false, 0, ClassGood},
+		{false, 0.049, ClassGood},
+		{false, 0.05, ClassInaccuracy},
+		{false, 0.10, ClassMistake},
+		{false, 0.149, ClassMistake},
+		{false, 0.15, ClassBlunder},
+		{false, 1, ClassBlunder},
+	}
+	for _, tc := range tests {
+		if got := classifyMove(tc.agreed, tc.loss); got != tc.want {
+			t.Errorf("classifyMove(%v, %v) = %q, want %q", tc.agreed, tc.loss, got, tc.want)
+		}
 	}
 }
 
@@ -182,6 +329,8 @@ func TestAnalyzeConfigFromRequest_overrides(t *testing.T) {
 		Level:     "beginner",
 		Style:     "aggressive",
 		TimeLimit: 5 * time.Second,
+		Seed:      42,
+		Nodes:     10000,
 	})
 	if cfg.Level != ai.Beginner {
 		t.Errorf("level = %v, want Beginner", cfg.Level)
@@ -195,6 +344,9 @@ func TestAnalyzeConfigFromRequest_overrides(t *testing.T) {
 	if cfg.TimeLimit != 5*time.Second {
 		t.Errorf("time = %v, want 5s", cfg.TimeLimit)
 	}
+	if cfg.Seed != 42 || cfg.Nodes != 10000 {
+		t.Errorf("seed, nodes = %d, %d, want 42, 10000", cfg.Seed, cfg.Nodes)
+	}
 }
 
 func TestAnalyzeConfigFromRequest_unknownLevelDefaults(t *testing.T) {
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// API token scopes. Password and OAuth sessions implicitly hold all of
+// them; API tokens hold only what they were created with.
+const (
+	scopePlay    = "play"    // create, join and move in games, request AI moves
+	scopeRead    = "read"    // read the owner's profile
+	scopeAnalyze = "analyze" // run engine analysis
+)
+
+var knownScopes = []string{scopePlay, scopeRead, scopeAnalyze}
+
+const (
+	// apiTokenPrefix lets authMiddleware tell API tokens from JWTs without
+	// trying to parse them, and makes leaked tokens easy to grep for.
+	apiTokenPrefix = "gtk_"
+	// maxAPITokensPerUser keeps a runaway script from filling the table.
+	maxAPITokensPerUser = 25
+)
+
+var (
+	errInvalidScope       = errors.New("invalid scope")
+	errNoScopes           = errors.New("at least one scope is required")
+	errTooManyAPITokens   = fmt.Errorf("a user may hold at most %d active API tokens", maxAPITokensPerUser)
+	errAPITokenNotFound   = errors.New("api token not found")
+	errAPITokenInvalid    = errors.New("api token invalid")
+	errAPITokenNeedsLogin = errors.New("API tokens cannot manage API tokens")
+)
+
+// CreateAPITokenRequest is the body of POST /auth/tokens.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" example:"my-tak-bot"`
+	Scopes        []string `json:"scopes" example:"play,read"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" example:"90"`
+}
+
+func (req *CreateAPITokenRequest) validate() []FieldError {
+	var out []FieldError
+	if strings.TrimSpace(req.Name) == "" {
+		out = append(out, FieldError{Field: "name", Message: "is required"})
+	}
+	if req.ExpiresInDays < 0 {
+		out = append(out, FieldError{Field: "expires_in_days", Message: "must not be negative"})
+	}
+	return out
+}
+
+// APITokenResponse describes a token without revealing it.
+type APITokenResponse struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" example:"gtk_3fa9"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPITokenResponse carries the raw token. It is shown exactly once.
+type CreateAPITokenResponse struct {
+	APITokenResponse
+	Token string `json:"token" example:"gtk_3fa9..."`
+}
+
+func newAPITokenResponse(t *APIToken) APITokenResponse {
+	return APITokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     splitScopes(t.Scopes),
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		RevokedAt:  t.RevokedAt,
+	}
+}
+
+// normalizeScopes validates, de-duplicates and sorts requested scopes.
+func normalizeScopes(scopes []string) ([]string, error) {
+	out := []string{}
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" {
+			continue
+		}
+		if !slices.Contains(knownScopes, s) {
+			return nil, fmt.Errorf("%w: %q", errInvalidScope, s)
+		}
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errNoScopes
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// createAPIToken mints a token for userID and returns the row plus the raw
+// token, which is not recoverable afterwards.
+func createAPIToken(db *gorm.DB, userID int64, name string, scopes []string, ttl time.Duration) (*APIToken, string, error) {
+	normalized, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var active int64
+	if err := db.Model(&APIToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Count(&active).Error; err != nil {
+		return nil, "", err
+	}
+	if active >= maxAPITokensPerUser {
+		return nil, "", errTooManyAPITokens
+	}
+
+	secret, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	raw := apiTokenPrefix + secret
+
+	token := &APIToken{
+		UserID:    userID,
+		Name:      truncate(strings.TrimSpace(name), 64),
+		Prefix:    raw[:len(apiTokenPrefix)+4],
+		TokenHash: hashRefreshToken(raw),
+		Scopes:    strings.Join(normalized, ","),
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		token.ExpiresAt = &expires
+	}
+	if err := db.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, raw, nil
+}
+
+func listAPITokens(db *gorm.DB, userID int64) ([]APIToken, error) {
+	var tokens []APIToken
+	err := db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// revokeAPIToken only touches tokens owned by userID, so one user can't
+// probe for another user's token ids.
+func revokeAPIToken(db *gorm.DB, userID, id int64) error {
+	result := db.Model(&APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errAPITokenNotFound
+	}
+	return nil
+}
+
+// authenticateAPIToken resolves a raw gtk_ token to its user. LastUsedAt
+// is updated best-effort.
+func authenticateAPIToken(db *gorm.DB, raw string) (*User, *APIToken, error) {
+	var token APIToken
+	if err := db.Where("token_hash = ?", hashRefreshToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errAPITokenInvalid
+		}
+		return nil, nil, err
+	}
+	now := time.Now()
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && now.After(*token.ExpiresAt)) {
+		return nil, nil, errAPITokenInvalid
+	}
+
+	var user User
+	if err := db.First(&user, token.UserID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	db.Model(&APIToken{}).Where("id = ?", token.ID).Update("last_used_at", now)
+	token.LastUsedAt = &now
+	return &user, &token, nil
+}
+
+// getAPITokenFromContext returns the API token that authenticated the
+// request, or nil for session-authenticated and anonymous requests.
+func getAPITokenFromContext(r *http.Request) *APIToken {
+	if token, ok := r.Context().Value(apiTokenContextKey).(*APIToken); ok && token != nil {
+		return token
+	}
+	return nil
+}
+
+// hasScope reports whether the request's credentials grant scope.
+// Sessions hold every scope.
+func hasScope(r *http.Request, scope string) bool {
+	token := getAPITokenFromContext(r)
+	if token == nil {
+		return true
+	}
+	return slices.Contains(splitScopes(token.Scopes), scope)
+}
+
+// requireScope rejects API-token requests whose token lacks scope.
+// Anonymous requests pass through; routes that need a user also sit
+// behind authMiddleware.
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasScope(r, scope) {
+				l := logging.FromContext(r.Context())
+				l.Warnw("api token missing scope", "scope", scope, "token_id", getAPITokenFromContext(r).ID)
+				writeProblem(w, r, newAPIError(http.StatusForbidden, fmt.Sprintf("token lacks the %q scope", scope)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireSession rejects requests authenticated with an API token, for
+// endpoints that manage credentials.
+func requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getAPITokenFromContext(r) != nil {
+			writeProblem(w, r, newAPIError(http.StatusForbidden, errAPITokenNeedsLogin.Error()))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// @Summary Create an API token
+// @Description Mints a personal API token for bots and scripts. The token
+// @Description is returned once and cannot be retrieved again. Scopes:
+// @Description play, read, analyze. Requires a password/OAuth session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body CreateAPITokenRequest true "Token name, scopes and optional lifetime"
+// @Success 201 {object} CreateAPITokenResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/tokens [post]
+func createAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	user := getMustUserFromContext(r)
+
+	var req CreateAPITokenRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	token, raw, err := store.CreateAPIToken(user.ID, req.Name, req.Scopes, ttl)
+	if err != nil {
+		problem := internalError("could not create token", err)
+		switch {
+		case errors.Is(err, errInvalidScope), errors.Is(err, errNoScopes):
+			problem = invalidRequest(FieldError{Field: "scopes", Message: err.Error()})
+		case errors.Is(err, errTooManyAPITokens):
+			problem = newAPIError(http.StatusBadRequest, err.Error())
+		default:
+			l.Errorw("could not create api token", "user_id", user.ID, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	l.Infow("api token created", "user_id", user.ID, "token_id", token.ID, "scopes", token.Scopes)
+	if err := Renderer.JSON(w, http.StatusCreated, CreateAPITokenResponse{
+		APITokenResponse: newAPITokenResponse(token),
+		Token:            raw,
+	}); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary List API tokens
+// @Description Lists the current user's API tokens, including revoked ones.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} APITokenResponse
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/tokens [get]
+func listAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	user := getMustUserFromContext(r)
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	tokens, err := store.APITokens(user.ID)
+	if err != nil {
+		l.Errorw("could not list api tokens", "user_id", user.ID, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not list tokens"))
+		return
+	}
+
+	out := make([]APITokenResponse, 0, len(tokens))
+	for i := range tokens {
+		out = append(out, newAPITokenResponse(&tokens[i]))
+	}
+	if err := Renderer.JSON(w, http.StatusOK, out); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Revoke an API token
+// @Description Revokes one of the current user's API tokens immediately.
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Token id"
+// @Success 200 {object} MessageResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/tokens/{id} [delete]
+func revokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+	user := getMustUserFromContext(r)
+
+	id, err := strconv.ParseInt(chi.URLParamFromCtx(ctx, "id"), 10, 64)
+	if err != nil {
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "invalid token id"))
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	if err := store.RevokeAPIToken(user.ID, id); err != nil {
+		problem := internalError("could not revoke token", err)
+		if errors.Is(err, errAPITokenNotFound) {
+			problem = newAPIError(http.StatusNotFound, "could not revoke token")
+		} else {
+			l.Errorw("could not revoke api token", "user_id", user.ID, "token_id", id, zap.Error(err))
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	l.Infow("api token revoked", "user_id", user.ID, "token_id", id)
+	if err := Renderer.JSON(w, http.StatusOK, MessageResponse{Message: "token revoked"}); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+
+	token, raw, err := createAPIToken(db, user.ID, "bot", []string{"Read", "play", "read"}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+	if !strings.HasPrefix(raw, apiTokenPrefix) {
+		t.Errorf("raw token %q lacks %q prefix", raw, apiTokenPrefix)
+	}
+	if !strings.HasPrefix(raw, token.Prefix) {
+		t.Errorf("display prefix %q is not a prefix of the token", token.Prefix)
+	}
+	if token.TokenHash == raw || strings.Contains(token.TokenHash, raw) {
+		t.Error("raw token stored in the database")
+	}
+	if token.Scopes != "play,read" {
+		t.Errorf("scopes = %q, want play,read", token.Scopes)
+	}
+	if token.ExpiresAt != nil {
+		t.Errorf("expected no expiry, got %v", token.ExpiresAt)
+	}
+
+	for _, bad := range [][]string{nil, {""}, {"admin"}} {
+		if _, _, err := createAPIToken(db, user.ID, "bad", bad, 0); err == nil {
+			t.Errorf("scopes %q should be rejected", bad)
+		}
+	}
+}
+
+func TestAuthenticateAPIToken(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+
+	token, raw, err := createAPIToken(db, user.ID, "bot", []string{scopePlay}, time.Hour)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+
+	got, gotToken, err := authenticateAPIToken(db, raw)
+	if err != nil {
+		t.Fatalf("authenticateAPIToken: %v", err)
+	}
+	if got.ID != user.ID || gotToken.ID != token.ID {
+		t.Errorf("got user %d token %d, want %d %d", got.ID, gotToken.ID, user.ID, token.ID)
+	}
+	if gotToken.LastUsedAt == nil {
+		t.Error("LastUsedAt not set")
+	}
+
+	if _, _, err := authenticateAPIToken(db, raw+"x"); !errors.Is(err, errAPITokenInvalid) {
+		t.Errorf("wrong token: err = %v, want errAPITokenInvalid", err)
+	}
+
+	if err := db.Model(token).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire token: %v", err)
+	}
+	if _, _, err := authenticateAPIToken(db, raw); !errors.Is(err, errAPITokenInvalid) {
+		t.Errorf("expired token: err = %v, want errAPITokenInvalid", err)
+	}
+}
+
+func TestRevokeAPIToken(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	other := &User{Provider: "local", ProviderID: "other", Email: "other@example.com", Name: "Other"}
+	if err := db.Create(other).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	token, raw, err := createAPIToken(db, user.ID, "bot", []string{scopeRead}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+
+	if err := revokeAPIToken(db, other.ID, token.ID); !errors.Is(err, errAPITokenNotFound) {
+		t.Errorf("revoking someone else's token: err = %v, want errAPITokenNotFound", err)
+	}
+	if err := revokeAPIToken(db, user.ID, token.ID); err != nil {
+		t.Fatalf("revokeAPIToken: %v", err)
+	}
+	if err := revokeAPIToken(db, user.ID, token.ID); !errors.Is(err, errAPITokenNotFound) {
+		t.Errorf("second revoke: err = %v, want errAPITokenNotFound", err)
+	}
+	if _, _, err := authenticateAPIToken(db, raw); !errors.Is(err, errAPITokenInvalid) {
+		t.Errorf("revoked token: err = %v, want errAPITokenInvalid", err)
+	}
+
+	tokens, err := listAPITokens(db, user.ID)
+	if err != nil {
+		t.Fatalf("listAPITokens: %v", err)
+	}
+	if len(tokens) != 1 || tokens[0].RevokedAt == nil {
+		t.Errorf("list = %+v, want the one revoked token", tokens)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := requireScope(scopePlay)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name  string
+		token *APIToken
+		want  int
+	}{
+		{"session", nil, http.StatusNoContent},
+		{"token with scope", &APIToken{ID: 1, Scopes: "analyze,play"}, http.StatusNoContent},
+		{"token without scope", &APIToken{ID: 2, Scopes: "read"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/game/new", nil)
+			if tt.token != nil {
+				req = req.WithContext(context.WithValue(req.Context(), apiTokenContextKey, tt.token))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
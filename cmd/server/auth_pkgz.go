@@ -1,13 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,8 +29,10 @@ import (
 type contextKey string
 
 const (
-	userContextKey  contextKey = "user"
-	emptyJSONObject string     = "{}" // Default empty JSON for user preferences
+	userContextKey     contextKey = "user"
+	sessionContextKey  contextKey = "session"
+	apiTokenContextKey contextKey = "api_token"
+	emptyJSONObject    string     = "{}" // Default empty JSON for user preferences
 )
 
 // getDBErrorMessage returns a user-friendly error message based on the database error
@@ -66,26 +70,24 @@ func getDBErrorMessage(err error) string {
 
 func newAuthService() *auth2.Service {
 	issuer := "gotak-app"
-	secret := os.Getenv("AUTH_JWT_SECRET")
+	secret := settings.JWTSecret
 	if secret == "" {
-		log.Fatalw("AUTH_JWT_SECRET environment variable is required")
+		log.Fatalw("no JWT secret configured")
 	}
 
 	service := auth2.NewService(auth2.Opts{
 		SecretReader:  token.SecretFunc(func(_ string) (string, error) { return secret, nil }),
 		TokenDuration: 24 * time.Hour, // 1 day
 		Issuer:        issuer,
-		URL:           "https://gotak.app", // change for local/dev
-		Validator:     nil,                 // no custom validation needed
-		DisableXSRF:   true,                // for API only
-		AvatarStore:   avatar.NewNoOp(),    // disable avatars support
+		URL:           settings.PublicURL,
+		Validator:     nil,              // no custom validation needed
+		DisableXSRF:   true,             // for API only
+		AvatarStore:   avatar.NewNoOp(), // disable avatars support
 	})
 
 	// Add Google OAuth2 provider if credentials are available
-	googleClientID := os.Getenv("GOOGLE_CLIENT_ID")
-	googleClientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	if googleClientID != "" && googleClientSecret != "" {
-		service.AddProvider("google", googleClientID, googleClientSecret)
+	if g := settings.Google; g.ClientID != "" && g.ClientSecret != "" {
+		service.AddProvider("google", g.ClientID, g.ClientSecret)
 	}
 
 	return service
@@ -97,17 +99,51 @@ type RegisterRequest struct {
 	Name     string `json:"name" example:"John Doe"`
 }
 
+// minPasswordLength is the shortest password an account can have.
+const minPasswordLength = 8
+
+func (req *RegisterRequest) validate() []FieldError {
+	out := requireFields("email", req.Email, "password", req.Password)
+	if req.Password != "" && len(req.Password) < minPasswordLength {
+		out = append(out, FieldError{Field: "password", Message: fmt.Sprintf("must be at least %d characters", minPasswordLength)})
+	}
+	return out
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" example:"user@example.com"`
 	Password string `json:"password" example:"secretpassword"`
 }
 
+func (req *LoginRequest) validate() []FieldError {
+	return requireFields("email", req.Email, "password", req.Password)
+}
+
+// AuthResponse is returned by login and refresh. Token is a short-lived
+// access token; RefreshToken is exchanged at /auth/refresh for a new pair
+// and is invalidated by the exchange.
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+	User         User      `json:"user"`
 }
 
-func AuthRoutes() http.Handler {
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" example:"4f1c..."`
+}
+
+func (req *RefreshRequest) validate() []FieldError {
+	return requireFields("refresh_token", req.RefreshToken)
+}
+
+// LogoutAllResponse reports how many sessions a log-out-everywhere revoked.
+type LogoutAllResponse struct {
+	Message string `json:"message" example:"logged out of all sessions"`
+	Revoked int64  `json:"revoked" example:"3"`
+}
+
+func AuthRoutes(limits *rateLimiter) http.Handler {
 	r := chi.NewRouter()
 
 	// Add rate limiting to auth endpoints
@@ -118,27 +154,41 @@ func AuthRoutes() http.Handler {
 	authHandler, _ := auth.Handlers() // avatarHandler not used here
 	r.Mount("/", authHandler)
 
-	// Add rate limiting specifically for registration and login
+	// Registration, login and password resets are limited per client IP,
+	// against password guessing and reset mail floods.
 	r.Group(func(r chi.Router) {
-		// Allow 10 requests per minute for auth operations
-		r.Use(middleware.ThrottleBacklog(10, 60, 50))
+		r.Use(limits.limit(settings.RateLimits.Auth))
 
 		r.Post("/register", registerHandler)
 		r.Post("/login", loginHandler)
+		r.Post("/reset-password", resetPasswordHandler)
+		r.Post("/confirm-reset", confirmResetHandler)
 	})
 
-	// Profile endpoints with less restrictive rate limiting - require authentication
+	// Refreshing only keeps a session alive, so it spends from the API
+	// budget of the session's user: clients sharing an address can't use
+	// up each other's logins.
+	r.With(limits.limitBy(settings.RateLimits.API, refreshRateKey)).Post("/refresh", refreshHandler)
+
+	// Profile endpoints, on the general rate limit - require authentication
 	r.Group(func(r chi.Router) {
 		r.Use(authMiddleware)
-		r.Get("/profile", profileHandler)
-		r.Put("/profile", updateProfileHandler)
-		r.Post("/logout", logoutHandler)
+		r.Use(limits.limit(settings.RateLimits.API))
+		r.With(requireScope(scopeRead)).Get("/profile", profileHandler)
+
+		// Credential management needs a real login; an API token can't
+		// mint, list or revoke tokens, or end sessions.
+		r.Group(func(r chi.Router) {
+			r.Use(requireSession)
+			r.Put("/profile", updateProfileHandler)
+			r.Post("/logout", logoutHandler)
+			r.Post("/logout-all", logoutAllHandler)
+			r.Post("/tokens", createAPITokenHandler)
+			r.Get("/tokens", listAPITokensHandler)
+			r.Delete("/tokens/{id}", revokeAPITokenHandler)
+		})
 	})
 
-	// Password reset endpoints
-	r.Post("/reset-password", resetPasswordHandler)
-	r.Post("/confirm-reset", confirmResetHandler)
-
 	return r
 }
 
@@ -149,60 +199,36 @@ func AuthRoutes() http.Handler {
 // @Produce json
 // @Param user body RegisterRequest true "User registration data"
 // @Success 201 {object} MessageResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /auth/register [post]
+// @Failure 400 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/register [post]
 func registerHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		l.Warnw("invalid registration request body", "error", err.Error(), "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid request body"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	if req.Email == "" || req.Password == "" {
-		l.Warnw("registration missing required fields", "email_empty", req.Email == "", "password_empty", req.Password == "", "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusBadRequest, map[string]string{"error": "email and password required"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	if len(req.Password) < 8 {
-		l.Warnw("registration password too short", "password_length", len(req.Password), "email", req.Email, "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusBadRequest, map[string]string{"error": "password must be at least 8 characters"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	if err := decodeRequest(r, &req); err != nil {
+		l.Warnw("invalid registration request", "remote_addr", r.RemoteAddr, zap.Error(err))
+		writeProblem(w, r, err)
 		return
 	}
 
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "database error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
 		return
 	}
 
-	var existingUser User
-	if err := db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
+	if _, err := store.UserByEmail(req.Email, ""); err == nil {
 		l.Warnw("registration attempt for existing user", "email", req.Email, "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusBadRequest, map[string]string{"error": "user already exists"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "user already exists"))
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		l.Errorw("failed to hash password", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, map[string]string{"error": "password processing error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "password processing error"))
 		return
 	}
 
@@ -217,14 +243,12 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		Preferences:  emptyJSONObject,
 	}
 
-	if err := db.Create(&user).Error; err != nil {
+	if err := store.CreateUser(&user); err != nil {
 		l.Errorw("failed to create user", "email", req.Email, "error", err.Error(), "remote_addr", r.RemoteAddr)
 
 		errorMsg := getDBErrorMessage(err)
 
-		if err := Renderer.JSON(w, http.StatusInternalServerError, map[string]string{"error": errorMsg}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, errorMsg))
 		return
 	}
 
@@ -241,72 +265,148 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param user body LoginRequest true "User login data"
 // @Success 200 {object} AuthResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 401 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /auth/login [post]
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/login [post]
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		l.Warnw("invalid login request body", "error", err.Error(), "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid request body"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	if err := decodeRequest(r, &req); err != nil {
+		l.Warnw("invalid login request", "remote_addr", r.RemoteAddr, zap.Error(err))
+		writeProblem(w, r, err)
 		return
 	}
 
-	if req.Email == "" || req.Password == "" {
-		l.Warnw("login missing required fields", "email_empty", req.Email == "", "password_empty", req.Password == "", "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusBadRequest, map[string]string{"error": "email and password required"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "database error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
 		return
 	}
 
-	var user User
-	if err := db.Where("email = ? AND provider = ?", req.Email, "local").First(&user).Error; err != nil {
+	user, err := store.UserByEmail(req.Email, "local")
+	if err != nil {
 		l.Warnw("login attempt for non-existent user", "email", req.Email, "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusUnauthorized, "invalid credentials"))
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		l.Warnw("login attempt with invalid password", "email", req.Email, "user_id", user.ID, "remote_addr", r.RemoteAddr)
-		if err := Renderer.JSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusUnauthorized, "invalid credentials"))
+		return
+	}
+	if user.BannedAt != nil {
+		l.Warnw("login attempt by banned user", "user_id", user.ID, "remote_addr", r.RemoteAddr)
+		writeProblem(w, r, bannedProblem())
 		return
 	}
 
-	token, err := generateJWT(user.ID)
+	resp, err := issueTokens(store, user, r.UserAgent())
 	if err != nil {
 		l.Errorw("failed to generate token", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, map[string]string{"error": "token generation error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "token generation error"))
+		return
+	}
+
+	l.Infow("user logged in successfully", "user_id", user.ID, "email", req.Email, "remote_addr", r.RemoteAddr)
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
+// @Summary Refresh an access token
+// @Description Exchange a refresh token for a new access token and a new
+// @Description refresh token. The presented refresh token stops working;
+// @Description presenting it again revokes the whole session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/refresh [post]
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	var req RefreshRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	session, refreshToken, err := store.RotateSession(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, errRefreshTokenReused) {
+			l.Warnw("refresh token reuse detected, session revoked", "remote_addr", r.RemoteAddr)
+		} else {
+			l.Warnw("refresh rejected", "remote_addr", r.RemoteAddr, zap.Error(err))
 		}
+		writeProblem(w, r, newAPIError(http.StatusUnauthorized, "invalid refresh token"))
 		return
 	}
 
-	user.PasswordHash = ""
+	user, err := store.User(session.UserID)
+	if err != nil {
+		l.Errorw("session user missing", "session_id", session.ID, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusUnauthorized, "invalid refresh token"))
+		return
+	}
 
-	l.Infow("user logged in successfully", "user_id", user.ID, "email", req.Email, "remote_addr", r.RemoteAddr)
-	if err := Renderer.JSON(w, http.StatusOK, AuthResponse{Token: token, User: user}); err != nil {
+	token, expiresAt, err := generateJWTForUser(user, session.ID)
+	if err != nil {
+		l.Errorw("failed to generate token", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "token generation error"))
+		return
+	}
+
+	user.PasswordHash = ""
+	if err := Renderer.JSON(w, http.StatusOK, AuthResponse{
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		User:         *user,
+	}); err != nil {
 		l.Errorw("failed to render JSON", zap.Error(err))
 	}
 }
 
+// refreshRateKey keys a refresh by the user whose session the refresh
+// token belongs to. It reads the body and puts it back for the handler.
+func refreshRateKey(r *http.Request) (string, string, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		return "", "", false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req RefreshRequest
+	if json.Unmarshal(body, &req) != nil || req.RefreshToken == "" {
+		return "", "", false
+	}
+	store, err := requestStore(r)
+	if err != nil {
+		return "", "", false
+	}
+	session, err := store.SessionByRefreshToken(req.RefreshToken)
+	if err != nil {
+		return "", "", false
+	}
+	return "user", strconv.FormatInt(session.UserID, 10), true
+}
+
 // @Summary Get user profile
 // @Description Get current user profile information
 // @Tags auth
@@ -314,9 +414,10 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} User
-// @Failure 401 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /auth/profile [get]
+// @Failure 401 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/profile [get]
 func profileHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
 	user := getMustUserFromContext(r)
@@ -337,11 +438,30 @@ type ResetPasswordRequest struct {
 	Email string `json:"email" example:"user@example.com"`
 }
 
+func (req *ResetPasswordRequest) validate() []FieldError {
+	return requireFields("email", req.Email)
+}
+
+// ResetPasswordResponse acknowledges a reset request. Until reset emails
+// are sent, DevToken carries the reset token itself.
+type ResetPasswordResponse struct {
+	Message  string `json:"message" example:"if email exists, reset instructions sent"`
+	DevToken string `json:"dev_token,omitempty"`
+}
+
 type ConfirmResetRequest struct {
 	Token       string `json:"token" example:"reset-token-here"`
 	NewPassword string `json:"new_password" example:"newsecretpassword"`
 }
 
+func (req *ConfirmResetRequest) validate() []FieldError {
+	out := requireFields("token", req.Token, "new_password", req.NewPassword)
+	if req.NewPassword != "" && len(req.NewPassword) < minPasswordLength {
+		out = append(out, FieldError{Field: "new_password", Message: fmt.Sprintf("must be at least %d characters", minPasswordLength)})
+	}
+	return out
+}
+
 // @Summary Update user profile
 // @Description Update current user profile information
 // @Tags auth
@@ -350,28 +470,25 @@ type ConfirmResetRequest struct {
 // @Security BearerAuth
 // @Param profile body UpdateProfileRequest true "Profile update data"
 // @Success 200 {object} User
-// @Failure 400 {object} ErrorResponse
-// @Failure 401 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /auth/profile [put]
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/profile [put]
 func updateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
 	user := getMustUserFromContext(r)
 
 	var req UpdateProfileRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		if err := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid request body"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "database error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
 		return
 	}
 
@@ -384,46 +501,104 @@ func updateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(updates) > 0 {
-		if err := db.Model(&user).Updates(updates).Error; err != nil {
+		if err := store.UpdateUser(user, updates); err != nil {
 			l.Errorw("failed to update user", zap.Error(err))
-			if err := Renderer.JSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update profile"}); err != nil {
-				l.Errorw("failed to render JSON", zap.Error(err))
-			}
+			writeProblem(w, r, newAPIError(http.StatusInternalServerError, "failed to update profile"))
 			return
 		}
 	}
 
-	if err := db.First(&user, user.ID).Error; err != nil {
+	reloaded, err := store.User(user.ID)
+	if err != nil {
 		l.Errorw("failed to reload user", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to reload profile"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "failed to reload profile"))
 		return
 	}
 
-	user.PasswordHash = ""
+	reloaded.PasswordHash = ""
 
-	if err := Renderer.JSON(w, http.StatusOK, user); err != nil {
+	if err := Renderer.JSON(w, http.StatusOK, reloaded); err != nil {
 		l.Errorw("failed to render JSON", zap.Error(err))
 	}
 }
 
 // @Summary Logout user
-// @Description Logout current user (client should discard token)
+// @Description Revokes the session behind the presented access token. The
+// @Description access token and its refresh token stop working immediately.
 // @Tags auth
 // @Accept json
 // @Produce json
+// @Security BearerAuth
 // @Success 200 {object} MessageResponse
-// @Router /auth/logout [post]
+// @Failure 401 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/logout [post]
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
-	// For JWT-based auth, logout is handled client-side by discarding the token.
-	// We could implement a token blacklist here if needed.
+	session := getSessionFromContext(r)
+	if session == nil {
+		writeProblem(w, r, newAPIError(http.StatusUnauthorized, "authentication required"))
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	if err := store.RevokeSession(session.ID); err != nil {
+		l.Errorw("failed to revoke session", "session_id", session.ID, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "logout failed"))
+		return
+	}
+
 	if err := Renderer.JSON(w, http.StatusOK, MessageResponse{Message: "logged out successfully"}); err != nil {
 		l.Errorw("failed to render JSON", zap.Error(err))
 	}
 }
 
+// @Summary Logout everywhere
+// @Description Revokes every session belonging to the current user,
+// @Description including the one making this request.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} LogoutAllResponse
+// @Failure 401 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/logout-all [post]
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	user := getMustUserFromContext(r)
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
+		return
+	}
+
+	revoked, err := store.RevokeAllSessions(user.ID)
+	if err != nil {
+		l.Errorw("failed to revoke sessions", "user_id", user.ID, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "logout failed"))
+		return
+	}
+
+	l.Infow("user logged out everywhere", "user_id", user.ID, "revoked", revoked)
+	if err := Renderer.JSON(w, http.StatusOK, LogoutAllResponse{
+		Message: "logged out of all sessions",
+		Revoked: revoked,
+	}); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
+
 func generateProviderID() string {
 	bytes := make([]byte, 16)
 	if _, err := rand.Read(bytes); err != nil {
@@ -432,33 +607,45 @@ func generateProviderID() string {
 	return fmt.Sprintf("%x", bytes)
 }
 
-func generateJWT(userID int64) (string, error) {
-	// Get the database to fetch the user's information
-	db, err := getDB()
+// issueTokens starts a new session for user and returns the login payload.
+// The user's password hash is cleared before it is returned.
+func issueTokens(store Store, user *User, userAgent string) (AuthResponse, error) {
+	session, refreshToken, err := store.CreateSession(user.ID, userAgent)
 	if err != nil {
-		return "", fmt.Errorf("database connection error: %w", err)
+		return AuthResponse{}, fmt.Errorf("could not create session: %w", err)
 	}
 
-	var user User
-	if err := db.First(&user, userID).Error; err != nil {
-		return "", fmt.Errorf("user not found: %w", err)
+	token, expiresAt, err := generateJWTForUser(user, session.ID)
+	if err != nil {
+		return AuthResponse{}, err
 	}
 
-	return generateJWTForUser(&user)
+	u := *user
+	u.PasswordHash = ""
+	return AuthResponse{
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		User:         u,
+	}, nil
 }
 
-func generateJWTForUser(user *User) (string, error) {
+// generateJWTForUser signs a short-lived access token bound to sessionID
+// via the jti claim, so revoking the session revokes the token.
+func generateJWTForUser(user *User, sessionID int64) (string, time.Time, error) {
 	auth := newAuthService()
 	tokenService := auth.TokenService()
 
 	// Create JWT claims with proper structure
 	now := time.Now()
+	expiresAt := now.Add(accessTokenTTL)
 	claims := token.Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        strconv.FormatInt(sessionID, 10),
 			Issuer:    "gotak-app",
 			Subject:   fmt.Sprintf("%d", user.ID),
 			Audience:  []string{"gotak"},
-			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			NotBefore: jwt.NewNumericDate(now),
 			IssuedAt:  jwt.NewNumericDate(now),
 		},
@@ -471,68 +658,136 @@ func generateJWTForUser(user *User) (string, error) {
 
 	tokenString, err := tokenService.Token(claims)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to generate token: %w", err)
 	}
-	return tokenString, nil
+	return tokenString, expiresAt, nil
 }
 
-func getCurrentUser(r *http.Request) (*User, error) {
+// getCurrentUser authenticates the bearer token on r. JWTs resolve to a
+// user and session; gtk_ API tokens resolve to a user and the token.
+func getCurrentUser(r *http.Request) (*User, *Session, *APIToken, error) {
 	// Get token from Authorization header
 	authHeader := r.Header.Get("Authorization")
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return nil, fmt.Errorf("missing or invalid authorization header")
+		return nil, nil, nil, fmt.Errorf("missing or invalid authorization header")
 	}
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
+	store, err := requestStore(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var (
+		user     *User
+		session  *Session
+		apiToken *APIToken
+	)
+	if strings.HasPrefix(tokenString, apiTokenPrefix) {
+		user, apiToken, err = store.AuthenticateAPIToken(tokenString)
+	} else {
+		user, session, err = authenticateAccessToken(store, tokenString)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Banning revokes the user's sessions and tokens; this also refuses
+	// any issued in a race with the ban.
+	if user != nil && user.BannedAt != nil {
+		return nil, nil, nil, errUserBanned
+	}
+	return user, session, apiToken, nil
+}
+
+// authenticateAccessToken verifies signature and expiry (the go-pkgz
+// parser checks neither exp nor nbf) and that the token's session is
+// still live.
+func authenticateAccessToken(store Store, tokenString string) (*User, *Session, error) {
 	auth := newAuthService()
 	tokenService := auth.TokenService()
 	claims, err := tokenService.Parse(tokenString)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	userID := claims.User.ID
+	if claims.ExpiresAt == nil || time.Now().After(claims.ExpiresAt.Time) {
+		return nil, nil, fmt.Errorf("token expired")
+	}
+	if claims.User == nil {
+		return nil, nil, fmt.Errorf("token has no user")
+	}
 
-	db, err := getDB()
+	sessionID, err := parseSessionID(claims.ID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	var user User
-	if err := db.First(&user, userID).Error; err != nil {
-		return nil, err
+	session, err := store.ActiveSession(sessionID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return &user, nil
+	userID, err := strconv.ParseInt(claims.User.ID, 10, 64)
+	if err != nil || userID != session.UserID {
+		return nil, nil, fmt.Errorf("token user does not own session")
+	}
+
+	user, err := store.User(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, session, nil
 }
 
 // Auth middleware to protect routes
 func authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		l := logging.FromContext(r.Context())
-		user, err := getCurrentUser(r)
+		user, session, apiToken, err := getCurrentUser(r)
+		if errors.Is(err, errUserBanned) {
+			l.Warnw("banned user refused", "path", r.URL.Path)
+			writeProblem(w, r, bannedProblem())
+			return
+		}
 		if err != nil {
 			l.Errorw("authentication failed", zap.Error(err))
-			if err := Renderer.JSON(w, http.StatusUnauthorized, ErrorResponse{Error: "authentication required"}); err != nil {
-				l.Errorw("failed to render JSON", zap.Error(err))
-			}
+			writeProblem(w, r, newAPIError(http.StatusUnauthorized, "authentication required"))
 			return
 		}
 
 		if user == nil {
 			l.Errorw("user is nil after successful authentication - this should never happen")
-			if err := Renderer.JSON(w, http.StatusUnauthorized, ErrorResponse{Error: "authentication required"}); err != nil {
-				l.Errorw("failed to render JSON", zap.Error(err))
-			}
+			writeProblem(w, r, newAPIError(http.StatusUnauthorized, "authentication required"))
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), userContextKey, user)
+		if session != nil {
+			ctx = context.WithValue(ctx, sessionContextKey, session)
+		}
+		if apiToken != nil {
+			ctx = context.WithValue(ctx, apiTokenContextKey, apiToken)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// optionalAuthMiddleware authenticates requests that carry an
+// Authorization header and lets anonymous ones through, so public routes
+// can still apply requireScope to API tokens.
+func optionalAuthMiddleware(next http.Handler) http.Handler {
+	protected := authMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
 // Helper to get user from request context
 func getUserFromContext(r *http.Request) *User {
 	if user, ok := r.Context().Value(userContextKey).(*User); ok && user != nil {
@@ -541,6 +796,15 @@ func getUserFromContext(r *http.Request) *User {
 	return nil
 }
 
+// getSessionFromContext returns the session authMiddleware authenticated,
+// or nil outside protected routes.
+func getSessionFromContext(r *http.Request) *Session {
+	if session, ok := r.Context().Value(sessionContextKey).(*Session); ok && session != nil {
+		return session
+	}
+	return nil
+}
+
 // Helper to get user from request context with panic on nil (for protected routes)
 func getMustUserFromContext(r *http.Request) *User {
 	user := getUserFromContext(r)
@@ -556,40 +820,29 @@ func getMustUserFromContext(r *http.Request) *User {
 // @Accept json
 // @Produce json
 // @Param request body ResetPasswordRequest true "Reset password request"
-// @Success 200 {object} MessageResponse
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /auth/reset-password [post]
+// @Success 200 {object} ResetPasswordResponse
+// @Failure 400 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/reset-password [post]
 func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
 	var req ResetPasswordRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		if err := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid request body"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
-	if req.Email == "" {
-		if err := Renderer.JSON(w, http.StatusBadRequest, map[string]string{"error": "email required"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "database error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "database error"))
 		return
 	}
 
-	var user User
-	if err := db.Where("email = ? AND provider = ?", req.Email, "local").First(&user).Error; err != nil {
+	if _, err := store.UserByEmail(req.Email, "local"); err != nil {
 		// Return success even if user doesn't exist (security best practice).
-		if err := Renderer.JSON(w, http.StatusOK, map[string]string{"message": "if email exists, reset instructions sent"}); err != nil {
+		if err := Renderer.JSON(w, http.StatusOK, ResetPasswordResponse{Message: "if email exists, reset instructions sent"}); err != nil {
 			l.Errorw("failed to render JSON", zap.Error(err))
 		}
 		return
@@ -600,9 +853,9 @@ func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO: In production, implement email sending and store token with expiration.
 	l.Infow("Password reset token generated", "email", req.Email, "token", resetToken)
 
-	if err := Renderer.JSON(w, http.StatusOK, map[string]string{
-		"message":   "if email exists, reset instructions sent",
-		"dev_token": resetToken,
+	if err := Renderer.JSON(w, http.StatusOK, ResetPasswordResponse{
+		Message:  "if email exists, reset instructions sent",
+		DevToken: resetToken,
 	}); err != nil {
 		l.Errorw("failed to render JSON", zap.Error(err))
 	}
@@ -615,35 +868,17 @@ func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param request body ConfirmResetRequest true "Confirm reset request"
 // @Success 200 {object} MessageResponse
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /auth/confirm-reset [post]
+// @Failure 400 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/auth/confirm-reset [post]
 func confirmResetHandler(w http.ResponseWriter, r *http.Request) {
-	l := logging.FromContext(r.Context())
 	var req ConfirmResetRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		if err := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid request body"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	if req.Token == "" || req.NewPassword == "" {
-		if err := Renderer.JSON(w, http.StatusBadRequest, map[string]string{"error": "token and new password required"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
-	}
-
-	if len(req.NewPassword) < 8 {
-		if err := Renderer.JSON(w, http.StatusBadRequest, map[string]string{"error": "password must be at least 8 characters"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
 		return
 	}
 
 	// TODO: In production, validate token from database and check expiration.
-	if err := Renderer.JSON(w, 400, map[string]string{"error": "password reset not fully implemented - token storage needed"}); err != nil {
-		l.Errorw("failed to render JSON", zap.Error(err))
-	}
+	writeProblem(w, r, newAPIError(http.StatusBadRequest, "password reset not fully implemented - token storage needed"))
 }
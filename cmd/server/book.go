@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/icco/gotak/ai"
+	"go.uber.org/zap"
+)
+
+const (
+	// bookPlies is how many half-moves of each finished game go into the
+	// opening book.
+	bookPlies = 16
+	// defaultBookVariety spreads AI openings over the good book moves
+	// rather than always playing the most successful one.
+	defaultBookVariety = 1.0
+	// bookMinGames keeps moves seen in a single game out of play.
+	bookMinGames = 2
+)
+
+// buildGameBook builds an opening book from the first bookPlies half-moves
+// of every finished game. It returns the book and the games it used;
+// games that don't replay are skipped.
+func buildGameBook(store Store, l *zap.SugaredLogger) (*ai.Book, int, error) {
+	finished, err := store.FinishedGames()
+	if err != nil {
+		return nil, 0, err
+	}
+	book := ai.NewBook()
+	used := 0
+	for _, row := range finished {
+		game, err := store.Game(row.Slug)
+		if err != nil {
+			l.Warnw("skipping game for opening book", "slug", row.Slug, zap.Error(err))
+			continue
+		}
+		if err := book.AddGame(game, row.Winner, bookPlies); err != nil {
+			l.Warnw("skipping game for opening book", "slug", row.Slug, zap.Error(err))
+			continue
+		}
+		used++
+	}
+	return book, used, nil
+}
+
+// loadOpeningBook gives the AI engines an opening book built from the
+// server's finished games plus the configured opening book file, if any.
+// The configured variety sets how far play strays from the best book move.
+func loadOpeningBook(store Store, l *zap.SugaredLogger) error {
+	book, games, err := buildGameBook(store, l)
+	if err != nil {
+		return err
+	}
+	if path := settings.Engines.OpeningBook; path != "" {
+		imported, err := ai.LoadBook(path)
+		if err != nil {
+			return err
+		}
+		book.Merge(imported)
+	}
+
+	variety := settings.Engines.BookVariety
+	engines.UseBook(book, ai.BookOptions{Variety: variety, MinGames: bookMinGames})
+	l.Infow("opening book loaded", "positions", book.Len(), "games", games, "variety", variety)
+	return nil
+}
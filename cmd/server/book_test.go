@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+	"go.uber.org/zap"
+)
+
+func TestBuildGameBook(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	game, _ := storeRoadGame(t, db, user)
+	l := zap.NewNop().Sugar()
+
+	book, games, err := buildGameBook(&gormStore{db: db}, l)
+	if err != nil || games != 0 || book.Len() != 0 {
+		t.Fatalf("book from unfinished games = %d positions, %d games, %v", book.Len(), games, err)
+	}
+
+	if err := updateGameStatus(db, game.Slug, gotak.PlayerWhite); err != nil {
+		t.Fatalf("updateGameStatus: %v", err)
+	}
+	book, games, err = buildGameBook(&gormStore{db: db}, l)
+	if err != nil || games != 1 {
+		t.Fatalf("buildGameBook = %d games, %v", games, err)
+	}
+	start, err := gotak.NewGame(5, 0, "start")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	moves, err := book.Moves(start)
+	if err != nil || len(moves) != 1 || moves[0] != (ai.BookMove{Move: "a5", Wins: 1}) {
+		t.Errorf("opening moves = %+v, %v", moves, err)
+	}
+	if book.Len() != 9 {
+		t.Errorf("book has %d positions, want one per move of the nine-move game", book.Len())
+	}
+}
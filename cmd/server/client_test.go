@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak/client"
+)
+
+// TestClient plays through the API with the Go client against the real
+// router, so a server change the client can't follow fails here.
+func TestClient(t *testing.T) {
+	useTestSettings(t)
+	store, err := openStore("memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx, stop := context.WithCancel(context.Background())
+	analysisJobs = newAnalysisQueue(store, 1)
+	analysisJobs.start(ctx)
+	t.Cleanup(func() {
+		stop()
+		analysisJobs.wait()
+		analysisJobs = nil
+	})
+	srv := httptest.NewServer(buildRouter(routerOptions{IsDev: true, Store: store}))
+	t.Cleanup(srv.Close)
+
+	var saved []client.Tokens
+	c := client.New(srv.URL, client.WithTokenHandler(func(t client.Tokens) { saved = append(saved, t) }))
+
+	if h, err := c.Health(ctx); err != nil || h.Healthy != "true" {
+		t.Fatalf("Health = %+v, %v", h, err)
+	}
+
+	// Accounts.
+	if err := c.Register(ctx, client.RegisterRequest{Email: "alice@example.com", Password: "correct horse", Name: "Alice"}); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := c.Login(ctx, "alice@example.com", "wrong password"); client.ErrorCode(err) != "unauthenticated" {
+		t.Errorf("Login with a wrong password = %v", err)
+	}
+	login, err := c.Login(ctx, "alice@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if len(saved) != 1 || saved[0].Access != login.Token {
+		t.Errorf("token handler saw %+v after login", saved)
+	}
+	if err := c.Refresh(ctx); err != nil || c.Tokens().Refresh == login.RefreshToken {
+		t.Errorf("Refresh = %v, tokens %+v", err, c.Tokens())
+	}
+	if u, err := c.Profile(ctx); err != nil || u.Name != "Alice" {
+		t.Errorf("Profile = %+v, %v", u, err)
+	}
+
+	// A game against the AI.
+	game, err := c.CreateGame(ctx, client.CreateGameRequest{Size: "5", Mode: "ai"})
+	if err != nil {
+		t.Fatalf("CreateGame: %v", err)
+	}
+	if game.Slug == "" || game.Board.Size != 5 || game.Status != "active" {
+		t.Errorf("CreateGame = %+v", game)
+	}
+	if game, err = c.Move(ctx, game.Slug, client.MoveRequest{Player: 1, Text: "a1", Turn: 1}); err != nil || len(game.Turns) != 1 {
+		t.Fatalf("Move = %+v, %v", game, err)
+	}
+	_, err = c.Move(ctx, game.Slug, client.MoveRequest{Player: 1, Text: "b2", Turn: 1})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("out of turn Move = %v", err)
+	}
+	ai, err := c.AIMove(ctx, game.Slug, client.AIRequest{Nodes: 200, TimeLimit: time.Second})
+	if err != nil || ai.Move == "" || ai.CurrentPlayer != 1 {
+		t.Fatalf("AIMove = %+v, %v", ai, err)
+	}
+	if g, err := c.GameWithThreats(ctx, game.Slug); err != nil || g.Threats == nil {
+		t.Errorf("GameWithThreats = %+v, %v", g, err)
+	}
+	if r, err := c.Replay(ctx, game.Slug); err != nil || len(r.Steps) != 2 {
+		t.Errorf("Replay = %+v, %v", r, err)
+	}
+	if ptn, err := c.PTN(ctx, game.Slug); err != nil || !strings.Contains(ptn, "1. a1 "+ai.Move) {
+		t.Errorf("PTN = %q, %v", ptn, err)
+	}
+
+	// Analysis.
+	job, err := c.AnalyzeGame(ctx, game.Slug, client.AnalyzeRequest{Nodes: 200})
+	if err != nil {
+		t.Fatalf("AnalyzeGame: %v", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if job, err = c.WaitForAnalysis(waitCtx, job.ID, 10*time.Millisecond); err != nil || job.Status != client.JobDone {
+		t.Errorf("WaitForAnalysis = %+v, %v", job, err)
+	}
+	if pa, err := c.PositionAnalysis(ctx, game.Slug, 1, 2, client.AnalyzeRequest{Nodes: 200}); err != nil || len(pa.Lines) == 0 {
+		t.Errorf("PositionAnalysis = %+v, %v", pa, err)
+	}
+	if o, err := c.Openings(ctx, "a1"); err != nil || len(o.Continuations) != 1 {
+		t.Errorf("Openings = %+v, %v", o, err)
+	}
+
+	// Ending every session from one client ends it for another holding
+	// the same tokens: its refresh is rejected.
+	other := client.New(srv.URL, client.WithTokens(c.Tokens()))
+	if _, err := c.LogoutAll(ctx); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	if _, err := other.Profile(ctx); !errors.Is(err, client.ErrSessionEnded) {
+		t.Errorf("Profile after logout-all = %v, want ErrSessionEnded", err)
+	}
+	if other.Tokens() != (client.Tokens{}) || saved[len(saved)-1] != (client.Tokens{}) {
+		t.Errorf("tokens kept after the session ended: %+v, %+v", other.Tokens(), saved)
+	}
+}
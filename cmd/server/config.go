@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the server's configuration. loadConfig starts from
+// defaultConfig, reads the YAML file CONFIG_FILE names over it, then
+// applies the environment variables in configEnv, so a deployment can keep
+// its settings in a file and override any of them from the environment.
+//
+//	port: "8080"
+//	database_url: postgres://gotak@db/gotak
+//	jwt_secret: change-me
+//	env: production
+//	public_url: https://gotak.app
+//	playtak_addr: ":10000"
+//	google: {client_id: …, client_secret: …}
+//	cors:
+//	  allowed_origins: [https://gotak.app]
+//	games:
+//	  board_sizes: [5, 6, 7, 8]
+//	  default_size: 6
+//	engines:
+//	  config: /etc/gotak/engines.yaml
+//	  move_time: 10s
+//	  analysis_time: 2s
+//	  max_time: 30s
+//	  analysis_workers: 2
+//	  opening_book: /etc/gotak/book.txt
+//	  book_variety: 1
+//	rate_limits:
+//	  store: database
+//	  trusted_proxies: 1
+//	  api: {burst: 120, per: 1m}
+//	  ai: {burst: 10, per: 1m}
+//	  analysis: {burst: 5, per: 1m}
+//	  auth: {burst: 10, per: 1m}
+type Config struct {
+	Port        string `yaml:"port"`
+	DatabaseURL string `yaml:"database_url"`
+	JWTSecret   string `yaml:"jwt_secret"`
+	// Env is "production" to redirect to HTTPS and send strict security
+	// headers; anything else is development.
+	Env string `yaml:"env"`
+	// PublicURL is where clients reach the server. It is the JWT audience
+	// and where the Swagger UI loads the API document from.
+	PublicURL   string       `yaml:"public_url"`
+	PlaytakAddr string       `yaml:"playtak_addr"`
+	Google      GoogleConfig `yaml:"google"`
+	CORS        CORSConfig   `yaml:"cors"`
+	Games       GamesConfig  `yaml:"games"`
+	Engines     EngineLimits `yaml:"engines"`
+	RateLimits  RateLimits   `yaml:"rate_limits"`
+}
+
+// GoogleConfig enables Google sign-in when both fields are set.
+type GoogleConfig struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+}
+
+// CORSConfig is who browsers let call the API.
+type CORSConfig struct {
+	// AllowedOrigins are origins such as https://gotak.app, or "*" for any.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// GamesConfig limits the games players can create.
+type GamesConfig struct {
+	BoardSizes  []int `yaml:"board_sizes"`
+	DefaultSize int   `yaml:"default_size"`
+}
+
+// EngineLimits bounds the work AI moves and analyses ask of the engines.
+type EngineLimits struct {
+	// Config is an ai.EnginesConfig file adding engines to the built-in ones.
+	Config string `yaml:"config"`
+	// MoveTime and AnalysisTime are the search time an AI move and each
+	// analysed move get when the request doesn't say. MaxTime caps what a
+	// request can ask for.
+	MoveTime        time.Duration `yaml:"move_time"`
+	AnalysisTime    time.Duration `yaml:"analysis_time"`
+	MaxTime         time.Duration `yaml:"max_time"`
+	AnalysisWorkers int           `yaml:"analysis_workers"`
+	// OpeningBook is a takbook file added to the book built from finished
+	// games; BookVariety is how far AI openings stray from its best move.
+	OpeningBook string  `yaml:"opening_book"`
+	BookVariety float64 `yaml:"book_variety"`
+}
+
+// RateLimits configures the rate limiter and its budgets.
+type RateLimits struct {
+	// Store is "memory" to keep budgets per server instance or "database"
+	// to share them.
+	Store string `yaml:"store"`
+	// TrustedProxies is how many reverse proxies in front of the server
+	// append to X-Forwarded-For.
+	TrustedProxies int       `yaml:"trusted_proxies"`
+	API            rateLimit `yaml:"api"`
+	AI             rateLimit `yaml:"ai"`
+	Analysis       rateLimit `yaml:"analysis"`
+	Auth           rateLimit `yaml:"auth"`
+}
+
+// settings is the configuration the handlers run with. main replaces it
+// with loadConfig's.
+var settings = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Port:      "8080",
+		PublicURL: "https://gotak.app",
+		CORS:      CORSConfig{AllowedOrigins: []string{"*"}},
+		Games:     GamesConfig{BoardSizes: []int{4, 5, 6, 7, 8, 9}, DefaultSize: 8},
+		Engines: EngineLimits{
+			MoveTime:        defaultAIMoveTimeLimit,
+			AnalysisTime:    defaultAnalyzeTimeLimit,
+			MaxTime:         time.Minute,
+			AnalysisWorkers: defaultAnalysisWorkers,
+			BookVariety:     defaultBookVariety,
+		},
+		RateLimits: RateLimits{Store: "memory", API: apiLimit, AI: aiLimit, Analysis: analysisLimit, Auth: authLimit},
+	}
+}
+
+// production reports whether c is a production deployment.
+func (c Config) production() bool {
+	return c.Env == "production"
+}
+
+// allowsBoardSize reports whether new games can be size x size.
+func (c Config) allowsBoardSize(size int) bool {
+	return slices.Contains(c.Games.BoardSizes, size)
+}
+
+// engineTime is the search time for a request asking for requested, fallback
+// when it doesn't say, capped at the configured maximum.
+func (c Config) engineTime(requested, fallback time.Duration) time.Duration {
+	if requested <= 0 {
+		requested = fallback
+	}
+	return min(requested, c.Engines.MaxTime)
+}
+
+// configEnv maps the environment variables that override the config file
+// to the settings they set.
+func configEnv(c *Config) map[string]any {
+	return map[string]any{
+		"PORT":                 &c.Port,
+		"DATABASE_URL":         &c.DatabaseURL,
+		"AUTH_JWT_SECRET":      &c.JWTSecret,
+		"NAT_ENV":              &c.Env,
+		"PUBLIC_URL":           &c.PublicURL,
+		"PLAYTAK_ADDR":         &c.PlaytakAddr,
+		"GOOGLE_CLIENT_ID":     &c.Google.ClientID,
+		"GOOGLE_CLIENT_SECRET": &c.Google.ClientSecret,
+		"CORS_ALLOWED_ORIGINS": &c.CORS.AllowedOrigins,
+		"BOARD_SIZES":          &c.Games.BoardSizes,
+		"ENGINES_CONFIG":       &c.Engines.Config,
+		"AI_MOVE_TIME":         &c.Engines.MoveTime,
+		"ANALYSIS_TIME":        &c.Engines.AnalysisTime,
+		"MAX_ENGINE_TIME":      &c.Engines.MaxTime,
+		"ANALYSIS_WORKERS":     &c.Engines.AnalysisWorkers,
+		"OPENING_BOOK":         &c.Engines.OpeningBook,
+		"OPENING_BOOK_VARIETY": &c.Engines.BookVariety,
+		"RATE_LIMIT_STORE":     &c.RateLimits.Store,
+		"TRUSTED_PROXIES":      &c.RateLimits.TrustedProxies,
+	}
+}
+
+// loadConfig reads the configuration from the YAML file at path, if any,
+// and the environment as getenv sees it. It doesn't validate it.
+func loadConfig(path string, getenv func(string) string) (Config, error) {
+	c := defaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator config
+		if err != nil {
+			return c, fmt.Errorf("read config: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return c, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+
+	var errs []error
+	for name, field := range configEnv(&c) {
+		s := getenv(name)
+		if s == "" {
+			continue
+		}
+		if err := setFromEnv(field, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	// The budgets' names key their buckets and aren't configurable.
+	c.RateLimits.API.Name, c.RateLimits.AI.Name = apiLimit.Name, aiLimit.Name
+	c.RateLimits.Analysis.Name, c.RateLimits.Auth.Name = analysisLimit.Name, authLimit.Name
+	return c, errors.Join(sortedErrors(errs)...)
+}
+
+// setFromEnv parses s into field, one of configEnv's.
+func setFromEnv(field any, s string) error {
+	switch f := field.(type) {
+	case *string:
+		*f = s
+	case *int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", s)
+		}
+		*f = n
+	case *float64:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		*f = v
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 10s", s)
+		}
+		*f = d
+	case *[]string:
+		*f = splitList(s)
+	case *[]int:
+		var ns []int
+		for _, item := range splitList(s) {
+			n, err := strconv.Atoi(item)
+			if err != nil {
+				return fmt.Errorf("%q is not a whole number", item)
+			}
+			ns = append(ns, n)
+		}
+		*f = ns
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated environment variable.
+func splitList(s string) []string {
+	var out []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// validate checks c is a configuration the server can run with, reporting
+// every problem at once.
+func (c Config) validate() error {
+	var errs []error
+	fail := func(setting, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+
+	if n, err := strconv.Atoi(c.Port); err != nil || n < 1 || n > 65535 {
+		fail("port", "%q is not a TCP port", c.Port)
+	}
+	if c.DatabaseURL == "" {
+		fail("database_url", "is required")
+	}
+	if c.JWTSecret == "" {
+		fail("jwt_secret", "is required")
+	}
+	if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("public_url", "%q is not an http or https URL", c.PublicURL)
+	}
+	if (c.Google.ClientID == "") != (c.Google.ClientSecret == "") {
+		fail("google", "client_id and client_secret must be set together")
+	}
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		fail("cors.allowed_origins", "must list at least one origin")
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			fail("cors.allowed_origins", "%q is not an origin such as https://gotak.app", origin)
+		}
+	}
+
+	if len(c.Games.BoardSizes) == 0 {
+		fail("games.board_sizes", "must list at least one size")
+	}
+	for _, size := range c.Games.BoardSizes {
+		if size < 4 || size > 9 {
+			fail("games.board_sizes", "%d is not a board size from 4 to 9", size)
+		}
+	}
+	if !c.allowsBoardSize(c.Games.DefaultSize) {
+		fail("games.default_size", "%d is not one of games.board_sizes", c.Games.DefaultSize)
+	}
+
+	e := c.Engines
+	for setting, d := range map[string]time.Duration{
+		"engines.move_time": e.MoveTime, "engines.analysis_time": e.AnalysisTime, "engines.max_time": e.MaxTime,
+	} {
+		if d <= 0 {
+			fail(setting, "must be positive")
+		}
+	}
+	if e.MoveTime > e.MaxTime || e.AnalysisTime > e.MaxTime {
+		fail("engines.max_time", "%s is less than the default move or analysis time", e.MaxTime)
+	}
+	if e.AnalysisWorkers < 1 {
+		fail("engines.analysis_workers", "must be at least 1")
+	}
+	if e.BookVariety < 0 {
+		fail("engines.book_variety", "must not be negative")
+	}
+
+	rl := c.RateLimits
+	if rl.Store != "memory" && rl.Store != "database" {
+		fail("rate_limits.store", "%q is not memory or database", rl.Store)
+	}
+	if rl.TrustedProxies < 0 {
+		fail("rate_limits.trusted_proxies", "must not be negative")
+	}
+	for _, l := range []rateLimit{rl.API, rl.AI, rl.Analysis, rl.Auth} {
+		if l.Burst < 1 || l.Per < time.Second {
+			fail("rate_limits."+l.Name, "needs a burst of at least 1 per at least 1s")
+		}
+	}
+	return errors.Join(sortedErrors(errs)...)
+}
+
+// sortedErrors sorts errs by message, so a configuration's problems are
+// reported in the same order every time.
+func sortedErrors(errs []error) []error {
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errs
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestSettings runs t with the default settings plus a JWT secret,
+// restoring the previous settings after it. Changes a test makes to the
+// returned settings apply to routers it builds afterwards.
+func useTestSettings(t *testing.T) *Config {
+	t.Helper()
+	saved := settings
+	settings = defaultConfig()
+	settings.JWTSecret = "test-secret"
+	t.Cleanup(func() { settings = saved })
+	return &settings
+}
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gotak.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+port: "9000"
+database_url: sqlite:gotak.db
+jwt_secret: from-file
+public_url: https://tak.example.com
+cors:
+  allowed_origins: [https://tak.example.com]
+games:
+  board_sizes: [5, 6]
+  default_size: 6
+engines:
+  move_time: 5s
+  max_time: 20s
+rate_limits:
+  store: database
+  ai: {burst: 3, per: 1m}
+`)
+	env := map[string]string{
+		"AUTH_JWT_SECRET":      "from-env",
+		"CORS_ALLOWED_ORIGINS": "https://a.example.com, https://b.example.com",
+		"ANALYSIS_WORKERS":     "4",
+		"OPENING_BOOK_VARIETY": "0.5",
+		"TRUSTED_PROXIES":      "1",
+	}
+	c, err := loadConfig(path, func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if err := c.validate(); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	// The environment wins over the file, and the file over the defaults.
+	if c.Port != "9000" || c.DatabaseURL != "sqlite:gotak.db" || c.JWTSecret != "from-env" || c.PublicURL != "https://tak.example.com" {
+		t.Errorf("loaded %+v", c)
+	}
+	if !slices.Equal(c.CORS.AllowedOrigins, []string{"https://a.example.com", "https://b.example.com"}) {
+		t.Errorf("allowed origins = %q", c.CORS.AllowedOrigins)
+	}
+	if !c.allowsBoardSize(5) || c.allowsBoardSize(8) || c.Games.DefaultSize != 6 {
+		t.Errorf("games = %+v", c.Games)
+	}
+	want := EngineLimits{MoveTime: 5 * time.Second, AnalysisTime: defaultAnalyzeTimeLimit, MaxTime: 20 * time.Second, AnalysisWorkers: 4, BookVariety: 0.5}
+	if c.Engines != want {
+		t.Errorf("engines = %+v, want %+v", c.Engines, want)
+	}
+	rl := c.RateLimits
+	if rl.Store != "database" || rl.TrustedProxies != 1 || rl.AI != (rateLimit{Name: "ai", Burst: 3, Per: time.Minute}) || rl.API != apiLimit {
+		t.Errorf("rate limits = %+v", rl)
+	}
+
+	// Without a file or environment, the defaults are only missing the
+	// database and secret.
+	c, err = loadConfig("", func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("loadConfig with nothing set: %v", err)
+	}
+	if err := c.validate(); err == nil || err.Error() != "database_url: is required\njwt_secret: is required" {
+		t.Errorf("validate defaults = %v", err)
+	}
+
+	for name, body := range map[string]string{
+		"unknown setting": "prot: 80\n",
+		"bad duration":    "engines: {move_time: soon}\n",
+	} {
+		if _, err := loadConfig(writeConfig(t, body), func(string) string { return "" }); err == nil {
+			t.Errorf("loadConfig with a %s should fail", name)
+		}
+	}
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml"), func(string) string { return "" }); err == nil {
+		t.Error("loadConfig with a missing file should fail")
+	}
+	env = map[string]string{"ANALYSIS_WORKERS": "lots", "AI_MOVE_TIME": "10", "BOARD_SIZES": "5,six"}
+	_, err = loadConfig("", func(name string) string { return env[name] })
+	for _, name := range []string{"AI_MOVE_TIME", "ANALYSIS_WORKERS", "BOARD_SIZES"} {
+		if err == nil || !strings.Contains(err.Error(), name+":") {
+			t.Errorf("loadConfig with a bad %s = %v", name, err)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := func() Config {
+		c := defaultConfig()
+		c.DatabaseURL, c.JWTSecret = "memory:", "secret"
+		return c
+	}
+	if err := valid().validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	for setting, change := range map[string]func(*Config){
+		"port":                        func(c *Config) { c.Port = "http" },
+		"public_url":                  func(c *Config) { c.PublicURL = "gotak.app" },
+		"google":                      func(c *Config) { c.Google.ClientID = "id" },
+		"cors.allowed_origins":        func(c *Config) { c.CORS.AllowedOrigins = []string{"https://gotak.app/play"} },
+		"games.board_sizes":           func(c *Config) { c.Games.BoardSizes = []int{3, 4, 5, 6, 7, 8} },
+		"games.default_size":          func(c *Config) { c.Games.DefaultSize = 10 },
+		"engines.move_time":           func(c *Config) { c.Engines.MoveTime = 0 },
+		"engines.max_time":            func(c *Config) { c.Engines.MaxTime = time.Second },
+		"engines.analysis_workers":    func(c *Config) { c.Engines.AnalysisWorkers = 0 },
+		"engines.book_variety":        func(c *Config) { c.Engines.BookVariety = -1 },
+		"rate_limits.store":           func(c *Config) { c.RateLimits.Store = "redis" },
+		"rate_limits.trusted_proxies": func(c *Config) { c.RateLimits.TrustedProxies = -1 },
+		"rate_limits.auth":            func(c *Config) { c.RateLimits.Auth.Burst = 0 },
+	} {
+		c := valid()
+		change(&c)
+		if err := c.validate(); err == nil || !strings.Contains(err.Error(), setting+":") {
+			t.Errorf("validate with a bad %s = %v", setting, err)
+		}
+	}
+}
+
+func TestEngineTime(t *testing.T) {
+	c := defaultConfig()
+	c.Engines.MaxTime = 30 * time.Second
+	for _, tc := range []struct{ requested, want time.Duration }{
+		{0, 10 * time.Second},
+		{time.Second, time.Second},
+		{time.Hour, 30 * time.Second},
+	} {
+		if got := c.engineTime(tc.requested, 10*time.Second); got != tc.want {
+			t.Errorf("engineTime(%s) = %s, want %s", tc.requested, got, tc.want)
+		}
+	}
+}
+
+// TestSettingsApply checks handlers and the router use the settings in
+// force rather than built-in values.
+func TestSettingsApply(t *testing.T) {
+	s := useTestSettings(t)
+	s.Games.BoardSizes = []int{5, 6}
+	s.Games.DefaultSize = 5
+	s.CORS.AllowedOrigins = []string{"https://tak.example.com"}
+
+	for size, allowed := range map[string]bool{"": true, "5": true, "6": true, "8": false} {
+		req := CreateGameRequest{Size: size, Mode: "human"}
+		if fields := req.validate(); (len(fields) == 0) != allowed {
+			t.Errorf("size %q: validate = %v", size, fields)
+		}
+	}
+
+	store := setupTestStore(t)
+	router := buildRouter(routerOptions{IsDev: true, Store: store})
+	for origin, allowed := range map[string]bool{"https://tak.example.com": true, "https://evil.example.com": false} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/ai/engines", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin") == origin; got != allowed {
+			t.Errorf("origin %s allowed = %v, want %v", origin, got, allowed)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/icco/gotak/cmd/server/docs"
+)
+
+// The contract tests check the server against the OpenAPI document it
+// embeds and serves: every operation in the document is called through the
+// real router and its responses are checked against the declared status
+// codes, media types and schemas, and every route the router serves must
+// be in the document. A handler change that isn't reflected in the
+// swagger annotations (or docs not regenerated after one) fails here.
+
+type swaggerDoc struct {
+	Paths       map[string]map[string]swaggerOp `json:"paths"`
+	Definitions map[string]*swaggerSchema       `json:"definitions"`
+}
+
+type swaggerOp struct {
+	Produces  []string `json:"produces"`
+	Responses map[string]struct {
+		Schema *swaggerSchema `json:"schema"`
+	} `json:"responses"`
+}
+
+// swaggerSchema is the subset of Swagger 2.0 schema objects swag emits.
+type swaggerSchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 string                    `json:"type"`
+	Properties           map[string]*swaggerSchema `json:"properties"`
+	AdditionalProperties *swaggerSchema            `json:"additionalProperties"`
+	Items                *swaggerSchema            `json:"items"`
+	AllOf                []*swaggerSchema          `json:"allOf"`
+	Enum                 []any                     `json:"enum"`
+}
+
+func loadSwaggerDoc(t *testing.T) *swaggerDoc {
+	t.Helper()
+	var doc swaggerDoc
+	if err := json.Unmarshal(docs.SwaggerJSON(), &doc); err != nil {
+		t.Fatalf("parse embedded swagger.json: %v", err)
+	}
+	return &doc
+}
+
+// check reports where v doesn't match s. Swagger 2.0 can't mark a property
+// nullable, so null matches anything: it is how Go encodes nil pointers,
+// slices and maps.
+func (d *swaggerDoc) check(s *swaggerSchema, v any, at string) []string {
+	if s.Ref != "" {
+		def, ok := d.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown definition %s", at, s.Ref)}
+		}
+		return d.check(def, v, at)
+	}
+	var errs []string
+	for _, sub := range s.AllOf {
+		errs = append(errs, d.check(sub, v, at)...)
+	}
+	if v == nil {
+		return errs
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+		errs = append(errs, fmt.Sprintf("%s: %v is not one of %v", at, v, s.Enum))
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: want an object, got %T", at, v))
+		}
+		if s.Properties == nil && s.AdditionalProperties == nil {
+			return errs
+		}
+		for k, pv := range obj {
+			switch {
+			case s.Properties[k] != nil:
+				errs = append(errs, d.check(s.Properties[k], pv, at+"."+k)...)
+			case s.AdditionalProperties != nil:
+				errs = append(errs, d.check(s.AdditionalProperties, pv, at+"."+k)...)
+			default:
+				errs = append(errs, fmt.Sprintf("%s: undocumented property %q", at, k))
+			}
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return append(errs, fmt.Sprintf("%s: want an array, got %T", at, v))
+		}
+		for i, item := range arr {
+			if s.Items != nil {
+				errs = append(errs, d.check(s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want a string, got %T", at, v))
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			errs = append(errs, fmt.Sprintf("%s: want an integer, got %v", at, v))
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want a number, got %T", at, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want a boolean, got %T", at, v))
+		}
+	}
+	return errs
+}
+
+// contractClient calls the router and checks each response against the
+// operation it belongs to, recording which operations were exercised.
+type contractClient struct {
+	t       *testing.T
+	doc     *swaggerDoc
+	handler http.Handler
+	called  map[string]bool
+}
+
+// do calls method on route, an operation's path in the document with its
+// parameters filled in from args and an optional query string, and checks
+// the response has status want and matches the document. It returns the
+// decoded JSON body.
+func (c *contractClient) do(method, route, token string, body any, want int, args ...any) map[string]any {
+	c.t.Helper()
+	route, query, _ := strings.Cut(route, "?")
+	op := strings.ToLower(method) + " " + route
+	c.called[op] = true
+
+	path := route
+	for _, a := range args {
+		start, end := strings.Index(path, "{"), strings.Index(path, "}")
+		path = path[:start] + fmt.Sprint(a) + path[end+1:]
+	}
+	if query != "" {
+		path += "?" + query
+	}
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			c.t.Fatalf("%s: encode body: %v", op, err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reqBody)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, req)
+
+	if w.Code != want {
+		c.t.Fatalf("%s %s = %d, want %d: %s", method, path, w.Code, want, w.Body)
+	}
+	spec, ok := c.doc.Paths[route][strings.ToLower(method)]
+	if !ok {
+		c.t.Fatalf("%s is not in the OpenAPI document", op)
+	}
+	resp, ok := spec.Responses[strconv.Itoa(w.Code)]
+	if !ok {
+		c.t.Errorf("%s: status %d is not documented", op, w.Code)
+		return nil
+	}
+
+	ct := w.Header().Get("Content-Type")
+	if w.Code >= 400 {
+		if !strings.HasPrefix(ct, problemContentType) {
+			c.t.Errorf("%s: error Content-Type = %q, want %s", op, ct, problemContentType)
+		}
+	} else if !slices.ContainsFunc(spec.Produces, func(p string) bool { return strings.HasPrefix(ct, p) }) {
+		c.t.Errorf("%s: Content-Type = %q, document says %v", op, ct, spec.Produces)
+	}
+	if resp.Schema == nil || !strings.Contains(ct, "json") {
+		return nil
+	}
+
+	var got any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		c.t.Fatalf("%s: decode response: %v", op, err)
+	}
+	for _, e := range c.doc.check(resp.Schema, got, "body") {
+		c.t.Errorf("%s %d: %s", op, w.Code, e)
+	}
+	obj, _ := got.(map[string]any)
+	return obj
+}
+
+func TestAPIContract(t *testing.T) {
+	useTestSettings(t)
+	store, err := openStore("memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	c := &contractClient{
+		t:       t,
+		doc:     loadSwaggerDoc(t),
+		handler: buildRouter(routerOptions{IsDev: true, Store: store}),
+		called:  map[string]bool{},
+	}
+	const none = ""
+
+	c.do("GET", "/", none, nil, http.StatusOK)
+	c.do("GET", "/healthz", none, nil, http.StatusOK)
+	c.do("GET", "/v1/ai/engines", none, nil, http.StatusOK)
+
+	// Accounts.
+	alice := RegisterRequest{Email: "alice@example.com", Password: "correct horse", Name: "Alice"}
+	c.do("POST", "/v1/auth/register", none, alice, http.StatusCreated)
+	c.do("POST", "/v1/auth/register", none, alice, http.StatusBadRequest)
+	c.do("POST", "/v1/auth/register", none, RegisterRequest{Email: "bob@example.com"}, http.StatusBadRequest)
+	c.do("POST", "/v1/auth/register", none, RegisterRequest{Email: "bob@example.com", Password: "battery staple", Name: "Bob"}, http.StatusCreated)
+	c.do("POST", "/v1/auth/login", none, LoginRequest{Email: alice.Email, Password: "wrong password"}, http.StatusUnauthorized)
+	login := c.do("POST", "/v1/auth/login", none, LoginRequest{Email: alice.Email, Password: alice.Password}, http.StatusOK)
+	refreshed := c.do("POST", "/v1/auth/refresh", none, RefreshRequest{RefreshToken: login["refresh_token"].(string)}, http.StatusOK)
+	token := refreshed["token"].(string)
+	bob := c.do("POST", "/v1/auth/login", none, LoginRequest{Email: "bob@example.com", Password: "battery staple"}, http.StatusOK)["token"].(string)
+
+	c.do("GET", "/v1/auth/profile", none, nil, http.StatusUnauthorized)
+	c.do("GET", "/v1/auth/profile", token, nil, http.StatusOK)
+	// Only an admin can mark an account as a bot.
+	if profile := c.do("PUT", "/v1/auth/profile", token, map[string]any{"name": "Alice L.", "bot": true}, http.StatusOK); profile["bot"] != false {
+		t.Errorf("profile update set bot: %v", profile["bot"])
+	}
+
+	created := c.do("POST", "/v1/auth/tokens", token, CreateAPITokenRequest{Name: "bot", Scopes: []string{"read"}}, http.StatusCreated)
+	c.do("GET", "/v1/auth/tokens", token, nil, http.StatusOK)
+	c.do("DELETE", "/v1/auth/tokens/{id}", token, nil, http.StatusOK, created["id"])
+	c.do("DELETE", "/v1/auth/tokens/{id}", token, nil, http.StatusNotFound, created["id"])
+
+	c.do("POST", "/v1/auth/reset-password", none, ResetPasswordRequest{Email: alice.Email}, http.StatusOK)
+	c.do("POST", "/v1/auth/confirm-reset", none, ConfirmResetRequest{Token: "bogus", NewPassword: "new password"}, http.StatusBadRequest)
+
+	// A game between two people.
+	c.do("POST", "/v1/game/new", none, CreateGameRequest{Size: "5"}, http.StatusUnauthorized)
+	c.do("GET", "/v1/game/new", token, nil, http.StatusCreated)
+	slug := c.do("POST", "/v1/game/new", token, CreateGameRequest{Size: "5"}, http.StatusCreated)["Slug"]
+	c.do("POST", "/v1/game/{slug}/join", bob, nil, http.StatusOK, slug)
+	c.do("POST", "/v1/game/{slug}/move", token, MoveRequest{Player: 1, Text: "a1"}, http.StatusOK, slug)
+	c.do("POST", "/v1/game/{slug}/move", token, MoveRequest{Player: 1, Text: "b2"}, http.StatusBadRequest, slug)
+	c.do("POST", "/v1/game/{slug}/move", bob, MoveRequest{Player: 2, Text: "e5"}, http.StatusOK, slug)
+	c.do("GET", "/v1/game/{slug}", none, nil, http.StatusOK, slug)
+	c.do("GET", "/v1/game/{slug}", none, nil, http.StatusNotFound, "nosuchgame")
+	c.do("GET", "/v1/game/{slug}/{turn}", none, nil, http.StatusOK, slug, 1)
+	c.do("GET", "/v1/game/{slug}/{turn}", none, nil, http.StatusBadRequest, slug, "first")
+	c.do("GET", "/v1/game/{slug}/ptn", none, nil, http.StatusOK, slug)
+	c.do("GET", "/v1/game/{slug}/replay", none, nil, http.StatusOK, slug)
+	c.do("GET", "/v1/game/{slug}/position/{turn}", none, nil, http.StatusOK, slug, 1)
+	c.do("GET", "/v1/game/{slug}/position/{turn}/analysis?nodes=200", none, nil, http.StatusOK, slug, 1)
+
+	// A game against the AI.
+	aiGame := c.do("POST", "/v1/game/new", token, CreateGameRequest{Size: "5", Mode: "ai"}, http.StatusCreated)["Slug"]
+	c.do("POST", "/v1/game/{slug}/ai-move", token, AIRequest{Nodes: 200}, http.StatusBadRequest, aiGame)
+	c.do("POST", "/v1/game/{slug}/move", token, MoveRequest{Player: 1, Text: "a1"}, http.StatusOK, aiGame)
+	c.do("POST", "/v1/game/{slug}/ai-move", bob, AIRequest{Nodes: 200}, http.StatusForbidden, aiGame)
+	c.do("POST", "/v1/game/{slug}/ai-move", token, AIRequest{Nodes: 200}, http.StatusOK, aiGame)
+
+	// Analysis.
+	job := c.do("POST", "/v1/analyze/game/{slug}", none, AnalyzeRequest{Nodes: 200}, http.StatusAccepted, slug)
+	c.do("GET", "/v1/analyze/jobs/{id}", none, nil, http.StatusOK, job["id"])
+	c.do("DELETE", "/v1/analyze/jobs/{id}", none, nil, http.StatusOK, job["id"])
+	c.do("GET", "/v1/analyze/jobs/{id}", none, nil, http.StatusNotFound, "nosuchjob")
+	c.do("POST", "/v1/analyze/position", none, PositionAnalyzeRequest{AnalyzeRequest: AnalyzeRequest{Nodes: 200}, Size: 5, Moves: []string{"a1", "e5"}}, http.StatusOK)
+	c.do("GET", "/v1/analyze/openings?prefix=a1", none, nil, http.StatusOK)
+	c.do("GET", "/v1/leaderboard", none, nil, http.StatusOK)
+
+	// No puzzles have been mined from this database.
+	c.do("GET", "/v1/puzzles/next", token, nil, http.StatusNotFound)
+	c.do("POST", "/v1/puzzles/{id}/attempt", token, PuzzleAttemptRequest{Moves: []string{"a1"}}, http.StatusNotFound, 1)
+
+	// Moderation, once Alice is made an admin.
+	c.do("GET", "/v1/admin/status", token, nil, http.StatusForbidden)
+	if _, err := setRole(storeDB(store), nil, alice.Email, roleAdmin); err != nil {
+		t.Fatalf("setRole: %v", err)
+	}
+	aliceID := login["user"].(map[string]any)["id"]
+	bobID := c.do("GET", "/v1/auth/profile", bob, nil, http.StatusOK)["id"]
+	c.do("GET", "/v1/admin/status", token, nil, http.StatusOK)
+	c.do("GET", "/v1/admin/users?query=example.com", token, nil, http.StatusOK)
+	c.do("GET", "/v1/admin/users?limit=0", token, nil, http.StatusBadRequest)
+	c.do("POST", "/v1/admin/users/{id}/ban", token, BanRequest{}, http.StatusBadRequest, bobID)
+	c.do("POST", "/v1/admin/users/{id}/ban", token, BanRequest{Reason: "spam"}, http.StatusForbidden, aliceID)
+	c.do("POST", "/v1/admin/users/{id}/ban", token, BanRequest{Reason: "spam"}, http.StatusNotFound, 999)
+	c.do("POST", "/v1/admin/users/{id}/ban", token, BanRequest{Reason: "spam"}, http.StatusOK, bobID)
+	c.do("POST", "/v1/admin/users/{id}/ban", token, BanRequest{Reason: "spam"}, http.StatusConflict, bobID)
+	c.do("POST", "/v1/auth/login", none, LoginRequest{Email: "bob@example.com", Password: "battery staple"}, http.StatusForbidden)
+	c.do("POST", "/v1/admin/users/{id}/unban", token, nil, http.StatusOK, bobID)
+	isBot := true
+	c.do("PUT", "/v1/admin/users/{id}/bot", token, SetBotRequest{}, http.StatusBadRequest, bobID)
+	c.do("PUT", "/v1/admin/users/{id}/bot", token, SetBotRequest{Bot: &isBot}, http.StatusNotFound, 999)
+	c.do("PUT", "/v1/admin/users/{id}/bot", token, SetBotRequest{Bot: &isBot}, http.StatusOK, bobID)
+	c.do("POST", "/v1/admin/users/{id}/unban", token, nil, http.StatusConflict, bobID)
+	bob = c.do("POST", "/v1/auth/login", none, LoginRequest{Email: "bob@example.com", Password: "battery staple"}, http.StatusOK)["token"].(string)
+	draw := 0
+	c.do("POST", "/v1/admin/games/{slug}/adjudicate", token, AdjudicateRequest{Reason: "abandoned"}, http.StatusBadRequest, slug)
+	c.do("POST", "/v1/admin/games/{slug}/adjudicate", token, AdjudicateRequest{Winner: &draw, Reason: "abandoned"}, http.StatusNotFound, "nosuchgame")
+	c.do("POST", "/v1/admin/games/{slug}/adjudicate", token, AdjudicateRequest{Winner: &draw, Reason: "abandoned"}, http.StatusOK, slug)
+	c.do("DELETE", "/v1/admin/analysis-cache?game="+fmt.Sprint(slug), token, nil, http.StatusOK)
+	c.do("DELETE", "/v1/admin/analysis-cache?game=nosuchgame", token, nil, http.StatusNotFound)
+	c.do("DELETE", "/v1/admin/games/{slug}?reason=test", token, nil, http.StatusOK, aiGame)
+	c.do("DELETE", "/v1/admin/games/{slug}", token, nil, http.StatusNotFound, aiGame)
+	c.do("DELETE", "/v1/admin/analysis-cache", token, nil, http.StatusOK)
+	c.do("GET", "/v1/admin/audit?action=ban_user", token, nil, http.StatusOK)
+	c.do("GET", "/v1/admin/audit?offset=-1", token, nil, http.StatusBadRequest)
+
+	c.do("POST", "/v1/auth/logout-all", token, nil, http.StatusOK)
+	c.do("POST", "/v1/auth/logout", bob, nil, http.StatusOK)
+
+	// Every documented operation was called above.
+	for path, ops := range c.doc.Paths {
+		for method := range ops {
+			if op := method + " " + path; !c.called[op] {
+				t.Errorf("%s is documented but not covered by the contract test", op)
+			}
+		}
+	}
+}
+
+// TestAPIRoutesDocumented fails when the router serves an API route the
+// OpenAPI document doesn't describe.
+func TestAPIRoutesDocumented(t *testing.T) {
+	useTestSettings(t)
+	doc := loadSwaggerDoc(t)
+
+	r := chi.NewRouter()
+	apiRoutes(r, AuthRoutes(nil), nil)
+	r.Mount("/admin", adminRoutes(nil))
+	var missing []string
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		// Social login is go-pkgz/auth's own set of routes.
+		if route == "/auth/*" {
+			return nil
+		}
+		route = apiVersionPrefix + strings.TrimSuffix(route, "/")
+		if _, ok := doc.Paths[route][strings.ToLower(method)]; !ok {
+			missing = append(missing, method+" "+route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk routes: %v", err)
+	}
+	sort.Strings(missing)
+	for _, m := range missing {
+		t.Errorf("%s is served but not in the OpenAPI document", m)
+	}
+}
+
+func TestDeprecatedAliases(t *testing.T) {
+	useTestSettings(t)
+	store, err := openStore("memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	router := buildRouter(routerOptions{IsDev: true, Store: store})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/ai/engines")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /v1/ai/engines = %d", w.Code)
+	}
+	if got, want := w.Header().Get("Deprecation"), fmt.Sprintf("@%d", unversionedDeprecatedAt.Unix()); got != want {
+		t.Errorf("Deprecation = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Link"); got != `</v1/ai/engines>; rel="successor-version"` {
+		t.Errorf("Link = %q", got)
+	}
+	if v1 := get("/v1/ai/engines"); v1.Code != http.StatusOK || v1.Header().Get("Deprecation") != "" || v1.Body.String() != w.Body.String() {
+		t.Errorf("GET /v1/ai/engines = %d, Deprecation %q", v1.Code, v1.Header().Get("Deprecation"))
+	}
+
+	// Redirects stay on the version that was asked for.
+	tokens, err := issueTokens(store, createTestUser(t, storeDB(store)), "test")
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	for path, want := range map[string]string{"/v1/game/new": "/v1/game/", "/game/new": "/game/"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.Token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if loc := w.Header().Get("Location"); w.Code != http.StatusTemporaryRedirect || !strings.HasPrefix(loc, want) {
+			t.Errorf("GET %s = %d to %q, want a redirect to %s...", path, w.Code, loc, want)
+		}
+	}
+
+	// Operational endpoints aren't versioned.
+	if w := get("/healthz"); w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+		t.Errorf("GET /healthz = %d, Deprecation %q", w.Code, w.Header().Get("Deprecation"))
+	}
+}
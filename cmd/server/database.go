@@ -2,50 +2,20 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 
 	"github.com/ifo/sanic"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"moul.io/zapgorm2"
 
 	"github.com/icco/gotak"
 )
 
-func getDB() (*gorm.DB, error) {
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		return nil, fmt.Errorf("DATABASE_URL is empty")
-	}
-
-	// Configure GORM to use zapgorm2 logger
-	config := &gorm.Config{
-		Logger: zapgorm2.New(log.Desugar()),
-	}
-
-	db, err := gorm.Open(postgres.Open(dbURL), config)
-	if err != nil {
-		return nil, err
-	}
-
-	// Auto-migrate the schema
-	err = AutoMigrate(db)
-	if err != nil {
-		return nil, fmt.Errorf("failed to run auto-migration: %w", err)
-	}
-
-	return db, nil
-}
-
 // slugWorker is shared across createGame calls so back-to-back creations within
 // the same second use distinct sequence numbers rather than colliding.
 var slugWorker = sanic.NewWorker7()
 
 func createGame(db *gorm.DB, size int, userID int64, mode string) (string, error) {
-	if size < 4 {
-		size = 6
-	}
+	size = gameBoardSize(size)
 
 	if userID == 0 {
 		return "", fmt.Errorf("user authentication required")
@@ -64,10 +34,18 @@ func createGame(db *gorm.DB, size int, userID int64, mode string) (string, error
 		status = "active" // AI games are ready to play immediately
 	}
 
+	board := &gotak.Board{Size: int64(size)}
+	if err := board.Init(); err != nil {
+		return "", err
+	}
+	position := positionTPS(board, 0)
+
 	game := Game{
 		Slug:          slug,
 		WhitePlayerID: &userID, // Creator becomes white player
 		Status:        status,
+		Position:      position,
+		PositionHash:  positionHash(position),
 	}
 
 	if err := db.Create(&game).Error; err != nil {
@@ -81,19 +59,28 @@ func createGame(db *gorm.DB, size int, userID int64, mode string) (string, error
 	return slug, updateTag(db, slug, "Mode", normalizedMode)
 }
 
+// gameBoardSize is the size createGame actually uses for a requested size.
+func gameBoardSize(size int) int {
+	if size < 4 {
+		return 6
+	}
+	return size
+}
+
+// updateTag sets a game's tag, replacing any value it already has.
 func updateTag(db *gorm.DB, slug, key, value string) error {
 	var game Game
 	if err := db.Where("slug = ?", slug).First(&game).Error; err != nil {
 		return err
 	}
 
-	tag := Tag{
-		GameID: game.ID,
-		Key:    key,
-		Value:  value,
-	}
-
-	return db.Create(&tag).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Tag{}).Where("game_id = ? AND key = ?", game.ID, key).Update("value", value)
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error
+		}
+		return tx.Create(&Tag{GameID: game.ID, Key: key, Value: value}).Error
+	})
 }
 
 func insertMove(db *gorm.DB, gameID int64, player int, text string, turnNumber int64) error {
@@ -116,45 +103,54 @@ func getGameID(db *gorm.DB, slug string) (int64, error) {
 }
 
 func getGame(db *gorm.DB, slug string) (*gotak.Game, error) {
-	id, err := getGameID(db, slug)
+	game, row, err := loadGameRecord(db, slug)
 	if err != nil {
-		return nil, err
+		return game, err
+	}
+
+	if err := loadBoard(db, row, game); err != nil {
+		return game, err
+	}
+
+	return game, nil
+}
+
+// loadGameRecord loads slug's games row and the game's turns and tags,
+// leaving its board empty.
+func loadGameRecord(db *gorm.DB, slug string) (*gotak.Game, *Game, error) {
+	var row Game
+	if err := db.Where("slug = ?", slug).First(&row).Error; err != nil {
+		return nil, nil, err
 	}
 
 	// Get Size
 	var tag Tag
-	if err := db.Where("game_id = ? AND key = ?", id, "Size").First(&tag).Error; err != nil {
-		return nil, err
+	if err := db.Where("game_id = ? AND key = ?", row.ID, "Size").First(&tag).Error; err != nil {
+		return nil, nil, err
 	}
 
 	size, err := strconv.ParseInt(tag.Value, 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Init game
-	game, err := gotak.NewGame(size, id, slug)
+	game, err := gotak.NewGame(size, row.ID, slug)
 	if err != nil {
-		return game, err
+		return game, nil, err
 	}
 
 	err = getTurns(db, game)
 	if err != nil {
-		return game, err
+		return game, nil, err
 	}
 
 	err = getMeta(db, game)
 	if err != nil {
-		return game, err
+		return game, nil, err
 	}
 
-	// Replay moves to update board state
-	err = replayMoves(game)
-	if err != nil {
-		return game, err
-	}
-
-	return game, nil
+	return game, &row, nil
 }
 
 func getTurns(db *gorm.DB, game *gotak.Game) error {
@@ -211,30 +207,42 @@ func replayMoves(game *gotak.Game) error {
 		return err
 	}
 
+	return applyMoves(game, 0, nil)
+}
+
+// applyMoves plays game's moves after the first from half-moves onto its
+// board, calling each, if set, with the number of half-moves played after
+// every one.
+func applyMoves(game *gotak.Game, from int, each func(ply int) error) error {
+	ply := 0
+	play := func(turn *gotak.Turn, mv *gotak.Move, player int, which string) error {
+		if mv == nil {
+			return nil
+		}
+		ply++
+		if ply <= from {
+			return nil
+		}
+		// On the first turn each player places the other's stone.
+		if turn.Number == 1 {
+			player = opponent(player)
+		}
+		if err := game.Board.DoMove(mv, player); err != nil {
+			return fmt.Errorf("error replaying turn %d %s move: %w", turn.Number, which, err)
+		}
+		if each != nil {
+			return each(ply)
+		}
+		return nil
+	}
+
 	// Replay all moves in order
 	for _, turn := range game.Turns {
-		if turn.First != nil {
-			if turn.Number == 1 {
-				// First turn: white places black stone
-				err = game.Board.DoMove(turn.First, gotak.PlayerBlack)
-			} else {
-				err = game.Board.DoMove(turn.First, gotak.PlayerWhite)
-			}
-			if err != nil {
-				return fmt.Errorf("error replaying turn %d first move: %w", turn.Number, err)
-			}
+		if err := play(turn, turn.First, gotak.PlayerWhite, "first"); err != nil {
+			return err
 		}
-
-		if turn.Second != nil {
-			if turn.Number == 1 {
-				// First turn: black places white stone
-				err = game.Board.DoMove(turn.Second, gotak.PlayerWhite)
-			} else {
-				err = game.Board.DoMove(turn.Second, gotak.PlayerBlack)
-			}
-			if err != nil {
-				return fmt.Errorf("error replaying turn %d second move: %w", turn.Number, err)
-			}
+		if err := play(turn, turn.Second, gotak.PlayerBlack, "second"); err != nil {
+			return err
 		}
 	}
 
@@ -243,9 +251,12 @@ func replayMoves(game *gotak.Game) error {
 
 // updateGameStatus marks the game as finished and records the winner.
 func updateGameStatus(db *gorm.DB, slug string, winner int) error {
-	result := db.Model(&Game{}).Where("slug = ?", slug).Updates(Game{
-		Status: "finished",
-		Winner: winner,
+	// Bump the version too, so a move in flight when the game ends (an AI
+	// search, say) is rejected.
+	result := db.Model(&Game{}).Where("slug = ?", slug).Updates(map[string]any{
+		"status":  "finished",
+		"winner":  winner,
+		"version": gorm.Expr("version + 1"),
 	})
 	if result.Error != nil {
 		return result.Error
@@ -318,6 +329,18 @@ func joinGame(db *gorm.DB, slug string, userID int64) error {
 	return nil
 }
 
+// playerOf is the side userID plays in g, or gotak.PlayerNone if they
+// aren't playing.
+func (g *Game) playerOf(userID int64) int {
+	switch {
+	case g.WhitePlayerID != nil && *g.WhitePlayerID == userID:
+		return gotak.PlayerWhite
+	case g.BlackPlayerID != nil && *g.BlackPlayerID == userID:
+		return gotak.PlayerBlack
+	}
+	return gotak.PlayerNone
+}
+
 // getPlayerNumber returns the player number (1 for white, 2 for black) for a user in a game
 func getPlayerNumber(db *gorm.DB, slug string, userID int64) (int, error) {
 	var game Game
@@ -18,15 +18,24 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
 
-	// Run auto-migration
-	err = AutoMigrate(db)
-	if err != nil {
+	if _, err := migrateUp(db); err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	return db
 }
 
+// setupTestStore is setupTestDB behind the Store interface.
+func setupTestStore(t *testing.T) Store {
+	return &gormStore{db: setupTestDB(t)}
+}
+
+// storeDB is the database behind a gorm store, for tests that check rows
+// directly.
+func storeDB(s Store) *gorm.DB {
+	return s.(*gormStore).db
+}
+
 func createTestUser(t *testing.T, db *gorm.DB) *User {
 	user := &User{
 		Provider:   "local",
@@ -415,39 +424,6 @@ func TestGameWorkflow(t *testing.T) {
 	}
 }
 
-func TestAutoMigrate(t *testing.T) {
-	// Test that AutoMigrate works correctly
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
-	})
-	if err != nil {
-		t.Fatalf("Failed to connect to test database: %v", err)
-	}
-
-	err = AutoMigrate(db)
-	if err != nil {
-		t.Fatalf("AutoMigrate failed: %v", err)
-	}
-
-	// Verify tables exist by trying to query them
-	var count int64
-
-	err = db.Model(&Game{}).Count(&count).Error
-	if err != nil {
-		t.Errorf("Games table not created properly: %v", err)
-	}
-
-	err = db.Model(&Tag{}).Count(&count).Error
-	if err != nil {
-		t.Errorf("Tags table not created properly: %v", err)
-	}
-
-	err = db.Model(&Move{}).Count(&count).Error
-	if err != nil {
-		t.Errorf("Moves table not created properly: %v", err)
-	}
-}
-
 func TestGetGameWithNoMoves(t *testing.T) {
 	db := setupTestDB(t)
 
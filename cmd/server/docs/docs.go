@@ -45,9 +45,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/analyze/game/{slug}": {
-            "post": {
-                "description": "Walks the game move-by-move, asking the AI engine what it\nwould play at each position, and records whether the player's\nmove matches. Useful as a rough \"blunder detector\".",
+        "/healthz": {
+            "get": {
+                "description": "Returns service health status",
                 "consumes": [
                     "application/json"
                 ],
@@ -55,73 +55,109 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "analysis"
+                    "health"
                 ],
-                "summary": "Analyze a game move-by-move",
+                "summary": "Health check",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/admin/analysis-cache": {
+            "delete": {
+                "description": "Deletes cached analyses so they are searched again: one\ngame's, or every game and position analysis when no game\nis given. Admin only.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Purge cached analyses",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Game slug identifier",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Engine config (optional)",
-                        "name": "request",
-                        "in": "body",
-                        "schema": {
-                            "$ref": "#/definitions/main.AnalyzeRequest"
-                        }
+                        "description": "Slug of the game whose analyses to purge",
+                        "name": "game",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.AnalyzeResponse"
+                            "$ref": "#/definitions/main.PurgeAnalysisResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/analyze/openings": {
+        "/v1/admin/audit": {
             "get": {
-                "description": "Given a prefix of moves (in PTN order — White on turn 1\nfirst, Black second, then alternating), returns the count\nof stored games matching the prefix and the frequency of\nmoves played in the next half-turn. Empty prefix lists\nfirst-move distribution across all games.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Lists admin actions, newest first, optionally only one\naction: ban_user, unban_user, set_bot, grant_admin,\nrevoke_admin, adjudicate_game, delete_game or\npurge_analysis_cache. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "analysis"
+                    "admin"
                 ],
-                "summary": "Look up opening continuations",
+                "summary": "Audit log",
                 "parameters": [
                     {
                         "type": "string",
-                        "example": "a1,e5",
-                        "description": "Comma-separated PTN moves",
-                        "name": "prefix",
+                        "description": "Only this action",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum entries (default 50, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Entries to skip",
+                        "name": "offset",
                         "in": "query"
                     }
                 ],
@@ -129,46 +165,70 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.OpeningsResponse"
+                            "$ref": "#/definitions/main.AuditLogResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/auth/confirm-reset": {
-            "post": {
-                "description": "Reset password with token",
-                "consumes": [
-                    "application/json"
-                ],
+        "/v1/admin/games/{slug}": {
+            "delete": {
+                "description": "Deletes a game with its moves, tags and analyses, canceling\nanalysis jobs for it. Puzzles taken from the game are kept.\nAdmin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Confirm password reset",
+                "summary": "Delete a game",
                 "parameters": [
                     {
-                        "description": "Confirm reset request",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/main.ConfirmResetRequest"
-                        }
+                        "type": "string",
+                        "description": "Game slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Why the game is deleted, for the audit log",
+                        "name": "reason",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -178,30 +238,47 @@ const docTemplate = `{
                             "$ref": "#/definitions/main.MessageResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/auth/login": {
+        "/v1/admin/games/{slug}/adjudicate": {
             "post": {
-                "description": "Login with email and password",
+                "description": "Ends a game with the given result, whether or not it is\nover, for abandoned or disputed games. Winner is 1 for\nWhite, 2 for Black, or 0 for a draw. Admin only.",
                 "consumes": [
                     "application/json"
                 ],
@@ -209,17 +286,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Login user",
+                "summary": "Adjudicate a game",
                 "parameters": [
                     {
-                        "description": "User login data",
-                        "name": "user",
+                        "type": "string",
+                        "description": "Game slug",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Result and why",
+                        "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.LoginRequest"
+                            "$ref": "#/definitions/main.AdjudicateRequest"
                         }
                     }
                 ],
@@ -227,151 +311,186 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.AuthResponse"
+                            "$ref": "#/definitions/main.GameStateResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
-                    }
-                }
-            }
-        },
-        "/auth/logout": {
-            "post": {
-                "description": "Logout current user (client should discard token)",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "auth"
-                ],
-                "summary": "Logout user",
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/main.MessageResponse"
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
-            }
-        },
-        "/auth/profile": {
-            "get": {
+                },
                 "security": [
                     {
                         "BearerAuth": []
                     }
-                ],
-                "description": "Get current user profile information",
-                "consumes": [
-                    "application/json"
-                ],
+                ]
+            }
+        },
+        "/v1/admin/status": {
+            "get": {
+                "description": "Counts users, games and analysis jobs by status, and the\ncached analyses. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Get user profile",
+                "summary": "Server status",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.User"
+                            "$ref": "#/definitions/main.AdminStatusResponse"
                         }
                     },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
-            },
-            "put": {
+                },
                 "security": [
                     {
                         "BearerAuth": []
                     }
-                ],
-                "description": "Update current user profile information",
-                "consumes": [
-                    "application/json"
-                ],
+                ]
+            }
+        },
+        "/v1/admin/users": {
+            "get": {
+                "description": "Lists users, newest first, optionally only those whose email\nor name contains query, or only banned ones. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Update user profile",
+                "summary": "List users",
                 "parameters": [
                     {
-                        "description": "Profile update data",
-                        "name": "profile",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/main.UpdateProfileRequest"
-                        }
+                        "type": "string",
+                        "description": "Text to find in the email or name",
+                        "name": "query",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only banned users",
+                        "name": "banned",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum users (default 50, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Users to skip",
+                        "name": "offset",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.User"
+                            "$ref": "#/definitions/main.AdminUsersResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "401": {
                         "description": "Unauthorized",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/auth/register": {
+        "/v1/admin/users/{id}/ban": {
             "post": {
-                "description": "Register with email and password",
+                "description": "Bans a user: they are signed out everywhere, their API\ntokens are revoked and they can't sign in again until\nunbanned. Admins can't be banned. Admin only.",
                 "consumes": [
                     "application/json"
                 ],
@@ -379,45 +498,87 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Register a new user",
+                "summary": "Ban a user",
                 "parameters": [
                     {
-                        "description": "User registration data",
-                        "name": "user",
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Why the user is banned",
+                        "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.RegisterRequest"
+                            "$ref": "#/definitions/main.BanRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.MessageResponse"
+                            "$ref": "#/definitions/main.User"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/auth/reset-password": {
-            "post": {
-                "description": "Send password reset token for email",
+        "/v1/admin/users/{id}/bot": {
+            "put": {
+                "description": "Marks an account as a bot, or as a person. Bots are\nlabelled in games and left off the leaderboard unless it is\nasked to include them. Admin only.",
                 "consumes": [
                     "application/json"
                 ],
@@ -425,17 +586,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth"
+                    "admin"
                 ],
-                "summary": "Request password reset",
+                "summary": "Mark a user as a bot",
                 "parameters": [
                     {
-                        "description": "Reset password request",
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Whether the user is a bot",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/main.ResetPasswordRequest"
+                            "$ref": "#/definitions/main.SetBotRequest"
                         }
                     }
                 ],
@@ -443,171 +611,158 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.MessageResponse"
+                            "$ref": "#/definitions/main.User"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/game/new": {
-            "get": {
-                "description": "Creates a new Tak game with the specified board size",
-                "consumes": [
-                    "application/json"
-                ],
+        "/v1/admin/users/{id}/unban": {
+            "post": {
+                "description": "Lifts a ban. The user signs in again to get new sessions and\ntokens. Admin only.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "game"
+                    "admin"
                 ],
-                "summary": "Create a new game",
+                "summary": "Unban a user",
                 "parameters": [
                     {
-                        "description": "Game configuration",
-                        "name": "game",
-                        "in": "body",
-                        "schema": {
-                            "$ref": "#/definitions/main.CreateGameRequest"
-                        }
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {
-                            "$ref": "#/definitions/main.GameStateResponse"
-                        }
-                    },
-                    "307": {
-                        "description": "Redirect to game URL",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.User"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
-                    }
-                }
-            },
-            "post": {
-                "description": "Creates a new Tak game with the specified board size",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "game"
-                ],
-                "summary": "Create a new game",
-                "parameters": [
-                    {
-                        "description": "Game configuration",
-                        "name": "game",
-                        "in": "body",
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
-                            "$ref": "#/definitions/main.CreateGameRequest"
+                            "$ref": "#/definitions/main.Problem"
                         }
-                    }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "Created",
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/main.GameStateResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
-                    "307": {
-                        "description": "Redirect to game URL",
+                    "409": {
+                        "description": "Conflict",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "429": {
+                        "description": "Too Many Requests",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/game/{slug}": {
+        "/v1/ai/engines": {
             "get": {
-                "description": "Returns the current state of a game",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Lists the AI engines that can be picked for AI games and\nanalysis, with the board sizes they play and whether they\nsupport komi and analysis.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "game"
-                ],
-                "summary": "Get game state",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Game slug identifier",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
-                    }
+                    "ai"
                 ],
+                "summary": "List AI engines",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.GameStateResponse"
+                            "$ref": "#/definitions/main.EnginesResponse"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "429": {
+                        "description": "Too Many Requests",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
                 }
             }
         },
-        "/game/{slug}/join": {
+        "/v1/analyze/game/{slug}": {
             "post": {
-                "description": "Join a game that is waiting for a second player (as black player)",
+                "description": "Queues an analysis job that walks the game move-by-move,\nasking the AI engine what it would play at each position and\nhow it scores the positions before and after the player's\nmove. Each move gets a loss (drop in win probability) and a\nclassification from best to blunder. Poll the returned job at\nGET /analyze/jobs/{id}. A job that is already queued for the\nsame game and settings is returned instead of a new one, and\ncached results come back as a finished job.",
                 "consumes": [
                     "application/json"
                 ],
@@ -615,9 +770,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "game"
+                    "analysis"
                 ],
-                "summary": "Join a waiting game",
+                "summary": "Analyze a game move-by-move",
                 "parameters": [
                     {
                         "type": "string",
@@ -625,114 +780,116 @@ const docTemplate = `{
                         "name": "slug",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Engine config (optional)",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.AnalyzeRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Finished job (cached result)",
                         "schema": {
-                            "$ref": "#/definitions/main.MessageResponse"
+                            "$ref": "#/definitions/main.AnalysisJobResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Queued or running job",
+                        "schema": {
+                            "$ref": "#/definitions/main.AnalysisJobResponse"
                         }
                     },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
-                    "403": {
-                        "description": "Forbidden",
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
                 }
             }
         },
-        "/game/{slug}/move": {
-            "post": {
-                "description": "Submit a move for a specific game",
-                "consumes": [
-                    "application/json"
-                ],
+        "/v1/analyze/jobs/{id}": {
+            "get": {
+                "description": "Reports a game analysis job's status and the moves analysed\nso far. Finished jobs carry the full analysis.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "game"
+                    "analysis"
                 ],
-                "summary": "Make a move in a game",
+                "summary": "Get an analysis job",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Game slug identifier",
-                        "name": "slug",
+                        "description": "Job id",
+                        "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Move details",
-                        "name": "move",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/main.MoveRequest"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.GameStateResponse"
+                            "$ref": "#/definitions/main.AnalysisJobResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
                 }
-            }
-        },
-        "/game/{slug}/position/{turn}": {
-            "get": {
-                "description": "Replays the game forward until it has applied every move\nof every turn with Number \u003c= turn, then returns the\nresulting board. turn=0 yields the starting (empty)\nposition; turn beyond the final turn yields the final\nposition.",
-                "consumes": [
-                    "application/json"
-                ],
+            },
+            "delete": {
+                "description": "Cancels a queued or running analysis job. Jobs started by a\nsigned-in user can only be canceled by that user.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "game"
+                    "analysis"
                 ],
-                "summary": "Get board state after N complete turns",
+                "summary": "Cancel an analysis job",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Game slug identifier",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Turn number (0 = starting position)",
-                        "name": "turn",
+                        "description": "Job id",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -741,74 +898,95 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.PositionResponse"
+                            "$ref": "#/definitions/main.AnalysisJobResponse"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "404": {
                         "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
                 }
             }
         },
-        "/game/{slug}/ptn": {
+        "/v1/analyze/openings": {
             "get": {
-                "description": "Serialises the game as Portable Tak Notation text.",
+                "description": "Given a prefix of moves (in PTN order — White on turn 1\nfirst, Black second, then alternating), returns the count\nof stored games matching the prefix and the frequency of\nmoves played in the next half-turn. Empty prefix lists\nfirst-move distribution across all games.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "tags": [
-                    "game"
+                    "analysis"
                 ],
-                "summary": "Download game as PTN",
+                "summary": "Look up opening continuations",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Game slug identifier",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
+                        "example": "a1,e5",
+                        "description": "Comma-separated PTN moves",
+                        "name": "prefix",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "PTN text",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/main.OpeningsResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
                 }
             }
         },
-        "/game/{slug}/replay": {
-            "get": {
-                "description": "Returns an ordered list of every half-turn played in the\ngame, along with the board state after each one, so a\nclient can step through without making per-turn requests.",
+        "/v1/analyze/position": {
+            "post": {
+                "description": "Asks the AI engine for its best moves in one position, given\nas TPS, a PTN move list, or both. Returns up to multi_pv\ncandidate moves with scores and expected lines. Results are\ncached by position.",
                 "consumes": [
                     "application/json"
                 ],
@@ -816,43 +994,51 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "game"
+                    "analysis"
                 ],
-                "summary": "Get full game replay",
+                "summary": "Analyze a single position",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Game slug identifier",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
+                        "description": "Position and engine config",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.PositionAnalyzeRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.ReplayResponse"
+                            "$ref": "#/definitions/main.PositionAnalysisResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
                 }
             }
         },
-        "/game/{slug}/{turn}": {
-            "get": {
-                "description": "Returns the state of a game at a specific turn",
+        "/v1/auth/confirm-reset": {
+            "post": {
+                "description": "Reset password with token",
                 "consumes": [
                     "application/json"
                 ],
@@ -860,44 +1046,207 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "game"
+                    "auth"
                 ],
-                "summary": "Get specific turn",
+                "summary": "Confirm password reset",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Game slug identifier",
-                        "name": "slug",
-                        "in": "path",
-                        "required": true
+                        "description": "Confirm reset request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ConfirmResetRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
                     },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/auth/login": {
+            "post": {
+                "description": "Login with email and password",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Login user",
+                "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Turn number",
-                        "name": "turn",
-                        "in": "path",
-                        "required": true
+                        "description": "User login data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.LoginRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/gotak.Turn"
+                            "$ref": "#/definitions/main.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/main.ErrorResponse"
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
                 }
             }
         },
-        "/healthz": {
+        "/v1/auth/logout": {
+            "post": {
+                "description": "Revokes the session behind the presented access token. The\naccess token and its refresh token stop working immediately.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Logout user",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessageResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/auth/logout-all": {
+            "post": {
+                "description": "Revokes every session belonging to the current user,\nincluding the one making this request.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Logout everywhere",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.LogoutAllResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/auth/profile": {
             "get": {
-                "description": "Returns service health status",
+                "description": "Get current user profile information",
                 "consumes": [
                     "application/json"
                 ],
@@ -905,172 +1254,2011 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "auth"
                 ],
-                "summary": "Health check",
+                "summary": "Get user profile",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/main.HealthResponse"
+                            "$ref": "#/definitions/main.User"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
                         }
                     }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            },
+            "put": {
+                "description": "Update current user profile information",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Update user profile",
+                "parameters": [
+                    {
+                        "description": "Profile update data",
+                        "name": "profile",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.UpdateProfileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/auth/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new access token and a new\nrefresh token. The presented refresh token stops working;\npresenting it again revokes the whole session.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Refresh an access token",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.RefreshRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AuthResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/auth/register": {
+            "post": {
+                "description": "Register with email and password",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Register a new user",
+                "parameters": [
+                    {
+                        "description": "User registration data",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.RegisterRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/auth/reset-password": {
+            "post": {
+                "description": "Send password reset token for email",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Request password reset",
+                "parameters": [
+                    {
+                        "description": "Reset password request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.ResetPasswordRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ResetPasswordResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/auth/tokens": {
+            "get": {
+                "description": "Lists the current user's API tokens, including revoked ones.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "List API tokens",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/main.APITokenResponse"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            },
+            "post": {
+                "description": "Mints a personal API token for bots and scripts. The token\nis returned once and cannot be retrieved again. Scopes:\nplay, read, analyze. Requires a password/OAuth session.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Create an API token",
+                "parameters": [
+                    {
+                        "description": "Token name, scopes and optional lifetime",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.CreateAPITokenRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.CreateAPITokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/auth/tokens/{id}": {
+            "delete": {
+                "description": "Revokes one of the current user's API tokens immediately.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Revoke an API token",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Token id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.MessageResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/game/new": {
+            "get": {
+                "description": "Creates a new Tak game with the specified board size",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Create a new game",
+                "parameters": [
+                    {
+                        "description": "Game configuration",
+                        "name": "game",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.CreateGameRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.GameStateResponse"
+                        }
+                    },
+                    "307": {
+                        "description": "Redirect to game URL",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            },
+            "post": {
+                "description": "Creates a new Tak game with the specified board size",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Create a new game",
+                "parameters": [
+                    {
+                        "description": "Game configuration",
+                        "name": "game",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.CreateGameRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/main.GameStateResponse"
+                        }
+                    },
+                    "307": {
+                        "description": "Redirect to game URL",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/game/{slug}": {
+            "get": {
+                "description": "Returns the current state of a game. With threats=true it\nalso lists each player's road threats and any forced road\nwin (Tinuë) for the player to move.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Get game state",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Include road threats",
+                        "name": "threats",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.GameStateResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/game/{slug}/ai-move": {
+            "post": {
+                "description": "Play the AI's move in a game against the AI. The caller must\nbe the game's human player and it must be the AI's turn.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "ai"
+                ],
+                "summary": "Have the AI move",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Engine settings",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/main.AIRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.AIMoveResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/game/{slug}/join": {
+            "post": {
+                "description": "Join a game that is waiting for a second player (as black player)",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Join a waiting game",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.JoinGameResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/game/{slug}/move": {
+            "post": {
+                "description": "Submit a move for a specific game. A move that races another\nchange to the game gets a 409. Resubmitting with the same\nidempotency_key returns the game without playing the move again.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Make a move in a game",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Move details",
+                        "name": "move",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.MoveRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.GameStateResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/v1/game/{slug}/position/{turn}": {
+            "get": {
+                "description": "Replays the game forward until it has applied every move\nof every turn with Number \u003c= turn, then returns the\nresulting board. turn=0 yields the starting (empty)\nposition; turn beyond the final turn yields the final\nposition.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Get board state after N complete turns",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Turn number (0 = starting position)",
+                        "name": "turn",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.PositionResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/game/{slug}/position/{turn}/analysis": {
+            "get": {
+                "description": "Analyzes the position after every move of every turn with\nNumber \u003c= turn, as GET /game/{slug}/position/{turn} returns it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "analysis"
+                ],
+                "summary": "Analyze a game position",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Turn number (0 = starting position)",
+                        "name": "turn",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Candidate moves to return (default 1)",
+                        "name": "multi_pv",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Engine name (see GET /v1/ai/engines)",
+                        "name": "engine",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "beginner, intermediate, advanced or expert",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "balanced, aggressive or defensive",
+                        "name": "style",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Search time, e.g. 2s",
+                        "name": "time_limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Search seed, for repeatable analysis",
+                        "name": "seed",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Search node budget, used instead of time_limit",
+                        "name": "nodes",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.PositionAnalysisResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/game/{slug}/ptn": {
+            "get": {
+                "description": "Serialises the game as Portable Tak Notation text.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Download game as PTN",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "PTN text",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/game/{slug}/replay": {
+            "get": {
+                "description": "Returns an ordered list of every half-turn played in the\ngame, along with the board state after each one, so a\nclient can step through without making per-turn requests.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Get full game replay",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.ReplayResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/game/{slug}/{turn}": {
+            "get": {
+                "description": "Returns the state of a game at a specific turn",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Get specific turn",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Game slug identifier",
+                        "name": "slug",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Turn number",
+                        "name": "turn",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/gotak.Turn"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/leaderboard": {
+            "get": {
+                "description": "Win/loss/draw records from finished games between two\nregistered players. Bot accounts, and games against them,\nare left out unless include_bots=true.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "game"
+                ],
+                "summary": "Player leaderboard",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Include bot accounts and games against bots",
+                        "name": "include_bots",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum entries (default 50, max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.LeaderboardResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/puzzles/next": {
+            "get": {
+                "description": "Returns a puzzle mined from a finished game: find the forced\nroad win for the player to move. Signed-in users get the\nunfinished puzzle rated closest to their puzzle rating;\nothers get puzzles near the default rating.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "puzzles"
+                ],
+                "summary": "Get the next puzzle",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only puzzles with this theme (road-in-one, tinue, missed-win, capstone, stack-move)",
+                        "name": "theme",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.PuzzleResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/puzzles/{id}/attempt": {
+            "post": {
+                "description": "Checks the solver's moves so far against the rules engine.\nWhile the attempt is correct the response carries the\ndefender's reply; once it is solved or incorrect it carries\nthe solution, and a signed-in user's first finished attempt\nupdates their puzzle rating.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "puzzles"
+                ],
+                "summary": "Attempt a puzzle",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Puzzle id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "The solver's moves",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/main.PuzzleAttemptRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/main.PuzzleAttemptResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/main.Problem"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "ai.Capabilities": {
+            "type": "object",
+            "properties": {
+                "analysis": {
+                    "description": "Analysis is true when the engine's choices are strong enough to\njudge other players' moves with.",
+                    "type": "boolean"
+                },
+                "komi": {
+                    "description": "Komi is true when the engine plays with a komi setting.",
+                    "type": "boolean"
+                },
+                "max_size": {
+                    "type": "integer"
+                },
+                "min_size": {
+                    "type": "integer"
+                },
+                "multi_pv": {
+                    "description": "MultiPV is true when the engine can report several candidate moves\nfrom one search; others report only their best.",
+                    "type": "boolean"
+                }
+            }
+        },
+        "ai.EngineInfo": {
+            "type": "object",
+            "properties": {
+                "capabilities": {
+                    "$ref": "#/definitions/ai.Capabilities"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "gotak.Board": {
+            "type": "object",
+            "properties": {
+                "Size": {
+                    "type": "integer",
+                    "format": "int64"
+                },
+                "Squares": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "array",
+                        "items": {
+                            "$ref": "#/definitions/gotak.Stone"
+                        }
+                    }
+                }
+            }
+        },
+        "gotak.Move": {
+            "type": "object",
+            "properties": {
+                "MoveCount": {
+                    "description": "Move only",
+                    "type": "integer",
+                    "format": "int64"
+                },
+                "MoveDirection": {
+                    "type": "string"
+                },
+                "MoveDropCounts": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer",
+                        "format": "int64"
+                    }
+                },
+                "Square": {
+                    "type": "string"
+                },
+                "Stone": {
+                    "description": "Both Drop and Move",
+                    "type": "string"
+                },
+                "Text": {
+                    "type": "string"
+                }
+            }
+        },
+        "gotak.Stone": {
+            "type": "object",
+            "properties": {
+                "Player": {
+                    "type": "integer"
+                },
+                "Type": {
+                    "type": "string"
+                }
+            }
+        },
+        "gotak.Tag": {
+            "type": "object",
+            "properties": {
+                "Key": {
+                    "type": "string"
+                },
+                "Value": {
+                    "type": "string"
+                }
+            }
+        },
+        "gotak.Turn": {
+            "type": "object",
+            "properties": {
+                "Branch": {
+                    "description": "Branch is the optional PTN branch label appended to the turn\nnumber (e.g. ` + "`" + `1a.` + "`" + ` -\u003e \"a\"). Main-line turns leave it empty.",
+                    "type": "string"
+                },
+                "Comment": {
+                    "type": "string"
+                },
+                "First": {
+                    "$ref": "#/definitions/gotak.Move"
+                },
+                "Number": {
+                    "type": "integer",
+                    "format": "int64"
+                },
+                "Result": {
+                    "type": "string"
+                },
+                "Second": {
+                    "$ref": "#/definitions/gotak.Move"
+                }
+            }
+        },
+        "main.AIMoveResponse": {
+            "type": "object",
+            "properties": {
+                "Board": {
+                    "$ref": "#/definitions/gotak.Board"
+                },
+                "ID": {
+                    "type": "integer",
+                    "format": "int64"
+                },
+                "Meta": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/gotak.Tag"
+                    }
+                },
+                "Slug": {
+                    "type": "string"
+                },
+                "Turns": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/gotak.Turn"
+                    }
+                },
+                "black_bot": {
+                    "type": "boolean"
+                },
+                "black_player_id": {
+                    "type": "integer"
+                },
+                "book": {
+                    "type": "boolean"
+                },
+                "current_player": {
+                    "type": "integer"
+                },
+                "engine": {
+                    "description": "Engine is the AI engine an \"ai\" mode game plays against.",
+                    "type": "string"
+                },
+                "hint": {
+                    "type": "string"
+                },
+                "mode": {
+                    "type": "string"
+                },
+                "move": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "threats": {
+                    "description": "Threats is only filled in when asked for with ?threats=true.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.ThreatReport"
+                        }
+                    ]
+                },
+                "white_bot": {
+                    "type": "boolean"
+                },
+                "white_player_id": {
+                    "type": "integer"
+                },
+                "winner": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.AIRequest": {
+            "type": "object",
+            "properties": {
+                "level": {
+                    "type": "string"
+                },
+                "nodes": {
+                    "type": "integer"
+                },
+                "personality": {
+                    "type": "string"
+                },
+                "seed": {
+                    "type": "integer"
+                },
+                "style": {
+                    "type": "string"
+                },
+                "time_limit": {
+                    "description": "TimeLimit is the search time in nanoseconds, capped at the server's\nmaximum.",
+                    "type": "integer",
+                    "example": 2000000000
+                }
+            }
+        },
+        "main.APITokenResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "gtk_3fa9"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.AdjudicateRequest": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "example": "black abandoned the game"
+                },
+                "winner": {
+                    "type": "integer",
+                    "example": 1
                 }
             }
-        }
-    },
-    "definitions": {
-        "gotak.Board": {
+        },
+        "main.AdminStatusResponse": {
             "type": "object",
             "properties": {
-                "size": {
+                "admins": {
                     "type": "integer",
-                    "format": "int64"
+                    "example": 2
                 },
-                "squares": {
+                "analysis_jobs": {
                     "type": "object",
                     "additionalProperties": {
-                        "type": "array",
-                        "items": {
-                            "$ref": "#/definitions/gotak.Stone"
-                        }
+                        "type": "integer",
+                        "format": "int64"
+                    }
+                },
+                "banned_users": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "game_analyses": {
+                    "type": "integer",
+                    "example": 5400
+                },
+                "games": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer",
+                        "format": "int64"
                     }
+                },
+                "position_analyses": {
+                    "type": "integer",
+                    "example": 880
+                },
+                "users": {
+                    "type": "integer",
+                    "example": 1200
                 }
             }
         },
-        "gotak.Move": {
+        "main.AdminUsersResponse": {
             "type": "object",
             "properties": {
-                "moveCount": {
-                    "description": "Move only",
+                "total": {
                     "type": "integer",
-                    "format": "int64"
+                    "example": 1200
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.User"
+                    }
+                }
+            }
+        },
+        "main.AnalysisJobResponse": {
+            "type": "object",
+            "properties": {
+                "agreed": {
+                    "type": "integer"
+                },
+                "completed": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "engine": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
                 },
-                "moveDirection": {
+                "level": {
                     "type": "string"
                 },
-                "moveDropCounts": {
+                "moves": {
                     "type": "array",
                     "items": {
-                        "type": "integer",
-                        "format": "int64"
+                        "$ref": "#/definitions/main.MoveAnalysis"
                     }
                 },
-                "square": {
+                "slug": {
                     "type": "string"
                 },
-                "stone": {
-                    "description": "Both Drop and Move",
+                "status": {
+                    "type": "string",
+                    "example": "running"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.AnalyzeRequest": {
+            "type": "object",
+            "properties": {
+                "engine": {
+                    "description": "Engine names a registered engine with analysis support (see\nGET /v1/ai/engines). Empty means the default engine.",
+                    "type": "string"
+                },
+                "level": {
                     "type": "string"
                 },
-                "text": {
+                "nodes": {
+                    "type": "integer"
+                },
+                "seed": {
+                    "description": "Seed and Nodes make the analysis repeatable: Nodes replaces the time\nlimit with a search budget and Seed fixes the engine's tie-breaking.",
+                    "type": "integer"
+                },
+                "style": {
                     "type": "string"
+                },
+                "time_limit": {
+                    "description": "TimeLimit is the search time in nanoseconds, capped at the server's\nmaximum.",
+                    "type": "integer",
+                    "example": 2000000000
                 }
             }
         },
-        "gotak.Stone": {
+        "main.AuditLog": {
             "type": "object",
             "properties": {
-                "player": {
+                "action": {
+                    "type": "string",
+                    "example": "ban_user"
+                },
+                "actor_id": {
                     "type": "integer"
                 },
-                "type": {
+                "created_at": {
                     "type": "string"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "spamming game lobbies"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "target_id": {
+                    "type": "string",
+                    "example": "42"
+                },
+                "target_type": {
+                    "type": "string",
+                    "example": "user"
                 }
             }
         },
-        "gotak.Tag": {
+        "main.AuditLogResponse": {
             "type": "object",
             "properties": {
-                "key": {
-                    "type": "string"
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.AuditLog"
+                    }
                 },
-                "value": {
-                    "type": "string"
+                "total": {
+                    "type": "integer",
+                    "example": 17
                 }
             }
         },
-        "gotak.Turn": {
+        "main.AuthResponse": {
             "type": "object",
             "properties": {
-                "branch": {
-                    "description": "Branch is the optional PTN branch label appended to the turn\nnumber (e.g. ` + "`" + `1a.` + "`" + ` -\u003e \"a\"). Main-line turns leave it empty.",
+                "expires_at": {
                     "type": "string"
                 },
-                "comment": {
+                "refresh_token": {
                     "type": "string"
                 },
-                "first": {
-                    "$ref": "#/definitions/gotak.Move"
-                },
-                "number": {
-                    "type": "integer",
-                    "format": "int64"
-                },
-                "result": {
+                "token": {
                     "type": "string"
                 },
-                "second": {
-                    "$ref": "#/definitions/gotak.Move"
+                "user": {
+                    "$ref": "#/definitions/main.User"
                 }
             }
         },
-        "main.AnalyzeRequest": {
-            "type": "object"
+        "main.BanRequest": {
+            "type": "object",
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "example": "spamming game chat"
+                }
+            }
         },
-        "main.AnalyzeResponse": {
+        "main.CandidateLine": {
             "type": "object",
             "properties": {
-                "agreed": {
+                "depth": {
                     "type": "integer"
                 },
-                "level": {
+                "explanation": {
+                    "description": "Explanation describes what Move does in the position.",
                     "type": "string"
                 },
-                "move_count": {
+                "mate": {
+                    "description": "Mate is non-zero for a forced win (positive) or loss (negative) in\nthat many moves.",
                     "type": "integer"
                 },
-                "moves": {
+                "move": {
+                    "type": "string"
+                },
+                "nodes": {
+                    "type": "integer"
+                },
+                "pv": {
                     "type": "array",
                     "items": {
-                        "$ref": "#/definitions/main.MoveAnalysis"
+                        "type": "string"
                     }
                 },
-                "size": {
+                "result": {
+                    "description": "Result is \"win\", \"loss\" or \"draw\" once the game is over; there is\nnothing left to search then.",
+                    "type": "string"
+                },
+                "score_cp": {
+                    "description": "ScoreCP is in centiflats; positive favours the player.",
                     "type": "integer"
                 },
-                "slug": {
-                    "type": "string"
+                "win_probability": {
+                    "type": "number"
                 }
             }
         },
-        "main.AuthResponse": {
+        "main.Classification": {
+            "type": "string",
+            "enum": [
+                "best",
+                "good",
+                "inaccuracy",
+                "mistake",
+                "blunder",
+                "missed_win"
+            ],
+            "x-enum-varnames": [
+                "ClassBest",
+                "ClassGood",
+                "ClassInaccuracy",
+                "ClassMistake",
+                "ClassBlunder",
+                "ClassMissedWin"
+            ]
+        },
+        "main.ConfirmResetRequest": {
             "type": "object",
             "properties": {
+                "new_password": {
+                    "type": "string",
+                    "example": "newsecretpassword"
+                },
                 "token": {
-                    "type": "string"
+                    "type": "string",
+                    "example": "reset-token-here"
+                }
+            }
+        },
+        "main.CreateAPITokenRequest": {
+            "type": "object",
+            "properties": {
+                "expires_in_days": {
+                    "type": "integer",
+                    "example": 90
                 },
-                "user": {
-                    "$ref": "#/definitions/main.User"
+                "name": {
+                    "type": "string",
+                    "example": "my-tak-bot"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "play",
+                        "read"
+                    ]
                 }
             }
         },
-        "main.ConfirmResetRequest": {
+        "main.CreateAPITokenResponse": {
             "type": "object",
             "properties": {
-                "new_password": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
                     "type": "string",
-                    "example": "newsecretpassword"
+                    "example": "gtk_3fa9"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
                 "token": {
                     "type": "string",
-                    "example": "reset-token-here"
+                    "example": "gtk_3fa9..."
                 }
             }
         },
         "main.CreateGameRequest": {
             "type": "object",
             "properties": {
+                "engine": {
+                    "description": "Engine picks the AI engine for mode \"ai\" (see GET /v1/ai/engines).",
+                    "type": "string",
+                    "example": "minimax"
+                },
                 "mode": {
                     "type": "string",
                     "example": "human"
@@ -1081,51 +3269,119 @@ const docTemplate = `{
                 }
             }
         },
-        "main.ErrorResponse": {
+        "main.EnginesResponse": {
             "type": "object",
             "properties": {
-                "error": {
-                    "type": "string",
-                    "example": "Something went wrong"
+                "default": {
+                    "type": "string"
+                },
+                "engines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/ai.EngineInfo"
+                    }
                 }
             }
         },
-        "main.GameStateResponse": {
+        "main.Evaluation": {
             "type": "object",
             "properties": {
-                "black_player_id": {
+                "depth": {
                     "type": "integer"
                 },
-                "board": {
-                    "$ref": "#/definitions/gotak.Board"
+                "mate": {
+                    "description": "Mate is non-zero for a forced win (positive) or loss (negative) in\nthat many moves.",
+                    "type": "integer"
                 },
-                "current_player": {
+                "nodes": {
                     "type": "integer"
                 },
-                "id": {
+                "pv": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "result": {
+                    "description": "Result is \"win\", \"loss\" or \"draw\" once the game is over; there is\nnothing left to search then.",
+                    "type": "string"
+                },
+                "score_cp": {
+                    "description": "ScoreCP is in centiflats; positive favours the player.",
+                    "type": "integer"
+                },
+                "win_probability": {
+                    "type": "number"
+                }
+            }
+        },
+        "main.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string",
+                    "example": "player"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "must be 1 or 2"
+                }
+            }
+        },
+        "main.GameStateResponse": {
+            "type": "object",
+            "properties": {
+                "Board": {
+                    "$ref": "#/definitions/gotak.Board"
+                },
+                "ID": {
                     "type": "integer",
                     "format": "int64"
                 },
-                "meta": {
+                "Meta": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/gotak.Tag"
                     }
                 },
-                "mode": {
+                "Slug": {
                     "type": "string"
                 },
-                "slug": {
+                "Turns": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/gotak.Turn"
+                    }
+                },
+                "black_bot": {
+                    "type": "boolean"
+                },
+                "black_player_id": {
+                    "type": "integer"
+                },
+                "current_player": {
+                    "type": "integer"
+                },
+                "engine": {
+                    "description": "Engine is the AI engine an \"ai\" mode game plays against.",
+                    "type": "string"
+                },
+                "mode": {
                     "type": "string"
                 },
                 "status": {
                     "type": "string"
                 },
-                "turns": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/gotak.Turn"
-                    }
+                "threats": {
+                    "description": "Threats is only filled in when asked for with ?threats=true.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.ThreatReport"
+                        }
+                    ]
+                },
+                "white_bot": {
+                    "type": "boolean"
                 },
                 "white_player_id": {
                     "type": "integer"
@@ -1156,6 +3412,63 @@ const docTemplate = `{
                 }
             }
         },
+        "main.JoinGameResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "successfully joined game"
+                },
+                "player": {
+                    "type": "string",
+                    "example": "black"
+                },
+                "slug": {
+                    "type": "string",
+                    "example": "abc123"
+                }
+            }
+        },
+        "main.LeaderboardEntry": {
+            "type": "object",
+            "properties": {
+                "bot": {
+                    "type": "boolean"
+                },
+                "draws": {
+                    "type": "integer"
+                },
+                "games": {
+                    "type": "integer"
+                },
+                "losses": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                },
+                "wins": {
+                    "type": "integer"
+                }
+            }
+        },
+        "main.LeaderboardResponse": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.LeaderboardEntry"
+                    }
+                },
+                "include_bots": {
+                    "type": "boolean"
+                }
+            }
+        },
         "main.LoginRequest": {
             "type": "object",
             "properties": {
@@ -1169,6 +3482,19 @@ const docTemplate = `{
                 }
             }
         },
+        "main.LogoutAllResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "logged out of all sessions"
+                },
+                "revoked": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
         "main.MessageResponse": {
             "type": "object",
             "properties": {
@@ -1187,10 +3513,39 @@ const docTemplate = `{
                 "best": {
                     "type": "string"
                 },
+                "classification": {
+                    "$ref": "#/definitions/main.Classification"
+                },
                 "error": {
                     "description": "Error captures why the engine couldn't evaluate this move, if any.\nWhen non-empty, Best and Agreed should be ignored.",
                     "type": "string"
                 },
+                "eval_after": {
+                    "$ref": "#/definitions/main.Evaluation"
+                },
+                "eval_before": {
+                    "description": "EvalBefore and EvalAfter are the position before and after the\nplayed move, both from the mover's point of view.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/main.Evaluation"
+                        }
+                    ]
+                },
+                "explanation": {
+                    "description": "Explanation describes what the played move does: roads it completes,\nthreatens or blocks, the flat count and so on.",
+                    "type": "string"
+                },
+                "loss": {
+                    "description": "Loss is how much the move lowered the mover's win probability, from\n0 to 1.",
+                    "type": "number"
+                },
+                "missed_win": {
+                    "description": "MissedWin is the forced road win the mover had and the played move\ngave up: their winning move, then the best defence and so on.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "played": {
                     "type": "string"
                 },
@@ -1205,6 +3560,11 @@ const docTemplate = `{
         "main.MoveRequest": {
             "type": "object",
             "properties": {
+                "idempotency_key": {
+                    "description": "IdempotencyKey lets a client retry a submission safely: a move\nalready recorded in the game under the same key is not played again.",
+                    "type": "string",
+                    "example": "5f0c2a9e-move-7"
+                },
                 "move": {
                     "type": "string",
                     "example": "c3"
@@ -1250,6 +3610,82 @@ const docTemplate = `{
                 }
             }
         },
+        "main.PositionAnalysisResponse": {
+            "type": "object",
+            "properties": {
+                "engine": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "level": {
+                    "type": "string"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.CandidateLine"
+                    }
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "to_move": {
+                    "type": "integer"
+                },
+                "tps": {
+                    "type": "string"
+                }
+            }
+        },
+        "main.PositionAnalyzeRequest": {
+            "type": "object",
+            "properties": {
+                "engine": {
+                    "description": "Engine names a registered engine with analysis support (see\nGET /v1/ai/engines). Empty means the default engine.",
+                    "type": "string"
+                },
+                "level": {
+                    "type": "string"
+                },
+                "moves": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "multi_pv": {
+                    "description": "MultiPV is how many candidate moves to return (default 1, at most\n8). Engines without multi-PV support return their best move only.",
+                    "type": "integer",
+                    "example": 3
+                },
+                "nodes": {
+                    "type": "integer"
+                },
+                "seed": {
+                    "description": "Seed and Nodes make the analysis repeatable: Nodes replaces the time\nlimit with a search budget and Seed fixes the engine's tie-breaking.",
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "Size is required without TPS, and must match it otherwise.",
+                    "type": "integer",
+                    "example": 5
+                },
+                "style": {
+                    "type": "string"
+                },
+                "time_limit": {
+                    "description": "TimeLimit is the search time in nanoseconds, capped at the server's\nmaximum.",
+                    "type": "integer",
+                    "example": 2000000000
+                },
+                "tps": {
+                    "type": "string",
+                    "example": "x5/x5/x5/x5/2,x4 2 1"
+                }
+            }
+        },
         "main.PositionResponse": {
             "type": "object",
             "properties": {
@@ -1273,6 +3709,139 @@ const docTemplate = `{
                 }
             }
         },
+        "main.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "validation_failed"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "player must be 1 or 2"
+                },
+                "error": {
+                    "type": "string",
+                    "example": "player must be 1 or 2"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/main.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string",
+                    "example": "/v1/game/abc123/move"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Bad Request"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "about:blank"
+                }
+            }
+        },
+        "main.PurgeAnalysisResponse": {
+            "type": "object",
+            "properties": {
+                "game_analyses": {
+                    "type": "integer",
+                    "example": 40
+                },
+                "position_analyses": {
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
+        "main.PuzzleAttemptRequest": {
+            "type": "object",
+            "properties": {
+                "moves": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "e2"
+                    ]
+                }
+            }
+        },
+        "main.PuzzleAttemptResponse": {
+            "type": "object",
+            "properties": {
+                "change": {
+                    "type": "integer"
+                },
+                "rating": {
+                    "description": "Rating and Change are the user's puzzle rating after their first\nfinished attempt at this puzzle, and how much it moved.",
+                    "type": "integer"
+                },
+                "reply": {
+                    "type": "string"
+                },
+                "result": {
+                    "type": "string"
+                },
+                "solution": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "main.PuzzleResponse": {
+            "type": "object",
+            "properties": {
+                "depth": {
+                    "description": "moves the solver needs",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "rating": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "themes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "to_move": {
+                    "type": "integer"
+                },
+                "tps": {
+                    "type": "string"
+                },
+                "user_rating": {
+                    "description": "UserRating is the signed-in user's puzzle rating.",
+                    "type": "integer"
+                }
+            }
+        },
+        "main.RefreshRequest": {
+            "type": "object",
+            "properties": {
+                "refresh_token": {
+                    "type": "string",
+                    "example": "4f1c..."
+                }
+            }
+        },
         "main.RegisterRequest": {
             "type": "object",
             "properties": {
@@ -1342,6 +3911,52 @@ const docTemplate = `{
                 }
             }
         },
+        "main.ResetPasswordResponse": {
+            "type": "object",
+            "properties": {
+                "dev_token": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "if email exists, reset instructions sent"
+                }
+            }
+        },
+        "main.SetBotRequest": {
+            "type": "object",
+            "properties": {
+                "bot": {
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "main.ThreatReport": {
+            "type": "object",
+            "properties": {
+                "black": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tinue": {
+                    "description": "Tinue is a forced road win for the player to move, when the solver\nfinds one: their move, then the best defence and so on.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "white": {
+                    "description": "White and Black are the moves that would complete a road for that\nplayer if it were their turn.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "main.UpdateProfileRequest": {
             "type": "object",
             "properties": {
@@ -1359,6 +3974,17 @@ const docTemplate = `{
                 "avatar_url": {
                     "type": "string"
                 },
+                "ban_reason": {
+                    "type": "string"
+                },
+                "banned_at": {
+                    "description": "banned users can't sign in or use the API",
+                    "type": "string"
+                },
+                "bot": {
+                    "description": "bot accounts are labelled in games and kept off human leaderboards",
+                    "type": "boolean"
+                },
                 "created_at": {
                     "type": "string"
                 },
@@ -1380,6 +4006,11 @@ const docTemplate = `{
                 "provider_id": {
                     "type": "string"
                 },
+                "role": {
+                    "description": "user or admin; see ` + "`" + `server admin` + "`" + `",
+                    "type": "string",
+                    "example": "user"
+                },
                 "updated_at": {
                     "type": "string"
                 }
@@ -1403,7 +4034,7 @@ var SwaggerInfo = &swag.Spec{
 	BasePath:         "/",
 	Schemes:          []string{},
 	Title:            "GoTak API",
-	Description:      "A Tak game server API with authentication",
+	Description:      "A Tak game server API with authentication. Errors are RFC 7807 problem details (application/problem+json). Requests are rate limited per user or client IP: responses carry RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers, and a request over its limit gets a 429 with Retry-After.",
 	InfoInstanceName: "swagger",
 	SwaggerTemplate:  docTemplate,
 	LeftDelim:        "{{",
@@ -3,6 +3,7 @@ package docs
 import (
 	_ "embed"
 	"encoding/json"
+	"slices"
 )
 
 //go:embed swagger.json
@@ -30,3 +31,8 @@ func GetSwaggerSpec() (*SwaggerSpec, error) {
 	}
 	return &spec, nil
 }
+
+// SwaggerJSON returns the embedded swagger.json document.
+func SwaggerJSON() []byte {
+	return slices.Clone(swaggerJSON)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/icco/gotak/ai"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+)
+
+// engines is the AI engine registry used by the AI move and analysis
+// handlers. main replaces it with ai.LoadRegistry when ENGINES_CONFIG is
+// set.
+var engines = ai.NewDefaultRegistry()
+
+// errEngineNotSuitable marks an engine that exists but can't serve the
+// request (wrong board size, no analysis support).
+var errEngineNotSuitable = errors.New("engine not suitable")
+
+// selectEngine resolves a requested engine name ("" for the default) and
+// checks it can play on a size x size board, and analyze if asked to.
+func selectEngine(name string, size int64, analysis bool) (ai.Engine, ai.EngineInfo, error) {
+	engine, info, err := engines.Get(name)
+	if err != nil {
+		return nil, info, err
+	}
+	if !info.Capabilities.SupportsSize(size) {
+		return nil, info, fmt.Errorf("%w: %s does not play %dx%d", errEngineNotSuitable, info.Name, size, size)
+	}
+	if analysis && !info.Capabilities.Analysis {
+		return nil, info, fmt.Errorf("%w: %s does not support analysis", errEngineNotSuitable, info.Name)
+	}
+	return engine, info, nil
+}
+
+// EnginesResponse lists the available AI engines.
+type EnginesResponse struct {
+	Default string          `json:"default"`
+	Engines []ai.EngineInfo `json:"engines"`
+}
+
+// @Summary List AI engines
+// @Description Lists the AI engines that can be picked for AI games and
+// @Description analysis, with the board sizes they play and whether they
+// @Description support komi and analysis.
+// @Tags ai
+// @Produce json
+// @Success 200 {object} EnginesResponse
+// @Failure 429 {object} Problem
+// @Router /v1/ai/engines [get]
+func getEnginesHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+	resp := EnginesResponse{Default: engines.Default(), Engines: engines.List()}
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
+	}
+}
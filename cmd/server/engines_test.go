@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/icco/gotak/ai"
+)
+
+func TestSelectEngine(t *testing.T) {
+	if _, info, err := selectEngine("", 6, true); err != nil || info.Name != ai.DefaultEngine {
+		t.Errorf("default engine = %q, %v", info.Name, err)
+	}
+	if _, _, err := selectEngine("random", 6, false); err != nil {
+		t.Errorf("random for play: %v", err)
+	}
+	if _, _, err := selectEngine("random", 6, true); !errors.Is(err, errEngineNotSuitable) {
+		t.Errorf("random for analysis err = %v, want errEngineNotSuitable", err)
+	}
+	if _, _, err := selectEngine("minimax", 9, false); !errors.Is(err, errEngineNotSuitable) {
+		t.Errorf("9x9 err = %v, want errEngineNotSuitable", err)
+	}
+	if _, _, err := selectEngine("nope", 6, false); !errors.Is(err, ai.ErrUnknownEngine) {
+		t.Errorf("unknown engine err = %v, want ai.ErrUnknownEngine", err)
+	}
+}
+
+func TestGetEnginesHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	getEnginesHandler(w, httptest.NewRequest(http.MethodGet, "/ai/engines", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp EnginesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Default != ai.DefaultEngine || len(resp.Engines) != 5 {
+		t.Errorf("response = %+v", resp)
+	}
+	for _, e := range resp.Engines {
+		if e.Capabilities.MaxSize == 0 {
+			t.Errorf("engine %q has no size range", e.Name)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"strings"
 
 	"github.com/icco/gotak"
-	"gorm.io/gorm"
 )
 
 // GameStateResponse is the enriched game payload returned to API clients.
@@ -20,7 +19,51 @@ type GameStateResponse struct {
 	Winner        int    `json:"winner"`
 	WhitePlayerID *int64 `json:"white_player_id,omitempty"`
 	BlackPlayerID *int64 `json:"black_player_id,omitempty"`
+	WhiteBot      bool   `json:"white_bot"`
+	BlackBot      bool   `json:"black_bot"`
 	Mode          string `json:"mode"`
+	// Engine is the AI engine an "ai" mode game plays against.
+	Engine string `json:"engine,omitempty"`
+	// Threats is only filled in when asked for with ?threats=true.
+	Threats *ThreatReport `json:"threats,omitempty"`
+}
+
+// tinueDepth bounds the Tinuë solver for threat reports and analysis: a
+// road in one, or a move that leaves the opponent in Tinuë.
+const tinueDepth = 2
+
+// ThreatReport lists the road threats on the board.
+type ThreatReport struct {
+	// White and Black are the moves that would complete a road for that
+	// player if it were their turn.
+	White []string `json:"white"`
+	Black []string `json:"black"`
+	// Tinue is a forced road win for the player to move, when the solver
+	// finds one: their move, then the best defence and so on.
+	Tinue []string `json:"tinue,omitempty"`
+}
+
+// newThreatReport reads the threats off g, whose board must reflect its
+// moves. Finished games have none.
+func newThreatReport(g *gotak.Game) *ThreatReport {
+	report := &ThreatReport{White: []string{}, Black: []string{}}
+	if _, over := g.GameOver(); over {
+		return report
+	}
+	report.White = moveTexts(g.RoadThreats(gotak.PlayerWhite))
+	report.Black = moveTexts(g.RoadThreats(gotak.PlayerBlack))
+	if line, ok := g.FindTinue(tinueDepth); ok {
+		report.Tinue = moveTexts(line)
+	}
+	return report
+}
+
+func moveTexts(moves []*gotak.Move) []string {
+	out := make([]string, len(moves))
+	for i, m := range moves {
+		out[i] = m.Text
+	}
+	return out
 }
 
 var errInvalidGameMode = errors.New(`invalid mode: must be "human" or "ai"`)
@@ -47,14 +90,14 @@ func normalizeGameMode(mode string) (string, error) {
 }
 
 // buildGameStateResponse loads the full game plus DB session fields.
-func buildGameStateResponse(db *gorm.DB, slug string) (*GameStateResponse, error) {
-	game, err := getGame(db, slug)
+func buildGameStateResponse(store Store, slug string) (*GameStateResponse, error) {
+	game, err := store.Game(slug)
 	if err != nil {
 		return nil, err
 	}
 
-	var dbGame Game
-	if err := db.Where("slug = ?", slug).First(&dbGame).Error; err != nil {
+	dbGame, err := store.GameRecord(slug)
+	if err != nil {
 		return nil, err
 	}
 
@@ -66,6 +109,8 @@ func buildGameStateResponse(db *gorm.DB, slug string) (*GameStateResponse, error
 		}
 	}
 
+	engine, _ := game.GetMeta("Engine")
+
 	return &GameStateResponse{
 		Game:          game,
 		CurrentPlayer: dbGame.CurrentPlayer,
@@ -73,6 +118,9 @@ func buildGameStateResponse(db *gorm.DB, slug string) (*GameStateResponse, error
 		Winner:        dbGame.Winner,
 		WhitePlayerID: dbGame.WhitePlayerID,
 		BlackPlayerID: dbGame.BlackPlayerID,
+		WhiteBot:      dbGame.WhitePlayer != nil && dbGame.WhitePlayer.Bot,
+		BlackBot:      dbGame.BlackPlayer != nil && dbGame.BlackPlayer.Bot,
 		Mode:          mode,
+		Engine:        engine,
 	}, nil
 }
@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
+
+	"github.com/icco/gotak"
 )
 
 func TestNormalizeGameMode(t *testing.T) {
@@ -86,7 +89,7 @@ func TestCreateGameModes(t *testing.T) {
 		t.Errorf("ai status = %q, want active", aiGame.Status)
 	}
 
-	state, err := buildGameStateResponse(db, aiSlug)
+	state, err := buildGameStateResponse(&gormStore{db: db}, aiSlug)
 	if err != nil {
 		t.Fatalf("buildGameStateResponse: %v", err)
 	}
@@ -131,7 +134,7 @@ func TestCreateGameDefaultMode(t *testing.T) {
 	if err != nil {
 		t.Fatalf("createGame empty mode: %v", err)
 	}
-	state, err := buildGameStateResponse(db, slug)
+	state, err := buildGameStateResponse(&gormStore{db: db}, slug)
 	if err != nil {
 		t.Fatalf("buildGameStateResponse: %v", err)
 	}
@@ -139,3 +142,31 @@ func TestCreateGameDefaultMode(t *testing.T) {
 		t.Errorf("mode = %q, want human", state.Mode)
 	}
 }
+
+func TestNewThreatReport(t *testing.T) {
+	// Both players have four in a row; white is to move and wins at e1.
+	g := playGame(t, []scriptedMove{
+		{gotak.PlayerWhite, "a5"},
+		{gotak.PlayerBlack, "a1"},
+		{gotak.PlayerWhite, "b1"},
+		{gotak.PlayerBlack, "b5"},
+		{gotak.PlayerWhite, "c1"},
+		{gotak.PlayerBlack, "c5"},
+		{gotak.PlayerWhite, "d1"},
+		{gotak.PlayerBlack, "d5"},
+	})
+	report := newThreatReport(g)
+	if !slices.Contains(report.White, "e1") || !slices.Contains(report.Black, "e5") {
+		t.Errorf("threats = %+v, want white e1 and black e5", report)
+	}
+	if len(report.Tinue) != 1 || report.Tinue[0] != "e1" {
+		t.Errorf("tinue = %v, want [e1]", report.Tinue)
+	}
+
+	if err := g.DoSingleMove("e1", gotak.PlayerWhite); err != nil {
+		t.Fatalf("e1: %v", err)
+	}
+	if report := newThreatReport(g); len(report.White)+len(report.Black)+len(report.Tinue) != 0 {
+		t.Errorf("finished game threats = %+v", report)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 100
+)
+
+type LeaderboardEntry struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Bot    bool   `json:"bot"`
+	Games  int    `json:"games"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+}
+
+// LeaderboardResponse entries are sorted by Wins desc, Losses asc, then
+// UserID asc.
+type LeaderboardResponse struct {
+	IncludeBots bool               `json:"include_bots"`
+	Entries     []LeaderboardEntry `json:"entries"`
+}
+
+// @Summary Player leaderboard
+// @Description Win/loss/draw records from finished games between two
+// @Description registered players. Bot accounts, and games against them,
+// @Description are left out unless include_bots=true.
+// @Tags game
+// @Produce json
+// @Param include_bots query bool false "Include bot accounts and games against bots"
+// @Param limit query int false "Maximum entries (default 50, max 100)"
+// @Success 200 {object} LeaderboardResponse
+// @Failure 400 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/leaderboard [get]
+func getLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	l := logging.FromContext(ctx)
+
+	q := r.URL.Query()
+	includeBots := q.Get("include_bots") == "true"
+	limit := defaultLeaderboardLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLeaderboardLimit {
+			writeProblem(w, r, newAPIError(http.StatusBadRequest, "limit must be between 1 and 100"))
+			return
+		}
+		limit = n
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
+		return
+	}
+	entries, err := store.Leaderboard(includeBots)
+	if err != nil {
+		l.Errorw("could not compute leaderboard", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not compute leaderboard"))
+		return
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	if err := Renderer.JSON(w, http.StatusOK, LeaderboardResponse{IncludeBots: includeBots, Entries: entries}); err != nil {
+		l.Errorw("failed to render leaderboard response", zap.Error(err))
+	}
+}
+
+// computeLeaderboard aggregates in Go, like computeOpenings. Games with an
+// empty seat (AI games, abandoned lobbies) don't count.
+func computeLeaderboard(db *gorm.DB, includeBots bool) ([]LeaderboardEntry, error) {
+	var games []Game
+	if err := db.Preload("WhitePlayer").Preload("BlackPlayer").
+		Where("status = ? AND white_player_id IS NOT NULL AND black_player_id IS NOT NULL", "finished").
+		Find(&games).Error; err != nil {
+		return nil, err
+	}
+
+	byUser := map[int64]*LeaderboardEntry{}
+	entry := func(u *User) *LeaderboardEntry {
+		e, ok := byUser[u.ID]
+		if !ok {
+			e = &LeaderboardEntry{UserID: u.ID, Name: u.Name, Bot: u.Bot}
+			byUser[u.ID] = e
+		}
+		return e
+	}
+
+	for _, g := range games {
+		white, black := g.WhitePlayer, g.BlackPlayer
+		if white == nil || black == nil || white.ID == black.ID {
+			continue
+		}
+		if !includeBots && (white.Bot || black.Bot) {
+			continue
+		}
+		we, be := entry(white), entry(black)
+		we.Games++
+		be.Games++
+		switch g.Winner {
+		case gotak.PlayerWhite:
+			we.Wins++
+			be.Losses++
+		case gotak.PlayerBlack:
+			be.Wins++
+			we.Losses++
+		default:
+			we.Draws++
+			be.Draws++
+		}
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(byUser))
+	for _, e := range byUser {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Wins != entries[j].Wins {
+			return entries[i].Wins > entries[j].Wins
+		}
+		if entries[i].Losses != entries[j].Losses {
+			return entries[i].Losses < entries[j].Losses
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+	return entries, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+)
+
+func TestComputeLeaderboard(t *testing.T) {
+	db := setupTestDB(t)
+	alice := createTestUser(t, db)
+	bob := &User{Provider: "local", ProviderID: "bob", Email: "bob@example.com", Name: "Bob"}
+	bot := &User{Provider: "local", ProviderID: "bot", Email: "bot@example.com", Name: "Bot", Bot: true}
+	for _, u := range []*User{bob, bot} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	finished := func(white, black *User, winner int) {
+		g := &Game{Slug: white.ProviderID + black.ProviderID + time.Now().String(), Status: "finished",
+			Winner: winner, WhitePlayerID: &white.ID, BlackPlayerID: &black.ID}
+		if err := db.Create(g).Error; err != nil {
+			t.Fatalf("create game: %v", err)
+		}
+	}
+	finished(alice, bob, gotak.PlayerWhite)
+	finished(bob, alice, 0)
+	finished(bot, alice, gotak.PlayerWhite)
+
+	entries, err := computeLeaderboard(db, false)
+	if err != nil {
+		t.Fatalf("computeLeaderboard: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 humans: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.UserID != alice.ID || e.Wins != 1 || e.Draws != 1 || e.Losses != 0 {
+		t.Errorf("first entry = %+v, want alice 1-0-1 without the bot game", e)
+	}
+
+	entries, err = computeLeaderboard(db, true)
+	if err != nil {
+		t.Fatalf("computeLeaderboard: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries with bots, want 3", len(entries))
+	}
+	for _, e := range entries {
+		if e.UserID == bot.ID && !e.Bot {
+			t.Error("bot entry not labelled")
+		}
+		if e.UserID == alice.ID && e.Losses != 1 {
+			t.Errorf("alice with bots = %+v, want 1 loss", e)
+		}
+	}
+}
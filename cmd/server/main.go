@@ -4,10 +4,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,6 +19,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
 	"github.com/icco/gotak/cmd/server/docs"
 	"github.com/icco/gutil/logging"
 	"github.com/microcosm-cc/bluemonday"
@@ -33,6 +34,7 @@ import (
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 var (
@@ -58,7 +60,7 @@ var (
 
 // @title GoTak API
 // @version 1.0
-// @description A Tak game server API with authentication
+// @description A Tak game server API with authentication. Errors are RFC 7807 problem details (application/problem+json). Requests are rate limited per user or client IP: responses carry RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers, and a request over its limit gets a 429 with Retry-After.
 // @contact.name API Support
 // @contact.url http://github.com/icco/gotak
 // @license.name MIT
@@ -74,13 +76,33 @@ var (
 const serverName = "gotak"
 
 func main() {
-	port := "8080"
-	if fromEnv := os.Getenv("PORT"); fromEnv != "" {
-		port = fromEnv
+	cfg, err := loadConfig(os.Getenv("CONFIG_FILE"), os.Getenv)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) > 1 {
+		commands := map[string]func(io.Writer, string, []string) error{
+			"admin":   runAdmin,
+			"migrate": runMigrate,
+			"verify":  runVerify,
+		}
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(os.Stdout, cfg.DatabaseURL, os.Args[2:]); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
 	}
-	log.Infow("Starting up", "host", "https://gotak.app")
 
-	isDev := os.Getenv("NAT_ENV") != "production"
+	if err := cfg.validate(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "invalid config:\n%v\n", err)
+		os.Exit(1)
+	}
+	settings = cfg
+	log.Infow("Starting up", "host", settings.PublicURL)
 
 	registry := prometheus.NewRegistry()
 	exporter, err := otelprom.New(otelprom.WithRegisterer(registry))
@@ -98,19 +120,64 @@ func main() {
 		}
 	}()
 
-	if _, err := getDB(); err != nil {
-		log.Panicw("could not get db", zap.Error(err))
+	store, err := openStore(settings.DatabaseURL)
+	if err != nil {
+		log.Panicw("could not open store", zap.Error(err))
+		return
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Warnw("store shutdown", zap.Error(err))
+		}
+	}()
+	if err := store.CheckSchema(); err != nil {
+		log.Panicw("refusing to serve on a mismatched schema", zap.Error(err))
 		return
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if path := settings.Engines.Config; path != "" {
+		engines, err = ai.LoadRegistry(path)
+		if err != nil {
+			log.Panicw("could not load engines", zap.Error(err))
+			return
+		}
+	}
+	if err := loadOpeningBook(store, log); err != nil {
+		log.Warnw("could not load opening book", zap.Error(err))
+	}
+	defer func() {
+		if err := engines.Close(); err != nil {
+			log.Warnw("engine shutdown", zap.Error(err))
+		}
+	}()
+
+	limits := newRateLimiterFromConfig(settings.RateLimits, store)
+	botProtocol = newPlaytakServer(store, limits)
+	if addr := settings.PlaytakAddr; addr != "" {
+		go func() {
+			if err := botProtocol.listenAndServe(ctx, addr); err != nil {
+				log.Errorw("playtak listener", zap.Error(err))
+			}
+		}()
+	}
+
+	analysisJobs = newAnalysisQueue(store, settings.Engines.AnalysisWorkers)
+	analysisJobs.start(ctx)
+
 	metricsHandler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
 	handler := buildRouter(routerOptions{
-		IsDev:          isDev,
+		IsDev:          !settings.production(),
 		MetricsHandler: metricsHandler,
+		Playtak:        botProtocol,
+		Store:          store,
+		RateLimiter:    limits,
 	})
 
 	server := &http.Server{
-		Addr:              ":" + port,
+		Addr:              ":" + settings.Port,
 		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       15 * time.Second,
@@ -119,9 +186,6 @@ func main() {
 		MaxHeaderBytes:    1 << 20, // 1MB
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
-
 	go func() {
 		log.Infow("http server starting", "addr", server.Addr)
 		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -138,28 +202,40 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Errorw("http shutdown", zap.Error(err))
 	}
+	analysisJobs.wait()
 }
 
 // routerOptions configures buildRouter.
 type routerOptions struct {
 	IsDev          bool
 	MetricsHandler http.Handler
+	// Playtak, when set, serves the bot protocol over WebSocket at /playtak.
+	Playtak *playtakServer
+	// Store is where handlers keep games, users and analyses. Without one
+	// they fail with 500s.
+	Store Store
+	// RateLimiter applies the API's rate limits. Without one there are
+	// none.
+	RateLimiter *rateLimiter
 }
 
-// buildRouter wires the chi router with logging, CORS, security headers,
-// /metrics, and otelhttp instrumentation (excluding /metrics).
+// buildRouter wires the chi router with logging, panic recovery, CORS,
+// security headers, /metrics, and otelhttp instrumentation (excluding
+// /metrics).
 func buildRouter(opts routerOptions) http.Handler {
 	r := chi.NewRouter()
 	r.Use(logging.Middleware(log.Desugar()))
+	r.Use(recoverProblems)
 	r.Use(routeTag)
+	r.Use(withStore(opts.Store))
 
 	r.Use(cors.New(cors.Options{
 		AllowCredentials:   true,
 		OptionsPassthrough: true,
-		AllowedOrigins:     []string{"*"},
-		AllowedMethods:     []string{"GET", "POST", "OPTIONS"},
+		AllowedOrigins:     settings.CORS.AllowedOrigins,
+		AllowedMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:     []string{"Link"},
+		ExposedHeaders:     []string{"Deprecation", "Link", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
 		MaxAge:             300, // Maximum value not ignored by any of major browsers
 	}).Handler)
 
@@ -186,26 +262,23 @@ func buildRouter(opts routerOptions) http.Handler {
 		r.Get("/", rootHandler)
 		r.Get("/healthz", healthCheckHandler)
 		r.Get("/swagger/*", httpSwagger.Handler(
-			httpSwagger.URL("https://gotak.app/swagger/doc.json"),
+			httpSwagger.URL(strings.TrimSuffix(settings.PublicURL, "/")+"/swagger/doc.json"),
 		))
 
-		r.Mount("/auth", AuthRoutes())
-
-		r.Get("/game/{slug}", getGameHandler)
-		r.Get("/game/{slug}/replay", getReplayHandler)
-		r.Get("/game/{slug}/ptn", getPTNHandler)
-		r.Get("/game/{slug}/position/{turn}", getPositionHandler)
-		r.Get("/game/{slug}/{turn}", getTurnHandler)
-		r.Post("/analyze/game/{slug}", postAnalyzeHandler)
-		r.Get("/analyze/openings", getOpeningsHandler)
+		if opts.Playtak != nil {
+			r.Get("/playtak", opts.Playtak.wsHandler)
+		}
 
+		auth := AuthRoutes(opts.RateLimiter)
+		r.Route(apiVersionPrefix, func(r chi.Router) {
+			apiRoutes(r, auth, opts.RateLimiter)
+			// The admin API is new, so it has no unversioned alias.
+			r.Mount("/admin", adminRoutes(opts.RateLimiter))
+		})
+		// The API as it was before /v1, kept for old clients.
 		r.Group(func(r chi.Router) {
-			r.Use(authMiddleware)
-			r.Get("/game/new", newGameHandler)
-			r.Post("/game/new", newGameHandler)
-			r.Post("/game/{slug}/join", joinGameHandler)
-			r.Post("/game/{slug}/move", newMoveHandler)
-			r.Post("/game/{slug}/ai-move", PostAIMoveHandler)
+			r.Use(deprecatedAlias)
+			apiRoutes(r, auth, opts.RateLimiter)
 		})
 	})
 
@@ -216,6 +289,71 @@ func buildRouter(opts routerOptions) http.Handler {
 	)
 }
 
+// apiRoutes registers the versioned API on r. The operational endpoints
+// (/, /healthz, /metrics, /swagger, /playtak) aren't part of it and stay
+// unversioned. Every route spends from the general rate limit, after
+// authentication so signed-in users are limited per account; the engine
+// calls spend from a stricter one too.
+func apiRoutes(r chi.Router, auth http.Handler, limits *rateLimiter) {
+	r.Mount("/auth", auth)
+
+	api := limits.limit(settings.RateLimits.API)
+	analysis := limits.limit(settings.RateLimits.Analysis)
+
+	r.With(api).Get("/game/{slug}", getGameHandler)
+	r.With(api).Get("/game/{slug}/replay", getReplayHandler)
+	r.With(api).Get("/game/{slug}/ptn", getPTNHandler)
+	r.With(api).Get("/game/{slug}/position/{turn}", getPositionHandler)
+	r.With(optionalAuthMiddleware, requireScope(scopeAnalyze), api, analysis).Get("/game/{slug}/position/{turn}/analysis", getPositionAnalysisHandler)
+	r.With(api).Get("/game/{slug}/{turn}", getTurnHandler)
+	r.With(optionalAuthMiddleware, requireScope(scopeAnalyze), api, analysis).Post("/analyze/game/{slug}", postAnalyzeHandler)
+	r.With(optionalAuthMiddleware, requireScope(scopeAnalyze), api, analysis).Post("/analyze/position", postAnalyzePositionHandler)
+	r.With(optionalAuthMiddleware, requireScope(scopeAnalyze), api).Get("/analyze/jobs/{id}", getAnalysisJobHandler)
+	r.With(optionalAuthMiddleware, requireScope(scopeAnalyze), api).Delete("/analyze/jobs/{id}", cancelAnalysisJobHandler)
+	r.With(api).Get("/analyze/openings", getOpeningsHandler)
+	r.With(api).Get("/ai/engines", getEnginesHandler)
+	r.With(api).Get("/leaderboard", getLeaderboardHandler)
+	r.With(optionalAuthMiddleware, requireScope(scopePlay), api).Get("/puzzles/next", getNextPuzzleHandler)
+	r.With(optionalAuthMiddleware, requireScope(scopePlay), api).Post("/puzzles/{id}/attempt", postPuzzleAttemptHandler)
+
+	r.Group(func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Use(requireScope(scopePlay))
+		r.Use(api)
+		r.Get("/game/new", newGameHandler)
+		r.Post("/game/new", newGameHandler)
+		r.Post("/game/{slug}/join", joinGameHandler)
+		r.Post("/game/{slug}/move", newMoveHandler)
+		r.With(limits.limit(settings.RateLimits.AI)).Post("/game/{slug}/ai-move", PostAIMoveHandler)
+	})
+}
+
+// apiVersionPrefix is where the current API version is mounted.
+const apiVersionPrefix = "/v1"
+
+// unversionedDeprecatedAt is when the unversioned API paths were
+// deprecated in favour of /v1.
+var unversionedDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// deprecatedAlias marks a response from an unversioned API path as
+// deprecated (RFC 9745) and links the /v1 path that replaces it.
+func deprecatedAlias(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", unversionedDeprecatedAt.Unix()))
+		w.Header().Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", apiVersionPrefix, r.URL.Path))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// versionedPath is path under the API version r was made to, so links
+// from a deprecated unversioned path stay unversioned.
+func versionedPath(r *http.Request, path string) string {
+	if strings.HasPrefix(r.URL.Path, apiVersionPrefix+"/") {
+		return apiVersionPrefix + path
+	}
+	return path
+}
+
 // routeTag stamps the chi route pattern onto otelhttp metric labels.
 func routeTag(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -331,8 +469,23 @@ func writeStaticHomePage(l *zap.SugaredLogger, w http.ResponseWriter) {
 
 // CreateGameRequest represents the request body for creating a new game
 type CreateGameRequest struct {
-	Size string `json:"size" example:"8" description:"Board size (4-9)"`
+	Size string `json:"size" example:"8" description:"Board size (4-9 unless the server allows fewer)"`
 	Mode string `json:"mode" example:"human" description:"Opponent mode: human or ai"`
+	// Engine picks the AI engine for mode "ai" (see GET /v1/ai/engines).
+	Engine string `json:"engine,omitempty" example:"minimax" description:"AI engine name; default engine when empty"`
+}
+
+func (req *CreateGameRequest) validate() []FieldError {
+	var out []FieldError
+	if req.Size != "" {
+		if size, err := strconv.Atoi(req.Size); err != nil || !settings.allowsBoardSize(size) {
+			out = append(out, FieldError{Field: "size", Message: fmt.Sprintf("must be one of the board sizes %v", settings.Games.BoardSizes)})
+		}
+	}
+	if _, err := normalizeGameMode(req.Mode); err != nil {
+		out = append(out, FieldError{Field: "mode", Message: `must be "human" or "ai"`})
+	}
+	return out
 }
 
 // @Summary Create a new game
@@ -343,60 +496,68 @@ type CreateGameRequest struct {
 // @Param game body CreateGameRequest false "Game configuration"
 // @Success 201 {object} GameStateResponse
 // @Success 307 {string} string "Redirect to game URL"
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /game/new [get]
-// @Router /game/new [post]
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /v1/game/new [get]
+// @Router /v1/game/new [post]
 func newGameHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
 
 	user := getMustUserFromContext(r)
 	userID := user.ID
 
-	boardSize := 8
-	mode := "human"
-
 	var data CreateGameRequest
-	if err := json.NewDecoder(r.Body).Decode(&data); err == nil {
-		if data.Size != "" {
-			i, err := strconv.Atoi(data.Size)
-			if err == nil && i > 0 {
-				boardSize = i
-			}
-		}
-		if data.Mode != "" {
-			mode = data.Mode
+	if err := decodeRequest(r, &data); err != nil {
+		l.Warnw("invalid new game request", zap.Error(err))
+		writeProblem(w, r, err)
+		return
+	}
+	boardSize := settings.Games.DefaultSize
+	if data.Size != "" {
+		boardSize, _ = strconv.Atoi(data.Size)
+	}
+
+	engineName := ""
+	if m, _ := normalizeGameMode(data.Mode); m == "ai" {
+		_, info, err := selectEngine(data.Engine, int64(boardSize), false)
+		if err != nil {
+			l.Warnw("unusable engine for new game", "engine", data.Engine, zap.Error(err))
+			writeProblem(w, r, invalidRequest(FieldError{Field: "engine", Message: err.Error()}))
+			return
 		}
+		engineName = info.Name
 	}
 
-	slug, err := createGame(db, boardSize, userID, mode)
+	slug, err := store.CreateGame(boardSize, userID, data.Mode)
 	if err != nil {
 		l.Errorw("could not create game", zap.Error(err))
-		status := http.StatusInternalServerError
-		if errors.Is(err, errInvalidGameMode) {
-			status = http.StatusBadRequest
-		}
-		if err := Renderer.JSON(w, status, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, internalError("could not create game", err))
 		return
 	}
 
+	if engineName != "" {
+		if err := store.UpdateTag(slug, "Engine", engineName); err != nil {
+			l.Errorw("could not record game engine", "slug", slug, zap.Error(err))
+			writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not create game"))
+			return
+		}
+	}
+
 	if wantsJSON(r) {
-		state, err := buildGameStateResponse(db, slug)
+		state, err := buildGameStateResponse(store, slug)
 		if err != nil {
 			l.Errorw("could not build game state after create", "slug", slug, zap.Error(err))
-			if err := Renderer.JSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()}); err != nil {
-				l.Errorw("failed to render JSON", zap.Error(err))
-			}
+			writeProblem(w, r, internalError("could not build game state", err))
 			return
 		}
 		if err := Renderer.JSON(w, http.StatusCreated, state); err != nil {
@@ -405,7 +566,14 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/game/%s", slug), http.StatusTemporaryRedirect)
+	http.Redirect(w, r, versionedPath(r, "/game/"+slug), http.StatusTemporaryRedirect)
+}
+
+// JoinGameResponse confirms joining a game and the side the caller plays.
+type JoinGameResponse struct {
+	Message string `json:"message" example:"successfully joined game"`
+	Slug    string `json:"slug" example:"abc123"`
+	Player  string `json:"player" example:"black"`
 }
 
 // @Summary Join a waiting game
@@ -414,50 +582,51 @@ func newGameHandler(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param slug path string true "Game slug identifier"
-// @Success 200 {object} MessageResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 403 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /game/{slug}/join [post]
+// @Success 200 {object} JoinGameResponse
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /v1/game/{slug}/join [post]
 func joinGameHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
-
 	slug := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "slug"))
 
 	user := getMustUserFromContext(r)
 
-	err = joinGame(db, slug, user.ID)
+	err = store.JoinGame(slug, user.ID)
 	if err != nil {
 		l.Errorw("could not join game", "slug", slug, "user_id", user.ID, zap.Error(err))
 
-		statusCode := 500
-		if strings.Contains(err.Error(), "already") || strings.Contains(err.Error(), "full") {
-			statusCode = 400
-		} else if strings.Contains(err.Error(), "can only join") {
-			statusCode = 400
-		}
-
-		if err := Renderer.JSON(w, statusCode, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
+		// joinGame's own refusals are safe to show; anything else is a
+		// database failure.
+		problem := internalError("could not join game", err)
+		switch msg := err.Error(); {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			problem = gameLoadError(err)
+		case strings.Contains(msg, "already"), strings.Contains(msg, "full"), strings.Contains(msg, "can only join"):
+			problem = newAPIError(http.StatusBadRequest, msg)
 		}
+		writeProblem(w, r, problem)
 		return
 	}
 
 	l.Infow("user joined game", "slug", slug, "user_id", user.ID)
 
-	if err := Renderer.JSON(w, 200, map[string]string{
-		"message": "successfully joined game",
-		"slug":    slug,
-		"player":  "black",
+	if err := Renderer.JSON(w, http.StatusOK, JoinGameResponse{
+		Message: "successfully joined game",
+		Slug:    slug,
+		Player:  "black",
 	}); err != nil {
 		l.Errorw("failed to render JSON", zap.Error(err))
 	}
@@ -468,143 +637,213 @@ type MoveRequest struct {
 	Player int    `json:"player" example:"1" description:"Player number (1 or 2)"`
 	Text   string `json:"move" example:"c3" description:"Move in PTN notation"`
 	Turn   int64  `json:"turn" example:"1" description:"Turn number"`
+	// IdempotencyKey lets a client retry a submission safely: a move
+	// already recorded in the game under the same key is not played again.
+	IdempotencyKey string `json:"idempotency_key,omitempty" example:"5f0c2a9e-move-7" description:"Client-chosen key making retries safe"`
+}
+
+// maxIdempotencyKey is the longest idempotency key a move can carry.
+const maxIdempotencyKey = 128
+
+func (req *MoveRequest) validate() []FieldError {
+	var out []FieldError
+	if req.Player != gotak.PlayerWhite && req.Player != gotak.PlayerBlack {
+		out = append(out, FieldError{Field: "player", Message: "must be 1 or 2"})
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		out = append(out, FieldError{Field: "move", Message: "is required"})
+	}
+	if len(req.IdempotencyKey) > maxIdempotencyKey {
+		out = append(out, FieldError{Field: "idempotency_key", Message: fmt.Sprintf("must be at most %d bytes", maxIdempotencyKey)})
+	}
+	return out
 }
 
 // @Summary Make a move in a game
-// @Description Submit a move for a specific game
+// @Description Submit a move for a specific game. A move that races another
+// @Description change to the game gets a 409. Resubmitting with the same
+// @Description idempotency_key returns the game without playing the move again.
 // @Tags game
 // @Accept json
 // @Produce json
 // @Param slug path string true "Game slug identifier"
 // @Param move body MoveRequest true "Move details"
 // @Success 200 {object} GameStateResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /game/{slug}/move [post]
+// @Failure 400 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 403 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Security BearerAuth
+// @Router /v1/game/{slug}/move [post]
 func newMoveHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
-
 	user := getMustUserFromContext(r)
 
 	slug := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "slug"))
 
-	if err := verifyGameParticipation(db, slug, user.ID); err != nil {
-		l.Errorw("game participation verification failed", "slug", slug, "user_id", user.ID, zap.Error(err))
-		if err := Renderer.JSON(w, 403, map[string]string{"error": "access denied: you are not a participant in this game"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	var data MoveRequest
+	if err := decodeRequest(r, &data); err != nil {
+		l.Warnw("invalid move request", zap.Error(err))
+		writeProblem(w, r, err)
 		return
 	}
 
-	game, err := getGame(db, slug)
+	game, err := store.SubmitMove(slug, user.ID, data.Player, data.Text, data.IdempotencyKey)
 	if err != nil {
-		l.Errorw("could not get game", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		l.Errorw("move rejected", "slug", slug, "user_id", user.ID, "move", data.Text, "player", data.Player, zap.Error(err))
+		writeProblem(w, r, err)
 		return
 	}
+	botProtocol.moveMade(game, data.Player, data.Text)
 
-	var data MoveRequest
-
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		l.Errorw("could not read body", zap.Error(err))
-		if err := Renderer.JSON(w, 400, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+	state, err := buildGameStateResponse(store, slug)
+	if err != nil {
+		l.Errorw("could not build game state", "slug", slug, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not build game state"))
 		return
 	}
 
-	if data.Text == "" {
-		l.Errorw("empty request", "data", data)
-		if err := Renderer.JSON(w, 400, map[string]string{"error": "empty move text"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+	if err := Renderer.JSON(w, http.StatusOK, state); err != nil {
+		l.Errorw("failed to render JSON", zap.Error(err))
 	}
+}
 
-	if data.Player != gotak.PlayerWhite && data.Player != gotak.PlayerBlack {
-		l.Errorw("invalid player", "player", data.Player)
-		if err := Renderer.JSON(w, 400, map[string]string{"error": "invalid player"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+// errMoveConflict means the game changed between reading it and recording
+// a move; the move was not recorded.
+var errMoveConflict = errors.New("game changed while the move was being made")
+
+// submitMove validates and records one half-move by userID in slug. It is
+// the move pipeline shared by the HTTP API and the playtak bot protocol,
+// and returns the game after the move. A non-empty key makes the
+// submission idempotent: a move already recorded in the game under the
+// same key is returned instead of being played again.
+func submitMove(db *gorm.DB, slug string, userID int64, player int, text, key string) (*gotak.Game, error) {
+	if text == "" {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeInvalidMove, detail: "empty move text"}
 	}
 
-	userPlayerNumber, err := getPlayerNumber(db, slug, user.ID)
-	if err != nil {
-		l.Errorw("could not get player number", "slug", slug, "user_id", user.ID, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "internal server error"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+	if player != gotak.PlayerWhite && player != gotak.PlayerBlack {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeInvalidMove, detail: "invalid player"}
 	}
 
-	if data.Player != userPlayerNumber {
-		l.Errorw("player mismatch", "requested_player", data.Player, "user_player", userPlayerNumber)
-		if err := Renderer.JSON(w, 403, map[string]string{"error": "you can only make moves as your assigned player"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
+	var game *gotak.Game
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var dbGame Game
+		if err := tx.Where("slug = ?", slug).First(&dbGame).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &apiError{status: http.StatusForbidden, code: codeNotParticipant, detail: "access denied: you are not a participant in this game", err: err}
+			}
+			return internalError("could not verify game state", err)
 		}
-		return
-	}
 
-	var dbGame Game
-	if err := db.Where("slug = ?", slug).First(&dbGame).Error; err != nil {
-		l.Errorw("could not get game state", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not verify game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
+		userPlayerNumber := dbGame.playerOf(userID)
+		if userPlayerNumber == gotak.PlayerNone {
+			return &apiError{status: http.StatusForbidden, code: codeNotParticipant, detail: "access denied: you are not a participant in this game"}
 		}
-		return
-	}
 
-	if dbGame.CurrentPlayer != data.Player {
-		l.Errorw("not player's turn", "current_player", dbGame.CurrentPlayer, "requested_player", data.Player)
-		if err := Renderer.JSON(w, 400, map[string]string{"error": "it's not your turn"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
+		if key != "" {
+			var done bool
+			var err error
+			if game, done, err = idempotentMove(tx, &dbGame, player, text, key); done || err != nil {
+				return err
+			}
 		}
-		return
-	}
 
-	winner, gameOver := game.GameOver()
-	if gameOver {
-		l.Errorw("game already over", "winner", winner)
-		if err := Renderer.JSON(w, 400, map[string]string{"error": fmt.Sprintf("game is over, winner: %d", winner)}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
+		if player != userPlayerNumber {
+			return &apiError{status: http.StatusForbidden, code: codeNotParticipant, detail: "you can only make moves as your assigned player"}
+		}
+
+		var err error
+		game, err = recordMove(tx, &dbGame, player, text, key)
+		return err
+	})
+	if errors.Is(err, errMoveConflict) && key != "" {
+		// A concurrent retry of the same submission may have won the race.
+		var dbGame Game
+		if db.Where("slug = ?", slug).First(&dbGame).Error == nil {
+			if replayed, done, retryErr := idempotentMove(db, &dbGame, player, text, key); done && retryErr == nil {
+				return replayed, nil
+			}
 		}
-		return
 	}
+	if err != nil {
+		return nil, moveError(err)
+	}
+	return game, nil
+}
 
-	err = replayMoves(game)
+// moveError is the problem a failed move is reported as: a conflict is a
+// 409 the client can retry after reloading.
+func moveError(err error) error {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae
+	}
+	if errors.Is(err, errMoveConflict) {
+		return &apiError{status: http.StatusConflict, code: codeMoveConflict, detail: "the game changed while your move was being made; reload and try again", err: err}
+	}
+	return internalError("could not save move", err)
+}
+
+// idempotentMove looks for a move recorded in dbGame under key. done
+// reports that one was found, in which case game is the game as it stands;
+// a key recorded for a different move is an error.
+func idempotentMove(db *gorm.DB, dbGame *Game, player int, text, key string) (game *gotak.Game, done bool, err error) {
+	var prior Move
+	err = db.Where("game_id = ? AND idempotency_key = ?", dbGame.ID, key).First(&prior).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
 	if err != nil {
-		l.Errorw("could not replay moves", zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not replay game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+		return nil, false, internalError("could not check idempotency key", err)
+	}
+	if prior.Player != player || prior.Text != text {
+		return nil, true, &apiError{status: http.StatusConflict, code: codeIdempotencyReuse, detail: "idempotency key was already used for a different move"}
+	}
+	game, err = getGame(db, dbGame.Slug)
+	if err != nil {
+		return nil, true, internalError("could not reload game state", err)
 	}
+	return game, true, nil
+}
 
-	err = game.DoSingleMove(data.Text, data.Player)
+// recordMove plays text as player's half-move on dbGame and stores it. It
+// is meant to run inside a transaction: the games row is only updated if
+// its version still matches dbGame's, so a move made from a stale read
+// fails with errMoveConflict and the transaction rolls back. It returns
+// the game after the move, with its board replayed.
+func recordMove(tx *gorm.DB, dbGame *Game, player int, text, key string) (*gotak.Game, error) {
+	// A game can be finished without a road or flat win on the board, by
+	// adjudication for one.
+	if dbGame.Status == "finished" {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeGameOver, detail: fmt.Sprintf("game is over, winner: %d", dbGame.Winner)}
+	}
+	if dbGame.CurrentPlayer != player {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeNotYourTurn, detail: "it's not your turn"}
+	}
+
+	game, err := getGame(tx, dbGame.Slug)
 	if err != nil {
-		l.Errorw("invalid move", "move", data.Text, "player", data.Player, zap.Error(err))
-		if err := Renderer.JSON(w, 400, map[string]string{"error": fmt.Sprintf("invalid move: %v", err)}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+		return nil, internalError("could not get game", err)
 	}
 
-	// Store the move in database - determine which turn this move belongs to.
-	// Check if we need to complete an existing turn or start a new one.
-	var currentTurn int64 = 1
+	winner, gameOver := game.GameOver()
+	if gameOver {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeGameOver, detail: fmt.Sprintf("game is over, winner: %d", winner)}
+	}
 
+	// Work out which turn the move belongs to before DoSingleMove appends
+	// it: complete an open turn or start a new one.
+	var currentTurn int64 = 1
 	if len(game.Turns) > 0 {
 		lastTurn := game.Turns[len(game.Turns)-1]
 		if lastTurn.First != nil && lastTurn.Second == nil {
@@ -614,101 +853,80 @@ func newMoveHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := insertMove(db, game.ID, data.Player, data.Text, currentTurn); err != nil {
-		l.Errorw("could not insert move", "data", data, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not save move"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+	if err := game.DoSingleMove(text, player); err != nil {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeInvalidMove, detail: fmt.Sprintf("invalid move: %v", err)}
 	}
 
-	// Reload the game state to get updated turns from database.
-	game, err = getGame(db, slug)
-	if err != nil {
-		l.Errorw("could not reload game after move", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not reload game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+	move := Move{GameID: dbGame.ID, Player: player, Text: text, Turn: currentTurn}
+	if key != "" {
+		move.IdempotencyKey = &key
 	}
-
-	// Update current player to switch turns.
-	var nextPlayer int
-	if len(game.Turns) > 0 {
-		lastTurn := game.Turns[len(game.Turns)-1]
-		if lastTurn.First != nil && lastTurn.Second != nil {
-			nextPlayer = gotak.PlayerWhite
-		} else {
-			if data.Player == gotak.PlayerWhite {
-				nextPlayer = gotak.PlayerBlack
-			} else {
-				nextPlayer = gotak.PlayerWhite
-			}
-		}
-	} else {
-		nextPlayer = gotak.PlayerWhite
+	if err := tx.Create(&move).Error; err != nil {
+		return nil, internalError("could not save move", err)
 	}
-
-	if err := db.Model(&Game{}).Where("slug = ?", slug).Update("current_player", nextPlayer).Error; err != nil {
-		l.Errorw("could not update current player", "slug", slug, "next_player", nextPlayer, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not update turn"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+	if err := savePosition(tx, dbGame.ID, game); err != nil {
+		return nil, internalError("could not save position", err)
 	}
 
-	winner, gameOver = game.GameOver()
-	if gameOver {
-		err = updateGameStatus(db, game.Slug, winner)
-		if err != nil {
-			l.Errorw("could not update game status", zap.Error(err))
-		}
+	// White moves first in every turn, so a completed turn hands the move
+	// back to White.
+	nextPlayer := gotak.PlayerWhite
+	lastTurn := game.Turns[len(game.Turns)-1]
+	if lastTurn.Second == nil && player == gotak.PlayerWhite {
+		nextPlayer = gotak.PlayerBlack
 	}
-
-	state, err := buildGameStateResponse(db, slug)
-	if err != nil {
-		l.Errorw("could not build game state", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": "could not build game state"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
-		return
+	updates := map[string]any{
+		"current_player": nextPlayer,
+		"version":        gorm.Expr("version + 1"),
 	}
-
-	if err := Renderer.JSON(w, http.StatusOK, state); err != nil {
-		l.Errorw("failed to render JSON", zap.Error(err))
+	if winner, gameOver := game.GameOver(); gameOver {
+		updates["status"] = "finished"
+		updates["winner"] = winner
+	}
+	result := tx.Model(&Game{}).Where("id = ? AND version = ?", dbGame.ID, dbGame.Version).Updates(updates)
+	if result.Error != nil {
+		return nil, internalError("could not update turn", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, errMoveConflict
 	}
+
+	return game, nil
 }
 
 // @Summary Get game state
-// @Description Returns the current state of a game
+// @Description Returns the current state of a game. With threats=true it
+// @Description also lists each player's road threats and any forced road
+// @Description win (Tinuë) for the player to move.
 // @Tags game
 // @Accept json
 // @Produce json
 // @Param slug path string true "Game slug identifier"
+// @Param threats query bool false "Include road threats"
 // @Success 200 {object} GameStateResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /game/{slug} [get]
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/game/{slug} [get]
 func getGameHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
-
 	slug := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "slug"))
-	state, err := buildGameStateResponse(db, slug)
+	state, err := buildGameStateResponse(store, slug)
 	if err != nil {
 		l.Errorw("could not get game", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, gameLoadError(err))
 		return
 	}
+	if threats, _ := strconv.ParseBool(r.URL.Query().Get("threats")); threats {
+		state.Threats = newThreatReport(state.Game)
+	}
 
 	if err := Renderer.JSON(w, http.StatusOK, state); err != nil {
 		l.Errorw("failed to render JSON", zap.Error(err))
@@ -723,45 +941,40 @@ func getGameHandler(w http.ResponseWriter, r *http.Request) {
 // @Param slug path string true "Game slug identifier"
 // @Param turn path int true "Turn number"
 // @Success 200 {object} gotak.Turn
-// @Failure 500 {object} ErrorResponse
-// @Router /game/{slug}/{turn} [get]
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/game/{slug}/{turn} [get]
 func getTurnHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if err := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
 
 	slug := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "slug"))
-	game, err := getGame(db, slug)
+	game, err := store.Game(slug)
 	if err != nil {
 		l.Errorw("could not get game", "slug", slug, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		writeProblem(w, r, gameLoadError(err))
 		return
 	}
 
 	turnStr := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "turn"))
 	turnNum, err := strconv.ParseInt(turnStr, 10, 0)
 	if err != nil {
-		l.Errorw("could not parse turn", "slug", slug, "turn", turnStr, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		l.Warnw("could not parse turn", "slug", slug, "turn", turnStr, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "turn must be an integer"))
 		return
 	}
 	turn, err := game.GetTurn(turnNum)
 	if err != nil {
-		l.Errorw("could not get turn", "slug", slug, "turn", turnNum, zap.Error(err))
-		if err := Renderer.JSON(w, 500, map[string]string{"error": err.Error()}); err != nil {
-			l.Errorw("failed to render JSON", zap.Error(err))
-		}
+		l.Warnw("could not get turn", "slug", slug, "turn", turnNum, zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusNotFound, fmt.Sprintf("game has no turn %d", turnNum)))
 		return
 	}
 
@@ -790,10 +1003,5 @@ func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func notFoundHandler(w http.ResponseWriter, r *http.Request) {
-	l := logging.FromContext(r.Context())
-	if err := Renderer.JSON(w, http.StatusNotFound, ErrorResponse{
-		Error: "404: This page could not be found",
-	}); err != nil {
-		l.Errorw("failed to render JSON", zap.Error(err))
-	}
+	writeProblem(w, r, newAPIError(http.StatusNotFound, "404: This page could not be found"))
 }
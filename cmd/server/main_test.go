@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/icco/gotak"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel"
 	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"gorm.io/gorm"
 )
 
 func TestHealthCheckHandler(t *testing.T) {
@@ -42,7 +51,7 @@ func TestHealthCheckHandler(t *testing.T) {
 // TestMetricsEndpoint asserts otelhttp's HTTP server histogram lands
 // in /metrics tagged with the chi route pattern.
 func TestMetricsEndpoint(t *testing.T) {
-	t.Setenv("AUTH_JWT_SECRET", "test-secret")
+	useTestSettings(t)
 
 	reg := prometheus.NewRegistry()
 	exporter, err := otelprom.New(otelprom.WithRegisterer(reg))
@@ -105,3 +114,217 @@ func TestMetricsEndpoint(t *testing.T) {
 		}
 	}
 }
+
+// setupMoveGame starts a game of the given size between two users in a
+// migrated SQLite file at url, which unlike :memory: is shared by every
+// pooled connection.
+func setupMoveGame(t *testing.T, url string, size int) (*gorm.DB, string, *User, *User) {
+	t.Helper()
+	store, err := openStore(url)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	db := storeDB(store)
+	if _, err := migrateUp(db); err != nil {
+		t.Fatalf("migrateUp: %v", err)
+	}
+
+	white := &User{Provider: "local", ProviderID: "white", Email: "white@example.com", Name: "White"}
+	black := &User{Provider: "local", ProviderID: "black", Email: "black@example.com", Name: "Black"}
+	for _, u := range []*User{white, black} {
+		if err := store.CreateUser(u); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	slug, err := store.CreateGame(size, white.ID, "human")
+	if err != nil {
+		t.Fatalf("CreateGame: %v", err)
+	}
+	if err := joinGame(db, slug, black.ID); err != nil {
+		t.Fatalf("joinGame: %v", err)
+	}
+	return db, slug, white, black
+}
+
+// testSQLiteURL names a new SQLite file for the test.
+func testSQLiteURL(t *testing.T) string {
+	return "sqlite:" + filepath.Join(t.TempDir(), "gotak.db")
+}
+
+// TestSubmitMoveConcurrent has the player to move submit many different
+// moves at once, every ply: exactly one of them may be recorded.
+func TestSubmitMoveConcurrent(t *testing.T) {
+	db, slug, white, black := setupMoveGame(t, testSQLiteURL(t), 6)
+
+	var squares []string
+	for _, file := range "abcdef" {
+		for rank := 1; rank <= 6; rank++ {
+			squares = append(squares, fmt.Sprintf("%c%d", file, rank))
+		}
+	}
+
+	const plies, racers = 10, 8
+	for ply := range plies {
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			played []string
+			start  = make(chan struct{})
+		)
+		user, player := white, gotak.PlayerWhite
+		if ply%2 == 1 {
+			user, player = black, gotak.PlayerBlack
+		}
+		for _, square := range squares[:racers] {
+			wg.Go(func() {
+				<-start
+				_, err := submitMove(db, slug, user.ID, player, square, "")
+				var ae *apiError
+				switch {
+				case err == nil:
+					mu.Lock()
+					played = append(played, square)
+					mu.Unlock()
+				case !errors.As(err, &ae) || (ae.status != http.StatusBadRequest && ae.status != http.StatusConflict):
+					t.Errorf("ply %d: %s: %v", ply, square, err)
+				}
+			})
+		}
+		close(start)
+		wg.Wait()
+		if len(played) != 1 {
+			t.Fatalf("ply %d: recorded %v, want exactly one move", ply, played)
+		}
+		squares = slices.DeleteFunc(squares, func(s string) bool { return s == played[0] })
+	}
+
+	var count int64
+	if err := db.Model(&Move{}).Count(&count).Error; err != nil || count != plies {
+		t.Errorf("stored %d moves, %v; want %d", count, err, plies)
+	}
+	var record Game
+	if err := db.Where("slug = ?", slug).First(&record).Error; err != nil {
+		t.Fatalf("load game: %v", err)
+	}
+	if record.CurrentPlayer != gotak.PlayerWhite || record.Version != plies {
+		t.Errorf("current player %d, version %d; want white, %d", record.CurrentPlayer, record.Version, plies)
+	}
+	game, err := getGame(db, slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+	if len(game.Turns) != plies/2 {
+		t.Errorf("%d turns, want %d", len(game.Turns), plies/2)
+	}
+	for i, turn := range game.Turns {
+		if turn.First == nil || turn.Second == nil {
+			t.Errorf("turn %d is incomplete: %+v", i+1, turn)
+		}
+	}
+}
+
+func TestSubmitMoveIdempotencyKey(t *testing.T) {
+	db, slug, white, black := setupMoveGame(t, testSQLiteURL(t), 6)
+
+	// Retries of one submission, all in flight at once, play it once.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, err := submitMove(db, slug, white.ID, gotak.PlayerWhite, "a1", "white-1"); err != nil {
+				t.Errorf("submission: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	game, err := submitMove(db, slug, white.ID, gotak.PlayerWhite, "a1", "white-1")
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if len(game.Turns) != 1 || game.Turns[0].First.Text != "a1" || game.Turns[0].Second != nil {
+		t.Errorf("turns after retries = %+v", game.Turns)
+	}
+
+	var ae *apiError
+	if _, err := submitMove(db, slug, white.ID, gotak.PlayerWhite, "b1", "white-1"); !errors.As(err, &ae) || ae.code != codeIdempotencyReuse {
+		t.Errorf("reused key for another move = %v, want 409", err)
+	}
+	if _, err := submitMove(db, slug, black.ID, gotak.PlayerBlack, "f6", "black-1"); err != nil {
+		t.Errorf("black's move: %v", err)
+	}
+	var count int64
+	if err := db.Model(&Move{}).Count(&count).Error; err != nil || count != 2 {
+		t.Errorf("stored %d moves, %v; want 2", count, err)
+	}
+}
+
+// TestRecordMoveOutdatedVersion records a move from a games row read
+// before the opponent's move committed: the version check refuses it, and
+// the client gets a 409.
+func TestRecordMoveOutdatedVersion(t *testing.T) {
+	db, slug, white, black := setupMoveGame(t, testSQLiteURL(t), 6)
+	if _, err := submitMove(db, slug, white.ID, gotak.PlayerWhite, "a1", ""); err != nil {
+		t.Fatalf("white's move: %v", err)
+	}
+
+	var stale Game
+	if err := db.Where("slug = ?", slug).First(&stale).Error; err != nil {
+		t.Fatalf("load game: %v", err)
+	}
+	if _, err := submitMove(db, slug, black.ID, gotak.PlayerBlack, "f6", ""); err != nil {
+		t.Fatalf("black's move: %v", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := recordMove(tx, &stale, gotak.PlayerBlack, "e6", "")
+		return err
+	})
+	if !errors.Is(err, errMoveConflict) {
+		t.Fatalf("move at version %d = %v, want a conflict", stale.Version, err)
+	}
+
+	w := httptest.NewRecorder()
+	writeProblem(w, httptest.NewRequest(http.MethodPost, "/game/"+slug+"/move", nil), moveError(err))
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	if w.Code != http.StatusConflict || p.Code != codeMoveConflict {
+		t.Errorf("response = %d %q, want 409 %q", w.Code, p.Code, codeMoveConflict)
+	}
+
+	var count int64
+	if err := db.Model(&Move{}).Count(&count).Error; err != nil || count != 2 {
+		t.Errorf("stored %d moves, %v; want 2", count, err)
+	}
+}
+
+// TestRecordMoveStaleRead records a move from a games row read before the
+// game changed, as a move in flight when the opponent resigns would be.
+func TestRecordMoveStaleRead(t *testing.T) {
+	db, slug, white, _ := setupMoveGame(t, testSQLiteURL(t), 6)
+	if _, err := submitMove(db, slug, white.ID, gotak.PlayerWhite, "a1", ""); err != nil {
+		t.Fatalf("submitMove: %v", err)
+	}
+
+	var stale Game
+	if err := db.Where("slug = ?", slug).First(&stale).Error; err != nil {
+		t.Fatalf("load game: %v", err)
+	}
+	if err := updateGameStatus(db, slug, gotak.PlayerBlack); err != nil {
+		t.Fatalf("updateGameStatus: %v", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := recordMove(tx, &stale, gotak.PlayerBlack, "f6", "")
+		return err
+	})
+	if !errors.Is(err, errMoveConflict) {
+		t.Fatalf("stale move = %v, want a conflict", err)
+	}
+	var count int64
+	if err := db.Model(&Move{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("stored %d moves, %v; the stale move should be rolled back", count, err)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the schema, one directory per SQL dialect. Each
+// migration is a pair of files, NNNN_name.up.sql and NNNN_name.down.sql,
+// applied in version order. Released migrations are never edited; a
+// change to the schema is a new migration for every dialect.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migration is one versioned schema change.
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// schemaMigration records an applied migration in schema_migrations.
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// migrationState is a known migration and when it was applied, if it was.
+type migrationState struct {
+	migration
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the migrations for dialect ("postgres" or
+// "sqlite"), oldest first.
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s", dialect)
+	}
+
+	byVersion := map[int64]*migration{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".sql")
+		if !ok {
+			continue
+		}
+		name, direction, _ := strings.Cut(name, ".")
+		number, title, ok := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(number, 10, 64)
+		if !ok || err != nil || version <= 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("bad migration file name %s", e.Name())
+		}
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	out := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// sqlStatements splits a migration into statements: each ends with a
+// semicolon at the end of a line. Lines starting with -- are comments.
+func sqlStatements(src string) []string {
+	var (
+		out []string
+		b   strings.Builder
+	)
+	for line := range strings.Lines(src) {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		b.WriteString(line)
+		if strings.HasSuffix(trimmed, ";") {
+			out = append(out, strings.TrimSpace(b.String()))
+			b.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(b.String()); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+// migrationsFor loads db's migrations and the versions applied to it,
+// creating schema_migrations if it doesn't exist yet.
+func migrationsFor(db *gorm.DB) ([]migration, map[int64]schemaMigration, error) {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+  version bigint PRIMARY KEY,
+  name text NOT NULL,
+  applied_at timestamp NOT NULL
+)`).Error; err != nil {
+		return nil, nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return migrations, applied, nil
+}
+
+// migrateUp applies every pending migration to db, each in its own
+// transaction, and returns the ones it applied.
+func migrateUp(db *gorm.DB) ([]migration, error) {
+	migrations, applied, err := migrationsFor(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range sqlStatements(m.Up) {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// migrateDown rolls back the last steps applied migrations, newest first,
+// and returns the ones it rolled back.
+func migrateDown(db *gorm.DB, steps int) ([]migration, error) {
+	migrations, applied, err := migrationsFor(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range sqlStatements(m.Down) {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("roll back migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// migrationStatus lists the known migrations and when each was applied,
+// along with any applied versions this server doesn't know, which a newer
+// release left behind.
+func migrationStatus(db *gorm.DB) ([]migrationState, []schemaMigration, error) {
+	migrations, applied, err := migrationsFor(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	states := make([]migrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].migration = m
+		if row, ok := applied[m.Version]; ok {
+			states[i].AppliedAt = &row.AppliedAt
+			delete(applied, m.Version)
+		}
+	}
+	unknown := make([]schemaMigration, 0, len(applied))
+	for _, row := range applied {
+		unknown = append(unknown, row)
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return states, unknown, nil
+}
+
+// checkSchema returns an error unless db has exactly the migrations this
+// server knows applied.
+func checkSchema(db *gorm.DB) error {
+	states, unknown, err := migrationStatus(db)
+	if err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		versions := make([]string, len(unknown))
+		for i, row := range unknown {
+			versions[i] = strconv.FormatInt(row.Version, 10)
+		}
+		return fmt.Errorf("database has migrations this server doesn't know (%s); it was migrated by a newer release", strings.Join(versions, ", "))
+	}
+	var pending []string
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending = append(pending, strconv.FormatInt(s.Version, 10))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database is missing migrations %s; run `server migrate up`", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+const migrateUsage = "usage: server migrate up | down [steps] | status"
+
+// runMigrate is the migrate subcommand: it applies, rolls back or lists
+// migrations on the database at url and reports to out.
+func runMigrate(out io.Writer, url string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			return errors.New(migrateUsage)
+		}
+	case "down":
+		if len(args) > 2 {
+			return errors.New(migrateUsage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down needs a positive number of steps, not %q", args[1])
+			}
+			steps = n
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	store, err := openStore(url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+
+	switch args[0] {
+	case "up":
+		done, err := store.Migrate()
+		for _, m := range done {
+			_, _ = fmt.Fprintf(out, "applied %04d %s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			_, _ = fmt.Fprintln(out, "schema is up to date")
+		}
+		return err
+	case "down":
+		done, err := store.Rollback(steps)
+		for _, m := range done {
+			_, _ = fmt.Fprintf(out, "rolled back %04d %s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			_, _ = fmt.Fprintln(out, "no migrations to roll back")
+		}
+		return err
+	}
+
+	states, unknown, err := store.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, s := range states {
+		status := "pending"
+		if s.AppliedAt != nil {
+			status = "applied " + s.AppliedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, status)
+	}
+	for _, row := range unknown {
+		_, _ = fmt.Fprintf(tw, "%04d\t%s\tapplied %s, unknown to this server\n", row.Version, row.Name, row.AppliedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// models are the tables the migrations create.
+var models = []any{&Game{}, &Tag{}, &Move{}, &User{}, &AnalysisCache{}, &PositionAnalysisCache{}, &AnalysisJob{}, &Session{}, &APIToken{}, &Puzzle{}, &PuzzleRating{}, &PuzzleAttempt{}, &BoardSnapshot{}, &RateLimitBucket{}, &AuditLog{}}
+
+func openTestSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	return db
+}
+
+func TestLoadMigrations(t *testing.T) {
+	pg, err := loadMigrations("postgres")
+	if err != nil {
+		t.Fatalf("postgres: %v", err)
+	}
+	lite, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatalf("sqlite: %v", err)
+	}
+	if len(pg) == 0 || len(pg) != len(lite) {
+		t.Fatalf("postgres has %d migrations, sqlite %d", len(pg), len(lite))
+	}
+	// Every schema change is made for both dialects, in the same order.
+	for i := range pg {
+		if pg[i].Version != lite[i].Version || pg[i].Name != lite[i].Name {
+			t.Errorf("migration %d: postgres %d %s, sqlite %d %s", i, pg[i].Version, pg[i].Name, lite[i].Version, lite[i].Name)
+		}
+		if strings.Contains(strings.ToLower(lite[i].Up), "jsonb") {
+			t.Errorf("sqlite migration %d uses jsonb", lite[i].Version)
+		}
+	}
+
+	if _, err := loadMigrations("mysql"); err == nil {
+		t.Error("loadMigrations should reject an unknown dialect")
+	}
+}
+
+func TestSQLStatements(t *testing.T) {
+	got := sqlStatements("-- comment\nCREATE TABLE a (\n  id integer\n);\n\nDROP INDEX b;\nSELECT 1")
+	want := []string{"CREATE TABLE a (\n  id integer\n);", "DROP INDEX b;", "SELECT 1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("sqlStatements = %q, want %q", got, want)
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	db := openTestSQLite(t)
+	if err := checkSchema(db); err == nil {
+		t.Fatal("checkSchema should fail on an empty database")
+	}
+
+	done, err := migrateUp(db)
+	if err != nil || len(done) == 0 {
+		t.Fatalf("migrateUp = %d migrations, %v", len(done), err)
+	}
+	if err := checkSchema(db); err != nil {
+		t.Fatalf("checkSchema after migrating: %v", err)
+	}
+	if again, err := migrateUp(db); err != nil || len(again) != 0 {
+		t.Errorf("second migrateUp = %d migrations, %v", len(again), err)
+	}
+
+	// The models and the migrated schema agree on every column.
+	m := db.Migrator()
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		for _, column := range stmt.Schema.DBNames {
+			if !m.HasColumn(model, column) {
+				t.Errorf("%s has no column %s", stmt.Schema.Table, column)
+			}
+		}
+	}
+
+	rolledBack, err := migrateDown(db, len(done))
+	if err != nil || len(rolledBack) != len(done) {
+		t.Fatalf("migrateDown = %d migrations, %v", len(rolledBack), err)
+	}
+	for _, model := range models {
+		if m.HasTable(model) {
+			t.Errorf("%T's table survived rolling back", model)
+		}
+	}
+	if _, err := migrateUp(db); err != nil {
+		t.Fatalf("migrateUp after rolling back: %v", err)
+	}
+
+	// A version this server doesn't know means a newer release migrated
+	// the database.
+	if err := db.Create(&schemaMigration{Version: 9999, Name: "future", AppliedAt: time.Now()}).Error; err != nil {
+		t.Fatalf("record future migration: %v", err)
+	}
+	if err := checkSchema(db); err == nil || !strings.Contains(err.Error(), "9999") {
+		t.Errorf("checkSchema with an unknown migration = %v", err)
+	}
+}
+
+// TestMigrateAdoptsAutoMigrate brings a database made by the last
+// AutoMigrate release, old cache indexes included, under migrations.
+func TestMigrateAdoptsAutoMigrate(t *testing.T) {
+	db := openTestSQLite(t)
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	user := createTestUser(t, db)
+	slug, err := createGame(db, 5, user.ID, "human")
+	if err != nil {
+		t.Fatalf("createGame: %v", err)
+	}
+
+	for _, stmt := range []string{
+		// Columns added by later migrations weren't there yet.
+		"ALTER TABLE moves DROP COLUMN idempotency_key",
+		"ALTER TABLE games DROP COLUMN version",
+		"ALTER TABLE games DROP COLUMN position",
+		"ALTER TABLE games DROP COLUMN position_hash",
+		"ALTER TABLE games DROP COLUMN position_ply",
+		"DROP TABLE board_snapshots",
+		"DROP TABLE rate_limit_buckets",
+		"ALTER TABLE users DROP COLUMN role",
+		"ALTER TABLE users DROP COLUMN banned_at",
+		"ALTER TABLE users DROP COLUMN ban_reason",
+		"DROP TABLE audit_logs",
+		// Indexes from before the cache keys gained engines and seeds.
+		"CREATE UNIQUE INDEX idx_analysis_lookup ON analysis_caches (game_id, level, style, time_limit_ns, game_version)",
+		"CREATE UNIQUE INDEX idx_analysis_engine_lookup ON analysis_caches (game_id, engine, level, style, time_limit_ns, game_version)",
+		"CREATE UNIQUE INDEX idx_position_analysis_lookup ON position_analysis_caches (position_hash, engine, level, style, time_limit_ns, multi_pv)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("recreate old schema: %v", err)
+		}
+	}
+	if _, err := migrateUp(db); err != nil {
+		t.Fatalf("migrateUp: %v", err)
+	}
+	if err := checkSchema(db); err != nil {
+		t.Errorf("checkSchema: %v", err)
+	}
+	if _, err := getGame(db, slug); err != nil {
+		t.Errorf("game lost adopting the database: %v", err)
+	}
+	m := db.Migrator()
+	for _, idx := range []struct {
+		model any
+		name  string
+	}{
+		{&AnalysisCache{}, "idx_analysis_lookup"},
+		{&AnalysisCache{}, "idx_analysis_engine_lookup"},
+		{&PositionAnalysisCache{}, "idx_position_analysis_lookup"},
+	} {
+		if m.HasIndex(idx.model, idx.name) {
+			t.Errorf("old index %s should be dropped", idx.name)
+		}
+	}
+	if !m.HasIndex(&AnalysisCache{}, "idx_analysis_search_lookup") || !m.HasIndex(&PositionAnalysisCache{}, "idx_position_search_lookup") {
+		t.Error("seed-aware cache indexes missing")
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	url := "sqlite:" + filepath.Join(t.TempDir(), "gotak.db")
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runMigrate(&out, url, args)
+		return out.String(), err
+	}
+
+	for _, args := range [][]string{nil, {"sideways"}, {"up", "2"}, {"down", "0"}, {"down", "x"}} {
+		if _, err := run(args...); err == nil {
+			t.Errorf("migrate %v should fail", args)
+		}
+	}
+
+	if out, err := run("status"); err != nil || !strings.Contains(out, "0001") || !strings.Contains(out, "pending") {
+		t.Errorf("status before up = %q, %v", out, err)
+	}
+	if out, err := run("up"); err != nil || !strings.Contains(out, "applied 0001 baseline") {
+		t.Errorf("up = %q, %v", out, err)
+	}
+	if out, err := run("up"); err != nil || !strings.Contains(out, "up to date") {
+		t.Errorf("second up = %q, %v", out, err)
+	}
+	if out, err := run("status"); err != nil || strings.Contains(out, "pending") {
+		t.Errorf("status after up = %q, %v", out, err)
+	}
+	if out, err := run("down"); err != nil || strings.Count(out, "rolled back") != 1 {
+		t.Errorf("down = %q, %v", out, err)
+	}
+	if out, err := run("down", "99"); err != nil || !strings.HasSuffix(out, "rolled back 0001 baseline\n") {
+		t.Errorf("down 99 = %q, %v", out, err)
+	}
+	if out, err := run("down"); err != nil || !strings.Contains(out, "no migrations") {
+		t.Errorf("second down = %q, %v", out, err)
+	}
+}
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS puzzle_attempts;
+DROP TABLE IF EXISTS puzzle_ratings;
+DROP TABLE IF EXISTS puzzles;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS analysis_jobs;
+DROP TABLE IF EXISTS position_analysis_caches;
+DROP TABLE IF EXISTS analysis_caches;
+DROP TABLE IF EXISTS moves;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS games;
+DROP TABLE IF EXISTS users;
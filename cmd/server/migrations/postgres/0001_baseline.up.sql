@@ -0,0 +1,194 @@
+-- Every table the server made with AutoMigrate before it had migrations:
+-- users, games, tags and moves, and the later sessions, API tokens,
+-- analysis jobs, game and position analysis caches and puzzles. Every
+-- statement is guarded so a database AutoMigrate created is adopted as it
+-- stands, including one that predates the engine, seed and node columns.
+
+CREATE TABLE IF NOT EXISTS users (
+  id bigserial PRIMARY KEY,
+  provider varchar(32) NOT NULL,
+  provider_id varchar(128) NOT NULL,
+  email varchar(255),
+  name varchar(128),
+  avatar_url varchar(512),
+  password_hash varchar(255),
+  preferences jsonb,
+  bot boolean DEFAULT false,
+  created_at timestamptz,
+  updated_at timestamptz
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bot boolean DEFAULT false;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_provider_id ON users (provider, provider_id);
+
+CREATE TABLE IF NOT EXISTS games (
+  id bigserial PRIMARY KEY,
+  slug text,
+  status text DEFAULT 'waiting',
+  winner bigint DEFAULT 0,
+  current_player bigint DEFAULT 1,
+  current_turn bigint DEFAULT 1,
+  white_player_id bigint,
+  black_player_id bigint,
+  created_at timestamptz,
+  updated_at timestamptz,
+  CONSTRAINT fk_games_white_player FOREIGN KEY (white_player_id) REFERENCES users (id),
+  CONSTRAINT fk_games_black_player FOREIGN KEY (black_player_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_games_slug ON games (slug);
+CREATE INDEX IF NOT EXISTS idx_games_white_player_id ON games (white_player_id);
+CREATE INDEX IF NOT EXISTS idx_games_black_player_id ON games (black_player_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id bigserial PRIMARY KEY,
+  game_id bigint NOT NULL,
+  key text,
+  value text,
+  created_at timestamptz,
+  CONSTRAINT fk_games_tags FOREIGN KEY (game_id) REFERENCES games (id)
+);
+CREATE INDEX IF NOT EXISTS idx_tags_game_id ON tags (game_id);
+
+CREATE TABLE IF NOT EXISTS moves (
+  id bigserial PRIMARY KEY,
+  game_id bigint NOT NULL,
+  player bigint NOT NULL,
+  turn bigint NOT NULL,
+  text text,
+  created_at timestamptz,
+  CONSTRAINT fk_games_moves FOREIGN KEY (game_id) REFERENCES games (id)
+);
+CREATE INDEX IF NOT EXISTS idx_moves_game_id ON moves (game_id);
+
+CREATE TABLE IF NOT EXISTS analysis_caches (
+  id bigserial PRIMARY KEY,
+  game_id bigint NOT NULL,
+  engine varchar(64) NOT NULL DEFAULT '',
+  level varchar(16) NOT NULL,
+  style varchar(16) NOT NULL,
+  time_limit_ns bigint NOT NULL,
+  game_version varchar(64) NOT NULL,
+  seed bigint NOT NULL DEFAULT 0,
+  nodes bigint NOT NULL DEFAULT 0,
+  agreed bigint,
+  moves jsonb,
+  created_at timestamptz
+);
+ALTER TABLE analysis_caches ADD COLUMN IF NOT EXISTS engine varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE analysis_caches ADD COLUMN IF NOT EXISTS seed bigint NOT NULL DEFAULT 0;
+ALTER TABLE analysis_caches ADD COLUMN IF NOT EXISTS nodes bigint NOT NULL DEFAULT 0;
+DROP INDEX IF EXISTS idx_analysis_lookup;
+DROP INDEX IF EXISTS idx_analysis_engine_lookup;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_analysis_search_lookup ON analysis_caches (game_id, engine, level, style, time_limit_ns, game_version, seed, nodes);
+
+CREATE TABLE IF NOT EXISTS position_analysis_caches (
+  id bigserial PRIMARY KEY,
+  position_hash varchar(64) NOT NULL,
+  engine varchar(64) NOT NULL,
+  level varchar(16) NOT NULL,
+  style varchar(16) NOT NULL,
+  time_limit_ns bigint NOT NULL,
+  multi_pv bigint NOT NULL,
+  seed bigint NOT NULL DEFAULT 0,
+  nodes bigint NOT NULL DEFAULT 0,
+  tps text NOT NULL,
+  lines jsonb,
+  created_at timestamptz
+);
+ALTER TABLE position_analysis_caches ADD COLUMN IF NOT EXISTS seed bigint NOT NULL DEFAULT 0;
+ALTER TABLE position_analysis_caches ADD COLUMN IF NOT EXISTS nodes bigint NOT NULL DEFAULT 0;
+DROP INDEX IF EXISTS idx_position_analysis_lookup;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_position_search_lookup ON position_analysis_caches (position_hash, engine, level, style, time_limit_ns, multi_pv, seed, nodes);
+
+CREATE TABLE IF NOT EXISTS analysis_jobs (
+  id varchar(32) PRIMARY KEY,
+  game_id bigint NOT NULL,
+  slug text NOT NULL,
+  user_id bigint,
+  engine varchar(64) NOT NULL,
+  level varchar(16) NOT NULL,
+  style varchar(16) NOT NULL,
+  time_limit_ns bigint NOT NULL,
+  game_version varchar(64) NOT NULL,
+  seed bigint NOT NULL DEFAULT 0,
+  nodes bigint NOT NULL DEFAULT 0,
+  status varchar(16) NOT NULL,
+  total bigint,
+  moves jsonb,
+  error text,
+  created_at timestamptz,
+  updated_at timestamptz,
+  finished_at timestamptz
+);
+ALTER TABLE analysis_jobs ADD COLUMN IF NOT EXISTS seed bigint NOT NULL DEFAULT 0;
+ALTER TABLE analysis_jobs ADD COLUMN IF NOT EXISTS nodes bigint NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_analysis_jobs_game_id ON analysis_jobs (game_id);
+CREATE INDEX IF NOT EXISTS idx_analysis_jobs_user_id ON analysis_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_analysis_jobs_status ON analysis_jobs (status);
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  token_hash varchar(64) NOT NULL,
+  previous_token_hash varchar(64),
+  user_agent varchar(255),
+  expires_at timestamptz NOT NULL,
+  revoked_at timestamptz,
+  last_used_at timestamptz,
+  created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions (token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions (previous_token_hash);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  name varchar(64) NOT NULL,
+  prefix varchar(16) NOT NULL,
+  token_hash varchar(64) NOT NULL,
+  scopes varchar(128) NOT NULL,
+  expires_at timestamptz,
+  revoked_at timestamptz,
+  last_used_at timestamptz,
+  created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_token_hash ON api_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS puzzles (
+  id bigserial PRIMARY KEY,
+  game_id bigint NOT NULL,
+  ply bigint NOT NULL,
+  position_hash varchar(64) NOT NULL,
+  tps text NOT NULL,
+  player bigint NOT NULL,
+  solution jsonb,
+  depth bigint NOT NULL,
+  themes varchar(128),
+  rating bigint NOT NULL,
+  attempts bigint,
+  solves bigint,
+  created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_puzzles_game_id ON puzzles (game_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_puzzles_position_hash ON puzzles (position_hash);
+CREATE INDEX IF NOT EXISTS idx_puzzles_rating ON puzzles (rating);
+
+CREATE TABLE IF NOT EXISTS puzzle_ratings (
+  user_id bigint PRIMARY KEY,
+  rating bigint NOT NULL,
+  attempts bigint,
+  solved bigint,
+  updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS puzzle_attempts (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL,
+  puzzle_id bigint NOT NULL,
+  solved boolean,
+  change bigint,
+  created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_puzzle_attempt ON puzzle_attempts (user_id, puzzle_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_moves_idempotency;
+ALTER TABLE moves DROP COLUMN idempotency_key;
+ALTER TABLE games DROP COLUMN version;
@@ -0,0 +1,6 @@
+-- Moves are recorded with a compare-and-swap on games.version, and a
+-- client-chosen key makes resubmitting a move safe.
+
+ALTER TABLE games ADD COLUMN version bigint NOT NULL DEFAULT 0;
+ALTER TABLE moves ADD COLUMN idempotency_key varchar(64);
+CREATE UNIQUE INDEX idx_moves_idempotency ON moves (game_id, idempotency_key);
@@ -0,0 +1,19 @@
+-- Moderation: users gain a role and can be banned, and every admin action
+-- is recorded in the audit log.
+
+ALTER TABLE users ADD COLUMN role varchar(16) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN banned_at timestamptz;
+ALTER TABLE users ADD COLUMN ban_reason text;
+
+CREATE TABLE audit_logs (
+  id bigserial PRIMARY KEY,
+  actor_id bigint,
+  action varchar(32) NOT NULL,
+  target_type varchar(16) NOT NULL,
+  target_id varchar(64) NOT NULL,
+  detail text,
+  created_at timestamptz NOT NULL,
+  CONSTRAINT fk_audit_logs_actor FOREIGN KEY (actor_id) REFERENCES users (id)
+);
+CREATE INDEX idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at);
@@ -0,0 +1,186 @@
+-- Every table the server made with AutoMigrate before it had migrations:
+-- users, games, tags and moves, and the later sessions, API tokens,
+-- analysis jobs, game and position analysis caches and puzzles. Every
+-- statement is guarded so a database AutoMigrate created is adopted as it
+-- stands.
+
+CREATE TABLE IF NOT EXISTS users (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  provider varchar(32) NOT NULL,
+  provider_id varchar(128) NOT NULL,
+  email varchar(255),
+  name varchar(128),
+  avatar_url varchar(512),
+  password_hash varchar(255),
+  preferences text,
+  bot numeric DEFAULT false,
+  created_at datetime,
+  updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_provider_id ON users (provider, provider_id);
+
+CREATE TABLE IF NOT EXISTS games (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  slug text,
+  status text DEFAULT 'waiting',
+  winner integer DEFAULT 0,
+  current_player integer DEFAULT 1,
+  current_turn integer DEFAULT 1,
+  white_player_id integer,
+  black_player_id integer,
+  created_at datetime,
+  updated_at datetime,
+  CONSTRAINT fk_games_white_player FOREIGN KEY (white_player_id) REFERENCES users (id),
+  CONSTRAINT fk_games_black_player FOREIGN KEY (black_player_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_games_slug ON games (slug);
+CREATE INDEX IF NOT EXISTS idx_games_white_player_id ON games (white_player_id);
+CREATE INDEX IF NOT EXISTS idx_games_black_player_id ON games (black_player_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  game_id integer NOT NULL,
+  key text,
+  value text,
+  created_at datetime,
+  CONSTRAINT fk_games_tags FOREIGN KEY (game_id) REFERENCES games (id)
+);
+CREATE INDEX IF NOT EXISTS idx_tags_game_id ON tags (game_id);
+
+CREATE TABLE IF NOT EXISTS moves (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  game_id integer NOT NULL,
+  player integer NOT NULL,
+  turn integer NOT NULL,
+  text text,
+  created_at datetime,
+  CONSTRAINT fk_games_moves FOREIGN KEY (game_id) REFERENCES games (id)
+);
+CREATE INDEX IF NOT EXISTS idx_moves_game_id ON moves (game_id);
+
+CREATE TABLE IF NOT EXISTS analysis_caches (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  game_id integer NOT NULL,
+  engine varchar(64) NOT NULL DEFAULT '',
+  level varchar(16) NOT NULL,
+  style varchar(16) NOT NULL,
+  time_limit_ns integer NOT NULL,
+  game_version varchar(64) NOT NULL,
+  seed integer NOT NULL DEFAULT 0,
+  nodes integer NOT NULL DEFAULT 0,
+  agreed integer,
+  moves text,
+  created_at datetime
+);
+DROP INDEX IF EXISTS idx_analysis_lookup;
+DROP INDEX IF EXISTS idx_analysis_engine_lookup;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_analysis_search_lookup ON analysis_caches (game_id, engine, level, style, time_limit_ns, game_version, seed, nodes);
+
+CREATE TABLE IF NOT EXISTS position_analysis_caches (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  position_hash varchar(64) NOT NULL,
+  engine varchar(64) NOT NULL,
+  level varchar(16) NOT NULL,
+  style varchar(16) NOT NULL,
+  time_limit_ns integer NOT NULL,
+  multi_pv integer NOT NULL,
+  seed integer NOT NULL DEFAULT 0,
+  nodes integer NOT NULL DEFAULT 0,
+  tps text NOT NULL,
+  lines text,
+  created_at datetime
+);
+DROP INDEX IF EXISTS idx_position_analysis_lookup;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_position_search_lookup ON position_analysis_caches (position_hash, engine, level, style, time_limit_ns, multi_pv, seed, nodes);
+
+CREATE TABLE IF NOT EXISTS analysis_jobs (
+  id varchar(32) PRIMARY KEY,
+  game_id integer NOT NULL,
+  slug text NOT NULL,
+  user_id integer,
+  engine varchar(64) NOT NULL,
+  level varchar(16) NOT NULL,
+  style varchar(16) NOT NULL,
+  time_limit_ns integer NOT NULL,
+  game_version varchar(64) NOT NULL,
+  seed integer NOT NULL DEFAULT 0,
+  nodes integer NOT NULL DEFAULT 0,
+  status varchar(16) NOT NULL,
+  total integer,
+  moves text,
+  error text,
+  created_at datetime,
+  updated_at datetime,
+  finished_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_analysis_jobs_game_id ON analysis_jobs (game_id);
+CREATE INDEX IF NOT EXISTS idx_analysis_jobs_user_id ON analysis_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_analysis_jobs_status ON analysis_jobs (status);
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  user_id integer NOT NULL,
+  token_hash varchar(64) NOT NULL,
+  previous_token_hash varchar(64),
+  user_agent varchar(255),
+  expires_at datetime NOT NULL,
+  revoked_at datetime,
+  last_used_at datetime,
+  created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions (token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions (previous_token_hash);
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  user_id integer NOT NULL,
+  name varchar(64) NOT NULL,
+  prefix varchar(16) NOT NULL,
+  token_hash varchar(64) NOT NULL,
+  scopes varchar(128) NOT NULL,
+  expires_at datetime,
+  revoked_at datetime,
+  last_used_at datetime,
+  created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_token_hash ON api_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS puzzles (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  game_id integer NOT NULL,
+  ply integer NOT NULL,
+  position_hash varchar(64) NOT NULL,
+  tps text NOT NULL,
+  player integer NOT NULL,
+  solution text,
+  depth integer NOT NULL,
+  themes varchar(128),
+  rating integer NOT NULL,
+  attempts integer,
+  solves integer,
+  created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_puzzles_game_id ON puzzles (game_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_puzzles_position_hash ON puzzles (position_hash);
+CREATE INDEX IF NOT EXISTS idx_puzzles_rating ON puzzles (rating);
+
+CREATE TABLE IF NOT EXISTS puzzle_ratings (
+  user_id integer PRIMARY KEY,
+  rating integer NOT NULL,
+  attempts integer,
+  solved integer,
+  updated_at datetime
+);
+
+CREATE TABLE IF NOT EXISTS puzzle_attempts (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  user_id integer NOT NULL,
+  puzzle_id integer NOT NULL,
+  solved numeric,
+  change integer,
+  created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_puzzle_attempt ON puzzle_attempts (user_id, puzzle_id);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS board_snapshots;
+ALTER TABLE games DROP COLUMN position_ply;
+ALTER TABLE games DROP COLUMN position_hash;
+ALTER TABLE games DROP COLUMN position;
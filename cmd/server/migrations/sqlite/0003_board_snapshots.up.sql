@@ -0,0 +1,18 @@
+-- The board after the last move is kept on the games row, with periodic
+-- snapshots to rebuild from. Existing games are left empty here and
+-- replayed on read until `server verify --fix` fills them in.
+
+ALTER TABLE games ADD COLUMN position text;
+ALTER TABLE games ADD COLUMN position_hash varchar(64);
+ALTER TABLE games ADD COLUMN position_ply integer NOT NULL DEFAULT 0;
+
+CREATE TABLE board_snapshots (
+  id integer PRIMARY KEY AUTOINCREMENT,
+  game_id integer NOT NULL,
+  ply integer NOT NULL,
+  tps text NOT NULL,
+  hash varchar(64) NOT NULL,
+  created_at datetime,
+  CONSTRAINT fk_board_snapshots_game FOREIGN KEY (game_id) REFERENCES games (id)
+);
+CREATE UNIQUE INDEX idx_board_snapshot ON board_snapshots (game_id, ply);
@@ -0,0 +1,9 @@
+-- Token buckets for the rate limiter when RATE_LIMIT_STORE=database, so
+-- every server instance spends from the same budgets.
+
+CREATE TABLE rate_limit_buckets (
+  bucket_key varchar(255) PRIMARY KEY,
+  tokens real NOT NULL,
+  refilled_at datetime NOT NULL
+);
+CREATE INDEX idx_rate_limit_buckets_refilled_at ON rate_limit_buckets (refilled_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS audit_logs;
+ALTER TABLE users DROP COLUMN ban_reason;
+ALTER TABLE users DROP COLUMN banned_at;
+ALTER TABLE users DROP COLUMN role;
@@ -2,15 +2,8 @@ package main
 
 import (
 	"time"
-
-	"gorm.io/gorm"
 )
 
-// ErrorResponse is the standard error payload returned by API handlers.
-type ErrorResponse struct {
-	Error string `json:"error" example:"Something went wrong"`
-}
-
 type MessageResponse struct {
 	Message string `json:"message" example:"Operation successful"`
 }
@@ -22,6 +15,10 @@ type HealthResponse struct {
 	Branch   string `json:"branch,omitempty" example:"main"`
 }
 
+// The tables behind the models below are created by the SQL files in
+// migrations/, not from their tags; a new field needs a migration for each
+// dialect.
+
 // Game represents a game in the database
 type Game struct {
 	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -30,6 +27,10 @@ type Game struct {
 	Winner        int       `gorm:"default:0" json:"winner"`
 	CurrentPlayer int       `gorm:"default:1" json:"current_player"`
 	CurrentTurn   int       `gorm:"default:1" json:"current_turn"`
+	Version       int64     `gorm:"not null;default:0" json:"-"` // bumped by every move, so a move made from a stale read is rejected
+	Position      string    `gorm:"type:text" json:"-"`          // TPS of the board after the last move, so reads don't replay the game
+	PositionHash  string    `gorm:"type:varchar(64)" json:"-"`   // positionHash of Position
+	PositionPly   int       `gorm:"not null;default:0" json:"-"` // half-moves Position reflects
 	WhitePlayerID *int64    `gorm:"index" json:"white_player_id,omitempty"`
 	BlackPlayerID *int64    `gorm:"index" json:"black_player_id,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
@@ -56,29 +57,91 @@ type Tag struct {
 
 // Move represents a move in a game
 type Move struct {
-	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	GameID    int64     `gorm:"index;not null" json:"game_id"`
-	Player    int       `gorm:"not null" json:"player"`
-	Turn      int64     `gorm:"not null" json:"turn"`
-	Text      string    `gorm:"type:text" json:"text"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	GameID         int64     `gorm:"index;not null" json:"game_id"`
+	Player         int       `gorm:"not null" json:"player"`
+	Turn           int64     `gorm:"not null" json:"turn"`
+	Text           string    `gorm:"type:text" json:"text"`
+	IdempotencyKey *string   `gorm:"type:varchar(64)" json:"-"` // unique within the game, so a retried submission isn't played twice
+	CreatedAt      time.Time `json:"created_at"`
 
 	// Associations
 	Game Game `gorm:"foreignKey:GameID" json:"-"`
 }
 
+// BoardSnapshot is the position in a game after Ply half-moves, kept every
+// snapshotInterval plies. A games row whose position is behind its moves
+// is rebuilt from the newest snapshot instead of from the first move.
+type BoardSnapshot struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	GameID    int64     `gorm:"not null;uniqueIndex:idx_board_snapshot,priority:1" json:"game_id"`
+	Ply       int       `gorm:"not null;uniqueIndex:idx_board_snapshot,priority:2" json:"ply"`
+	TPS       string    `gorm:"type:text;not null" json:"tps"`
+	Hash      string    `gorm:"type:varchar(64);not null" json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // User represents an authenticated user (local or social)
 type User struct {
-	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	Provider     string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_provider_id" json:"provider"`
-	ProviderID   string    `gorm:"type:varchar(128);not null;uniqueIndex:idx_provider_id" json:"provider_id"`
-	Email        string    `gorm:"type:varchar(255);uniqueIndex" json:"email,omitempty"`
-	Name         string    `gorm:"type:varchar(128)" json:"name,omitempty"`
-	AvatarURL    string    `gorm:"type:varchar(512)" json:"avatar_url,omitempty"`
-	PasswordHash string    `gorm:"type:varchar(255)" json:"-"` // nullable for social login
-	Preferences  string    `gorm:"type:jsonb" json:"preferences,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Provider     string     `gorm:"type:varchar(32);not null;uniqueIndex:idx_provider_id" json:"provider"`
+	ProviderID   string     `gorm:"type:varchar(128);not null;uniqueIndex:idx_provider_id" json:"provider_id"`
+	Email        string     `gorm:"type:varchar(255);uniqueIndex" json:"email,omitempty"`
+	Name         string     `gorm:"type:varchar(128)" json:"name,omitempty"`
+	AvatarURL    string     `gorm:"type:varchar(512)" json:"avatar_url,omitempty"`
+	PasswordHash string     `gorm:"type:varchar(255)" json:"-"` // nullable for social login
+	Preferences  string     `gorm:"type:jsonb" json:"preferences,omitempty"`
+	Bot          bool       `gorm:"default:false" json:"bot"`                                            // bot accounts are labelled in games and kept off human leaderboards
+	Role         string     `gorm:"type:varchar(16);not null;default:'user'" json:"role" example:"user"` // user or admin; see `server admin`
+	BannedAt     *time.Time `json:"banned_at,omitempty"`                                                 // banned users can't sign in or use the API
+	BanReason    string     `gorm:"type:text" json:"ban_reason,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// AuditLog records one admin action. ActorID is the admin who took it, or
+// nil for the server admin command.
+type AuditLog struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	ActorID    *int64    `gorm:"index" json:"actor_id,omitempty"`
+	Action     string    `gorm:"type:varchar(32);not null" json:"action" example:"ban_user"`
+	TargetType string    `gorm:"type:varchar(16);not null" json:"target_type" example:"user"`
+	TargetID   string    `gorm:"type:varchar(64);not null" json:"target_id" example:"42"`
+	Detail     string    `gorm:"type:text" json:"detail,omitempty" example:"spamming game lobbies"`
+	CreatedAt  time.Time `gorm:"not null;index" json:"created_at"`
+}
+
+// Session is one login on one device. The refresh token itself is never
+// stored, only its SHA-256; PreviousTokenHash remembers the token it was
+// rotated from so a replayed refresh token can be detected and the
+// session killed.
+type Session struct {
+	ID                int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID            int64      `gorm:"index;not null" json:"user_id"`
+	TokenHash         string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	PreviousTokenHash string     `gorm:"type:varchar(64);index" json:"-"`
+	UserAgent         string     `gorm:"type:varchar(255)" json:"user_agent,omitempty"`
+	ExpiresAt         time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// APIToken is a user-managed bearer token for bots and scripts. As with
+// sessions only the SHA-256 of the token is stored; Prefix keeps the first
+// few characters so users can tell their tokens apart. Scopes is a
+// comma-separated list (see knownScopes).
+type APIToken struct {
+	ID         int64      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     int64      `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"type:varchar(64);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`
+	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"type:varchar(128);not null" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 // AnalysisCache stores a previously computed analysis result.
@@ -86,17 +149,99 @@ type User struct {
 // (UpdatedAt, content hash) without a schema change.
 type AnalysisCache struct {
 	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	GameID      int64     `gorm:"not null;uniqueIndex:idx_analysis_lookup,priority:1" json:"game_id"`
-	Level       string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_analysis_lookup,priority:2" json:"level"`
-	Style       string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_analysis_lookup,priority:3" json:"style"`
-	TimeLimitNs int64     `gorm:"not null;uniqueIndex:idx_analysis_lookup,priority:4" json:"time_limit_ns"`
-	GameVersion string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_analysis_lookup,priority:5" json:"game_version"`
+	GameID      int64     `gorm:"not null;uniqueIndex:idx_analysis_search_lookup,priority:1" json:"game_id"`
+	Engine      string    `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_analysis_search_lookup,priority:2" json:"engine"`
+	Level       string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_analysis_search_lookup,priority:3" json:"level"`
+	Style       string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_analysis_search_lookup,priority:4" json:"style"`
+	TimeLimitNs int64     `gorm:"not null;uniqueIndex:idx_analysis_search_lookup,priority:5" json:"time_limit_ns"`
+	GameVersion string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_analysis_search_lookup,priority:6" json:"game_version"`
+	Seed        int64     `gorm:"not null;default:0;uniqueIndex:idx_analysis_search_lookup,priority:7" json:"seed"`
+	Nodes       int64     `gorm:"not null;default:0;uniqueIndex:idx_analysis_search_lookup,priority:8" json:"nodes"`
 	Agreed      int       `json:"agreed"`
 	Moves       string    `gorm:"type:jsonb" json:"moves"` // JSON-encoded []MoveAnalysis
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-// AutoMigrate runs the database migrations
-func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(&Game{}, &Tag{}, &Move{}, &User{}, &AnalysisCache{})
+// AnalysisJob is a queued game analysis. Moves holds the results so far, so
+// a job that is picked up again after a restart resumes where it stopped;
+// UpdatedAt is its heartbeat while running. Total is the number of
+// half-moves to analyse, fixed when the job is queued.
+type AnalysisJob struct {
+	ID          string     `gorm:"type:varchar(32);primaryKey" json:"id"`
+	GameID      int64      `gorm:"not null;index" json:"game_id"`
+	Slug        string     `gorm:"type:text;not null" json:"slug"`
+	UserID      *int64     `gorm:"index" json:"user_id,omitempty"`
+	Engine      string     `gorm:"type:varchar(64);not null" json:"engine"`
+	Level       string     `gorm:"type:varchar(16);not null" json:"level"`
+	Style       string     `gorm:"type:varchar(16);not null" json:"style"`
+	TimeLimitNs int64      `gorm:"not null" json:"time_limit_ns"`
+	GameVersion string     `gorm:"type:varchar(64);not null" json:"game_version"`
+	Seed        int64      `gorm:"not null;default:0" json:"seed"`
+	Nodes       int64      `gorm:"not null;default:0" json:"nodes"`
+	Status      string     `gorm:"type:varchar(16);not null;index" json:"status"` // queued, running, done, failed, canceled
+	Total       int        `json:"total"`
+	Moves       string     `gorm:"type:jsonb" json:"moves"` // JSON-encoded []MoveAnalysis
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// PositionAnalysisCache stores an engine's candidate lines for one
+// position, keyed by the hash of its TPS so every game that reaches the
+// position shares the entry.
+type PositionAnalysisCache struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	PositionHash string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_position_search_lookup,priority:1" json:"position_hash"`
+	Engine       string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_position_search_lookup,priority:2" json:"engine"`
+	Level        string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_position_search_lookup,priority:3" json:"level"`
+	Style        string    `gorm:"type:varchar(16);not null;uniqueIndex:idx_position_search_lookup,priority:4" json:"style"`
+	TimeLimitNs  int64     `gorm:"not null;uniqueIndex:idx_position_search_lookup,priority:5" json:"time_limit_ns"`
+	MultiPV      int       `gorm:"not null;uniqueIndex:idx_position_search_lookup,priority:6" json:"multi_pv"`
+	Seed         int64     `gorm:"not null;default:0;uniqueIndex:idx_position_search_lookup,priority:7" json:"seed"`
+	Nodes        int64     `gorm:"not null;default:0;uniqueIndex:idx_position_search_lookup,priority:8" json:"nodes"`
+	TPS          string    `gorm:"type:text;not null" json:"tps"`
+	Lines        string    `gorm:"type:jsonb" json:"lines"` // JSON-encoded []CandidateLine
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Puzzle is a position mined from a finished game where the player to move
+// has a forced road win. Solution is the line FindTinue proved: the
+// solver's moves alternating with the best defence. Depth counts the
+// solver's moves. Themes is a comma-separated list (see puzzleThemes).
+type Puzzle struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	GameID       int64     `gorm:"not null;index" json:"game_id"`
+	Ply          int       `gorm:"not null" json:"ply"` // half-moves played in the game before the position
+	PositionHash string    `gorm:"type:varchar(64);uniqueIndex;not null" json:"position_hash"`
+	TPS          string    `gorm:"type:text;not null" json:"tps"`
+	Player       int       `gorm:"not null" json:"player"`
+	Solution     string    `gorm:"type:jsonb" json:"solution"` // JSON-encoded []string
+	Depth        int       `gorm:"not null" json:"depth"`
+	Themes       string    `gorm:"type:varchar(128)" json:"themes"`
+	Rating       int       `gorm:"not null;index" json:"rating"`
+	Attempts     int       `json:"attempts"`
+	Solves       int       `json:"solves"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PuzzleRating is a user's puzzle rating, created at their first rated
+// attempt.
+type PuzzleRating struct {
+	UserID    int64     `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Rating    int       `gorm:"not null" json:"rating"`
+	Attempts  int       `json:"attempts"`
+	Solved    int       `json:"solved"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PuzzleAttempt records a user's first finished attempt at a puzzle; only
+// that attempt changes ratings.
+type PuzzleAttempt struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    int64     `gorm:"not null;uniqueIndex:idx_puzzle_attempt,priority:1" json:"user_id"`
+	PuzzleID  int64     `gorm:"not null;uniqueIndex:idx_puzzle_attempt,priority:2" json:"puzzle_id"`
+	Solved    bool      `json:"solved"`
+	Change    int       `json:"change"`
+	CreatedAt time.Time `json:"created_at"`
 }
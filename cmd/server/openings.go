@@ -34,9 +34,10 @@ type OpeningsResponse struct {
 // @Produce json
 // @Param prefix query string false "Comma-separated PTN moves" example(a1,e5)
 // @Success 200 {object} OpeningsResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /analyze/openings [get]
+// @Failure 400 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/analyze/openings [get]
 func getOpeningsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
@@ -44,27 +45,20 @@ func getOpeningsHandler(w http.ResponseWriter, r *http.Request) {
 	prefix, err := parseOpeningPrefix(r.URL.Query().Get("prefix"))
 	if err != nil {
 		l.Warnw("invalid opening prefix", zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, err.Error()))
 		return
 	}
 
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return
 	}
-
-	count, conts, err := computeOpenings(db, prefix)
+	count, conts, err := store.Openings(prefix)
 	if err != nil {
 		l.Errorw("could not compute openings", zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "could not compute openings"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not compute openings"))
 		return
 	}
 
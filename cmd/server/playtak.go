@@ -0,0 +1,748 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/icco/gotak"
+	"github.com/nelhage/taktician/playtak"
+	"github.com/nelhage/taktician/ptn"
+	"go.uber.org/zap"
+)
+
+// The bot protocol is the subset of the playtak.com line protocol that
+// community bots (taktician, tiltak, ...) rely on: Client, Login, PING,
+// Seek, Accept, List, quit, and the in-game P, M and Resign commands.
+// Players log in with their account name or email and a personal API
+// token with the play scope as the password. Login attempts spend from the
+// auth rate limit of the connection's address, and a connection whose
+// token is revoked or whose user is banned is dropped at its next seek,
+// accept or game command. Clocks are reported but not enforced.
+
+const (
+	// playtakIdleTimeout drops connections that stop talking; playtak
+	// clients PING every 30 seconds or so.
+	playtakIdleTimeout  = 5 * time.Minute
+	playtakWriteTimeout = 10 * time.Second
+	playtakMaxLine      = 4096
+)
+
+var (
+	errPlaytakAuth   = errors.New("authentication failure")
+	errPlaytakNoSeek = errors.New("no such seek")
+)
+
+// botProtocol is the running playtak hub, if any. The HTTP move handler
+// reports moves to it so protocol clients see moves made over the API.
+var botProtocol *playtakServer
+
+// lineConn is one protocol connection, TCP or WebSocket.
+type lineConn interface {
+	ReadLine() (string, error)
+	WriteLine(line string) error
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// playtakServer tracks connections, open seeks and games in progress.
+// Game numbers on the wire are Game.ID; seek numbers only live as long as
+// the process.
+type playtakServer struct {
+	store  Store
+	limits *rateLimiter
+
+	mu       sync.Mutex
+	conns    map[*playtakConn]struct{}
+	seeks    map[int]*playtakSeek
+	nextSeek int
+	games    map[int64]*playtakGame
+}
+
+type playtakSeek struct {
+	id    int
+	owner *playtakConn
+	size  int
+	time  int
+	incr  int
+	color string // W, B or A
+}
+
+type playtakGame struct {
+	id    int64
+	slug  string
+	size  int
+	time  int
+	white *playtakConn
+	black *playtakConn
+}
+
+// side returns which player c is in g, or PlayerNone.
+func (g *playtakGame) side(c *playtakConn) int {
+	switch c {
+	case g.white:
+		return gotak.PlayerWhite
+	case g.black:
+		return gotak.PlayerBlack
+	}
+	return gotak.PlayerNone
+}
+
+func (g *playtakGame) conn(player int) *playtakConn {
+	if player == gotak.PlayerWhite {
+		return g.white
+	}
+	return g.black
+}
+
+type playtakConn struct {
+	lc lineConn
+	ip string
+
+	wmu     sync.Mutex
+	user    *User
+	tokenID int64
+	name    string
+}
+
+func (c *playtakConn) send(format string, args ...any) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.lc.WriteLine(fmt.Sprintf(format, args...)); err != nil {
+		// The read loop notices the broken connection and cleans up.
+		_ = c.lc.Close()
+	}
+}
+
+func newPlaytakServer(store Store, limits *rateLimiter) *playtakServer {
+	return &playtakServer{
+		store:  store,
+		limits: limits,
+		conns:  map[*playtakConn]struct{}{},
+		seeks:  map[int]*playtakSeek{},
+		games:  map[int64]*playtakGame{},
+	}
+}
+
+// listenAndServe accepts TCP connections on addr until ctx is done.
+func (s *playtakServer) listenAndServe(ctx context.Context, addr string) error {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	log.Infow("playtak protocol listening", "addr", ln.Addr().String())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.serve(newTCPLineConn(conn), addrHost(conn.RemoteAddr().String()))
+	}
+}
+
+var playtakUpgrader = websocket.Upgrader{
+	Subprotocols: []string{"binary"},
+	// Credentials travel in-band, never in cookies, so cross-origin
+	// clients are fine.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// wsHandler upgrades to a WebSocket speaking the same line protocol.
+func (s *playtakServer) wsHandler(w http.ResponseWriter, r *http.Request) {
+	ws, err := playtakUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warnw("playtak websocket upgrade", zap.Error(err))
+		return
+	}
+	// The HTTP server's read/write timeouts still apply to the hijacked
+	// connection.
+	_ = ws.NetConn().SetDeadline(time.Time{})
+	ip := addrHost(r.RemoteAddr)
+	if s.limits != nil {
+		ip = s.limits.clientIP(r)
+	}
+	s.serve(&wsLineConn{ws: ws}, ip)
+}
+
+// serve runs the protocol on lc, a connection from address ip.
+func (s *playtakServer) serve(lc lineConn, ip string) {
+	c := &playtakConn{lc: lc, ip: ip}
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer s.disconnect(c)
+
+	c.send("Welcome!")
+	c.send("Login or Register")
+	for {
+		_ = lc.SetReadDeadline(time.Now().Add(playtakIdleTimeout))
+		line, err := lc.ReadLine()
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.EqualFold(line, "quit") {
+			return
+		}
+		s.handle(c, line)
+	}
+}
+
+func (s *playtakServer) handle(c *playtakConn, line string) {
+	words := strings.Fields(line)
+	switch words[0] {
+	case "Client":
+		return
+	case "PING":
+		c.send("OK")
+		return
+	case "Login":
+		s.login(c, words[1:])
+		return
+	case "Register":
+		c.send("Registration is not supported here; sign up over HTTP and create an API token")
+		return
+	}
+
+	if c.user == nil {
+		c.send("NOK")
+		return
+	}
+	if words[0] != "List" {
+		if err := s.recheck(c); err != nil {
+			log.Infow("playtak connection no longer authorized", "user_id", c.user.ID, zap.Error(err))
+			c.send("Authentication failure")
+			_ = c.lc.Close()
+			return
+		}
+	}
+
+	switch {
+	case words[0] == "Seek":
+		if err := s.seek(c, words[1:]); err != nil {
+			c.send("NOK")
+		}
+	case words[0] == "Accept":
+		if err := s.accept(c, words[1:]); err != nil {
+			log.Warnw("playtak accept", "user_id", c.user.ID, zap.Error(err))
+			c.send("NOK")
+		}
+	case words[0] == "List":
+		s.listSeeks(c)
+	case strings.HasPrefix(words[0], "Game#"):
+		s.gameCommand(c, words)
+	default:
+		c.send("NOK")
+	}
+}
+
+func (s *playtakServer) login(c *playtakConn, args []string) {
+	if c.user != nil || len(args) != 2 {
+		c.send("Authentication failure")
+		return
+	}
+	d, err := s.limits.take(context.Background(), settings.RateLimits.Auth, "ip", c.ip)
+	if err != nil {
+		log.Warnw("rate limit store failed, allowing login", zap.Error(err))
+	} else if !d.Allowed {
+		log.Infow("playtak login rate limited", "ip", c.ip)
+		c.send("Authentication failure")
+		return
+	}
+	user, token, err := s.authenticate(args[0], args[1])
+	if err != nil {
+		log.Infow("playtak login failed", "name", args[0], zap.Error(err))
+		c.send("Authentication failure")
+		return
+	}
+
+	s.mu.Lock()
+	c.user = user
+	c.tokenID = token.ID
+	c.name = playtakName(user)
+	s.mu.Unlock()
+
+	c.send("Welcome %s!", c.name)
+	s.listSeeks(c)
+}
+
+// authenticate accepts an account name or email plus an API token that
+// carries the play scope.
+func (s *playtakServer) authenticate(name, secret string) (*User, *APIToken, error) {
+	if !strings.HasPrefix(secret, apiTokenPrefix) {
+		return nil, nil, errPlaytakAuth
+	}
+	user, token, err := s.store.AuthenticateAPIToken(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user.BannedAt != nil {
+		return nil, nil, errUserBanned
+	}
+	if !slices.Contains(splitScopes(token.Scopes), scopePlay) {
+		return nil, nil, fmt.Errorf("%w: token lacks the play scope", errPlaytakAuth)
+	}
+	if !strings.EqualFold(name, playtakName(user)) && !strings.EqualFold(name, user.Email) {
+		return nil, nil, fmt.Errorf("%w: name does not match token", errPlaytakAuth)
+	}
+	return user, token, nil
+}
+
+// recheck confirms c's token is still live and its user not banned, for
+// a connection that logged in a while ago.
+func (s *playtakServer) recheck(c *playtakConn) error {
+	token, err := s.store.APIToken(c.tokenID)
+	if err != nil {
+		return err
+	}
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		return errAPITokenInvalid
+	}
+	user, err := s.store.User(token.UserID)
+	if err != nil {
+		return err
+	}
+	if user.BannedAt != nil {
+		return errUserBanned
+	}
+	return nil
+}
+
+// playtakName is the user's name as shown on the wire: playtak names are
+// a single word of letters, digits and underscores.
+func playtakName(u *User) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r == ' ' || r == '-':
+			return '_'
+		}
+		return -1
+	}, u.Name)
+	if name == "" {
+		return fmt.Sprintf("user%d", u.ID)
+	}
+	return truncate(name, 32)
+}
+
+// seek handles "Seek <size> <time> <incr> [W|B|A] ...". Trailing fields
+// newer clients send (komi, piece counts, rated, ...) are ignored. Size 0
+// withdraws the connection's seek.
+func (s *playtakServer) seek(c *playtakConn, args []string) error {
+	if len(args) < 3 {
+		return errors.New("seek needs size, time and increment")
+	}
+	nums := make([]int, 3)
+	for i := range nums {
+		n, err := strconv.Atoi(args[i])
+		if err != nil || n < 0 {
+			return fmt.Errorf("bad seek field %q", args[i])
+		}
+		nums[i] = n
+	}
+	size, secs, incr := nums[0], nums[1], nums[2]
+
+	s.mu.Lock()
+	lines := s.removeSeeksLocked(c)
+	sk, err := s.addSeekLocked(c, size, secs, incr, args[3:])
+	if sk != nil {
+		lines = append(lines, "Seek new "+formatSeek(sk))
+	}
+	conns := s.loggedInLocked()
+	s.mu.Unlock()
+
+	broadcast(conns, lines...)
+	return err
+}
+
+// addSeekLocked opens c's seek; size 0 opens none.
+func (s *playtakServer) addSeekLocked(c *playtakConn, size, secs, incr int, args []string) (*playtakSeek, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	if size < 4 || size > 8 || !settings.allowsBoardSize(size) {
+		return nil, fmt.Errorf("unsupported board size %d", size)
+	}
+
+	color := "A"
+	if len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "W", "B", "A":
+			color = strings.ToUpper(args[0])
+		default:
+			return nil, fmt.Errorf("bad seek color %q", args[0])
+		}
+	}
+
+	s.nextSeek++
+	sk := &playtakSeek{id: s.nextSeek, owner: c, size: size, time: secs, incr: incr, color: color}
+	s.seeks[sk.id] = sk
+	return sk, nil
+}
+
+func formatSeek(sk *playtakSeek) string {
+	flats, caps := playtakPieces(sk.size)
+	return fmt.Sprintf("%d %s %d %d %d %s 0 %d %d 1 0", sk.id, sk.owner.name, sk.size, sk.time, sk.incr, sk.color, flats, caps)
+}
+
+// playtakPieces returns the reserve counts gotak uses for size.
+func playtakPieces(size int) (int64, int64) {
+	g := &gotak.Game{Board: &gotak.Board{Size: int64(size)}}
+	return g.GetMaxStonesForBoardSize(), g.GetCapstoneCount()
+}
+
+// removeSeeksLocked withdraws c's seeks and returns the lines that
+// announce it.
+func (s *playtakServer) removeSeeksLocked(c *playtakConn) []string {
+	var lines []string
+	for id, sk := range s.seeks {
+		if sk.owner == c {
+			delete(s.seeks, id)
+			lines = append(lines, "Seek remove "+formatSeek(sk))
+		}
+	}
+	return lines
+}
+
+// loggedInLocked lists the logged-in connections. Broadcasts go to this
+// list once s.mu is released, so a slow client can't hold up everyone
+// else behind the lock.
+func (s *playtakServer) loggedInLocked() []*playtakConn {
+	conns := make([]*playtakConn, 0, len(s.conns))
+	for c := range s.conns {
+		if c.user != nil {
+			conns = append(conns, c)
+		}
+	}
+	return conns
+}
+
+// broadcast sends each line to each of conns. s.mu must not be held.
+func broadcast(conns []*playtakConn, lines ...string) {
+	for _, c := range conns {
+		for _, line := range lines {
+			c.send("%s", line)
+		}
+	}
+}
+
+func (s *playtakServer) listSeeks(c *playtakConn) {
+	s.mu.Lock()
+	ids := make([]int, 0, len(s.seeks))
+	for id := range s.seeks {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		lines = append(lines, "Seek new "+formatSeek(s.seeks[id]))
+	}
+	s.mu.Unlock()
+
+	broadcast([]*playtakConn{c}, lines...)
+}
+
+// accept handles "Accept <seek>": it creates a human game with both
+// players seated and sends each side its Game Start line.
+func (s *playtakServer) accept(c *playtakConn, args []string) error {
+	if len(args) < 1 {
+		return errPlaytakNoSeek
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errPlaytakNoSeek
+	}
+
+	s.mu.Lock()
+	sk, ok := s.seeks[id]
+	if !ok || sk.owner == c || sk.owner.user.ID == c.user.ID {
+		s.mu.Unlock()
+		return errPlaytakNoSeek
+	}
+	delete(s.seeks, id)
+	conns := s.loggedInLocked()
+	s.mu.Unlock()
+	broadcast(conns, "Seek remove "+formatSeek(sk))
+
+	white, black := sk.owner, c
+	switch sk.color {
+	case "B":
+		white, black = c, sk.owner
+	case "A":
+		if rand.IntN(2) == 0 {
+			white, black = c, sk.owner
+		}
+	}
+
+	slug, err := s.store.CreateGame(sk.size, white.user.ID, "human")
+	if err != nil {
+		return err
+	}
+	if err := s.store.JoinGame(slug, black.user.ID); err != nil {
+		return err
+	}
+	record, err := s.store.GameRecord(slug)
+	if err != nil {
+		return err
+	}
+	gameID := record.ID
+
+	g := &playtakGame{id: gameID, slug: slug, size: sk.size, time: sk.time, white: white, black: black}
+	s.mu.Lock()
+	s.games[gameID] = g
+	s.mu.Unlock()
+
+	log.Infow("playtak game started", "slug", slug, "white", white.user.ID, "black", black.user.ID)
+	flats, caps := playtakPieces(sk.size)
+	for _, side := range []struct {
+		conn  *playtakConn
+		color string
+	}{{white, "white"}, {black, "black"}} {
+		side.conn.send("Game Start %d %d %s vs %s %s %d 0 %d %d", gameID, sk.size, white.name, black.name, side.color, sk.time, flats, caps)
+	}
+	return nil
+}
+
+// gameCommand handles "Game#<id> P ...", "Game#<id> M ..." and
+// "Game#<id> Resign". Draw offers and undo requests aren't supported.
+func (s *playtakServer) gameCommand(c *playtakConn, words []string) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(words[0], "Game#"), 10, 64)
+	if err != nil || len(words) < 2 {
+		c.send("NOK")
+		return
+	}
+
+	s.mu.Lock()
+	g := s.games[id]
+	s.mu.Unlock()
+	if g == nil || g.side(c) == gotak.PlayerNone {
+		c.send("NOK")
+		return
+	}
+	player := g.side(c)
+
+	switch words[1] {
+	case "P", "M":
+		text, err := playtakToPTN(strings.Join(words[1:], " "))
+		if err != nil {
+			c.send("NOK")
+			return
+		}
+		game, err := s.store.SubmitMove(g.slug, c.user.ID, player, text, "")
+		if err != nil {
+			log.Infow("playtak move rejected", "slug", g.slug, "user_id", c.user.ID, "move", text, zap.Error(err))
+			c.send("NOK")
+			return
+		}
+		s.moveMade(game, player, text)
+	case "Resign":
+		s.finish(g, opponent(player), resignResult(opponent(player)), "")
+	default:
+		c.send("NOK")
+	}
+}
+
+// moveMade relays a recorded move to the opponent's protocol connection,
+// if the game is being played over the protocol, and announces the result
+// when the move ended the game. game must have its board replayed.
+func (s *playtakServer) moveMade(game *gotak.Game, player int, text string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	g := s.games[game.ID]
+	s.mu.Unlock()
+	if g == nil {
+		return
+	}
+
+	server, err := ptnToPlaytak(text)
+	if err != nil {
+		log.Errorw("could not convert move for playtak", "slug", g.slug, "move", text, zap.Error(err))
+		return
+	}
+	g.conn(opponent(player)).send("Game#%d %s", g.id, server)
+	g.white.send("Game#%d Time %d %d", g.id, g.time, g.time)
+	g.black.send("Game#%d Time %d %d", g.id, g.time, g.time)
+
+	if winner, over := game.GameOver(); over {
+		s.endGame(g, playtakResult(game.Board, winner))
+	}
+}
+
+// finish records winner for a game that ended off the board (resignation
+// or abandonment) and tells both sides.
+func (s *playtakServer) finish(g *playtakGame, winner int, result, abandonedBy string) {
+	if err := s.store.FinishGame(g.slug, winner); err != nil {
+		log.Errorw("could not update game status", "slug", g.slug, zap.Error(err))
+	}
+	if abandonedBy != "" {
+		s.mu.Lock()
+		delete(s.games, g.id)
+		s.mu.Unlock()
+		g.conn(winner).send("Game#%d Abandoned. %s quit", g.id, abandonedBy)
+		return
+	}
+	s.endGame(g, result)
+}
+
+func (s *playtakServer) endGame(g *playtakGame, result string) {
+	s.mu.Lock()
+	delete(s.games, g.id)
+	s.mu.Unlock()
+	g.white.send("Game#%d Over %s", g.id, result)
+	g.black.send("Game#%d Over %s", g.id, result)
+}
+
+// disconnect withdraws c's seeks and forfeits its unfinished games.
+func (s *playtakServer) disconnect(c *playtakConn) {
+	_ = c.lc.Close()
+
+	s.mu.Lock()
+	delete(s.conns, c)
+	lines := s.removeSeeksLocked(c)
+	conns := s.loggedInLocked()
+	var abandoned []*playtakGame
+	for _, g := range s.games {
+		if g.side(c) != gotak.PlayerNone {
+			abandoned = append(abandoned, g)
+		}
+	}
+	s.mu.Unlock()
+
+	broadcast(conns, lines...)
+
+	for _, g := range abandoned {
+		s.finish(g, opponent(g.side(c)), "", c.name)
+	}
+}
+
+func opponent(player int) int {
+	if player == gotak.PlayerWhite {
+		return gotak.PlayerBlack
+	}
+	return gotak.PlayerWhite
+}
+
+func resignResult(winner int) string {
+	if winner == gotak.PlayerWhite {
+		return "1-0"
+	}
+	return "0-1"
+}
+
+// playtakResult formats a finished game's result: R for a road, F for
+// flats, 1/2-1/2 for a draw.
+func playtakResult(b *gotak.Board, winner int) string {
+	if winner == gotak.PlayerNone {
+		return "1/2-1/2"
+	}
+	kind := "F"
+	if b.HasRoad(winner) {
+		kind = "R"
+	}
+	if winner == gotak.PlayerWhite {
+		return kind + "-0"
+	}
+	return "0-" + kind
+}
+
+// playtakToPTN converts a wire move ("P A1 C", "M C1 C3 2 1") to PTN.
+func playtakToPTN(server string) (string, error) {
+	m, err := playtak.ParseServer(server)
+	if err != nil {
+		return "", err
+	}
+	return ptn.FormatMove(m), nil
+}
+
+// ptnToPlaytak converts a PTN move to wire syntax.
+func ptnToPlaytak(text string) (string, error) {
+	m, err := ptn.ParseMove(text)
+	if err != nil {
+		return "", err
+	}
+	return playtak.FormatServer(m), nil
+}
+
+type tcpLineConn struct {
+	net.Conn
+	r *bufio.Scanner
+}
+
+func newTCPLineConn(conn net.Conn) *tcpLineConn {
+	r := bufio.NewScanner(conn)
+	r.Buffer(make([]byte, 0, 256), playtakMaxLine)
+	return &tcpLineConn{Conn: conn, r: r}
+}
+
+func (c *tcpLineConn) ReadLine() (string, error) {
+	if !c.r.Scan() {
+		if err := c.r.Err(); err != nil {
+			return "", err
+		}
+		return "", net.ErrClosed
+	}
+	return c.r.Text(), nil
+}
+
+func (c *tcpLineConn) WriteLine(line string) error {
+	_ = c.SetWriteDeadline(time.Now().Add(playtakWriteTimeout))
+	_, err := c.Write([]byte(line + "\n"))
+	return err
+}
+
+// wsLineConn speaks the protocol over WebSocket messages. A message may
+// carry several newline-separated lines.
+type wsLineConn struct {
+	ws      *websocket.Conn
+	pending []string
+}
+
+func (c *wsLineConn) ReadLine() (string, error) {
+	for len(c.pending) == 0 {
+		_, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return "", err
+		}
+		if len(msg) > playtakMaxLine {
+			return "", bufio.ErrTooLong
+		}
+		c.pending = strings.Split(strings.TrimRight(string(msg), "\n"), "\n")
+	}
+	line := c.pending[0]
+	c.pending = c.pending[1:]
+	return line, nil
+}
+
+func (c *wsLineConn) WriteLine(line string) error {
+	_ = c.ws.SetWriteDeadline(time.Now().Add(playtakWriteTimeout))
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(line+"\n"))
+}
+
+func (c *wsLineConn) SetReadDeadline(t time.Time) error { return c.ws.SetReadDeadline(t) }
+
+func (c *wsLineConn) Close() error { return c.ws.Close() }
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/icco/gotak"
+)
+
+func TestPlaytakMoveConversion(t *testing.T) {
+	tests := []struct {
+		server string
+		ptn    string
+	}{
+		{"P A1", "a1"},
+		{"P C3 W", "Sc3"},
+		{"P E5 C", "Ce5"},
+		{"M C1 C3 2 1", "3c1+21"},
+		{"M D2 E2 1", "d2>"},
+		{"M D4 D1 1 1 1", "3d4-111"},
+		{"M D4 A4 3 1 1", "5d4<311"},
+	}
+	for _, tt := range tests {
+		got, err := playtakToPTN(tt.server)
+		if err != nil {
+			t.Errorf("playtakToPTN(%q): %v", tt.server, err)
+			continue
+		}
+		if got != tt.ptn {
+			t.Errorf("playtakToPTN(%q) = %q, want %q", tt.server, got, tt.ptn)
+		}
+		if _, err := gotak.NewMove(got); err != nil {
+			t.Errorf("gotak rejects converted move %q: %v", got, err)
+		}
+
+		back, err := ptnToPlaytak(tt.ptn)
+		if err != nil {
+			t.Errorf("ptnToPlaytak(%q): %v", tt.ptn, err)
+			continue
+		}
+		if back != tt.server {
+			t.Errorf("ptnToPlaytak(%q) = %q, want %q", tt.ptn, back, tt.server)
+		}
+	}
+
+	for _, bad := range []string{"", "P", "P Z9", "M A1 B2 1", "X A1"} {
+		if _, err := playtakToPTN(bad); err == nil {
+			t.Errorf("playtakToPTN(%q) should fail", bad)
+		}
+	}
+}
+
+type playtakTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Scanner
+}
+
+func (c *playtakTestClient) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+		c.t.Fatalf("send %q: %v", line, err)
+	}
+}
+
+// expect reads lines until one starts with prefix and returns it.
+func (c *playtakTestClient) expect(prefix string) string {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for c.r.Scan() {
+		if line := c.r.Text(); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	c.t.Fatalf("never got %q: %v", prefix, c.r.Err())
+	return ""
+}
+
+func dialPlaytak(t *testing.T, addr string) *playtakTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	c := &playtakTestClient{t: t, conn: conn, r: bufio.NewScanner(conn)}
+	c.expect("Login or Register")
+	return c
+}
+
+// listenPlaytak serves srv on a local port and returns its address.
+func listenPlaytak(t *testing.T, srv *playtakServer) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(newTCPLineConn(conn), addrHost(conn.RemoteAddr().String()))
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPlaytakProtocolGame(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	// Every connection to :memory: is a separate database.
+	sqlDB.SetMaxOpenConns(1)
+
+	alice := createTestUser(t, db)
+	bob := &User{Provider: "local", ProviderID: "bob", Email: "bob@example.com", Name: "Bob Bot", Bot: true}
+	if err := db.Create(bob).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	_, aliceToken, err := createAPIToken(db, alice.ID, "bot", []string{scopePlay}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+	_, bobToken, err := createAPIToken(db, bob.ID, "bot", []string{scopePlay}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+	_, readOnly, err := createAPIToken(db, bob.ID, "ro", []string{scopeRead}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+
+	addr := listenPlaytak(t, newPlaytakServer(&gormStore{db: db}, nil))
+
+	w := dialPlaytak(t, addr)
+	w.send("Seek 5 600 0")
+	w.expect("NOK")
+	w.send("Login Test_User " + aliceToken)
+	if got := w.expect("Welcome "); got != "Welcome Test_User!" {
+		t.Fatalf("login reply = %q", got)
+	}
+
+	b := dialPlaytak(t, addr)
+	b.send("Login Bob_Bot " + readOnly)
+	b.expect("Authentication failure")
+	b.send("Login Test_User " + bobToken)
+	b.expect("Authentication failure")
+	b.send("Login bob@example.com " + bobToken)
+	b.expect("Welcome Bob_Bot!")
+
+	w.send("Seek 4 600 10 W")
+	seek := w.expect("Seek new ")
+	if !strings.HasPrefix(seek, "Seek new 1 Test_User 4 600 10 W") {
+		t.Fatalf("seek = %q", seek)
+	}
+	b.expect("Seek new 1 ")
+	b.send("Accept 1")
+
+	start := w.expect("Game Start ")
+	fields := strings.Fields(start)
+	if len(fields) < 9 || fields[4] != "Test_User" || fields[6] != "Bob_Bot" || fields[7] != "white" || fields[8] != "600" {
+		t.Fatalf("white start = %q", start)
+	}
+	gameStr := "Game#" + fields[2]
+	if got := b.expect("Game Start "); !strings.Contains(got, " black 600") {
+		t.Fatalf("black start = %q", got)
+	}
+
+	// White builds a road up the a-file; turn one places the opponent's
+	// stone, so black seeds a1 for white.
+	moves := []struct {
+		c    *playtakTestClient
+		move string
+	}{
+		{w, "P D4"}, {b, "P A1"},
+		{w, "P A2"}, {b, "P D3"},
+		{w, "P A3"}, {b, "P D2"},
+		{w, "P A4"},
+	}
+	b.send(gameStr + " P B2")
+	b.expect("NOK")
+	for i, m := range moves {
+		other := b
+		if m.c == b {
+			other = w
+		}
+		m.c.send(gameStr + " " + m.move)
+		if got := other.expect(gameStr + " P"); got != gameStr+" "+m.move {
+			t.Fatalf("move %d: opponent got %q, want %q", i, got, m.move)
+		}
+	}
+
+	if got := w.expect(gameStr + " Over"); got != gameStr+" Over R-0" {
+		t.Errorf("white result = %q", got)
+	}
+	if got := b.expect(gameStr + " Over"); got != gameStr+" Over R-0" {
+		t.Errorf("black result = %q", got)
+	}
+
+	var game Game
+	if err := db.Where("id = ?", strings.TrimPrefix(gameStr, "Game#")).First(&game).Error; err != nil {
+		t.Fatalf("load game: %v", err)
+	}
+	if game.Status != "finished" || game.Winner != gotak.PlayerWhite {
+		t.Errorf("game status %q winner %d, want finished/white", game.Status, game.Winner)
+	}
+}
+
+func TestPlaytakLoginLimits(t *testing.T) {
+	cfg := useTestSettings(t)
+	cfg.RateLimits.Auth.Burst = 2
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	alice := createTestUser(t, db)
+	_, token, err := createAPIToken(db, alice.ID, "bot", []string{scopePlay}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+	addr := listenPlaytak(t, newPlaytakServer(&gormStore{db: db}, newRateLimiter(newMemoryRateLimitStore(), 0)))
+
+	// Failed attempts spend the address's budget, and a fresh connection
+	// doesn't get a new one.
+	c := dialPlaytak(t, addr)
+	c.send("Login Test_User " + apiTokenPrefix + "wrong")
+	c.expect("Authentication failure")
+	c.send("Login Test_User " + apiTokenPrefix + "wrong")
+	c.expect("Authentication failure")
+	c = dialPlaytak(t, addr)
+	c.send("Login Test_User " + token)
+	c.expect("Authentication failure")
+}
+
+// TestPlaytakRevalidation checks that a ban or a revoked token drops a
+// connection that logged in before it.
+func TestPlaytakRevalidation(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	alice := createTestUser(t, db)
+	addr := listenPlaytak(t, newPlaytakServer(&gormStore{db: db}, nil))
+
+	for _, tc := range []struct {
+		name   string
+		revoke func(tokenID int64) error
+	}{
+		{"revoked", func(id int64) error {
+			return db.Model(&APIToken{}).Where("id = ?", id).Update("revoked_at", time.Now()).Error
+		}},
+		{"banned", func(int64) error {
+			return db.Model(alice).Update("banned_at", time.Now()).Error
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			apiToken, token, err := createAPIToken(db, alice.ID, tc.name, []string{scopePlay}, 0)
+			if err != nil {
+				t.Fatalf("createAPIToken: %v", err)
+			}
+			c := dialPlaytak(t, addr)
+			c.send("Login Test_User " + token)
+			c.expect("Welcome ")
+			c.send("Seek 5 600 0")
+			c.expect("Seek new ")
+
+			if err := tc.revoke(apiToken.ID); err != nil {
+				t.Fatalf("revoke: %v", err)
+			}
+			c.send("Seek 5 600 0")
+			c.expect("Authentication failure")
+			_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for c.r.Scan() {
+			}
+			if err := c.r.Err(); err != nil {
+				t.Errorf("connection not closed: %v", err)
+			}
+		})
+	}
+}
+
+// TestPlaytakWebSocket speaks the protocol through the router's /playtak
+// upgrade, the way browser clients connect.
+func TestPlaytakWebSocket(t *testing.T) {
+	useTestSettings(t)
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	user := createTestUser(t, db)
+	_, token, err := createAPIToken(db, user.ID, "bot", []string{scopePlay}, 0)
+	if err != nil {
+		t.Fatalf("createAPIToken: %v", err)
+	}
+
+	store := &gormStore{db: db}
+	srv := httptest.NewServer(buildRouter(routerOptions{IsDev: true, Store: store, Playtak: newPlaytakServer(store, nil)}))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"binary"}}
+	ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/playtak", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_ = resp.Body.Close()
+	t.Cleanup(func() { _ = ws.Close() })
+	if ws.Subprotocol() != "binary" {
+		t.Errorf("subprotocol = %q, want binary", ws.Subprotocol())
+	}
+
+	c := &wsLineConn{ws: ws}
+	expect := func(prefix string) string {
+		t.Helper()
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				t.Fatalf("never got %q: %v", prefix, err)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		}
+	}
+	send := func(line string) {
+		t.Helper()
+		if err := c.WriteLine(line); err != nil {
+			t.Fatalf("send %q: %v", line, err)
+		}
+	}
+
+	expect("Login or Register")
+	send("Login Test_User " + token)
+	if got := expect("Welcome "); got != "Welcome Test_User!" {
+		t.Fatalf("login reply = %q", got)
+	}
+	send("Seek 5 600 0")
+	if got := expect("Seek new "); !strings.HasPrefix(got, "Seek new 1 Test_User 5 600 0 A") {
+		t.Errorf("seek = %q", got)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// problemContentType is the media type of error responses (RFC 7807).
+const problemContentType = "application/problem+json"
+
+// maxRequestBody caps the JSON bodies decodeRequest reads.
+const maxRequestBody = 1 << 20
+
+// Error codes. A code names what went wrong in a way clients can switch on;
+// the detail that comes with it is for people and may change.
+const (
+	codeBadRequest      = "bad_request"
+	codeInvalidBody     = "invalid_body"
+	codeValidation      = "validation_failed"
+	codeUnauthenticated = "unauthenticated"
+	codeForbidden       = "forbidden"
+	codeNotFound        = "not_found"
+	codeConflict        = "conflict"
+	codeRateLimited     = "rate_limited"
+	codeInternal        = "internal"
+	codeUnavailable     = "unavailable"
+
+	codeNotParticipant   = "not_participant"
+	codeInvalidMove      = "invalid_move"
+	codeNotYourTurn      = "not_your_turn"
+	codeGameOver         = "game_over"
+	codeMoveConflict     = "move_conflict"
+	codeIdempotencyReuse = "idempotency_key_reused"
+	codeBanned           = "account_banned"
+)
+
+// Problem is the body of every error response, an RFC 7807 problem
+// details object. Code is the stable machine-readable error, Errors lists
+// the invalid fields of a request that failed validation, and Error
+// repeats Detail for clients written against the older {"error": "..."}
+// body.
+type Problem struct {
+	Type     string       `json:"type" example:"about:blank"`
+	Title    string       `json:"title" example:"Bad Request"`
+	Status   int          `json:"status" example:"400"`
+	Detail   string       `json:"detail,omitempty" example:"player must be 1 or 2"`
+	Instance string       `json:"instance,omitempty" example:"/v1/game/abc123/move"`
+	Code     string       `json:"code" example:"validation_failed"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Error    string       `json:"error" example:"player must be 1 or 2"`
+}
+
+// FieldError is one invalid field in a request body.
+type FieldError struct {
+	Field   string `json:"field" example:"player"`
+	Message string `json:"message" example:"must be 1 or 2"`
+}
+
+// apiError is an error a handler reports to the client: the HTTP status,
+// an error code and a client-safe detail. err, when set, is the
+// underlying cause for logs; it is never sent.
+type apiError struct {
+	status int
+	code   string
+	detail string
+	fields []FieldError
+	err    error
+}
+
+// newAPIError is an apiError with the generic code for status.
+func newAPIError(status int, detail string) *apiError {
+	return &apiError{status: status, code: statusCode(status), detail: detail}
+}
+
+// internalError is a 500 whose cause is logged but not shown.
+func internalError(detail string, err error) *apiError {
+	return &apiError{status: http.StatusInternalServerError, code: codeInternal, detail: detail, err: err}
+}
+
+// gameLoadError reports a game that couldn't be loaded: a 404 if there is
+// no such game, otherwise a 500.
+func gameLoadError(err error) *apiError {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &apiError{status: http.StatusNotFound, code: codeNotFound, detail: "game not found", err: err}
+	}
+	return internalError("could not load game", err)
+}
+
+func (e *apiError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s: %v", e.detail, e.err)
+	}
+	return e.detail
+}
+
+func (e *apiError) Unwrap() error { return e.err }
+
+// statusCode is the generic error code for an HTTP status.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeBadRequest
+	case http.StatusUnauthorized:
+		return codeUnauthenticated
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusTooManyRequests:
+		return codeRateLimited
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	}
+	if status >= 500 {
+		return codeInternal
+	}
+	return codeBadRequest
+}
+
+// writeProblem writes err as a problem response. Errors other than an
+// apiError are reported as a bare 500, so internal messages never reach
+// the client; handlers log the cause themselves.
+func writeProblem(w http.ResponseWriter, r *http.Request, err error) {
+	var ae *apiError
+	if !errors.As(err, &ae) {
+		ae = internalError("internal server error", err)
+	}
+	p := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(ae.status),
+		Status:   ae.status,
+		Detail:   ae.detail,
+		Instance: r.URL.Path,
+		Code:     ae.code,
+		Errors:   ae.fields,
+		Error:    ae.detail,
+	}
+	if p.Error == "" {
+		p.Error = p.Title
+	}
+	w.Header().Set("Content-Type", problemContentType+"; charset=UTF-8")
+	w.WriteHeader(ae.status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logging.FromContext(r.Context()).Errorw("failed to render problem", zap.Error(err))
+	}
+}
+
+// validator is a request body that checks its own fields.
+type validator interface {
+	validate() []FieldError
+}
+
+// decodeRequest reads r's JSON body into v, then validates v if it is a
+// validator. An empty body leaves v as it is, so requests whose fields are
+// all optional can omit it; required fields are the validator's job.
+func decodeRequest(r *http.Request, v any) error {
+	if r.Body != nil {
+		err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBody)).Decode(v)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return invalidBody(err)
+		}
+	}
+	if val, ok := v.(validator); ok {
+		if fields := val.validate(); len(fields) > 0 {
+			return invalidRequest(fields...)
+		}
+	}
+	return nil
+}
+
+// invalidBody is the 400 for a body that isn't the JSON a handler takes.
+func invalidBody(err error) *apiError {
+	e := &apiError{status: http.StatusBadRequest, code: codeInvalidBody, detail: "invalid request body", err: err}
+	var typeErr *json.UnmarshalTypeError
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		e.fields = []FieldError{{Field: typeErr.Field, Message: "must be a " + typeErr.Type.String()}}
+		e.detail = fmt.Sprintf("invalid request body: %s must be a %s", typeErr.Field, typeErr.Type)
+	case errors.As(err, &tooBig):
+		e.status = http.StatusRequestEntityTooLarge
+		e.detail = fmt.Sprintf("request body is larger than %d bytes", tooBig.Limit)
+	}
+	return e
+}
+
+// requireFields reports every field in name, value pairs whose value is
+// blank.
+func requireFields(pairs ...string) []FieldError {
+	var out []FieldError
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if strings.TrimSpace(pairs[i+1]) == "" {
+			out = append(out, FieldError{Field: pairs[i], Message: "is required"})
+		}
+	}
+	return out
+}
+
+// invalidRequest is the 400 for a request with invalid fields.
+func invalidRequest(fields ...FieldError) *apiError {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return &apiError{
+		status: http.StatusBadRequest,
+		code:   codeValidation,
+		detail: strings.Join(msgs, "; "),
+		fields: fields,
+	}
+}
+
+// recoverProblems turns a panicking handler into a logged 500 problem
+// rather than a dropped connection.
+func recoverProblems(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler { //nolint:errorlint // sentinel panic value
+				panic(p)
+			}
+			logging.FromContext(r.Context()).Errorw("handler panicked", "panic", p, "stack", string(debug.Stack()))
+			// Once a response has started it can't be replaced.
+			if ww.Status() == 0 {
+				writeProblem(ww, r, internalError("internal server error", fmt.Errorf("panic: %v", p)))
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, problemContentType) {
+		t.Errorf("Content-Type = %q, want %s", ct, problemContentType)
+	}
+	var p Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	return p
+}
+
+func TestWriteProblem(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/game/abc/move", nil)
+
+	w := httptest.NewRecorder()
+	writeProblem(w, r, &apiError{status: http.StatusConflict, code: codeMoveConflict, detail: "reload and try again", err: errors.New("version 3 != 4")})
+	p := decodeProblem(t, w)
+	if w.Code != http.StatusConflict || p.Status != http.StatusConflict || p.Code != codeMoveConflict || p.Title != "Conflict" {
+		t.Errorf("problem = %d %+v", w.Code, p)
+	}
+	if p.Detail != "reload and try again" || p.Error != p.Detail || p.Instance != "/game/abc/move" {
+		t.Errorf("problem = %+v", p)
+	}
+
+	// Errors that aren't apiErrors don't reach the client.
+	w = httptest.NewRecorder()
+	writeProblem(w, r, errors.New("pq: relation \"games\" does not exist"))
+	p = decodeProblem(t, w)
+	if w.Code != http.StatusInternalServerError || p.Code != codeInternal || strings.Contains(p.Detail, "pq") {
+		t.Errorf("internal problem = %d %+v", w.Code, p)
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	decode := func(body string, v any) *apiError {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		err := decodeRequest(r, v)
+		if err == nil {
+			return nil
+		}
+		var ae *apiError
+		if !errors.As(err, &ae) {
+			t.Fatalf("decodeRequest(%q) = %v, want an apiError", body, err)
+		}
+		return ae
+	}
+	fields := func(ae *apiError) []string {
+		var out []string
+		if ae != nil {
+			for _, f := range ae.fields {
+				out = append(out, f.Field)
+			}
+		}
+		return out
+	}
+
+	// Every AIRequest field is optional.
+	var ai AIRequest
+	if ae := decode("", &ai); ae != nil {
+		t.Errorf("empty AI request = %v", ae)
+	}
+	if ae := decode(`{"level":"expert","nodes":5000}`, &ai); ae != nil || ai.Level != "expert" || ai.Nodes != 5000 {
+		t.Errorf("AI request = %+v, %v", ai, ae)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		body   string
+		v      any
+		code   string
+		fields string
+	}{
+		{"malformed", `{"player":`, &MoveRequest{}, codeInvalidBody, ""},
+		{"wrong type", `{"player":"white","move":"a1"}`, &MoveRequest{}, codeInvalidBody, "player"},
+		{"empty move", `{}`, &MoveRequest{}, codeValidation, "player,move"},
+		{"long key", `{"player":1,"move":"a1","idempotency_key":"` + strings.Repeat("k", maxIdempotencyKey+1) + `"}`, &MoveRequest{}, codeValidation, "idempotency_key"},
+		{"board size", `{"size":"12","mode":"robot"}`, &CreateGameRequest{}, codeValidation, "size,mode"},
+		{"ai level", `{"level":"grandmaster","style":"sneaky","time_limit":-1}`, &AIRequest{}, codeValidation, "level,style,time_limit"},
+		{"register", `{"email":"a@example.com","password":"short"}`, &RegisterRequest{}, codeValidation, "password"},
+	} {
+		ae := decode(tc.body, tc.v)
+		if ae == nil || ae.status != http.StatusBadRequest || ae.code != tc.code || strings.Join(fields(ae), ",") != tc.fields {
+			t.Errorf("%s: decodeRequest = %+v, want %s on %q", tc.name, ae, tc.code, tc.fields)
+		}
+	}
+
+	if ae := decode(`{"player":2,"move":"a1"}`, &MoveRequest{}); ae != nil {
+		t.Errorf("valid move = %v", ae)
+	}
+	if ae := decode(`{"size":"6","mode":"ai"}`, &CreateGameRequest{}); ae != nil {
+		t.Errorf("valid new game = %v", ae)
+	}
+	if ae := decode(`{"moves":["`+strings.Repeat("a", maxRequestBody)+`"]}`, &PuzzleAttemptRequest{}); ae == nil || ae.status != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body = %v, want 413", ae)
+	}
+}
+
+func TestRecoverProblems(t *testing.T) {
+	h := recoverProblems(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if p := decodeProblem(t, w); w.Code != http.StatusInternalServerError || p.Code != codeInternal || strings.Contains(p.Detail, "boom") {
+		t.Errorf("panic = %d %+v", w.Code, p)
+	}
+}
+
+func TestRouterProblems(t *testing.T) {
+	useTestSettings(t)
+	store, err := openStore("memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	router := buildRouter(routerOptions{IsDev: true, Store: store})
+
+	for _, path := range []string{"/game/nosuchgame", "/game/nosuchgame/1", "/no/such/route"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if p := decodeProblem(t, w); w.Code != http.StatusNotFound || p.Code != codeNotFound {
+			t.Errorf("GET %s = %d %+v", path, w.Code, p)
+		}
+	}
+}
@@ -13,9 +13,10 @@ import (
 // @Produce plain
 // @Param slug path string true "Game slug identifier"
 // @Success 200 {string} string "PTN text"
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /game/{slug}/ptn [get]
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/game/{slug}/ptn [get]
 func getPTNHandler(w http.ResponseWriter, r *http.Request) {
 	l := logging.FromContext(r.Context())
 
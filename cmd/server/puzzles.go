@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/icco/gotak"
+	"github.com/icco/gutil/logging"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Puzzle themes, stored comma-separated in Puzzle.Themes.
+const (
+	themeRoadInOne = "road-in-one" // the first move completes a road
+	themeTinue     = "tinue"       // the first move leaves the opponent in Tinuë
+	themeMissedWin = "missed-win"  // the player in the game didn't find it
+	themeCapstone  = "capstone"    // the first move places a capstone
+	themeStackMove = "stack-move"  // the first move moves a stack
+)
+
+var puzzleThemes = []string{themeRoadInOne, themeTinue, themeMissedWin, themeCapstone, themeStackMove}
+
+const (
+	// defaultPuzzleRating is a new user's puzzle rating.
+	defaultPuzzleRating = 1200
+	// userPuzzleK and puzzleK are the Elo K-factors for users and puzzles;
+	// puzzles are attempted by many users, so their ratings move slower.
+	userPuzzleK = 32
+	puzzleK     = 16
+)
+
+// Attempt results. An attempt stays correct until the solver completes
+// the road or plays a move that lets the win go.
+const (
+	attemptCorrect   = "correct"
+	attemptSolved    = "solved"
+	attemptIncorrect = "incorrect"
+)
+
+// PuzzleResponse is a puzzle as served to solvers, without its solution.
+type PuzzleResponse struct {
+	ID     int64    `json:"id"`
+	TPS    string   `json:"tps"`
+	Size   int64    `json:"size"`
+	ToMove int      `json:"to_move"`
+	Depth  int      `json:"depth"` // moves the solver needs
+	Rating int      `json:"rating"`
+	Themes []string `json:"themes"`
+	// UserRating is the signed-in user's puzzle rating.
+	UserRating int `json:"user_rating,omitempty"`
+}
+
+// PuzzleAttemptRequest lists the solver's moves so far, without the
+// replies: the server plays the defence itself, so the same moves always
+// get the same replies.
+type PuzzleAttemptRequest struct {
+	Moves []string `json:"moves" example:"e2"`
+}
+
+func (req *PuzzleAttemptRequest) validate() []FieldError {
+	if len(req.Moves) == 0 {
+		return []FieldError{{Field: "moves", Message: "is required"}}
+	}
+	return nil
+}
+
+// PuzzleAttemptResponse reports how an attempt stands. Reply is the
+// defender's answer to the last move while the attempt is correct;
+// Solution is only revealed once the attempt is over.
+type PuzzleAttemptResponse struct {
+	Result   string   `json:"result"`
+	Reply    string   `json:"reply,omitempty"`
+	Solution []string `json:"solution,omitempty"`
+	// Rating and Change are the user's puzzle rating after their first
+	// finished attempt at this puzzle, and how much it moved.
+	Rating int `json:"rating,omitempty"`
+	Change int `json:"change,omitempty"`
+}
+
+func (p *Puzzle) solution() []string {
+	var out []string
+	if p.Solution == "" {
+		return out
+	}
+	if err := json.Unmarshal([]byte(p.Solution), &out); err != nil {
+		log.Warnw("could not decode puzzle solution", "puzzle", p.ID, zap.Error(err))
+	}
+	return out
+}
+
+func (p *Puzzle) themes() []string {
+	if p.Themes == "" {
+		return []string{}
+	}
+	return strings.Split(p.Themes, ",")
+}
+
+func newPuzzleResponse(p *Puzzle) PuzzleResponse {
+	resp := PuzzleResponse{ID: p.ID, TPS: p.TPS, ToMove: p.Player, Depth: p.Depth, Rating: p.Rating, Themes: p.themes()}
+	if b, _, _, err := gotak.ParseTPS(p.TPS); err == nil {
+		resp.Size = b.Size
+	}
+	return resp
+}
+
+// puzzleCandidate reports whether the analysis of a move points at a
+// forced win before it: the move completed a road, the engine saw a win,
+// or the move let one go.
+func puzzleCandidate(m MoveAnalysis) bool {
+	if m.Error != "" {
+		return false
+	}
+	return m.MissedWin != nil ||
+		(m.EvalBefore != nil && m.EvalBefore.Mate > 0) ||
+		(m.EvalAfter != nil && m.EvalAfter.Result == "win")
+}
+
+// minePuzzles stores a puzzle for every position of a finished game where
+// the analysis points at a forced win and the Tinuë solver proves one.
+// moves is the game's analysis, in the order of half. Positions already
+// stored, from this game or another, are skipped. It returns how many
+// puzzles it added.
+func minePuzzles(store Store, l *zap.SugaredLogger, gameID int64, game *gotak.Game, half []halfMove, moves []MoveAnalysis) int {
+	if row, err := store.GameRecord(game.Slug); err != nil || row.Status != "finished" {
+		return 0
+	}
+
+	added := 0
+	for i, m := range moves {
+		if i >= len(half) || !puzzleCandidate(m) {
+			continue
+		}
+		pre, err := gameBeforeMove(game, half[i].turnIdx, half[i].isSecond)
+		if err != nil {
+			continue
+		}
+		pos, err := replayedGame(pre)
+		if err != nil {
+			continue
+		}
+		line, ok := pos.FindTinue(tinueDepth)
+		if !ok {
+			continue
+		}
+		p, err := newPuzzle(gameID, i, pos.Board.TPS(half[i].player, half[i].number), line, m.MissedWin != nil)
+		if err != nil {
+			l.Warnw("could not build puzzle", "game_id", gameID, "ply", i, zap.Error(err))
+			continue
+		}
+		saved, err := store.SavePuzzle(p)
+		if err != nil {
+			l.Warnw("could not store puzzle", "game_id", gameID, "ply", i, zap.Error(err))
+			continue
+		}
+		if saved {
+			added++
+		}
+	}
+	if added > 0 {
+		l.Infow("mined puzzles", "game_id", gameID, "puzzles", added)
+	}
+	return added
+}
+
+// newPuzzle builds the puzzle for tps, where line is the solver's forced
+// win. Its starting rating grows with the number of moves to find, and
+// with what made the win hard to see in the game.
+func newPuzzle(gameID int64, ply int, tps string, line []*gotak.Move, missed bool) (*Puzzle, error) {
+	solution := moveTexts(line)
+	encoded, err := json.Marshal(solution)
+	if err != nil {
+		return nil, err
+	}
+	_, player, _, err := gotak.ParseTPS(tps)
+	if err != nil {
+		return nil, err
+	}
+
+	depth := (len(line) + 1) / 2
+	first := line[0]
+	themes := []string{themeRoadInOne}
+	rating := 800
+	if depth > 1 {
+		themes = []string{themeTinue}
+		rating = 1000 + 400*(depth-1)
+	}
+	if missed {
+		themes = append(themes, themeMissedWin)
+		rating += 100
+	}
+	if first.Stone == gotak.StoneCap {
+		themes = append(themes, themeCapstone)
+	}
+	if first.MoveDirection != "" {
+		themes = append(themes, themeStackMove)
+		rating += 100
+	}
+
+	return &Puzzle{
+		GameID:       gameID,
+		Ply:          ply,
+		PositionHash: positionHash(tps),
+		TPS:          tps,
+		Player:       player,
+		Solution:     string(encoded),
+		Depth:        depth,
+		Themes:       strings.Join(themes, ","),
+		Rating:       rating,
+	}, nil
+}
+
+// checkAttempt replays moves, the solver's moves so far, against p. Each
+// must be legal and keep a forced win within the puzzle's depth; any such
+// move is accepted, not only the stored solution. While the solver follows
+// the stored line the defender replies as it does, and otherwise with the
+// Tinuë solver's longest defence. It errors on illegal moves and moves
+// played after the attempt was over.
+func checkAttempt(p *Puzzle, moves []string) (PuzzleAttemptResponse, error) {
+	solution := p.solution()
+	resp := PuzzleAttemptResponse{Result: attemptCorrect}
+	var played []string
+	onLine := true
+	for i, text := range moves {
+		if resp.Result != attemptCorrect {
+			return resp, errors.New("the attempt is already over")
+		}
+		pos, err := positionFromRequest(PositionAnalyzeRequest{TPS: p.TPS, Moves: append(slices.Clone(played), text)})
+		if err != nil {
+			return resp, err
+		}
+		played = append(played, text)
+		if onLine {
+			onLine = 2*i < len(solution) && sameMoveText(solution[2*i], text)
+		}
+
+		g, err := puzzleGame(pos)
+		if err != nil {
+			return resp, err
+		}
+		if g.Board.HasRoad(p.Player) {
+			resp.Result, resp.Reply = attemptSolved, ""
+			continue
+		}
+		defence, lost := g.TinueDefence(p.Depth - i - 1)
+		if !lost {
+			resp.Result, resp.Reply = attemptIncorrect, ""
+			continue
+		}
+
+		resp.Reply = defence[0].Text
+		if onLine && 2*i+1 < len(solution) {
+			resp.Reply = solution[2*i+1]
+		}
+		played = append(played, resp.Reply)
+		if len(defence) == 1 {
+			// The defender's only moves complete the solver's road.
+			resp.Result = attemptSolved
+		}
+	}
+	if resp.Result != attemptCorrect {
+		resp.Solution = solution
+	}
+	return resp, nil
+}
+
+// sameMoveText reports whether two PTN strings are the same move, so "a1"
+// matches "Fa1" and "a1+" matches "1a1+1".
+func sameMoveText(a, b string) bool {
+	ma, err := gotak.NewMove(a)
+	if err != nil {
+		return false
+	}
+	mb, err := gotak.NewMove(b)
+	return err == nil && ma.Equal(mb)
+}
+
+// puzzleGame is pos as a game whose board is the position, as the rules
+// engine needs it.
+func puzzleGame(pos analysisPosition) (*gotak.Game, error) {
+	g, err := pos.game()
+	if err != nil {
+		return nil, err
+	}
+	g.Board = pos.board
+	return g, nil
+}
+
+// eloExpected is the chance a player rated a beats one rated b.
+func eloExpected(a, b int) float64 {
+	return 1 / (1 + math.Pow(10, float64(b-a)/400))
+}
+
+// ratePuzzleAttempt records user's first finished attempt at p and moves
+// both ratings. Later attempts change nothing; it returns the user's
+// rating and the change this attempt made.
+func ratePuzzleAttempt(db *gorm.DB, userID int64, p *Puzzle, solved bool) (rating, change int, err error) {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		current := PuzzleRating{UserID: userID, Rating: defaultPuzzleRating}
+		if err := tx.Where(PuzzleRating{UserID: userID}).Attrs(current).FirstOrCreate(&current).Error; err != nil {
+			return err
+		}
+		rating = current.Rating
+
+		score := 0.0
+		if solved {
+			score = 1
+		}
+		expected := eloExpected(current.Rating, p.Rating)
+		attempt := PuzzleAttempt{
+			UserID:   userID,
+			PuzzleID: p.ID,
+			Solved:   solved,
+			Change:   int(math.Round(userPuzzleK * (score - expected))),
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&attempt)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+
+		// The change is applied to the stored rating, not to the one read
+		// above, so attempts at two puzzles at once both count.
+		change = attempt.Change
+		solves := 0
+		if solved {
+			solves = 1
+		}
+		if err := tx.Model(&PuzzleRating{}).Where("user_id = ?", userID).Updates(map[string]any{
+			"rating":   gorm.Expr("rating + ?", change),
+			"attempts": gorm.Expr("attempts + 1"),
+			"solved":   gorm.Expr("solved + ?", solves),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&current, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		rating = current.Rating
+		puzzleChange := int(math.Round(puzzleK * (score - expected)))
+		return tx.Model(&Puzzle{}).Where("id = ?", p.ID).Updates(map[string]any{
+			"rating":   gorm.Expr("rating - ?", puzzleChange),
+			"attempts": gorm.Expr("attempts + 1"),
+			"solves":   gorm.Expr("solves + ?", solves),
+		}).Error
+	})
+	return rating, change, err
+}
+
+// userPuzzleRating is userID's puzzle rating, or the default before their
+// first rated attempt.
+func userPuzzleRating(db *gorm.DB, userID int64) (int, error) {
+	var row PuzzleRating
+	err := db.First(&row, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultPuzzleRating, nil
+	}
+	return row.Rating, err
+}
+
+// nextPuzzle picks the puzzle rated closest to rating, leaving out those
+// userID has already finished, and those with a theme other than theme
+// when it is set.
+func nextPuzzle(db *gorm.DB, userID int64, rating int, theme string) (*Puzzle, error) {
+	q := db.Model(&Puzzle{})
+	if userID != 0 {
+		q = q.Where("id NOT IN (?)", db.Model(&PuzzleAttempt{}).Select("puzzle_id").Where("user_id = ?", userID))
+	}
+	if theme != "" {
+		q = q.Where("',' || themes || ',' LIKE ?", "%,"+theme+",%")
+	}
+	var p Puzzle
+	if err := q.Order(clause.OrderBy{Expression: clause.Expr{SQL: "ABS(rating - ?), id", Vars: []any{rating}, WithoutParentheses: true}}).First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// @Summary Get the next puzzle
+// @Description Returns a puzzle mined from a finished game: find the forced
+// @Description road win for the player to move. Signed-in users get the
+// @Description unfinished puzzle rated closest to their puzzle rating;
+// @Description others get puzzles near the default rating.
+// @Tags puzzles
+// @Produce json
+// @Param theme query string false "Only puzzles with this theme (road-in-one, tinue, missed-win, capstone, stack-move)"
+// @Success 200 {object} PuzzleResponse
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/puzzles/next [get]
+func getNextPuzzleHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+
+	theme := r.URL.Query().Get("theme")
+	if theme != "" && !slices.Contains(puzzleThemes, theme) {
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "unknown puzzle theme "+strconv.Quote(theme)))
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
+		return
+	}
+
+	var userID int64
+	rating := defaultPuzzleRating
+	if user := getUserFromContext(r); user != nil {
+		userID = user.ID
+		if rating, err = store.PuzzleRating(userID); err != nil {
+			l.Errorw("could not load puzzle rating", "user_id", userID, zap.Error(err))
+			writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not load puzzle rating"))
+			return
+		}
+	}
+
+	p, err := store.NextPuzzle(userID, rating, theme)
+	if err != nil {
+		problem := newAPIError(http.StatusNotFound, "no puzzles left")
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			l.Errorw("could not pick a puzzle", zap.Error(err))
+			problem = internalError("could not pick a puzzle", err)
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+
+	resp := newPuzzleResponse(p)
+	if userID != 0 {
+		resp.UserRating = rating
+	}
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render puzzle", zap.Error(err))
+	}
+}
+
+// @Summary Attempt a puzzle
+// @Description Checks the solver's moves so far against the rules engine.
+// @Description While the attempt is correct the response carries the
+// @Description defender's reply; once it is solved or incorrect it carries
+// @Description the solution, and a signed-in user's first finished attempt
+// @Description updates their puzzle rating.
+// @Tags puzzles
+// @Accept json
+// @Produce json
+// @Param id path int true "Puzzle id"
+// @Param request body PuzzleAttemptRequest true "The solver's moves"
+// @Success 200 {object} PuzzleAttemptResponse
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/puzzles/{id}/attempt [post]
+func postPuzzleAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	l := logging.FromContext(r.Context())
+
+	var req PuzzleAttemptRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeProblem(w, r, err)
+		return
+	}
+
+	store, err := requestStore(r)
+	if err != nil {
+		l.Errorw("could not get db", zap.Error(err))
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParamFromCtx(r.Context(), "id"), 10, 64)
+	var p *Puzzle
+	if err == nil {
+		p, err = store.Puzzle(id)
+	}
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			l.Errorw("could not load puzzle", "puzzle", id, zap.Error(err))
+		}
+		writeProblem(w, r, newAPIError(http.StatusNotFound, "puzzle not found"))
+		return
+	}
+
+	resp, err := checkAttempt(p, req.Moves)
+	if err != nil {
+		writeProblem(w, r, &apiError{status: http.StatusBadRequest, code: codeInvalidMove, detail: err.Error()})
+		return
+	}
+
+	if user := getUserFromContext(r); user != nil && resp.Result != attemptCorrect {
+		resp.Rating, resp.Change, err = store.RatePuzzleAttempt(user.ID, p, resp.Result == attemptSolved)
+		if err != nil {
+			l.Errorw("could not rate puzzle attempt", "puzzle", p.ID, "user_id", user.ID, zap.Error(err))
+		}
+	}
+
+	if err := Renderer.JSON(w, http.StatusOK, resp); err != nil {
+		l.Errorw("failed to render puzzle attempt", zap.Error(err))
+	}
+}
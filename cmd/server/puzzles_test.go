@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// storeRoadGame stores a five-by-five game white wins with e1 and returns
+// it with its id.
+func storeRoadGame(t *testing.T, db *gorm.DB, user *User) (*gotak.Game, int64) {
+	t.Helper()
+	slug, err := createGame(db, 5, user.ID, "human")
+	if err != nil {
+		t.Fatalf("createGame: %v", err)
+	}
+	id, err := getGameID(db, slug)
+	if err != nil {
+		t.Fatalf("getGameID: %v", err)
+	}
+	for i, text := range []string{"a5", "a1", "b1", "b5", "c1", "c5", "d1", "d5", "e1"} {
+		player := gotak.PlayerWhite
+		if i%2 == 1 {
+			player = gotak.PlayerBlack
+		}
+		if err := insertMove(db, id, player, text, int64(i/2+1)); err != nil {
+			t.Fatalf("insertMove: %v", err)
+		}
+	}
+	game, err := getGame(db, slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+	return game, id
+}
+
+// tinuePuzzle is a two-move puzzle: white makes a double road threat.
+func tinuePuzzle(t *testing.T) *Puzzle {
+	t.Helper()
+	tps := "2,2,x2,2/x5/x5/x3,1,x/1,1,1,x2 1 4"
+	pos, err := positionFromRequest(PositionAnalyzeRequest{TPS: tps})
+	if err != nil {
+		t.Fatalf("positionFromRequest: %v", err)
+	}
+	g, err := puzzleGame(pos)
+	if err != nil {
+		t.Fatalf("puzzleGame: %v", err)
+	}
+	line, ok := g.FindTinue(tinueDepth)
+	if !ok {
+		t.Fatal("no tinue found")
+	}
+	p, err := newPuzzle(1, 6, tps, line, false)
+	if err != nil {
+		t.Fatalf("newPuzzle: %v", err)
+	}
+	return p
+}
+
+func TestMinePuzzles(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	game, id := storeRoadGame(t, db, user)
+
+	half := gameHalfMoves(game)
+	// The engine disagrees with every move, so the analysis of e1 records
+	// the win it ends in.
+	engine := &stubEngine{moves: slices.Repeat([]string{"a3"}, len(half))}
+	moves := analyzeGame(context.Background(), engine, game, ai.AIConfig{})
+	l := zap.NewNop().Sugar()
+
+	if n := minePuzzles(&gormStore{db: db}, l, id, game, half, moves); n != 0 {
+		t.Errorf("mined %d puzzles from an unfinished game", n)
+	}
+	if err := updateGameStatus(db, game.Slug, gotak.PlayerWhite); err != nil {
+		t.Fatalf("updateGameStatus: %v", err)
+	}
+	if n := minePuzzles(&gormStore{db: db}, l, id, game, half, moves); n != 1 {
+		t.Fatalf("mined %d puzzles, want the position before e1", n)
+	}
+	if n := minePuzzles(&gormStore{db: db}, l, id, game, half, moves); n != 0 {
+		t.Errorf("mined %d puzzles again", n)
+	}
+
+	var p Puzzle
+	if err := db.First(&p).Error; err != nil {
+		t.Fatalf("load puzzle: %v", err)
+	}
+	if p.Ply != 8 || p.Player != gotak.PlayerWhite || p.Depth != 1 || !slices.Equal(p.solution(), []string{"e1"}) {
+		t.Errorf("puzzle = %+v", p)
+	}
+	if !slices.Equal(p.themes(), []string{themeRoadInOne}) || p.Rating != 800 {
+		t.Errorf("themes %v rating %d", p.themes(), p.Rating)
+	}
+}
+
+func TestCheckAttempt(t *testing.T) {
+	p := tinuePuzzle(t)
+	solution := p.solution()
+	if p.Depth != 2 || len(solution) != 3 || !slices.Contains(p.themes(), themeTinue) {
+		t.Fatalf("puzzle = %+v", p)
+	}
+
+	got, err := checkAttempt(p, solution[:1])
+	if err != nil || got.Result != attemptCorrect || got.Reply != solution[1] || got.Solution != nil {
+		t.Fatalf("first move = %+v, %v", got, err)
+	}
+	got, err = checkAttempt(p, []string{solution[0], solution[2]})
+	if err != nil || got.Result != attemptSolved || !slices.Equal(got.Solution, solution) {
+		t.Errorf("solution = %+v, %v", got, err)
+	}
+
+	got, err = checkAttempt(p, []string{"a3"})
+	if err != nil || got.Result != attemptIncorrect || got.Reply != "" || !slices.Equal(got.Solution, solution) {
+		t.Errorf("wrong move = %+v, %v", got, err)
+	}
+	if _, err := checkAttempt(p, []string{"a3", "b3"}); err == nil {
+		t.Error("moves after a failed attempt should be rejected")
+	}
+	if _, err := checkAttempt(p, []string{"a1"}); err == nil {
+		t.Error("an illegal move should be rejected")
+	}
+}
+
+func TestRatePuzzleAttempt(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+	p := tinuePuzzle(t)
+	if err := db.Create(p).Error; err != nil {
+		t.Fatalf("create puzzle: %v", err)
+	}
+	easy, err := newPuzzle(1, 8, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5", []*gotak.Move{{Text: "e1", Square: "e1"}}, false)
+	if err != nil {
+		t.Fatalf("newPuzzle: %v", err)
+	}
+	if err := db.Create(easy).Error; err != nil {
+		t.Fatalf("create puzzle: %v", err)
+	}
+
+	// A new user gets the puzzle nearest the default rating.
+	next, err := nextPuzzle(db, user.ID, defaultPuzzleRating, "")
+	if err != nil || next.ID != p.ID {
+		t.Fatalf("next = %+v, %v; want puzzle %d", next, err, p.ID)
+	}
+	if next, err := nextPuzzle(db, user.ID, defaultPuzzleRating, themeRoadInOne); err != nil || next.ID != easy.ID {
+		t.Errorf("next road-in-one = %+v, %v", next, err)
+	}
+
+	rating, change, err := ratePuzzleAttempt(db, user.ID, p, true)
+	if err != nil || change <= 0 || rating != defaultPuzzleRating+change {
+		t.Fatalf("rating %d change %d, %v", rating, change, err)
+	}
+	if again, c, err := ratePuzzleAttempt(db, user.ID, p, false); err != nil || again != rating || c != 0 {
+		t.Errorf("second attempt = %d, %d, %v; want no change", again, c, err)
+	}
+	if got, err := userPuzzleRating(db, user.ID); err != nil || got != rating {
+		t.Errorf("userPuzzleRating = %d, %v", got, err)
+	}
+
+	var stored Puzzle
+	if err := db.First(&stored, p.ID).Error; err != nil {
+		t.Fatalf("reload puzzle: %v", err)
+	}
+	if stored.Rating >= p.Rating || stored.Attempts != 1 || stored.Solves != 1 {
+		t.Errorf("puzzle after a solve = %+v", stored)
+	}
+
+	// Finished puzzles aren't served again.
+	if next, err := nextPuzzle(db, user.ID, rating, ""); err != nil || next.ID != easy.ID {
+		t.Errorf("next after solving = %+v, %v", next, err)
+	}
+}
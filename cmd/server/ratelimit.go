@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/icco/gutil/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rateLimit is a token bucket budget: Burst requests at once, refilled
+// evenly at Burst per Per. Name keys the buckets and labels the metrics.
+type rateLimit struct {
+	Name  string        `yaml:"-"`
+	Burst int           `yaml:"burst"`
+	Per   time.Duration `yaml:"per"`
+}
+
+// The API's default budgets; settings.RateLimits has the ones in use.
+// Every API request spends from apiLimit; the engine calls also spend from
+// their own stricter budget, and the account endpoints that take a
+// password or send mail from authLimit.
+var (
+	apiLimit      = rateLimit{Name: "api", Burst: 120, Per: time.Minute}
+	aiLimit       = rateLimit{Name: "ai", Burst: 10, Per: time.Minute}
+	analysisLimit = rateLimit{Name: "analysis", Burst: 5, Per: time.Minute}
+	authLimit     = rateLimit{Name: "auth", Burst: 10, Per: time.Minute}
+)
+
+const (
+	// rateLimitIdle is how long a bucket goes unused before it is pruned.
+	// It is longer than any budget's Per, so a pruned bucket was full.
+	rateLimitIdle = time.Hour
+	// rateLimitPruneEvery is how often a limiter prunes its store.
+	rateLimitPruneEvery = 10 * time.Minute
+)
+
+// rateDecision is the outcome of spending from a bucket.
+type rateDecision struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token, when none was left.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// bucket is a token bucket's state: the tokens it held when it was last
+// refilled.
+type bucket struct {
+	Tokens   float64
+	Refilled time.Time
+}
+
+// take refills b for the time since it was last refilled and spends a
+// token if there is one.
+func (b *bucket) take(l rateLimit, now time.Time) rateDecision {
+	burst := float64(l.Burst)
+	perToken := l.Per / time.Duration(max(l.Burst, 1))
+	if elapsed := now.Sub(b.Refilled); elapsed > 0 {
+		b.Tokens = min(burst, b.Tokens+float64(elapsed)/float64(perToken))
+		b.Refilled = now
+	}
+
+	var d rateDecision
+	if b.Tokens >= 1 {
+		b.Tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = time.Duration((1 - b.Tokens) * float64(perToken))
+	}
+	d.Remaining = int(b.Tokens)
+	d.Reset = time.Duration((burst - b.Tokens) * float64(perToken))
+	return d
+}
+
+// rateLimitStore keeps the buckets.
+type rateLimitStore interface {
+	// take spends a token from the bucket for key under l.
+	take(ctx context.Context, key string, l rateLimit, now time.Time) (rateDecision, error)
+	// prune drops the buckets not used since before.
+	prune(ctx context.Context, before time.Time) error
+}
+
+// memoryRateLimitStore keeps buckets in this process, so each server
+// instance has its own budget.
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{buckets: map[string]*bucket{}}
+}
+
+func (s *memoryRateLimitStore) take(_ context.Context, key string, l rateLimit, now time.Time) (rateDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{Tokens: float64(l.Burst), Refilled: now}
+		s.buckets[key] = b
+	}
+	return b.take(l, now), nil
+}
+
+func (s *memoryRateLimitStore) prune(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, b := range s.buckets {
+		if b.Refilled.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
+
+// RateLimitBucket is a token bucket kept in the database, so every server
+// instance spends from the same budget.
+type RateLimitBucket struct {
+	Key        string    `gorm:"column:bucket_key;primaryKey;type:varchar(255)"`
+	Tokens     float64   `gorm:"not null"`
+	RefilledAt time.Time `gorm:"not null;index"`
+}
+
+func (RateLimitBucket) TableName() string { return "rate_limit_buckets" }
+
+// dbRateLimitStore keeps buckets in rate_limit_buckets.
+type dbRateLimitStore struct {
+	db *gorm.DB
+}
+
+// take locks the bucket's row for the read-modify-write. SQLite has no
+// row locks, but its transactions take the write lock when they begin.
+func (s *dbRateLimitStore) take(ctx context.Context, key string, l rateLimit, now time.Time) (rateDecision, error) {
+	var d rateDecision
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		fresh := RateLimitBucket{Key: key, Tokens: float64(l.Burst), RefilledAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fresh).Error; err != nil {
+			return err
+		}
+		var row RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("bucket_key = ?", key).Take(&row).Error; err != nil {
+			return err
+		}
+		b := bucket{Tokens: row.Tokens, Refilled: row.RefilledAt}
+		d = b.take(l, now)
+		return tx.Model(&RateLimitBucket{}).Where("bucket_key = ?", key).
+			Updates(map[string]any{"tokens": b.Tokens, "refilled_at": b.Refilled}).Error
+	})
+	return d, err
+}
+
+func (s *dbRateLimitStore) prune(ctx context.Context, before time.Time) error {
+	return s.db.WithContext(ctx).Where("refilled_at < ?", before).Delete(&RateLimitBucket{}).Error
+}
+
+// rateLimiter applies budgets to requests, per signed-in user or else per
+// client IP.
+type rateLimiter struct {
+	store rateLimitStore
+	// proxies is how many reverse proxies in front of the server append
+	// to X-Forwarded-For; the client IP is the address the outermost one
+	// saw. With none, it is the connection's address.
+	proxies  int
+	now      func() time.Time
+	rejected metric.Int64Counter
+
+	lastPrune atomic.Int64
+}
+
+func newRateLimiter(store rateLimitStore, proxies int) *rateLimiter {
+	rejected, err := otel.Meter(serverName).Int64Counter("gotak.rate_limit.rejected",
+		metric.WithDescription("Requests rejected for exceeding a rate limit."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		log.Warnw("could not create rate limit metric", zap.Error(err))
+	}
+	l := &rateLimiter{store: store, proxies: proxies, now: time.Now, rejected: rejected}
+	l.lastPrune.Store(time.Now().UnixNano())
+	return l
+}
+
+// newRateLimiterFromConfig builds the limiter c asks for: the "memory"
+// store keeps budgets per server instance, "database" shares them through
+// db.
+func newRateLimiterFromConfig(c RateLimits, store Store) *rateLimiter {
+	if c.Store == "database" {
+		return newRateLimiter(store.RateLimitBuckets(), c.TrustedProxies)
+	}
+	return newRateLimiter(newMemoryRateLimitStore(), c.TrustedProxies)
+}
+
+// limit is middleware that spends from budget l. It goes after the
+// authentication middleware, if any, so signed-in users are limited per
+// account rather than per address. Responses carry the budget in
+// RateLimit-* headers; a request over it gets a 429 with Retry-After. If
+// the store fails the request is let through. A nil limiter limits
+// nothing.
+func (rl *rateLimiter) limit(l rateLimit) func(http.Handler) http.Handler {
+	return rl.limitBy(l, nil)
+}
+
+// rateKey finds the bucket key for a request that isn't signed in, as a
+// kind ("user", say) and an id. ok is false when it can't tell.
+type rateKey func(r *http.Request) (kind, id string, ok bool)
+
+// limitBy is limit for requests key can place better than by client IP
+// when they aren't signed in.
+func (rl *rateLimiter) limitBy(l rateLimit, key rateKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rl == nil {
+			return next
+		}
+		policy := fmt.Sprintf("%d;w=%d", l.Burst, int(l.Per.Seconds()))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			kind, id := "ip", rl.clientIP(r)
+			if user := getUserFromContext(r); user != nil {
+				kind, id = "user", strconv.FormatInt(user.ID, 10)
+			} else if key != nil {
+				if k, i, ok := key(r); ok {
+					kind, id = k, i
+				}
+			}
+
+			d, err := rl.take(r.Context(), l, kind, id)
+			if err != nil {
+				logging.FromContext(r.Context()).Warnw("rate limit store failed, allowing request", "policy", l.Name, zap.Error(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(l.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+			h.Set("RateLimit-Policy", policy)
+			if !d.Allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+				writeProblem(w, r, newAPIError(http.StatusTooManyRequests,
+					fmt.Sprintf("rate limit exceeded, retry in %d seconds", ceilSeconds(d.RetryAfter))))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// take spends from the bucket for kind and id under l, counting the
+// rejection if there was nothing to spend. A nil limiter allows
+// everything.
+func (rl *rateLimiter) take(ctx context.Context, l rateLimit, kind, id string) (rateDecision, error) {
+	if rl == nil {
+		return rateDecision{Allowed: true, Remaining: l.Burst}, nil
+	}
+	now := rl.now()
+	rl.maybePrune(ctx, now)
+	d, err := rl.store.take(ctx, l.Name+":"+kind+":"+id, l, now)
+	if err == nil && !d.Allowed && rl.rejected != nil {
+		rl.rejected.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("policy", l.Name), attribute.String("key", kind)))
+	}
+	return d, err
+}
+
+// maybePrune prunes idle buckets if it is time to. One request does it;
+// the others carry on.
+func (rl *rateLimiter) maybePrune(ctx context.Context, now time.Time) {
+	last := rl.lastPrune.Load()
+	if now.UnixNano()-last < int64(rateLimitPruneEvery) || !rl.lastPrune.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	if err := rl.store.prune(ctx, now.Add(-rateLimitIdle)); err != nil {
+		logging.FromContext(ctx).Warnw("could not prune rate limit buckets", zap.Error(err))
+	}
+}
+
+// clientIP is the address the request came from: the connection's peer,
+// or behind rl.proxies proxies, the address the outermost proxy added to
+// X-Forwarded-For. Addresses further left are the client's to forge.
+func (rl *rateLimiter) clientIP(r *http.Request) string {
+	if rl.proxies > 0 {
+		var hops []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(v, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+		if i := len(hops) - rl.proxies; i >= 0 && hops[i] != "" {
+			return hops[i]
+		}
+	}
+	return addrHost(r.RemoteAddr)
+}
+
+// addrHost is the host part of a host:port address.
+func addrHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// ceilSeconds is d in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestBucket(t *testing.T) {
+	l := rateLimit{Name: "test", Burst: 2, Per: 2 * time.Second}
+	start := time.Unix(1000, 0)
+	b := bucket{Tokens: 2, Refilled: start}
+
+	for i, want := range []rateDecision{
+		{Allowed: true, Remaining: 1, Reset: time.Second},
+		{Allowed: true, Remaining: 0, Reset: 2 * time.Second},
+		{Allowed: false, Remaining: 0, RetryAfter: time.Second, Reset: 2 * time.Second},
+	} {
+		if got := b.take(l, start); got != want {
+			t.Errorf("take %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	// Half a token later, the next one is half a second away.
+	if got := b.take(l, start.Add(500*time.Millisecond)); got.Allowed || got.RetryAfter != 500*time.Millisecond {
+		t.Errorf("take after 0.5s = %+v", got)
+	}
+	if got := b.take(l, start.Add(time.Second)); !got.Allowed || got.Remaining != 0 {
+		t.Errorf("take after 1s = %+v", got)
+	}
+	// A long idle refills the bucket to its burst and no further.
+	if got := b.take(l, start.Add(time.Hour)); !got.Allowed || got.Remaining != 1 {
+		t.Errorf("take after an hour = %+v", got)
+	}
+}
+
+func TestRateLimitStores(t *testing.T) {
+	for name, store := range map[string]rateLimitStore{
+		"memory":   newMemoryRateLimitStore(),
+		"database": &dbRateLimitStore{db: setupTestDB(t)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			l := rateLimit{Name: "test", Burst: 2, Per: time.Minute}
+			now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+
+			for i, allowed := range []bool{true, true, false} {
+				d, err := store.take(ctx, "test:ip:192.0.2.1", l, now)
+				if err != nil || d.Allowed != allowed {
+					t.Errorf("take %d = %+v, %v; want allowed %v", i, d, err, allowed)
+				}
+			}
+			if d, err := store.take(ctx, "test:ip:192.0.2.2", l, now); err != nil || !d.Allowed {
+				t.Errorf("another key's take = %+v, %v", d, err)
+			}
+			if d, err := store.take(ctx, "test:ip:192.0.2.1", l, now.Add(30*time.Second)); err != nil || !d.Allowed {
+				t.Errorf("take after a refill = %+v, %v", d, err)
+			}
+
+			// Pruning forgets idle buckets, which start full again.
+			if err := store.prune(ctx, now.Add(time.Minute)); err != nil {
+				t.Fatalf("prune: %v", err)
+			}
+			for range 2 {
+				if d, err := store.take(ctx, "test:ip:192.0.2.1", l, now.Add(31*time.Second)); err != nil || !d.Allowed {
+					t.Errorf("take after prune = %+v, %v", d, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	useTestSettings(t).RateLimits.API.Burst = 2
+	previous := otel.GetMeterProvider()
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	store, err := openStore("memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	limits := newRateLimiter(newMemoryRateLimitStore(), 1)
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	limits.now = func() time.Time { return now }
+	router := buildRouter(routerOptions{IsDev: true, Store: store, RateLimiter: limits})
+
+	user := createTestUser(t, storeDB(store))
+	tokens, err := issueTokens(store, user, "test")
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	get := func(path, forwardedFor, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The client IP is the one the proxy added, whatever the client sent
+	// before it. The unversioned alias shares the /v1 budget.
+	for i, path := range []string{"/v1/ai/engines", "/ai/engines"} {
+		rec := get(path, "203.0.113.9, 192.0.2.1", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != []string{"1", "0"}[i] {
+			t.Errorf("GET %s = %d, RateLimit-Remaining %q", path, rec.Code, rec.Header().Get("RateLimit-Remaining"))
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" || rec.Header().Get("RateLimit-Policy") != "2;w=60" {
+			t.Errorf("GET %s headers = %v", path, rec.Header())
+		}
+	}
+	rec := get("/v1/ai/engines", "198.51.100.7, 192.0.2.1", "")
+	var p Problem
+	_ = json.Unmarshal(rec.Body.Bytes(), &p)
+	if rec.Code != http.StatusTooManyRequests || p.Code != codeRateLimited || !strings.HasPrefix(rec.Header().Get("Content-Type"), problemContentType) {
+		t.Errorf("GET over the limit = %d %s %+v", rec.Code, rec.Header().Get("Content-Type"), p)
+	}
+	if rec.Header().Get("Retry-After") != "30" || rec.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("GET over the limit headers = %v", rec.Header())
+	}
+	if rec := get("/v1/ai/engines", "192.0.2.2", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET from another address = %d", rec.Code)
+	}
+	// Operational endpoints aren't limited.
+	if rec := get("/healthz", "192.0.2.1", ""); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("GET /healthz = %d, %v", rec.Code, rec.Header())
+	}
+
+	// A signed-in user has a budget of their own wherever they come from.
+	for i, ip := range []string{"192.0.2.1", "192.0.2.50", "192.0.2.51"} {
+		want := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}[i]
+		if rec := get("/v1/auth/profile", ip, tokens.Token); rec.Code != want {
+			t.Errorf("GET /v1/auth/profile %d from %s = %d, want %d", i, ip, rec.Code, want)
+		}
+	}
+
+	now = now.Add(30 * time.Second)
+	if rec := get("/v1/ai/engines", "192.0.2.1", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET after a refill = %d", rec.Code)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+	rejected := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "gotak.rate_limit.rejected" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				key, _ := dp.Attributes.Value("key")
+				rejected[key.AsString()] += dp.Value
+			}
+		}
+	}
+	if rejected["ip"] != 1 || rejected["user"] != 1 {
+		t.Errorf("rejections counted = %v, want one per key kind", rejected)
+	}
+}
+
+// TestRefreshRateLimit checks refreshes spend from their user's API budget
+// rather than their address's auth budget.
+func TestRefreshRateLimit(t *testing.T) {
+	s := useTestSettings(t)
+	s.RateLimits.Auth.Burst = 1
+	s.RateLimits.API.Burst = 2
+	store := setupTestStore(t)
+	db := storeDB(store)
+	router := buildRouter(routerOptions{IsDev: true, Store: store, RateLimiter: newRateLimiter(newMemoryRateLimitStore(), 0)})
+
+	refreshTokens := map[string]string{"nobody": "not-a-token"}
+	for _, name := range []string{"alice", "bob"} {
+		user := &User{Provider: "local", ProviderID: name, Email: name + "@example.com", Name: name}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		tokens, err := issueTokens(&gormStore{db: db}, user, "test")
+		if err != nil {
+			t.Fatalf("issueTokens: %v", err)
+		}
+		refreshTokens[name] = tokens.RefreshToken
+	}
+	refresh := func(name string) int {
+		body, _ := json.Marshal(RefreshRequest{RefreshToken: refreshTokens[name]})
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/refresh", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var resp AuthResponse
+		if json.Unmarshal(rec.Body.Bytes(), &resp) == nil && resp.RefreshToken != "" {
+			refreshTokens[name] = resp.RefreshToken
+		}
+		return rec.Code
+	}
+
+	// Everyone comes from the same address, which has an auth budget of one.
+	for i, tc := range []struct {
+		name string
+		want int
+	}{
+		{"alice", http.StatusOK},
+		{"alice", http.StatusOK},
+		{"bob", http.StatusOK},
+		{"alice", http.StatusTooManyRequests},
+		{"nobody", http.StatusUnauthorized},
+	} {
+		if got := refresh(tc.name); got != tc.want {
+			t.Errorf("refresh %d for %s = %d, want %d", i, tc.name, got, tc.want)
+		}
+	}
+}
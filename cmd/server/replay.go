@@ -47,19 +47,20 @@ type PositionResponse struct {
 // @Produce json
 // @Param slug path string true "Game slug identifier"
 // @Success 200 {object} ReplayResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /game/{slug}/replay [get]
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/game/{slug}/replay [get]
 func getReplayHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
 
-	db, game, ok := loadGameForReadWithDB(w, r, l)
+	store, game, ok := loadGameForReadWithStore(w, r, l)
 	if !ok {
 		return
 	}
 
-	times, err := loadMoveTimestamps(db, game.ID)
+	times, err := store.MoveTimestamps(game.ID)
 	if err != nil {
 		// Timestamps are nice-to-have; degrade rather than fail.
 		l.Warnw("could not load move timestamps", "slug", game.Slug, zap.Error(err))
@@ -69,9 +70,7 @@ func getReplayHandler(w http.ResponseWriter, r *http.Request) {
 	steps, err := buildReplaySteps(game, times)
 	if err != nil {
 		l.Errorw("could not build replay", "slug", game.Slug, zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "could not build replay"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not build replay"))
 		return
 	}
 
@@ -96,10 +95,11 @@ func getReplayHandler(w http.ResponseWriter, r *http.Request) {
 // @Param slug path string true "Game slug identifier"
 // @Param turn path int true "Turn number (0 = starting position)"
 // @Success 200 {object} PositionResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
-// @Router /game/{slug}/position/{turn} [get]
+// @Failure 400 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 429 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /v1/game/{slug}/position/{turn} [get]
 func getPositionHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	l := logging.FromContext(ctx)
@@ -108,9 +108,7 @@ func getPositionHandler(w http.ResponseWriter, r *http.Request) {
 	turnNum, err := strconv.ParseInt(turnStr, 10, 64)
 	if err != nil || turnNum < 0 {
 		l.Warnw("invalid turn number", "turn", turnStr, zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusBadRequest, ErrorResponse{Error: "turn must be a non-negative integer"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusBadRequest, "turn must be a non-negative integer"))
 		return
 	}
 
@@ -122,9 +120,7 @@ func getPositionHandler(w http.ResponseWriter, r *http.Request) {
 	board, err := boardAtTurn(game, turnNum)
 	if err != nil {
 		l.Errorw("could not replay to turn", "slug", game.Slug, "turn", turnNum, zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "could not compute position"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "could not compute position"))
 		return
 	}
 
@@ -138,37 +134,33 @@ func getPositionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// loadGameForRead handles the getDB + getGame boilerplate shared by the
+// loadGameForRead handles the store + game lookup boilerplate shared by the
 // read-only game endpoints. It writes the appropriate error response
 // itself; callers should bail when it returns ok=false.
 func loadGameForRead(w http.ResponseWriter, r *http.Request, l *zap.SugaredLogger) (*gotak.Game, bool) {
-	_, game, ok := loadGameForReadWithDB(w, r, l)
+	_, game, ok := loadGameForReadWithStore(w, r, l)
 	return game, ok
 }
 
-// loadGameForReadWithDB also returns the DB handle for callers that
-// need extra queries.
-func loadGameForReadWithDB(w http.ResponseWriter, r *http.Request, l *zap.SugaredLogger) (*gorm.DB, *gotak.Game, bool) {
+// loadGameForReadWithStore also returns the store for callers that need
+// extra queries.
+func loadGameForReadWithStore(w http.ResponseWriter, r *http.Request, l *zap.SugaredLogger) (Store, *gotak.Game, bool) {
 	ctx := r.Context()
-	db, err := getDB()
+	store, err := requestStore(r)
 	if err != nil {
 		l.Errorw("could not get db", zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusInternalServerError, ErrorResponse{Error: "bad connection to db"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, newAPIError(http.StatusInternalServerError, "bad connection to db"))
 		return nil, nil, false
 	}
 
 	slug := ugcPolicy.Sanitize(chi.URLParamFromCtx(ctx, "slug"))
-	game, err := getGame(db, slug)
+	game, err := store.Game(slug)
 	if err != nil {
 		l.Errorw("could not get game", "slug", slug, zap.Error(err))
-		if jerr := Renderer.JSON(w, http.StatusNotFound, ErrorResponse{Error: "game not found"}); jerr != nil {
-			l.Errorw("failed to render JSON", zap.Error(jerr))
-		}
+		writeProblem(w, r, gameLoadError(err))
 		return nil, nil, false
 	}
-	return db, game, true
+	return store, game, true
 }
 
 // loadMoveTimestamps returns CreatedAt for every Move in replay order
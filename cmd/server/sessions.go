@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// accessTokenTTL is deliberately short: revocation is checked on every
+	// request, but a leaked access token is still only useful briefly.
+	accessTokenTTL = 15 * time.Minute
+	// refreshTokenTTL bounds how long a device can stay logged in without
+	// the user typing their password again.
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	errSessionNotFound = errors.New("session not found")
+	errSessionRevoked  = errors.New("session revoked")
+	errSessionExpired  = errors.New("session expired")
+	// errRefreshTokenReused means a refresh token that was already rotated
+	// away was presented again, which only happens if it leaked.
+	errRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// newRefreshToken returns a random 256-bit token, hex encoded.
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// createSession starts a session for userID and returns it along with the
+// raw refresh token, which is only ever handed to the client.
+func createSession(db *gorm.DB, userID int64, userAgent string) (*Session, string, error) {
+	raw, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		UserID:     userID,
+		TokenHash:  hashRefreshToken(raw),
+		UserAgent:  truncate(userAgent, 255),
+		ExpiresAt:  now.Add(refreshTokenTTL),
+		LastUsedAt: now,
+	}
+	if err := db.Create(session).Error; err != nil {
+		return nil, "", err
+	}
+	return session, raw, nil
+}
+
+// rotateSession exchanges a refresh token for a new one on the same
+// session. Presenting the token a session was last rotated from revokes
+// that session outright.
+func rotateSession(db *gorm.DB, raw string) (*Session, string, error) {
+	hash := hashRefreshToken(raw)
+
+	var session Session
+	err := db.Where("token_hash = ?", hash).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var reused Session
+		if db.Where("previous_token_hash = ?", hash).First(&reused).Error == nil {
+			if err := revokeSession(db, reused.ID); err != nil {
+				return nil, "", err
+			}
+			return nil, "", errRefreshTokenReused
+		}
+		return nil, "", errSessionNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := checkSession(&session); err != nil {
+		return nil, "", err
+	}
+
+	next, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	// Matching on the old hash makes concurrent rotations of the same
+	// token lose cleanly instead of both succeeding.
+	result := db.Model(&Session{}).
+		Where("id = ? AND token_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{
+			"token_hash":          hashRefreshToken(next),
+			"previous_token_hash": hash,
+			"last_used_at":        now,
+		})
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, "", errSessionNotFound
+	}
+
+	session.TokenHash = hashRefreshToken(next)
+	session.PreviousTokenHash = hash
+	session.LastUsedAt = now
+	return &session, next, nil
+}
+
+// activeSession loads a session and verifies it can still authenticate
+// requests.
+func activeSession(db *gorm.DB, id int64) (*Session, error) {
+	var session Session
+	if err := db.First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errSessionNotFound
+		}
+		return nil, err
+	}
+	if err := checkSession(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func checkSession(s *Session) error {
+	if s.RevokedAt != nil {
+		return errSessionRevoked
+	}
+	if time.Now().After(s.ExpiresAt) {
+		return errSessionExpired
+	}
+	return nil
+}
+
+// revokeSession is idempotent; revoking an already revoked session keeps
+// the original timestamp.
+func revokeSession(db *gorm.DB, id int64) error {
+	return db.Model(&Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeAllSessions logs a user out everywhere and reports how many
+// sessions were still live.
+func revokeAllSessions(db *gorm.DB, userID int64) (int64, error) {
+	result := db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// parseSessionID reads the session id out of a JWT's jti claim.
+func parseSessionID(jti string) (int64, error) {
+	id, err := strconv.ParseInt(jti, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("token has no session")
+	}
+	return id, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRotateSession(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+
+	session, first, err := createSession(db, user.ID, "test-agent")
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+
+	rotated, second, err := rotateSession(db, first)
+	if err != nil {
+		t.Fatalf("rotateSession: %v", err)
+	}
+	if rotated.ID != session.ID {
+		t.Errorf("rotation moved to session %d, want %d", rotated.ID, session.ID)
+	}
+	if second == first {
+		t.Error("rotation returned the same refresh token")
+	}
+
+	if _, _, err := rotateSession(db, second); err != nil {
+		t.Fatalf("rotating the new token: %v", err)
+	}
+}
+
+func TestRotateSession_reuseRevokes(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+
+	session, first, err := createSession(db, user.ID, "")
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+	_, second, err := rotateSession(db, first)
+	if err != nil {
+		t.Fatalf("rotateSession: %v", err)
+	}
+
+	if _, _, err := rotateSession(db, first); !errors.Is(err, errRefreshTokenReused) {
+		t.Fatalf("replaying rotated token: err = %v, want errRefreshTokenReused", err)
+	}
+	if _, err := activeSession(db, session.ID); !errors.Is(err, errSessionRevoked) {
+		t.Errorf("session after reuse: err = %v, want errSessionRevoked", err)
+	}
+	if _, _, err := rotateSession(db, second); !errors.Is(err, errSessionRevoked) {
+		t.Errorf("current token after reuse: err = %v, want errSessionRevoked", err)
+	}
+}
+
+func TestRotateSession_unknownAndExpired(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+
+	if _, _, err := rotateSession(db, "not-a-token"); !errors.Is(err, errSessionNotFound) {
+		t.Errorf("unknown token: err = %v, want errSessionNotFound", err)
+	}
+
+	session, raw, err := createSession(db, user.ID, "")
+	if err != nil {
+		t.Fatalf("createSession: %v", err)
+	}
+	if err := db.Model(session).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire session: %v", err)
+	}
+	if _, _, err := rotateSession(db, raw); !errors.Is(err, errSessionExpired) {
+		t.Errorf("expired session: err = %v, want errSessionExpired", err)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+
+	var ids []int64
+	for range 3 {
+		s, _, err := createSession(db, user.ID, "")
+		if err != nil {
+			t.Fatalf("createSession: %v", err)
+		}
+		ids = append(ids, s.ID)
+	}
+	if err := revokeSession(db, ids[0]); err != nil {
+		t.Fatalf("revokeSession: %v", err)
+	}
+
+	n, err := revokeAllSessions(db, user.ID)
+	if err != nil {
+		t.Fatalf("revokeAllSessions: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("revoked %d sessions, want 2 (one was already revoked)", n)
+	}
+	for _, id := range ids {
+		if _, err := activeSession(db, id); !errors.Is(err, errSessionRevoked) {
+			t.Errorf("session %d: err = %v, want errSessionRevoked", id, err)
+		}
+	}
+}
+
+func TestAuthenticateAccessToken(t *testing.T) {
+	useTestSettings(t)
+	db := setupTestDB(t)
+	user := createTestUser(t, db)
+
+	resp, err := issueTokens(&gormStore{db: db}, user, "test-agent")
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	if resp.RefreshToken == "" {
+		t.Error("expected a refresh token")
+	}
+	if ttl := time.Until(resp.ExpiresAt); ttl <= 0 || ttl > accessTokenTTL {
+		t.Errorf("access token ttl = %v, want within (0, %v]", ttl, accessTokenTTL)
+	}
+
+	got, session, err := authenticateAccessToken(&gormStore{db: db}, resp.Token)
+	if err != nil {
+		t.Fatalf("authenticateAccessToken: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("user = %d, want %d", got.ID, user.ID)
+	}
+
+	if err := revokeSession(db, session.ID); err != nil {
+		t.Fatalf("revokeSession: %v", err)
+	}
+	if _, _, err := authenticateAccessToken(&gormStore{db: db}, resp.Token); !errors.Is(err, errSessionRevoked) {
+		t.Errorf("token after logout: err = %v, want errSessionRevoked", err)
+	}
+}
+
+func TestParseSessionID(t *testing.T) {
+	for _, bad := range []string{"", "0", "-1", "12abc", "1 OR 1=1"} {
+		if _, err := parseSessionID(bad); err == nil {
+			t.Errorf("parseSessionID(%q) should fail", bad)
+		}
+	}
+	if id, err := parseSessionID("42"); err != nil || id != 42 {
+		t.Errorf("parseSessionID(42) = %d, %v", id, err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/icco/gotak"
+	"gorm.io/gorm"
+)
+
+// snapshotInterval is how many plies apart board snapshots are kept.
+const snapshotInterval = 20
+
+// positionTPS is board as TPS once ply half-moves have been played: White
+// moves on even plies and every turn is two plies.
+func positionTPS(board *gotak.Board, ply int) string {
+	player := gotak.PlayerWhite
+	if ply%2 == 1 {
+		player = gotak.PlayerBlack
+	}
+	return board.TPS(player, int64(ply/2+1))
+}
+
+// gamePlies counts the half-moves in game.
+func gamePlies(game *gotak.Game) int {
+	plies := 0
+	for _, turn := range game.Turns {
+		if turn == nil {
+			continue
+		}
+		if turn.First != nil {
+			plies++
+		}
+		if turn.Second != nil {
+			plies++
+		}
+	}
+	return plies
+}
+
+// loadBoard sets game's board, whose turns are loaded, from the position
+// stored on row. When the row is behind the moves (games from before
+// positions were stored, or moves written some other way) the board is
+// rebuilt from the newest snapshot, or by replaying the whole game if
+// there is none.
+func loadBoard(db *gorm.DB, row *Game, game *gotak.Game) error {
+	plies := gamePlies(game)
+	if row.Position != "" && row.PositionPly == plies {
+		board, _, _, err := gotak.ParseTPS(row.Position)
+		if err != nil {
+			return fmt.Errorf("stored position: %w", err)
+		}
+		game.Board = board
+		return nil
+	}
+
+	var snap BoardSnapshot
+	err := db.Where("game_id = ? AND ply <= ?", row.ID, plies).Order("ply DESC").First(&snap).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return replayMoves(game)
+	}
+	if err != nil {
+		return err
+	}
+	board, _, _, err := gotak.ParseTPS(snap.TPS)
+	if err != nil {
+		return fmt.Errorf("snapshot at ply %d: %w", snap.Ply, err)
+	}
+	game.Board = board
+	return applyMoves(game, snap.Ply, nil)
+}
+
+// savePosition stores game's board, after its last move, on the games row
+// and, every snapshotInterval plies, as a board snapshot.
+func savePosition(db *gorm.DB, gameID int64, game *gotak.Game) error {
+	plies := gamePlies(game)
+	tps := positionTPS(game.Board, plies)
+	hash := positionHash(tps)
+	if err := db.Model(&Game{}).Where("id = ?", gameID).Updates(map[string]any{
+		"position":      tps,
+		"position_hash": hash,
+		"position_ply":  plies,
+	}).Error; err != nil {
+		return err
+	}
+	if plies == 0 || plies%snapshotInterval != 0 {
+		return nil
+	}
+	return db.Create(&BoardSnapshot{GameID: gameID, Ply: plies, TPS: tps, Hash: hash}).Error
+}
+
+// boardMismatch is a stored position that doesn't match the moves.
+type boardMismatch struct {
+	Slug string
+	Ply  int
+	What string // "game" for the games row, "snapshot" for a board snapshot
+	Want string
+	Got  string
+}
+
+// verifyBoards replays the game in row from its moves and compares every
+// stored position. With fix, the games row is rewritten and bad snapshots
+// are replaced; missing ones are added.
+func verifyBoards(db *gorm.DB, row *Game, fix bool) ([]boardMismatch, error) {
+	game, _, err := loadGameRecord(db, row.Slug)
+	if err != nil {
+		return nil, err
+	}
+	var snaps []BoardSnapshot
+	if err := db.Where("game_id = ?", row.ID).Order("ply").Find(&snaps).Error; err != nil {
+		return nil, err
+	}
+	stored := make(map[int]BoardSnapshot, len(snaps))
+	for _, s := range snaps {
+		stored[s.Ply] = s
+	}
+
+	if err := game.Board.Init(); err != nil {
+		return nil, err
+	}
+	var out []boardMismatch
+	want := map[int]string{}
+	err = applyMoves(game, 0, func(ply int) error {
+		if ply%snapshotInterval == 0 {
+			want[ply] = positionTPS(game.Board, ply)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	plies := gamePlies(game)
+	final := positionTPS(game.Board, plies)
+
+	if row.Position != final || row.PositionPly != plies || row.PositionHash != positionHash(final) {
+		out = append(out, boardMismatch{Slug: row.Slug, Ply: plies, What: "game", Want: final, Got: row.Position})
+	}
+	for ply, s := range stored {
+		if tps, ok := want[ply]; !ok || s.TPS != tps || s.Hash != positionHash(tps) {
+			out = append(out, boardMismatch{Slug: row.Slug, Ply: ply, What: "snapshot", Want: tps, Got: s.TPS})
+		}
+	}
+	if !fix || len(out) == 0 && len(want) == len(stored) {
+		return out, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Game{}).Where("id = ?", row.ID).Updates(map[string]any{
+			"position":      final,
+			"position_hash": positionHash(final),
+			"position_ply":  plies,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("game_id = ?", row.ID).Delete(&BoardSnapshot{}).Error; err != nil {
+			return err
+		}
+		for ply, tps := range want {
+			if err := tx.Create(&BoardSnapshot{GameID: row.ID, Ply: ply, TPS: tps, Hash: positionHash(tps)}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+const verifyUsage = "usage: server verify [--fix] [slug ...]"
+
+// runVerify is the verify subcommand: it replays games from their moves
+// and reports stored positions that disagree, for every game or the slugs
+// given. With --fix it rewrites them. It fails if it found mismatches it
+// didn't fix.
+func runVerify(out io.Writer, url string, args []string) error {
+	fix := false
+	var slugs []string
+	for _, arg := range args {
+		switch {
+		case arg == "--fix":
+			fix = true
+		case strings.HasPrefix(arg, "-"):
+			return errors.New(verifyUsage)
+		default:
+			slugs = append(slugs, arg)
+		}
+	}
+
+	store, err := openStore(url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+	if err := store.CheckSchema(); err != nil {
+		return err
+	}
+
+	checked, bad, failed := 0, 0, 0
+	err = store.Games(slugs, func(row *Game) error {
+		checked++
+		mismatches, err := store.VerifyBoards(row, fix)
+		if err != nil {
+			failed++
+			_, _ = fmt.Fprintf(out, "%s: %v\n", row.Slug, err)
+			return nil
+		}
+		if len(mismatches) > 0 {
+			bad++
+		}
+		for _, m := range mismatches {
+			_, _ = fmt.Fprintf(out, "%s: %s at ply %d is %q, moves give %q\n", m.Slug, m.What, m.Ply, m.Got, m.Want)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(slugs) > checked {
+		return fmt.Errorf("found %d of %d games", checked, len(slugs))
+	}
+
+	_, _ = fmt.Fprintf(out, "checked %d games: %d mismatched, %d could not be replayed\n", checked, bad, failed)
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d games could not be replayed", failed)
+	case bad > 0 && !fix:
+		return fmt.Errorf("%d games have stored positions that don't match their moves; rerun with --fix", bad)
+	}
+	return nil
+}
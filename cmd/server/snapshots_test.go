@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/icco/gotak"
+	"gorm.io/gorm"
+)
+
+// playColumns plays plies placements on an eight-by-eight board, file by
+// file. No row gets more than six stones, so nobody makes a road.
+func playColumns(t *testing.T, db *gorm.DB, slug string, white, black *User, plies int) {
+	t.Helper()
+	for ply := range plies {
+		user, player := white, gotak.PlayerWhite
+		if ply%2 == 1 {
+			user, player = black, gotak.PlayerBlack
+		}
+		square := fmt.Sprintf("%c%d", 'a'+ply/8, ply%8+1)
+		if _, err := submitMove(db, slug, user.ID, player, square, ""); err != nil {
+			t.Fatalf("ply %d, %s: %v", ply, square, err)
+		}
+	}
+}
+
+// replayedBoard is slug's board rebuilt from its moves alone.
+func replayedBoard(t *testing.T, db *gorm.DB, slug string) *gotak.Game {
+	t.Helper()
+	game, _, err := loadGameRecord(db, slug)
+	if err != nil {
+		t.Fatalf("loadGameRecord: %v", err)
+	}
+	if err := replayMoves(game); err != nil {
+		t.Fatalf("replayMoves: %v", err)
+	}
+	return game
+}
+
+func sameBoard(t *testing.T, got, want *gotak.Game) bool {
+	t.Helper()
+	a, err := json.Marshal(got.Board)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	b, err := json.Marshal(want.Board)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return bytes.Equal(a, b)
+}
+
+func TestStoredPosition(t *testing.T) {
+	db, slug, white, black := setupMoveGame(t, testSQLiteURL(t), 8)
+	const plies = 45
+	playColumns(t, db, slug, white, black, plies)
+
+	var row Game
+	if err := db.Where("slug = ?", slug).First(&row).Error; err != nil {
+		t.Fatalf("load game: %v", err)
+	}
+	replayed := replayedBoard(t, db, slug)
+	if tps := positionTPS(replayed.Board, plies); row.Position != tps || row.PositionPly != plies || row.PositionHash != positionHash(tps) {
+		t.Errorf("stored position %q at ply %d, want %q at %d", row.Position, row.PositionPly, tps, plies)
+	}
+	var snaps []BoardSnapshot
+	if err := db.Where("game_id = ?", row.ID).Order("ply").Find(&snaps).Error; err != nil {
+		t.Fatalf("load snapshots: %v", err)
+	}
+	if len(snaps) != 2 || snaps[0].Ply != 20 || snaps[1].Ply != 40 {
+		t.Errorf("snapshots = %+v, want plies 20 and 40", snaps)
+	}
+
+	game, err := getGame(db, slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+	if !sameBoard(t, game, replayed) {
+		t.Error("board read from the stored position differs from the replayed one")
+	}
+
+	// A row behind its moves is rebuilt from the newest snapshot, and
+	// without snapshots from the moves.
+	if err := db.Model(&Game{}).Where("id = ?", row.ID).Updates(map[string]any{"position": "", "position_ply": 0}).Error; err != nil {
+		t.Fatalf("clear position: %v", err)
+	}
+	if game, err := getGame(db, slug); err != nil || !sameBoard(t, game, replayed) {
+		t.Errorf("board rebuilt from a snapshot: %v", err)
+	}
+	if err := db.Where("game_id = ?", row.ID).Delete(&BoardSnapshot{}).Error; err != nil {
+		t.Fatalf("delete snapshots: %v", err)
+	}
+	if game, err := getGame(db, slug); err != nil || !sameBoard(t, game, replayed) {
+		t.Errorf("board replayed without snapshots: %v", err)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	url := testSQLiteURL(t)
+	db, slug, white, black := setupMoveGame(t, url, 8)
+	playColumns(t, db, slug, white, black, 25)
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runVerify(&out, url, args)
+		return out.String(), err
+	}
+
+	if out, err := run(); err != nil || !strings.Contains(out, "checked 1 games: 0 mismatched") {
+		t.Fatalf("verify = %q, %v", out, err)
+	}
+	if _, err := run("--bogus"); err == nil {
+		t.Error("verify should reject unknown flags")
+	}
+	if _, err := run("nosuchgame"); err == nil {
+		t.Error("verify should report unknown slugs")
+	}
+
+	// Corrupt the stored position and the snapshot.
+	if err := db.Model(&Game{}).Where("slug = ?", slug).Update("position", "x8/x8/x8/x8/x8/x8/x8/x8 1 1").Error; err != nil {
+		t.Fatalf("corrupt position: %v", err)
+	}
+	if err := db.Model(&BoardSnapshot{}).Where("ply = ?", 20).Update("tps", "x8/x8/x8/x8/x8/x8/x8/x8 1 11").Error; err != nil {
+		t.Fatalf("corrupt snapshot: %v", err)
+	}
+	out, err := run(slug)
+	if err == nil || !strings.Contains(out, slug+": game at ply 25") || !strings.Contains(out, slug+": snapshot at ply 20") {
+		t.Errorf("verify after corruption = %q, %v", out, err)
+	}
+
+	if out, err := run("--fix"); err != nil || !strings.Contains(out, "1 mismatched") {
+		t.Errorf("verify --fix = %q, %v", out, err)
+	}
+	if out, err := run(); err != nil || !strings.Contains(out, "0 mismatched") {
+		t.Errorf("verify after fixing = %q, %v", out, err)
+	}
+	game, err := getGame(db, slug)
+	if err != nil {
+		t.Fatalf("getGame: %v", err)
+	}
+	if !sameBoard(t, game, replayedBoard(t, db, slug)) {
+		t.Error("fixed position differs from the replayed one")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/icco/gotak"
+)
+
+func TestOpenStore(t *testing.T) {
+	for _, url := range []string{"", "sqlite:"} {
+		if _, err := openStore(url); err == nil {
+			t.Errorf("openStore(%q) should fail", url)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "gotak.db")
+	store, err := openStore("sqlite:" + path)
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	// A new file has no schema until it is migrated.
+	if err := store.CheckSchema(); err == nil {
+		t.Fatal("CheckSchema should fail before migrating")
+	}
+	if _, err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	user := &User{Provider: "local", ProviderID: "p1", Email: "a@example.com", Name: "A"}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	slug, err := store.CreateGame(5, user.ID, "human")
+	if err != nil {
+		t.Fatalf("CreateGame: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A SQLite store keeps its games across restarts.
+	store, err = openStore("sqlite://" + path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if err := store.CheckSchema(); err != nil {
+		t.Errorf("CheckSchema after reopening: %v", err)
+	}
+	if game, err := store.Game(slug); err != nil || game.Board.Size != 5 {
+		t.Errorf("Game after reopening = %v, %v", game, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, err := openStore("memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	user := &User{Provider: "local", ProviderID: "p1", Email: "a@example.com", Name: "A"}
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if got, err := store.UserByEmail("a@example.com", "local"); err != nil || got.ID != user.ID {
+		t.Errorf("UserByEmail = %v, %v", got, err)
+	}
+	if _, err := store.UserByEmail("a@example.com", "github"); err == nil {
+		t.Error("UserByEmail should match the provider")
+	}
+	if err := store.UpdateUser(user, map[string]any{"name": "B"}); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if got, err := store.User(user.ID); err != nil || got.Name != "B" {
+		t.Errorf("User = %v, %v", got, err)
+	}
+
+	slug, err := store.CreateGame(5, user.ID, "human")
+	if err != nil {
+		t.Fatalf("CreateGame: %v", err)
+	}
+	record, err := store.GameRecord(slug)
+	if err != nil {
+		t.Fatalf("GameRecord: %v", err)
+	}
+	if _, err := store.RecordMove(record, gotak.PlayerWhite, "a1"); err != nil {
+		t.Fatalf("RecordMove: %v", err)
+	}
+	if err := store.UpdateTag(slug, "Event", "LAN cup"); err != nil {
+		t.Fatalf("UpdateTag: %v", err)
+	}
+	game, err := store.Game(slug)
+	if err != nil {
+		t.Fatalf("Game: %v", err)
+	}
+	if event, _ := game.GetMeta("Event"); event != "LAN cup" || len(game.Turns) != 1 || game.Turns[0].First.Text != "a1" {
+		t.Errorf("game = %+v, event %q", game.Turns, event)
+	}
+}
+
+// TestRouterStore drives the real handlers against an in-memory store:
+// register, log in, create a game and fetch it.
+func TestRouterStore(t *testing.T) {
+	useTestSettings(t)
+	store, err := openStore("memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	srv := httptest.NewServer(buildRouter(routerOptions{IsDev: true, Store: store}))
+	t.Cleanup(srv.Close)
+
+	post := func(path, token string, body any) *http.Response {
+		t.Helper()
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	creds := RegisterRequest{Email: "lan@example.com", Password: "correct horse", Name: "LAN"}
+	if resp := post("/auth/register", "", creds); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("register status = %d", resp.StatusCode)
+	}
+	resp := post("/auth/login", "", LoginRequest{Email: creds.Email, Password: creds.Password})
+	var auth AuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil || auth.Token == "" {
+		t.Fatalf("login = %d, %v", resp.StatusCode, err)
+	}
+
+	resp = post("/game/new", auth.Token, CreateGameRequest{Size: "5"})
+	var state GameStateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("new game = %d, %v", resp.StatusCode, err)
+	}
+
+	got, err := http.Get(srv.URL + "/game/" + state.Game.Slug) //nolint:noctx // test
+	if err != nil {
+		t.Fatalf("get game: %v", err)
+	}
+	t.Cleanup(func() { _ = got.Body.Close() })
+	if got.StatusCode != http.StatusOK {
+		t.Errorf("get game status = %d", got.StatusCode)
+	}
+
+	// Without a store, handlers report a server error.
+	bare := httptest.NewServer(buildRouter(routerOptions{IsDev: true}))
+	t.Cleanup(bare.Close)
+	missing, err := http.Get(bare.URL + "/game/" + state.Game.Slug) //nolint:noctx // test
+	if err != nil {
+		t.Fatalf("get game: %v", err)
+	}
+	t.Cleanup(func() { _ = missing.Body.Close() })
+	if missing.StatusCode != http.StatusInternalServerError {
+		t.Errorf("storeless status = %d, want 500", missing.StatusCode)
+	}
+}
@@ -0,0 +1,113 @@
+// Package main implements takbook, which builds an opening book for the AI
+// engines from finished games in PTN files:
+//
+//	takbook -o book.gtb games/*.ptn
+//
+// Files may hold several games, as takmatch writes them. The server reads
+// the book from OPENING_BOOK, and takmatch from --book.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+)
+
+var opts struct {
+	Output flags.Filename   `short:"o" long:"output" description:"Book file to write" required:"true"`
+	Plies  int              `short:"p" long:"plies" description:"Half-moves of each game to add" default:"16"`
+	Merge  []flags.Filename `short:"m" long:"merge" description:"Existing book to add to the new one; may be repeated"`
+	Args   struct {
+		Files []flags.Filename `positional-arg-name:"PTN" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func main() {
+	if _, err := flags.Parse(&opts); err != nil {
+		os.Exit(1)
+	}
+
+	book := ai.NewBook()
+	for _, path := range opts.Merge {
+		b, err := ai.LoadBook(string(path))
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		book.Merge(b)
+	}
+
+	added, skipped := 0, 0
+	for _, path := range opts.Args.Files {
+		data, err := os.ReadFile(string(path))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, text := range splitPTN(data) {
+			if err := addGame(book, text); err != nil {
+				log.Printf("%s game %d: %v", path, i+1, err)
+				skipped++
+				continue
+			}
+			added++
+		}
+	}
+
+	if err := book.Save(string(opts.Output)); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d games added (%d skipped), %d positions in %s\n", added, skipped, book.Len(), opts.Output)
+}
+
+// addGame adds one PTN game to book. Games without a result are skipped.
+func addGame(book *ai.Book, text []byte) error {
+	g, err := gotak.ParsePTN(text)
+	if err != nil {
+		return err
+	}
+	result, _ := g.GetMeta("Result")
+	if result == "" && len(g.Turns) > 0 {
+		result = g.Turns[len(g.Turns)-1].Result
+	}
+	winner, ok := ai.GameWinner(result)
+	if !ok {
+		return fmt.Errorf("no result")
+	}
+	return book.AddGame(g, winner, opts.Plies)
+}
+
+// splitPTN splits data into games: a tag after move text starts a new
+// game.
+func splitPTN(data []byte) [][]byte {
+	var games [][]byte
+	var cur bytes.Buffer
+	inMoves := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "["):
+			if inMoves {
+				games = append(games, bytes.Clone(cur.Bytes()))
+				cur.Reset()
+				inMoves = false
+			}
+		case trimmed != "":
+			inMoves = true
+		}
+		cur.WriteString(line)
+		cur.WriteByte('\n')
+	}
+	if strings.TrimSpace(cur.String()) != "" {
+		games = append(games, cur.Bytes())
+	}
+	return games
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+)
+
+func TestSplitPTN(t *testing.T) {
+	data := []byte(`[Size "5"]
+[Result "R-0"]
+
+1. a1 e5
+2. e4 R-0
+
+[Size "5"]
+[Result "0-R"]
+
+1. a1 e5
+
+[Size "5"]
+`)
+	games := splitPTN(data)
+	if len(games) != 3 {
+		t.Fatalf("split into %d games: %q", len(games), games)
+	}
+
+	opts.Plies = 16
+	book := ai.NewBook()
+	for i, want := range []bool{true, true, false} {
+		if err := addGame(book, games[i]); (err == nil) != want {
+			t.Errorf("game %d: addGame = %v", i+1, err)
+		}
+	}
+	start, err := gotak.NewGame(5, 0, "start")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	if moves, err := book.Moves(start); err != nil || len(moves) != 1 || moves[0].Games() != 2 {
+		t.Errorf("first moves = %+v, %v", moves, err)
+	}
+}
@@ -0,0 +1,204 @@
+// Package main implements takmatch, which plays AI engine configurations
+// against each other to measure whether a change makes an engine stronger.
+//
+// Every opening is played twice with colours swapped. Games are written as
+// PTN with the seed each was played with, and the result is reported as wins, draws and losses for the first
+// engine with the Elo difference and an SPRT verdict:
+//
+//	takmatch -a gotak,level=expert -b gotak,level=advanced -n 100
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+)
+
+var opts struct {
+	First    string         `short:"a" long:"first" description:"First engine: name[,level=...][,style=...][,time=...][,nodes=...]" required:"true"`
+	Second   string         `short:"b" long:"second" description:"Second engine, as for --first" required:"true"`
+	Games    int            `short:"n" long:"games" description:"Games to play; rounded up to an even number" default:"20"`
+	Size     int64          `short:"s" long:"size" description:"Board size for the default openings" default:"5"`
+	Openings flags.Filename `short:"o" long:"openings" description:"File of opening TPS positions, one per line, white to move"`
+	Engines  flags.Filename `short:"e" long:"engines" description:"Engines config file adding engines such as TEI ones (as ENGINES_CONFIG)"`
+	Book     flags.Filename `long:"book" description:"Opening book built by takbook for both engines to play from"`
+	Variety  float64        `long:"book-variety" description:"How far book play strays from the best book move" default:"1"`
+	PTN      flags.Filename `short:"p" long:"ptn" description:"File to write the games to as PTN" default:"takmatch.ptn"`
+	MaxMoves int            `long:"max-moves" description:"Adjudicate a draw after this many moves" default:"300"`
+	Seed     int64          `long:"seed" description:"Seed for game N is this plus N, so a match can be replayed; random if 0"`
+	Elo0     float64        `long:"elo0" description:"SPRT null hypothesis Elo difference" default:"0"`
+	Elo1     float64        `long:"elo1" description:"SPRT alternative hypothesis Elo difference" default:"10"`
+	Alpha    float64        `long:"alpha" description:"SPRT false positive rate" default:"0.05"`
+	Beta     float64        `long:"beta" description:"SPRT false negative rate" default:"0.05"`
+}
+
+func main() {
+	if _, err := flags.Parse(&opts); err != nil {
+		os.Exit(1)
+	}
+
+	reg := ai.NewDefaultRegistry()
+	if opts.Engines != "" {
+		var err error
+		if reg, err = ai.LoadRegistry(string(opts.Engines)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if opts.Book != "" {
+		book, err := ai.LoadBook(string(opts.Book))
+		if err != nil {
+			log.Fatal(err)
+		}
+		reg.UseBook(book, ai.BookOptions{Variety: opts.Variety})
+	}
+	defer func() {
+		if err := reg.Close(); err != nil {
+			log.Printf("engine shutdown: %v", err)
+		}
+	}()
+
+	a, err := parsePlayer(reg, opts.First)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := parsePlayer(reg, opts.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	openings := defaultOpenings(opts.Size)
+	if opts.Openings != "" {
+		if openings, err = readOpenings(string(opts.Openings)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	out, err := os.Create(string(opts.PTN))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			log.Printf("close %s: %v", opts.PTN, err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	test := sprt{elo0: opts.Elo0, elo1: opts.Elo1, alpha: opts.Alpha, beta: opts.Beta}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Int64N(1 << 53) // #nosec G404 -- game variety, not security
+	}
+	s, err := runMatch(ctx, a, b, openings, opts.Games, opts.MaxMoves, seed, out, os.Stdout)
+	if err != nil {
+		log.Printf("match stopped: %v", err)
+	}
+	report(os.Stdout, a, b, s, test)
+}
+
+// readOpenings reads TPS positions from path, one per line. Blank lines
+// and lines starting with # are skipped.
+func readOpenings(path string) ([]string, error) {
+	f, err := os.Open(path) // #nosec G304 -- path comes from the command line
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var openings []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		openings = append(openings, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(openings) == 0 {
+		return nil, fmt.Errorf("%s has no openings", path)
+	}
+	return openings, nil
+}
+
+// runMatch plays games games between a and b, cycling through openings
+// and playing each twice with colours swapped. Game N is played with seed
+// plus N. Each game is written to ptn as it finishes and a line about it
+// to progress. It returns the score so far if ctx is canceled or an
+// opening is invalid.
+func runMatch(ctx context.Context, a, b *player, openings []string, games, maxPlies int, seed int64, ptn, progress io.Writer) (score, error) {
+	var s score
+	for round := 0; round < games+games%2; round++ {
+		tps := openings[(round/2)%len(openings)]
+		white, black := a, b
+		if round%2 == 1 {
+			white, black = b, a
+		}
+
+		g, err := openingGame(tps)
+		if err != nil {
+			return s, err
+		}
+		gameSeed := seed + int64(round) + 1
+		res, err := playGame(ctx, g, white, black, maxPlies, gameSeed)
+		if err != nil {
+			return s, err
+		}
+
+		switch {
+		case res.winner == 0:
+			s.draws++
+		case (res.winner == gotak.PlayerWhite) == (white == a):
+			s.wins++
+		default:
+			s.losses++
+		}
+
+		text, err := gamePTN(g, round+1, white, black, gameSeed, res)
+		if err != nil {
+			return s, err
+		}
+		if _, err := fmt.Fprintln(ptn, text); err != nil {
+			return s, err
+		}
+		line := fmt.Sprintf("game %d: %s vs %s %s", round+1, white.label, black.label, res.result)
+		if res.reason != "" {
+			line += " (" + res.reason + ")"
+		}
+		_, _ = fmt.Fprintf(progress, "%s  [+%d =%d -%d]\n", line, s.wins, s.draws, s.losses)
+	}
+	return s, nil
+}
+
+// report prints the match result from a's point of view.
+func report(w io.Writer, a, b *player, s score, test sprt) {
+	_, _ = fmt.Fprintf(w, "\n%s vs %s: %d games, +%d =%d -%d\n", a.label, b.label, s.games(), s.wins, s.draws, s.losses)
+	if s.games() == 0 {
+		return
+	}
+	diff, margin := s.elo()
+	elo := fmt.Sprintf("%+.1f ± %.1f", diff, margin)
+	if math.IsInf(diff, 0) || math.IsNaN(margin) {
+		elo = fmt.Sprintf("%+.0f (a clean sweep has no finite estimate)", diff)
+	}
+	_, _ = fmt.Fprintf(w, "Score %.1f%%, Elo %s, LOS %.1f%%\n", 100*s.mean(), elo, 100*s.los())
+	lower, upper := test.bounds()
+	_, _ = fmt.Fprintf(w, "SPRT elo0=%g elo1=%g alpha=%g beta=%g: LLR %.2f (%.2f, %.2f), %s\n",
+		test.elo0, test.elo1, test.alpha, test.beta, test.llr(s), lower, upper, test.verdict(s))
+}
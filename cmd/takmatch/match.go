@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+)
+
+// player is one side of a match: a registered engine with its settings.
+type player struct {
+	label  string
+	engine ai.Engine
+	cfg    ai.AIConfig
+}
+
+// parsePlayer reads a spec such as "gotak,level=expert,style=aggressive,time=500ms":
+// an engine name from reg followed by optional settings. nodes=N searches
+// N positions instead of for a time, which with a seed makes games
+// repeatable. The spec is the player's label in reports and PTN.
+func parsePlayer(reg *ai.Registry, spec string) (*player, error) {
+	fields := strings.Split(spec, ",")
+	engine, _, err := reg.Get(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	p := &player{
+		label:  spec,
+		engine: engine,
+		cfg:    ai.AIConfig{Level: ai.Intermediate, Style: ai.Balanced, TimeLimit: time.Second},
+	}
+	for _, f := range fields[1:] {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: setting %q is not key=value", spec, f)
+		}
+		switch key {
+		case "level":
+			switch value {
+			case "beginner":
+				p.cfg.Level = ai.Beginner
+			case "intermediate":
+				p.cfg.Level = ai.Intermediate
+			case "advanced":
+				p.cfg.Level = ai.Advanced
+			case "expert":
+				p.cfg.Level = ai.Expert
+			default:
+				return nil, fmt.Errorf("%q: unknown level %q", spec, value)
+			}
+		case "style":
+			switch s := ai.Style(value); s {
+			case ai.Aggressive, ai.Defensive, ai.Balanced:
+				p.cfg.Style = s
+			default:
+				return nil, fmt.Errorf("%q: unknown style %q", spec, value)
+			}
+		case "time":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("%q: invalid time %q", spec, value)
+			}
+			p.cfg.TimeLimit = d
+		case "nodes":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("%q: invalid nodes %q", spec, value)
+			}
+			p.cfg.Nodes = n
+		default:
+			return nil, fmt.Errorf("%q: unknown setting %q", spec, key)
+		}
+	}
+	return p, nil
+}
+
+// outcome is a finished game from white's point of view.
+type outcome struct {
+	// winner is gotak.PlayerWhite, gotak.PlayerBlack or 0 for a draw.
+	winner int
+	// result is the PTN result: "R-0", "0-F", "1/2-1/2" and so on.
+	result string
+	// reason explains forfeits and adjudicated draws.
+	reason string
+}
+
+// openingGame returns a game starting from tps, which must have white to
+// move so turns can be numbered from it.
+func openingGame(tps string) (*gotak.Game, error) {
+	b, toMove, move, err := gotak.ParseTPS(tps)
+	if err != nil {
+		return nil, fmt.Errorf("opening %q: %w", tps, err)
+	}
+	if toMove != gotak.PlayerWhite {
+		return nil, fmt.Errorf("opening %q: white must be to move", tps)
+	}
+	g, err := gotak.NewGame(b.Size, 0, "takmatch")
+	if err != nil {
+		return nil, err
+	}
+	g.Board = b
+	if move > 1 || tps != b.TPS(gotak.PlayerWhite, 1) {
+		if err := g.UpdateMeta("TPS", tps); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// defaultOpenings are the positions played when no openings file is
+// given: the empty board, and the first two flats in adjacent or opposite
+// corners.
+func defaultOpenings(size int64) []string {
+	empties := func(n int64) string {
+		if n == 1 {
+			return "x"
+		}
+		return fmt.Sprintf("x%d", n)
+	}
+	board := func(top, bottom string) string {
+		rows := slices.Repeat([]string{empties(size)}, int(size))
+		if top != "" {
+			rows[0] = top
+		}
+		if bottom != "" {
+			rows[size-1] = bottom
+		}
+		return strings.Join(rows, "/")
+	}
+	return []string{
+		board("", "") + " 1 1",
+		board("", "2,"+empties(size-2)+",1") + " 1 2",
+		board(empties(size-1)+",1", "2,"+empties(size-1)) + " 1 2",
+	}
+}
+
+// playGame plays white against black from g's position until GameOver
+// reports a result or maxPlies moves have been played, which is a draw.
+// Both engines search with seed. An engine that errors or answers with an
+// illegal move forfeits.
+func playGame(ctx context.Context, g *gotak.Game, white, black *player, maxPlies int, seed int64) (outcome, error) {
+	sides := map[int]*player{gotak.PlayerWhite: white, gotak.PlayerBlack: black}
+	for ply := 0; ; ply++ {
+		if winner, over := g.GameOver(); over {
+			return finished(g, winner), nil
+		}
+		if ply >= maxPlies {
+			return outcome{result: "1/2-1/2", reason: fmt.Sprintf("adjudicated a draw after %d moves", maxPlies)}, nil
+		}
+
+		toMove, opening := g.ToMove()
+		side := sides[toMove]
+		cfg := side.cfg
+		cfg.Seed = seed
+		text, err := side.engine.GetMove(ctx, g, cfg)
+		if ctx.Err() != nil {
+			return outcome{}, ctx.Err()
+		}
+		if err != nil {
+			return forfeit(toMove, fmt.Sprintf("%s failed: %v", side.label, err)), nil
+		}
+		mv, err := gotak.NewMove(text)
+		if err == nil {
+			_, legal := g.LegalMoves()
+			if !slices.ContainsFunc(legal, mv.Equal) {
+				err = errors.New("not a legal move")
+			}
+		}
+		if err != nil {
+			return forfeit(toMove, fmt.Sprintf("%s played %q: %v", side.label, text, err)), nil
+		}
+
+		color := toMove
+		if opening {
+			color = gotak.PlayerWhite + gotak.PlayerBlack - toMove
+		}
+		if err := g.Board.DoMove(mv, color); err != nil {
+			return forfeit(toMove, fmt.Sprintf("%s played %q: %v", side.label, text, err)), nil
+		}
+		record(g, mv, toMove)
+	}
+}
+
+// record appends mv to g's turns. Openings have white to move, so white's
+// moves start turns.
+func record(g *gotak.Game, mv *gotak.Move, player int) {
+	if player == gotak.PlayerBlack && len(g.Turns) > 0 {
+		g.Turns[len(g.Turns)-1].Second = mv
+		return
+	}
+	number := int64(1)
+	if len(g.Turns) > 0 {
+		number = g.Turns[len(g.Turns)-1].Number + 1
+	} else if tps, err := g.GetMeta("TPS"); err == nil && tps != "" {
+		if _, _, move, err := gotak.ParseTPS(tps); err == nil {
+			number = move
+		}
+	}
+	g.Turns = append(g.Turns, &gotak.Turn{Number: number, First: mv})
+}
+
+func finished(g *gotak.Game, winner int) outcome {
+	kind := "F"
+	if winner != 0 && g.Board.HasRoad(winner) {
+		kind = "R"
+	}
+	switch winner {
+	case gotak.PlayerWhite:
+		return outcome{winner: winner, result: kind + "-0"}
+	case gotak.PlayerBlack:
+		return outcome{winner: winner, result: "0-" + kind}
+	}
+	return outcome{result: "1/2-1/2"}
+}
+
+func forfeit(loser int, reason string) outcome {
+	if loser == gotak.PlayerWhite {
+		return outcome{winner: gotak.PlayerBlack, result: "0-1", reason: reason}
+	}
+	return outcome{winner: gotak.PlayerWhite, result: "1-0", reason: reason}
+}
+
+// gamePTN tags g with the players, seed and result and renders it as PTN.
+func gamePTN(g *gotak.Game, round int, white, black *player, seed int64, out outcome) (string, error) {
+	tags := [][2]string{
+		{"Site", "takmatch"},
+		{"Round", fmt.Sprint(round)},
+		{"Player1", white.label},
+		{"Player2", black.label},
+		{"Seed", fmt.Sprint(seed)},
+		{"Result", out.result},
+	}
+	if out.reason != "" {
+		tags = append(tags, [2]string{"Termination", out.reason})
+	}
+	for _, t := range tags {
+		if err := g.UpdateMeta(t[0], t[1]); err != nil {
+			return "", err
+		}
+	}
+	if len(g.Turns) > 0 {
+		g.Turns[len(g.Turns)-1].Result = out.result
+	}
+	return g.PTN(), nil
+}
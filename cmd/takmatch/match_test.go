@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icco/gotak"
+	"github.com/icco/gotak/ai"
+)
+
+func TestParsePlayer(t *testing.T) {
+	reg := ai.NewDefaultRegistry()
+	p, err := parsePlayer(reg, "gotak,level=expert,style=aggressive,time=250ms")
+	if err != nil {
+		t.Fatalf("parsePlayer: %v", err)
+	}
+	want := ai.AIConfig{Level: ai.Expert, Style: ai.Aggressive, TimeLimit: 250 * time.Millisecond}
+	if p.cfg != want {
+		t.Errorf("cfg = %+v, want %+v", p.cfg, want)
+	}
+
+	if p, err := parsePlayer(reg, "gotak,nodes=5000"); err != nil || p.cfg.Nodes != 5000 {
+		t.Errorf("nodes setting = %+v, %v", p, err)
+	}
+
+	for _, spec := range []string{
+		"nosuchengine",
+		"gotak,level",
+		"gotak,level=godlike",
+		"gotak,style=sneaky",
+		"gotak,time=soon",
+		"gotak,nodes=0",
+		"gotak,depth=3",
+	} {
+		if _, err := parsePlayer(reg, spec); err == nil {
+			t.Errorf("parsePlayer(%q) should fail", spec)
+		}
+	}
+}
+
+func TestOpenings(t *testing.T) {
+	for _, size := range []int64{4, 5, 8} {
+		for _, tps := range defaultOpenings(size) {
+			g, err := openingGame(tps)
+			if err != nil {
+				t.Errorf("size %d: %v", size, err)
+				continue
+			}
+			if g.Board.Size != size {
+				t.Errorf("%q: size %d", tps, g.Board.Size)
+			}
+		}
+	}
+	if _, err := openingGame("x5/x5/x5/x5/1,x4 2 1"); err == nil {
+		t.Error("an opening with black to move should be rejected")
+	}
+}
+
+func TestPlayGame(t *testing.T) {
+	reg := ai.NewDefaultRegistry()
+	white, err := parsePlayer(reg, "random")
+	if err != nil {
+		t.Fatalf("parsePlayer: %v", err)
+	}
+	black, err := parsePlayer(reg, "random,time=10ms")
+	if err != nil {
+		t.Fatalf("parsePlayer: %v", err)
+	}
+
+	openings := defaultOpenings(4)
+	g, err := openingGame(openings[1])
+	if err != nil {
+		t.Fatalf("openingGame: %v", err)
+	}
+	out, err := playGame(context.Background(), g, white, black, 6, 9)
+	if err != nil {
+		t.Fatalf("playGame: %v", err)
+	}
+	if _, over := g.GameOver(); !over && (out.winner != 0 || out.reason == "") {
+		t.Errorf("unfinished game ended %+v", out)
+	}
+	if g.Turns[0].Number != 2 {
+		t.Errorf("first turn numbered %d, want 2 after the opening", g.Turns[0].Number)
+	}
+
+	text, err := gamePTN(g, 1, white, black, 9, out)
+	if err != nil {
+		t.Fatalf("gamePTN: %v", err)
+	}
+	parsed, err := gotak.ParsePTN([]byte(text))
+	if err != nil {
+		t.Fatalf("ParsePTN: %v\n%s", err, text)
+	}
+	if got, _ := parsed.GetMeta("Player2"); got != black.label {
+		t.Errorf("Player2 = %q", got)
+	}
+	if got, _ := parsed.GetMeta("Seed"); got != "9" {
+		t.Errorf("Seed = %q", got)
+	}
+
+	// The same seed replays the same game.
+	replay, err := openingGame(openings[1])
+	if err != nil {
+		t.Fatalf("openingGame: %v", err)
+	}
+	replayOut, err := playGame(context.Background(), replay, white, black, 6, 9)
+	if err != nil {
+		t.Fatalf("playGame: %v", err)
+	}
+	if again, _ := gamePTN(replay, 1, white, black, 9, replayOut); again != text {
+		t.Errorf("seed 9 played\n%s\nthen\n%s", text, again)
+	}
+
+	var ptn, progress strings.Builder
+	s, err := runMatch(context.Background(), white, black, openings, 3, 300, 1, &ptn, &progress)
+	if err != nil {
+		t.Fatalf("runMatch: %v", err)
+	}
+	if s.games() != 4 || strings.Count(ptn.String(), "[Round ") != 4 {
+		t.Errorf("played %d games:\n%s", s.games(), progress.String())
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// score tallies a match from the first player's point of view.
+type score struct {
+	wins, draws, losses int
+}
+
+func (s score) games() int { return s.wins + s.draws + s.losses }
+
+// mean is the first player's average points per game.
+func (s score) mean() float64 {
+	return (float64(s.wins) + float64(s.draws)/2) / float64(s.games())
+}
+
+// variance is the per-game variance of the points scored.
+func (s score) variance() float64 {
+	m := s.mean()
+	n := float64(s.games())
+	return (float64(s.wins)*(1-m)*(1-m) + float64(s.draws)*(0.5-m)*(0.5-m) + float64(s.losses)*m*m) / n
+}
+
+// eloFromScore is the Elo difference at which the expected score is m.
+func eloFromScore(m float64) float64 {
+	return -400 * math.Log10(1/m-1)
+}
+
+// scoreFromElo is the expected score at an Elo difference of elo.
+func scoreFromElo(elo float64) float64 {
+	return 1 / (1 + math.Pow(10, -elo/400))
+}
+
+// elo is the Elo difference the match suggests and the half-width of its
+// 95% confidence interval. A clean sweep gives an infinite difference.
+func (s score) elo() (diff, margin float64) {
+	if s.games() == 0 {
+		return 0, math.Inf(1)
+	}
+	m := s.mean()
+	diff = eloFromScore(m)
+	se := math.Sqrt(s.variance() / float64(s.games()))
+	lo, hi := math.Max(m-1.96*se, 0), math.Min(m+1.96*se, 1)
+	return diff, (eloFromScore(hi) - eloFromScore(lo)) / 2
+}
+
+// los is the likelihood of superiority: the chance the first player is
+// the stronger, judged from decisive games.
+func (s score) los() float64 {
+	decisive := float64(s.wins + s.losses)
+	if decisive == 0 {
+		return 0.5
+	}
+	return 0.5 * (1 + math.Erf(float64(s.wins-s.losses)/math.Sqrt(2*decisive)))
+}
+
+// sprt is a sequential probability ratio test of H0: the Elo difference
+// is elo0, against H1: it is elo1, with error rates alpha and beta.
+type sprt struct {
+	elo0, elo1  float64
+	alpha, beta float64
+}
+
+// bounds are the log-likelihood ratios at which the test accepts H0 and
+// H1.
+func (t sprt) bounds() (lower, upper float64) {
+	return math.Log(t.beta / (1 - t.alpha)), math.Log((1 - t.beta) / t.alpha)
+}
+
+// llr is the log-likelihood ratio of H1 to H0 for s, using the normal
+// approximation to the trinomial game outcomes.
+func (t sprt) llr(s score) float64 {
+	v := s.variance()
+	if s.games() == 0 || v == 0 {
+		return 0
+	}
+	s0, s1 := scoreFromElo(t.elo0), scoreFromElo(t.elo1)
+	return float64(s.games()) * (s1 - s0) * (2*s.mean() - s0 - s1) / (2 * v)
+}
+
+// verdict says which hypothesis s supports, if the test has finished.
+func (t sprt) verdict(s score) string {
+	llr := t.llr(s)
+	lower, upper := t.bounds()
+	switch {
+	case llr >= upper:
+		return fmt.Sprintf("H1 accepted: the difference is nearer %+g Elo than %+g", t.elo1, t.elo0)
+	case llr <= lower:
+		return fmt.Sprintf("H0 accepted: the difference is nearer %+g Elo than %+g", t.elo0, t.elo1)
+	}
+	return "inconclusive: play more games"
+}
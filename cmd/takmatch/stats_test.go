@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestScoreElo(t *testing.T) {
+	even := score{wins: 10, draws: 5, losses: 10}
+	if diff, margin := even.elo(); diff != 0 || margin <= 0 {
+		t.Errorf("even elo = %v ± %v", diff, margin)
+	}
+	if los := even.los(); los != 0.5 {
+		t.Errorf("even los = %v", los)
+	}
+
+	// 75% is about +191 Elo.
+	ahead := score{wins: 30, draws: 0, losses: 10}
+	diff, margin := ahead.elo()
+	if math.Abs(diff-190.8) > 0.1 || margin <= 0 || margin > diff {
+		t.Errorf("ahead elo = %v ± %v", diff, margin)
+	}
+	if los := ahead.los(); los < 0.99 {
+		t.Errorf("ahead los = %v", los)
+	}
+	if got := scoreFromElo(eloFromScore(0.75)); math.Abs(got-0.75) > 1e-9 {
+		t.Errorf("round trip = %v", got)
+	}
+}
+
+func TestSPRT(t *testing.T) {
+	test := sprt{elo0: 0, elo1: 10, alpha: 0.05, beta: 0.05}
+	lower, upper := test.bounds()
+	if math.Abs(lower+2.944) > 0.001 || math.Abs(upper-2.944) > 0.001 {
+		t.Errorf("bounds = %v, %v", lower, upper)
+	}
+
+	for _, tc := range []struct {
+		s    score
+		want string
+	}{
+		{score{wins: 10, draws: 10, losses: 10}, "inconclusive"},
+		{score{wins: 1500, draws: 1000, losses: 1200}, "H1 accepted"},
+		{score{wins: 1200, draws: 1000, losses: 1500}, "H0 accepted"},
+	} {
+		if got := test.verdict(tc.s); !strings.HasPrefix(got, tc.want) {
+			t.Errorf("verdict(%+v) = %q (llr %v), want %s", tc.s, got, test.llr(tc.s), tc.want)
+		}
+	}
+}
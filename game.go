@@ -131,51 +131,11 @@ func (g *Game) PTN() string {
 
 // GameOver determines if a game is over and who won. A game is over if a
 // player has a continuous path from one side of the board to the other.
-//
-//nolint:gocyclo // Game over logic is inherently complex
 func (g *Game) GameOver() (int, bool) {
-	letters := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}
-
 	// Check for road wins for both players
 	for player := PlayerWhite; player <= PlayerBlack; player++ {
-		// Check horizontal roads (left to right)
-		leftEdge := []string{}
-		rightEdge := []string{}
-		for y := int64(1); y <= g.Board.Size; y++ {
-			leftEdge = append(leftEdge, letters[0]+strconv.FormatInt(y, 10))
-			rightEdge = append(rightEdge, letters[g.Board.Size-1]+strconv.FormatInt(y, 10))
-		}
-
-		// Check if any left edge square can reach any right edge square
-		for _, startSquare := range leftEdge {
-			if g.Board.Color(startSquare) == player {
-				topStone := g.Board.TopStone(startSquare)
-				if topStone != nil && (topStone.Type == StoneFlat || topStone.Type == StoneCap) {
-					if g.Board.FindRoad(startSquare, rightEdge) {
-						return player, true
-					}
-				}
-			}
-		}
-
-		// Check vertical roads (bottom to top)
-		bottomEdge := []string{}
-		topEdge := []string{}
-		for x := range g.Board.Size {
-			bottomEdge = append(bottomEdge, letters[x]+"1")
-			topEdge = append(topEdge, letters[x]+strconv.FormatInt(g.Board.Size, 10))
-		}
-
-		// Check if any bottom edge square can reach any top edge square
-		for _, startSquare := range bottomEdge {
-			if g.Board.Color(startSquare) == player {
-				topStone := g.Board.TopStone(startSquare)
-				if topStone != nil && (topStone.Type == StoneFlat || topStone.Type == StoneCap) {
-					if g.Board.FindRoad(startSquare, topEdge) {
-						return player, true
-					}
-				}
-			}
+		if g.Board.HasRoad(player) {
+			return player, true
 		}
 	}
 
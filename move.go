@@ -3,6 +3,7 @@ package gotak
 import (
 	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -158,3 +159,15 @@ func (m *Move) parseMove() error {
 
 	return nil
 }
+
+// Equal reports whether two parsed moves do the same thing, however they
+// were spelled ("a1" and "Fa1", "a1>" and "1a1>1").
+func (m *Move) Equal(o *Move) bool {
+	if m.Square != o.Square || m.MoveDirection != o.MoveDirection {
+		return false
+	}
+	if m.MoveDirection == "" {
+		return m.Stone == o.Stone
+	}
+	return m.MoveCount == o.MoveCount && slices.Equal(m.MoveDropCounts, o.MoveDropCounts)
+}
@@ -160,3 +160,31 @@ func TestParseDropStones(t *testing.T) {
 		})
 	}
 }
+
+func TestMoveEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"a1", "Fa1", true},
+		{"a1", "Sa1", false},
+		{"a1>", "1a1>1", true},
+		{"3c3+12", "3c3+12", true},
+		{"3c3+12", "3c3+21", false},
+		{"a1>", "a1+", false},
+		{"a1", "b1", false},
+	}
+	for _, tc := range tests {
+		a, err := NewMove(tc.a)
+		if err != nil {
+			t.Fatalf("NewMove(%q): %v", tc.a, err)
+		}
+		b, err := NewMove(tc.b)
+		if err != nil {
+			t.Fatalf("NewMove(%q): %v", tc.b, err)
+		}
+		if got := a.Equal(b); got != tc.want {
+			t.Errorf("%s.Equal(%s) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package gotak
+
+import "strconv"
+
+var moveDirections = []string{MoveUp, MoveDown, MoveLeft, MoveRight}
+
+// Clone returns a deep copy of the board. DoMove flattens standing stones in
+// place, so a shallow copy would share them.
+func (b *Board) Clone() *Board {
+	nb := &Board{Size: b.Size, Squares: make(map[string][]*Stone, len(b.Squares))}
+	for sq, stack := range b.Squares {
+		cp := make([]*Stone, len(stack))
+		for i, s := range stack {
+			st := *s
+			cp[i] = &st
+		}
+		nb.Squares[sq] = cp
+	}
+	return nb
+}
+
+// Reserves returns how many stones and capstones player still has in hand,
+// assuming g.Board reflects the game so far. Pieces never leave the board,
+// so this is the starting count minus what's on it.
+func (g *Game) Reserves(player int) (stones, caps int64) {
+	stones, caps = g.GetMaxStonesForBoardSize(), g.GetCapstoneCount()
+	_ = g.Board.IterateOverSquares(func(_ string, stack []*Stone) error {
+		for _, s := range stack {
+			if s.Player != player {
+				continue
+			}
+			if s.Type == StoneCap {
+				caps--
+			} else {
+				stones--
+			}
+		}
+		return nil
+	})
+	return max(stones, 0), max(caps, 0)
+}
+
+// ToMove returns the player whose turn it is and whether it is the opening
+// turn, on which players place their opponent's flat. Games with a TPS tag
+// count their moves from the position it describes.
+func (g *Game) ToMove() (player int, opening bool) {
+	ply := int64(0)
+	if tps, err := g.GetMeta("TPS"); err == nil && tps != "" {
+		if _, p, move, err := ParseTPS(tps); err == nil {
+			ply = (move - 1) * 2
+			if p == PlayerBlack {
+				ply++
+			}
+		}
+	}
+	for _, t := range g.Turns {
+		if t == nil {
+			continue
+		}
+		if t.First != nil {
+			ply++
+		}
+		if t.Second != nil {
+			ply++
+		}
+	}
+	if ply%2 == 1 {
+		return PlayerBlack, ply < 2
+	}
+	return PlayerWhite, ply < 2
+}
+
+// LegalMoves returns every move available to the player whose turn it is,
+// assuming g.Board reflects g.Turns. It does not check whether the game is
+// already over.
+func (g *Game) LegalMoves() (int, []*Move) {
+	player, opening := g.ToMove()
+	stones, caps := g.Reserves(player)
+	return player, g.Board.LegalMoves(player, stones, caps, opening)
+}
+
+// LegalMoves returns every move player can make given the stones and
+// capstones they have in hand. On the opening turn only flat placements on
+// empty squares are legal. Moves follow DoMove's rules, so each one is
+// accepted by DoMove; their Text is canonical PTN.
+func (b *Board) LegalMoves(player int, stones, caps int64, opening bool) []*Move {
+	var moves []*Move
+	_ = b.IterateOverSquares(func(sq string, stack []*Stone) error {
+		if len(stack) == 0 {
+			if opening {
+				moves = append(moves, placeMove(StoneFlat, sq))
+				return nil
+			}
+			if stones > 0 {
+				moves = append(moves, placeMove(StoneFlat, sq), placeMove(StoneStanding, sq))
+			}
+			if caps > 0 {
+				moves = append(moves, placeMove(StoneCap, sq))
+			}
+			return nil
+		}
+		if opening || stack[len(stack)-1].Player != player {
+			return nil
+		}
+		moves = append(moves, b.stackMoves(sq, stack, player)...)
+		return nil
+	})
+	return moves
+}
+
+// stackMoves lists the moves of the stack on sq in every direction.
+func (b *Board) stackMoves(sq string, stack []*Stone, player int) []*Move {
+	var moves []*Move
+	top := stack[len(stack)-1]
+	maxCarry := min(int64(len(stack)), b.Size)
+
+	for _, dir := range moveDirections {
+		// Walk until something blocks. A capstone moving alone onto an
+		// opponent's wall may flatten it as its final step.
+		steps := 0
+		flattenEnd := false
+		for cur := Translate(sq, dir); b.isValidSquare(cur); cur = Translate(cur, dir) {
+			t := b.TopStone(cur)
+			if t != nil && t.Type == StoneCap {
+				break
+			}
+			if t != nil && t.Type == StoneStanding {
+				if top.Type == StoneCap && t.Player != player {
+					steps++
+					flattenEnd = true
+				}
+				break
+			}
+			steps++
+		}
+		if steps == 0 {
+			continue
+		}
+
+		for carry := int64(1); carry <= maxCarry; carry++ {
+			forEachDropSequence(carry, steps, func(drops []int64) {
+				if flattenEnd && len(drops) == steps && drops[len(drops)-1] != 1 {
+					return
+				}
+				moves = append(moves, stackMove(sq, dir, drops))
+			})
+		}
+	}
+	return moves
+}
+
+// forEachDropSequence calls f with every way of dropping carry stones over
+// at most maxSteps squares, at least one per square. f must not keep drops.
+func forEachDropSequence(carry int64, maxSteps int, f func([]int64)) {
+	drops := make([]int64, 0, maxSteps)
+	var rec func(left int64)
+	rec = func(left int64) {
+		if left == 0 {
+			f(drops)
+			return
+		}
+		if len(drops) == maxSteps {
+			return
+		}
+		for d := int64(1); d <= left; d++ {
+			drops = append(drops, d)
+			rec(left - d)
+			drops = drops[:len(drops)-1]
+		}
+	}
+	rec(carry)
+}
+
+func placeMove(stone, sq string) *Move {
+	text := sq
+	if stone != StoneFlat {
+		text = stone + sq
+	}
+	return &Move{Stone: stone, Square: sq, Text: text}
+}
+
+func stackMove(sq, dir string, drops []int64) *Move {
+	var carry int64
+	for _, d := range drops {
+		carry += d
+	}
+	text := ""
+	if carry > 1 {
+		text = strconv.FormatInt(carry, 10)
+	}
+	text += sq + dir
+	if len(drops) > 1 {
+		for _, d := range drops {
+			text += strconv.FormatInt(d, 10)
+		}
+	}
+	return &Move{
+		Stone:          StoneFlat,
+		Square:         sq,
+		MoveCount:      carry,
+		MoveDirection:  dir,
+		MoveDropCounts: append([]int64(nil), drops...),
+		Text:           text,
+	}
+}
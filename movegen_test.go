@@ -0,0 +1,166 @@
+package gotak
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func moveTexts(moves []*Move) []string {
+	out := make([]string, len(moves))
+	for i, m := range moves {
+		out[i] = m.Text
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestLegalMoves_opening(t *testing.T) {
+	g, err := NewGame(5, 1, "movegen")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	player, moves := g.LegalMoves()
+	if player != PlayerWhite || len(moves) != 25 {
+		t.Fatalf("player %d with %d moves, want white with 25", player, len(moves))
+	}
+	for _, m := range moves {
+		if m.Stone != StoneFlat || m.MoveDirection != "" {
+			t.Errorf("opening move %q is not a flat placement", m.Text)
+		}
+	}
+
+	if err := g.DoSingleMove("a1", PlayerWhite); err != nil {
+		t.Fatalf("DoSingleMove: %v", err)
+	}
+	player, moves = g.LegalMoves()
+	if player != PlayerBlack || len(moves) != 24 {
+		t.Errorf("player %d with %d moves, want black with 24 flat placements", player, len(moves))
+	}
+}
+
+func TestLegalMoves_afterOpening(t *testing.T) {
+	g, err := NewGame(5, 1, "movegen")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	if err := g.DoTurn("a1", "e5"); err != nil {
+		t.Fatalf("DoTurn: %v", err)
+	}
+	player, moves := g.LegalMoves()
+	if player != PlayerWhite {
+		t.Fatalf("player = %d, want white", player)
+	}
+	// 23 empty squares x {flat, wall, cap} plus e5 moving down or left.
+	if len(moves) != 23*3+2 {
+		t.Errorf("got %d moves, want %d", len(moves), 23*3+2)
+	}
+	texts := moveTexts(moves)
+	for _, want := range []string{"e5-", "e5<", "Sc3", "Cc3", "c3"} {
+		if i := sort.SearchStrings(texts, want); i == len(texts) || texts[i] != want {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+func TestLegalMoves_stacks(t *testing.T) {
+	b := &Board{Size: 4}
+	if err := b.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	w, bl := PlayerWhite, PlayerBlack
+	b.Squares["a1"] = []*Stone{{Type: StoneFlat, Player: bl}, {Type: StoneFlat, Player: w}, {Type: StoneCap, Player: w}}
+	b.Squares["a3"] = []*Stone{{Type: StoneStanding, Player: bl}}
+	b.Squares["c1"] = []*Stone{{Type: StoneStanding, Player: w}}
+
+	got := moveTexts(b.LegalMoves(w, 0, 0, false))
+	want := []string{
+		// The capstone may step onto the black wall on a3 only by itself.
+		"a1+", "2a1+", "2a1+11", "3a1+", "3a1+21",
+		// The white wall on c1 stops a1 at b1 and can itself move.
+		"a1>", "2a1>", "3a1>",
+		"c1+", "c1<", "c1>",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("moves =\n%v\nwant\n%v", got, want)
+	}
+}
+
+// Random playouts: every generated move must parse back to itself and be
+// accepted by DoMove.
+func TestLegalMoves_playouts(t *testing.T) {
+	rng := rand.New(rand.NewSource(7)) // #nosec G404 -- deterministic test
+	for _, size := range []int64{4, 5, 6} {
+		for game := 0; game < 20; game++ {
+			g, err := NewGame(size, 1, "playout")
+			if err != nil {
+				t.Fatalf("NewGame: %v", err)
+			}
+			for ply := 0; ply < 120; ply++ {
+				if _, over := g.GameOver(); over {
+					break
+				}
+				player, moves := g.LegalMoves()
+				if len(moves) == 0 {
+					t.Fatalf("size %d ply %d: no legal moves", size, ply)
+				}
+				for _, m := range moves {
+					parsed, err := NewMove(m.Text)
+					if err != nil {
+						t.Fatalf("generated %q does not parse: %v", m.Text, err)
+					}
+					parsed.Text = m.Text
+					if !reflect.DeepEqual(parsed, m) {
+						t.Fatalf("generated %+v, parses as %+v", m, parsed)
+					}
+					color := player
+					if _, opening := g.ToMove(); opening {
+						color = PlayerWhite + PlayerBlack - player
+					}
+					if err := g.Board.Clone().DoMove(m, color); err != nil {
+						t.Fatalf("size %d ply %d: DoMove(%q): %v\nboard %s", size, ply, m.Text, err, g.Board.TPS(player, 1))
+					}
+				}
+				pick := moves[rng.Intn(len(moves))]
+				if err := g.DoSingleMove(pick.Text, player); err != nil {
+					t.Fatalf("DoSingleMove(%q): %v", pick.Text, err)
+				}
+			}
+		}
+	}
+}
+
+func TestBoardClone(t *testing.T) {
+	b := &Board{Size: 4}
+	if err := b.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	b.Squares["b2"] = []*Stone{{Type: StoneStanding, Player: PlayerBlack}}
+	c := b.Clone()
+	c.Squares["b2"][0].Type = StoneFlat
+	c.Squares["a1"] = append(c.Squares["a1"], &Stone{Type: StoneFlat, Player: PlayerWhite})
+	if b.Squares["b2"][0].Type != StoneStanding || len(b.Squares["a1"]) != 0 {
+		t.Error("mutating the clone changed the original")
+	}
+}
+
+func TestReserves(t *testing.T) {
+	g, err := NewGame(5, 1, "reserves")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	if err := g.DoTurn("a1", "e5"); err != nil {
+		t.Fatalf("DoTurn: %v", err)
+	}
+	if err := g.DoTurn("Cc3", "Sd4"); err != nil {
+		t.Fatalf("DoTurn: %v", err)
+	}
+	if s, c := g.Reserves(PlayerWhite); s != 20 || c != 0 {
+		t.Errorf("white reserves = %d/%d, want 20/0", s, c)
+	}
+	if s, c := g.Reserves(PlayerBlack); s != 19 || c != 1 {
+		t.Errorf("black reserves = %d/%d, want 19/1", s, c)
+	}
+}
@@ -0,0 +1,271 @@
+package gotak
+
+import "strconv"
+
+// HasRoad reports whether player has a road: a connected path of their
+// flats and capstones joining opposite edges of the board.
+func (b *Board) HasRoad(player int) bool {
+	letters := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}
+	size := b.Size
+	edges := func(horizontal bool) (starts, ends []string) {
+		for i := range size {
+			if horizontal {
+				// Left edge to right edge.
+				row := strconv.FormatInt(i+1, 10)
+				starts = append(starts, letters[0]+row)
+				ends = append(ends, letters[size-1]+row)
+			} else {
+				// Bottom edge to top edge.
+				starts = append(starts, letters[i]+"1")
+				ends = append(ends, letters[i]+strconv.FormatInt(size, 10))
+			}
+		}
+		return starts, ends
+	}
+
+	for _, horizontal := range []bool{true, false} {
+		starts, ends := edges(horizontal)
+		for _, sq := range starts {
+			if b.Color(sq) != player {
+				continue
+			}
+			top := b.TopStone(sq)
+			if top != nil && (top.Type == StoneFlat || top.Type == StoneCap) && b.FindRoad(sq, ends) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RoadThreats returns every move that would complete a road for player if
+// it were their turn, assuming g.Board reflects the game so far. Asking
+// for the player who isn't to move shows what they threaten next turn.
+func (g *Game) RoadThreats(player int) []*Move {
+	return g.tinueState().threats(player, nil)
+}
+
+// FindTinue looks for a forced road win for the player to move that needs
+// at most depth of their moves, assuming g.Board reflects the game so far.
+// Depth 1 finds a road in one; depth 2 a move after which the opponent is
+// in Tinuë, unable to stop every road. Each of the attacker's moves must
+// threaten a road, so the solver proves the wins it reports but can miss
+// slower ones.
+//
+// The line returned starts with the winning move and follows the
+// defender's longest resistance to the road. The search grows steeply
+// with depth; depths beyond 3 are rarely practical.
+func (g *Game) FindTinue(depth int) ([]*Move, bool) {
+	player, opening := g.ToMove()
+	if opening {
+		return nil, false
+	}
+	s := g.tinueState()
+	if s.over() {
+		return nil, false
+	}
+	return s.attack(player, depth, nil)
+}
+
+// InTinue reports whether the player to move is in Tinuë: whatever they
+// play, their opponent completes a road within depth more moves.
+func (g *Game) InTinue(depth int) bool {
+	_, lost := g.TinueDefence(depth)
+	return lost
+}
+
+// TinueDefence is InTinue with the defence that holds out longest: the
+// reply of the player to move, then the attacker's forced road.
+func (g *Game) TinueDefence(depth int) ([]*Move, bool) {
+	player, opening := g.ToMove()
+	if opening {
+		return nil, false
+	}
+	s := g.tinueState()
+	if s.over() {
+		return nil, false
+	}
+	return s.defend(player, depth, s.threats(otherPlayer(player), nil))
+}
+
+// tinueState is a position as the Tinuë solver sees it: the board and both
+// players' reserves. The player to move is tracked by the search.
+type tinueState struct {
+	board  *Board
+	stones [3]int64
+	caps   [3]int64
+}
+
+func (g *Game) tinueState() tinueState {
+	s := tinueState{board: g.Board}
+	for _, p := range []int{PlayerWhite, PlayerBlack} {
+		s.stones[p], s.caps[p] = g.Reserves(p)
+	}
+	return s
+}
+
+func otherPlayer(player int) int {
+	return PlayerWhite + PlayerBlack - player
+}
+
+// over reports whether the game has ended: a road for either player, a
+// full board or a player out of pieces.
+func (s tinueState) over() bool {
+	if s.board.HasRoad(PlayerWhite) || s.board.HasRoad(PlayerBlack) {
+		return true
+	}
+	for _, p := range []int{PlayerWhite, PlayerBlack} {
+		if s.stones[p]+s.caps[p] == 0 {
+			return true
+		}
+	}
+	full := true
+	_ = s.board.IterateOverSquares(func(_ string, stack []*Stone) error {
+		full = full && len(stack) > 0
+		return nil
+	})
+	return full
+}
+
+func (s tinueState) moves(player int) []*Move {
+	return s.board.LegalMoves(player, s.stones[player], s.caps[player], false)
+}
+
+// play returns the position after player makes m, which must be legal.
+func (s tinueState) play(m *Move, player int) (tinueState, bool) {
+	next := s
+	next.board = s.board.Clone()
+	if err := next.board.DoMove(m, player); err != nil {
+		return s, false
+	}
+	if m.MoveDirection == "" {
+		if m.Stone == StoneCap {
+			next.caps[player]--
+		} else {
+			next.stones[player]--
+		}
+	}
+	return next, true
+}
+
+// roadPossible is a cheap filter: a road needs one of player's stones on
+// each square of a row or column.
+func (s tinueState) roadPossible(player int) bool {
+	n := int64(0)
+	for _, stack := range s.board.Squares {
+		for _, st := range stack {
+			if st.Player == player {
+				n++
+			}
+		}
+	}
+	if s.stones[player]+s.caps[player] > 0 {
+		n++
+	}
+	return n >= s.board.Size
+}
+
+// threats lists player's road-completing moves. hint holds moves that
+// completed a road in a related position; when one still does, it is
+// returned alone without generating every move.
+func (s tinueState) threats(player int, hint []*Move) []*Move {
+	if !s.roadPossible(player) {
+		return nil
+	}
+	for _, m := range hint {
+		if s.legalHint(m, player) && s.wins(m, player) {
+			return []*Move{m}
+		}
+	}
+	var out []*Move
+	for _, m := range s.moves(player) {
+		if s.wins(m, player) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// legalHint checks the parts of legality DoMove doesn't: placements need
+// an empty square and a piece in hand.
+func (s tinueState) legalHint(m *Move, player int) bool {
+	if m.MoveDirection != "" {
+		return true
+	}
+	if len(s.board.Squares[m.Square]) > 0 {
+		return false
+	}
+	if m.Stone == StoneCap {
+		return s.caps[player] > 0
+	}
+	return s.stones[player] > 0
+}
+
+func (s tinueState) wins(m *Move, player int) bool {
+	next, ok := s.play(m, player)
+	return ok && next.board.HasRoad(player)
+}
+
+// attack finds a forced road for attacker, to move in s, within depth of
+// their moves.
+func (s tinueState) attack(attacker, depth int, hint []*Move) ([]*Move, bool) {
+	if depth < 1 {
+		return nil, false
+	}
+	if roads := s.threats(attacker, hint); len(roads) > 0 {
+		return roads[:1], true
+	}
+	if depth == 1 {
+		return nil, false
+	}
+
+	defender := otherPlayer(attacker)
+	for _, m := range s.moves(attacker) {
+		next, ok := s.play(m, attacker)
+		if !ok || next.over() {
+			continue
+		}
+		threats := next.threats(attacker, nil)
+		if len(threats) == 0 {
+			continue
+		}
+		if line, lost := next.defend(defender, depth-1, threats); lost {
+			return append([]*Move{m}, line...), true
+		}
+	}
+	return nil, false
+}
+
+// defend reports whether every reply of defender, to move in s, still lets
+// the attacker force a road within depth, and the reply that holds out
+// longest with its continuation.
+func (s tinueState) defend(defender, depth int, threats []*Move) ([]*Move, bool) {
+	attacker := otherPlayer(defender)
+	var longest []*Move
+	for _, r := range s.moves(defender) {
+		next, ok := s.play(r, defender)
+		if !ok {
+			continue
+		}
+		// A road for the mover wins even if it completes one for the
+		// opponent too.
+		if next.board.HasRoad(defender) {
+			return nil, false
+		}
+		line := []*Move{r}
+		if !next.board.HasRoad(attacker) {
+			if next.over() {
+				return nil, false
+			}
+			rest, won := next.attack(attacker, depth, threats)
+			if !won {
+				return nil, false
+			}
+			line = append(line, rest...)
+		}
+		if len(line) > len(longest) {
+			longest = line
+		}
+	}
+	return longest, longest != nil
+}
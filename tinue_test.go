@@ -0,0 +1,118 @@
+package gotak
+
+import (
+	"slices"
+	"testing"
+)
+
+// tpsGame returns a game that starts from tps.
+func tpsGame(t *testing.T, tps string) *Game {
+	t.Helper()
+	b, _, _, err := ParseTPS(tps)
+	if err != nil {
+		t.Fatalf("ParseTPS(%q): %v", tps, err)
+	}
+	g, err := NewGame(b.Size, 1, "tinue")
+	if err != nil {
+		t.Fatalf("NewGame: %v", err)
+	}
+	g.Board = b
+	if err := g.UpdateMeta("TPS", tps); err != nil {
+		t.Fatalf("UpdateMeta: %v", err)
+	}
+	return g
+}
+
+func TestRoadThreats(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 2 5")
+	got := moveTexts(g.RoadThreats(PlayerWhite))
+	if !slices.Contains(got, "e1") || !slices.Contains(got, "Ce1") || slices.Contains(got, "Se1") {
+		t.Errorf("white threats = %v, want e1 and Ce1 but not a wall", got)
+	}
+	if got := g.RoadThreats(PlayerBlack); len(got) != 0 {
+		t.Errorf("black threats = %v, want none", moveTexts(got))
+	}
+
+	// A stack move can complete a road too.
+	g = tpsGame(t, "x5/x5/x5/x4,1/1,1,1,1,2 1 8")
+	if got := moveTexts(g.RoadThreats(PlayerWhite)); !slices.Contains(got, "e2-") {
+		t.Errorf("white threats = %v, want e2-", got)
+	}
+
+	if got := tpsGame(t, "x5/x5/x5/x5/x5 1 1").RoadThreats(PlayerWhite); len(got) != 0 {
+		t.Errorf("empty board threats = %v", moveTexts(got))
+	}
+}
+
+func TestFindTinue(t *testing.T) {
+	// Road in one.
+	line, ok := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,x 1 5").FindTinue(1)
+	if !ok || len(line) != 1 || line[0].Square != "e1" {
+		t.Errorf("road in one = %v, %v", moveTexts(line), ok)
+	}
+
+	// White makes two threats black can't both stop.
+	g := tpsGame(t, "2,2,x2,2/x5/x5/x3,1,x/1,1,1,x2 1 4")
+	if _, ok := g.FindTinue(1); ok {
+		t.Error("there is no road in one")
+	}
+	line, ok = g.FindTinue(2)
+	if !ok || len(line) != 3 {
+		t.Fatalf("tinue = %v, %v; want attack, defence, road", moveTexts(line), ok)
+	}
+	// Playing the line out ends in a white road.
+	for i, m := range line {
+		player := PlayerWhite
+		if i%2 == 1 {
+			player = PlayerBlack
+		}
+		if err := g.Board.DoMove(m, player); err != nil {
+			t.Fatalf("line %v: %s: %v", moveTexts(line), m.Text, err)
+		}
+	}
+	if !g.Board.HasRoad(PlayerWhite) {
+		t.Errorf("line %v doesn't finish a road", moveTexts(line))
+	}
+
+	// One threat can be blocked.
+	if _, ok := tpsGame(t, "2,2,x2,2/x5/x5/x5/1,1,1,x2 1 4").FindTinue(2); ok {
+		t.Error("a single blockable threat isn't tinue")
+	}
+	// Finished games and the opening have nothing to find.
+	if _, ok := tpsGame(t, "x5/x5/x5/2,2,2,x2/1,1,1,1,1 2 5").FindTinue(2); ok {
+		t.Error("a finished game has no tinue")
+	}
+	if _, ok := tpsGame(t, "x5/x5/x5/x5/x5 1 1").FindTinue(2); ok {
+		t.Error("the opening has no tinue")
+	}
+}
+
+func TestInTinue(t *testing.T) {
+	if !tpsGame(t, "2,2,x2,2/x5/x5/x3,1,1/1,1,1,x2 2 4").InTinue(1) {
+		t.Error("black can't stop both d1 and c2")
+	}
+	if tpsGame(t, "2,2,x2,2/x5/x5/x5/1,1,1,1,x 2 4").InTinue(1) {
+		t.Error("black can block e1")
+	}
+}
+
+func TestToMove_tps(t *testing.T) {
+	g := tpsGame(t, "x5/x5/x5/x5/2,x4 2 1")
+	if player, opening := g.ToMove(); player != PlayerBlack || !opening {
+		t.Errorf("ToMove = %d, %v; want black on the opening", player, opening)
+	}
+	g.Turns = append(g.Turns, &Turn{Number: 1, Second: &Move{Text: "e5"}})
+	if player, opening := g.ToMove(); player != PlayerWhite || opening {
+		t.Errorf("ToMove = %d, %v; want white after the opening", player, opening)
+	}
+}
+
+func TestTinueDefence(t *testing.T) {
+	line, ok := tpsGame(t, "2,2,x2,2/x5/x5/x3,1,1/1,1,1,x2 2 4").TinueDefence(1)
+	if !ok || len(line) != 2 {
+		t.Fatalf("defence = %v, %v; want a reply and the road", moveTexts(line), ok)
+	}
+	if _, ok := tpsGame(t, "2,2,x2,2/x5/x5/x5/1,1,1,1,x 2 4").TinueDefence(1); ok {
+		t.Error("black can block e1")
+	}
+}
@@ -129,3 +129,54 @@ func parseTPSStack(cell string) ([]*Stone, error) {
 
 	return stack, nil
 }
+
+// TPS serializes the board in Tak Position System notation, with player to
+// move next and the (1-indexed) move number. It is the inverse of ParseTPS.
+func (b *Board) TPS(player int, move int64) string {
+	rows := make([]string, 0, b.Size)
+	for rank := b.Size; rank >= 1; rank-- {
+		cells := []string{}
+		empty := 0
+		flush := func() {
+			switch empty {
+			case 0:
+			case 1:
+				cells = append(cells, "x")
+			default:
+				cells = append(cells, "x"+strconv.Itoa(empty))
+			}
+			empty = 0
+		}
+		for col := range b.Size {
+			stack := b.Squares[fmt.Sprintf("%c%d", 'a'+col, rank)]
+			if len(stack) == 0 {
+				empty++
+				continue
+			}
+			flush()
+			cells = append(cells, formatTPSStack(stack))
+		}
+		flush()
+		rows = append(rows, strings.Join(cells, ","))
+	}
+
+	return fmt.Sprintf("%s %d %d", strings.Join(rows, "/"), player, move)
+}
+
+func formatTPSStack(stack []*Stone) string {
+	var sb strings.Builder
+	for _, s := range stack {
+		if s.Player == PlayerBlack {
+			sb.WriteByte('2')
+		} else {
+			sb.WriteByte('1')
+		}
+	}
+	switch stack[len(stack)-1].Type {
+	case StoneStanding:
+		sb.WriteByte('S')
+	case StoneCap:
+		sb.WriteByte('C')
+	}
+	return sb.String()
+}
@@ -70,3 +70,37 @@ func TestParseTPS_invalid(t *testing.T) {
 		}
 	}
 }
+
+func TestBoardTPS_roundTrip(t *testing.T) {
+	cases := []string{
+		"x5/x5/x5/x5/x5 1 1",
+		"x4/x4/x4/1,12S,1C,x 2 3",
+		"2,x4,1/x6/x2,21C,x3/x6/x6/1,x4,2 1 7",
+	}
+	for _, tps := range cases {
+		b, player, move, err := ParseTPS(tps)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tps, err)
+		}
+		if got := b.TPS(player, move); got != tps {
+			t.Errorf("TPS() = %q, want %q", got, tps)
+		}
+	}
+}
+
+func TestBoardTPS_afterMoves(t *testing.T) {
+	g, err := NewGame(5, 1, "tps")
+	if err != nil {
+		t.Fatalf("new game: %v", err)
+	}
+	if err := g.DoSingleMove("a1", PlayerWhite); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if err := g.DoSingleMove("e5", PlayerBlack); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	// Turn one places the opponent's stone.
+	if got, want := g.Board.TPS(PlayerWhite, 2), "x4,1/x5/x5/x5/2,x4 1 2"; got != want {
+		t.Errorf("TPS() = %q, want %q", got, want)
+	}
+}